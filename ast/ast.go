@@ -0,0 +1,329 @@
+// Package ast declares the types used to represent the syntax trees of
+// the DRepl descriptions.
+//
+// The trees are produced by parser.ParseAST and contain only what is in
+// the source. The names are not resolved, and the expressions are not
+// evaluated, so the tools that analyze or generate descriptions can use
+// them without the semantic processing done by the parser package.
+package ast
+
+import (
+	"fmt"
+)
+
+// Pos is a position in a source file
+type Pos struct {
+	Filename	string
+	Offset		int		// byte offset, starting at 0
+	Line		int		// starting at 1
+	Column		int		// in characters, starting at 1
+}
+
+// true if the position is set
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Pos) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+
+	if s == "" {
+		s = "-"
+	}
+
+	return s
+}
+
+// All nodes implement the Node interface
+type Node interface {
+	Pos() Pos		// position of the first character of the node
+}
+
+// Expressions and the names used in them
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Type expressions: names, arrays and structs
+type Type interface {
+	Node
+	typeNode()
+}
+
+// Declarations
+type Decl interface {
+	Node
+	declNode()
+}
+
+// A single // or /* */ comment
+type Comment struct {
+	Slash	Pos
+	Text	string		// including the // or /* */
+}
+
+// Comments with no tokens or blank lines between them
+type CommentGroup struct {
+	List	[]*Comment
+}
+
+// Kinds of the literals
+type LitKind int
+
+const (
+	INT LitKind = iota
+	FLOAT
+	STRING
+)
+
+// Expressions
+
+type Ident struct {
+	NamePos	Pos
+	Name	string
+}
+
+type BasicLit struct {
+	ValuePos	Pos
+	Kind		LitKind
+	Value		string		// as in the source, strings are quoted
+}
+
+// expression in parentheses
+type ParenExpr struct {
+	Lparen	Pos
+	X	Expr
+}
+
+// -x, +x, !x
+type UnaryExpr struct {
+	OpPos	Pos
+	Op	string
+	X	Expr
+}
+
+type BinaryExpr struct {
+	X	Expr
+	OpPos	Pos
+	Op	string
+	Y	Expr
+}
+
+// x[i, j, ...], an element of a dataset variable, or one rank of a
+// partitioned view in a replica
+type IndexExpr struct {
+	X	Expr
+	Lbrack	Pos
+	Index	[]Expr
+}
+
+// x.Sel, a field of a struct value
+type SelectorExpr struct {
+	X	Expr
+	Sel	*Ident
+}
+
+// Fun(Args), a math function in the expression of a computed field
+type CallExpr struct {
+	Fun	*Ident
+	Lparen	Pos
+	Args	[]Expr
+	Rparen	Pos
+}
+
+// lo:hi:step, a range of a dataset dimension in a view. Any of the
+// expressions can be nil.
+type SliceExpr struct {
+	Lo	Expr
+	Colon	Pos		// position of the first ":"
+	Hi	Expr
+	Step	Expr
+}
+
+// block, block ghost(G), cyclic or cyclic(B), the part of a dataset
+// dimension of the rank of a partitioned view
+type DistExpr struct {
+	NamePos	Pos
+	Name	string		// block or cyclic
+	Arg	Expr		// ghost width of block, or block size of cyclic, nil if not specified
+}
+
+// Types
+
+// [d1, d2, ...]Elem. In the dataset the dimensions are the array
+// lengths, nil if unlimited. In the views they are the expressions of
+// the view's or the dataset's indices.
+type ArrayType struct {
+	Lbrack	Pos
+	Dims	[]Expr
+	Elem	Type		// nil if not specified in a view
+}
+
+// struct { ... } in the dataset, { ... } Base in the views
+type StructType struct {
+	Struct	Pos		// position of struct, or { in the views
+	Packed	bool
+	Align	Expr		// align(N), nil if not specified
+	Fields	[]*Field
+	Base	*Ident		// dataset type a view struct is based on, nil if none
+}
+
+// Fields of a struct sharing the same type and layout annotations
+type Field struct {
+	Names	[]*Ident
+	Type	Type		// nil if not specified in a view
+	Packed	bool
+	Align	Expr		// nil if not specified
+	Value	Expr		// value of a computed field of a view, nil if not computed
+}
+
+// Declarations
+
+// dataset { ... } or dataset "file"
+type DatasetDecl struct {
+	Dataset	Pos
+	File	*BasicLit	// the included file, nil if inline
+	Decls	[]Decl		// the declarations, in the included file if any
+}
+
+// type Name Type, in the dataset or a view
+type TypeDecl struct {
+	TypePos	Pos
+	Name	*Ident
+	Type	Type
+}
+
+// var a, b Type in the dataset
+type VarDecl struct {
+	Var	Pos
+	Names	[]*Ident
+	Type	Type
+}
+
+// const Name = Value
+type ConstDecl struct {
+	Const	Pos
+	Name	*Ident
+	Value	Expr
+}
+
+// Flag of a view, the order of a view variable, or a flag of a replica.
+// Name is the keyword or identifier as in the source, Args are the
+// parameters in parentheses, if any.
+type Flag struct {
+	NamePos	Pos
+	Name	string
+	Args	[]Expr
+}
+
+// view Name flags { ... } or view Name flags "file". A partitioned view
+// Name(Rank of Ranks) is declared once for all the ranks.
+type ViewDecl struct {
+	View	Pos
+	Name	*Ident
+	Rank	*Ident		// nil if the view isn't partitioned
+	Ranks	Expr		// number of ranks, nil if the view isn't partitioned
+	Flags	[]*Flag
+	File	*BasicLit	// the included file, nil if inline
+	Decls	[]Decl
+}
+
+// var Name order Type = Value RType in a view, or
+// var Name order Type = Reduce(Value RType)
+type ViewVarDecl struct {
+	Var	Pos
+	Name	*Ident
+	Order	*Flag		// element order of the arrays, nil if the view's one
+	Type	Type		// nil if not specified
+	Reduce	*Ident		// aggregation function, nil if the elements aren't reduced
+	Value	*Ident		// the dataset variable
+	RType	Type		// how the dataset variable is indexed, nil if not specified
+	Where	Pos		// position of "where", if Cond is not nil
+	Cond	Expr		// predicate selecting the elements, nil if not specified
+}
+
+// replica flags Name "file" { view v1; ... }
+type ReplicaDecl struct {
+	Replica	Pos
+	Flags	[]*Flag
+	Name	*Ident
+	File	*BasicLit	// nil if not specified
+	Views	[]Expr	// *Ident, or *IndexExpr for one rank of a partitioned view
+}
+
+// A parsed description
+type File struct {
+	Name		string
+	Decls		[]Decl
+	Comments	[]*CommentGroup	// all comments, including the included files
+}
+
+func (c *Comment) Pos() Pos		{ return c.Slash }
+func (g *CommentGroup) Pos() Pos	{ return g.List[0].Pos() }
+func (x *Ident) Pos() Pos		{ return x.NamePos }
+func (x *BasicLit) Pos() Pos		{ return x.ValuePos }
+func (x *ParenExpr) Pos() Pos		{ return x.Lparen }
+func (x *UnaryExpr) Pos() Pos		{ return x.OpPos }
+func (x *BinaryExpr) Pos() Pos		{ return x.X.Pos() }
+func (x *IndexExpr) Pos() Pos		{ return x.X.Pos() }
+func (x *SelectorExpr) Pos() Pos	{ return x.X.Pos() }
+func (x *CallExpr) Pos() Pos		{ return x.Fun.Pos() }
+func (x *SliceExpr) Pos() Pos {
+	if x.Lo != nil {
+		return x.Lo.Pos()
+	}
+
+	return x.Colon
+}
+
+func (x *DistExpr) Pos() Pos		{ return x.NamePos }
+
+func (t *ArrayType) Pos() Pos		{ return t.Lbrack }
+func (t *StructType) Pos() Pos		{ return t.Struct }
+func (f *Field) Pos() Pos		{ return f.Names[0].Pos() }
+func (d *DatasetDecl) Pos() Pos		{ return d.Dataset }
+func (d *TypeDecl) Pos() Pos		{ return d.TypePos }
+func (d *VarDecl) Pos() Pos		{ return d.Var }
+func (d *ConstDecl) Pos() Pos		{ return d.Const }
+func (f *Flag) Pos() Pos		{ return f.NamePos }
+func (d *ViewDecl) Pos() Pos		{ return d.View }
+func (d *ViewVarDecl) Pos() Pos		{ return d.Var }
+func (d *ReplicaDecl) Pos() Pos		{ return d.Replica }
+func (f *File) Pos() Pos {
+	if len(f.Decls) == 0 {
+		return Pos{Filename: f.Name}
+	}
+
+	return f.Decls[0].Pos()
+}
+
+func (*Ident) exprNode()	{}
+func (*BasicLit) exprNode()	{}
+func (*ParenExpr) exprNode()	{}
+func (*UnaryExpr) exprNode()	{}
+func (*BinaryExpr) exprNode()	{}
+func (*IndexExpr) exprNode()	{}
+func (*SelectorExpr) exprNode()	{}
+func (*CallExpr) exprNode()	{}
+func (*SliceExpr) exprNode()	{}
+func (*DistExpr) exprNode()	{}
+
+func (*Ident) typeNode()	{}
+func (*ArrayType) typeNode()	{}
+func (*StructType) typeNode()	{}
+
+func (*DatasetDecl) declNode()	{}
+func (*TypeDecl) declNode()	{}
+func (*VarDecl) declNode()	{}
+func (*ConstDecl) declNode()	{}
+func (*ViewDecl) declNode()	{}
+func (*ViewVarDecl) declNode()	{}
+func (*ReplicaDecl) declNode()	{}
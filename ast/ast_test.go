@@ -0,0 +1,143 @@
+package ast_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"drepl/ast"
+	"drepl/parser"
+)
+
+const src = `// the dataset
+dataset {
+	const N = 4
+	var a [N]int32	// values
+}
+
+/* the view */
+view v {
+	var x [i] = a[2*i] where i < N/2
+}
+`
+
+func parse(t *testing.T) *ast.File {
+	f, err := parser.ParseAST("test.drepl", []byte(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// the nodes are visited in the order of the source, the comments last
+func TestInspect(t *testing.T) {
+	f := parse(t)
+
+	var idents []string
+	depth := 0
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil:
+			depth--
+			return false
+
+		case *ast.Ident:
+			idents = append(idents, n.Name)
+
+		case *ast.Comment:
+			idents = append(idents, n.Text)
+		}
+
+		depth++
+		return true
+	})
+
+	want := []string{"N", "a", "N", "int32", "v", "x", "i", "a", "i", "i", "N", "// the dataset", "// values", "/* the view */"}
+	if !reflect.DeepEqual(idents, want) {
+		t.Errorf("got %q, expecting %q", idents, want)
+	}
+
+	// each visited node is followed by a call with nil
+	if depth != 0 {
+		t.Errorf("got %d more nodes than calls with nil", depth)
+	}
+
+	// the children of the views aren't visited
+	var names []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ViewDecl, *ast.CommentGroup:
+			return false
+
+		case *ast.Ident:
+			names = append(names, n.Name)
+		}
+
+		return true
+	})
+
+	if want := []string{"N", "a", "N", "int32"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q, expecting %q", names, want)
+	}
+}
+
+func TestParseAST(t *testing.T) {
+	f := parse(t)
+	if f.Name != "test.drepl" || len(f.Decls) != 2 {
+		t.Fatalf("got file %q with %d declarations, expecting test.drepl with 2", f.Name, len(f.Decls))
+	}
+
+	ds := f.Decls[0].(*ast.DatasetDecl)
+	vd := ds.Decls[1].(*ast.VarDecl)
+	vw := f.Decls[1].(*ast.ViewDecl)
+	vv := vw.Decls[0].(*ast.ViewVarDecl)
+	cond := vv.Cond.(*ast.BinaryExpr)
+
+	for _, test := range []struct {
+		node	ast.Node
+		want	string
+	}{
+		{ds, "test.drepl:2:1"},
+		{ds.Decls[0], "test.drepl:3:2"},
+		{vd, "test.drepl:4:2"},
+		{vd.Names[0], "test.drepl:4:6"},
+		{vd.Type, "test.drepl:4:8"},
+		{vw, "test.drepl:8:1"},
+		{vw.Name, "test.drepl:8:6"},
+		{vv.Value, "test.drepl:9:14"},
+		{vv.RType, "test.drepl:9:15"},
+		{cond, "test.drepl:9:27"},
+		{cond.Y, "test.drepl:9:31"},
+	} {
+		if got := test.node.Pos().String(); got != test.want {
+			t.Errorf("%T: got %s, expecting %s", test.node, got, test.want)
+		}
+	}
+
+	if got := vv.Where.String(); got != "test.drepl:9:21" {
+		t.Errorf("where: got %s, expecting test.drepl:9:21", got)
+	}
+
+	// the offsets are in bytes
+	if p := vd.Names[0].Pos(); src[p.Offset:p.Offset+1] != "a" {
+		t.Errorf("got offset %d of %q", p.Offset, src[p.Offset:])
+	}
+
+	var comments []string
+	for _, g := range f.Comments {
+		for _, c := range g.List {
+			comments = append(comments, fmt.Sprintf("%v %s", c.Pos(), c.Text))
+		}
+	}
+
+	want := []string{
+		"test.drepl:1:1 // the dataset",
+		"test.drepl:4:17 // values",
+		"test.drepl:7:1 /* the view */",
+	}
+
+	if !reflect.DeepEqual(comments, want) {
+		t.Errorf("got comments %q, expecting %q", comments, want)
+	}
+}
@@ -0,0 +1,225 @@
+package ast
+
+import (
+	"fmt"
+)
+
+// A Visitor's Visit method is called for each node found by Walk. If the
+// visitor w returned is not nil, Walk visits the children of the node
+// with w, followed by a call to w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in depth-first order, in the order of the
+// source. The comments are visited only when node is a *File, after the
+// declarations.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Comment, *Ident, *BasicLit:
+		// no children
+
+	case *CommentGroup:
+		for _, c := range n.List {
+			Walk(v, c)
+		}
+
+	case *ParenExpr:
+		Walk(v, n.X)
+
+	case *UnaryExpr:
+		Walk(v, n.X)
+
+	case *BinaryExpr:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+
+	case *IndexExpr:
+		Walk(v, n.X)
+		walkExprs(v, n.Index)
+
+	case *SelectorExpr:
+		Walk(v, n.X)
+		Walk(v, n.Sel)
+
+	case *CallExpr:
+		Walk(v, n.Fun)
+		walkExprs(v, n.Args)
+
+	case *SliceExpr:
+		for _, x := range []Expr{n.Lo, n.Hi, n.Step} {
+			if x != nil {
+				Walk(v, x)
+			}
+		}
+
+	case *DistExpr:
+		if n.Arg != nil {
+			Walk(v, n.Arg)
+		}
+
+	case *ArrayType:
+		walkExprs(v, n.Dims)
+		if n.Elem != nil {
+			Walk(v, n.Elem)
+		}
+
+	case *StructType:
+		if n.Align != nil {
+			Walk(v, n.Align)
+		}
+
+		for _, f := range n.Fields {
+			Walk(v, f)
+		}
+
+		if n.Base != nil {
+			Walk(v, n.Base)
+		}
+
+	case *Field:
+		for _, x := range n.Names {
+			Walk(v, x)
+		}
+
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+
+		if n.Align != nil {
+			Walk(v, n.Align)
+		}
+
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *DatasetDecl:
+		if n.File != nil {
+			Walk(v, n.File)
+		}
+
+		walkDecls(v, n.Decls)
+
+	case *TypeDecl:
+		Walk(v, n.Name)
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+
+	case *VarDecl:
+		for _, x := range n.Names {
+			Walk(v, x)
+		}
+
+		Walk(v, n.Type)
+
+	case *ConstDecl:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+
+	case *Flag:
+		walkExprs(v, n.Args)
+
+	case *ViewDecl:
+		Walk(v, n.Name)
+		if n.Rank != nil {
+			Walk(v, n.Rank)
+			Walk(v, n.Ranks)
+		}
+
+		for _, f := range n.Flags {
+			Walk(v, f)
+		}
+
+		if n.File != nil {
+			Walk(v, n.File)
+		}
+
+		walkDecls(v, n.Decls)
+
+	case *ViewVarDecl:
+		Walk(v, n.Name)
+		if n.Order != nil {
+			Walk(v, n.Order)
+		}
+
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+
+		if n.Reduce != nil {
+			Walk(v, n.Reduce)
+		}
+
+		Walk(v, n.Value)
+		if n.RType != nil {
+			Walk(v, n.RType)
+		}
+
+		if n.Cond != nil {
+			Walk(v, n.Cond)
+		}
+
+	case *ReplicaDecl:
+		for _, f := range n.Flags {
+			Walk(v, f)
+		}
+
+		Walk(v, n.Name)
+		if n.File != nil {
+			Walk(v, n.File)
+		}
+
+		for _, x := range n.Views {
+			Walk(v, x)
+		}
+
+	case *File:
+		walkDecls(v, n.Decls)
+		for _, g := range n.Comments {
+			Walk(v, g)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkExprs(v Visitor, list []Expr) {
+	for _, x := range list {
+		// unlimited dimensions are nil
+		if x != nil {
+			Walk(v, x)
+		}
+	}
+}
+
+func walkDecls(v Visitor, list []Decl) {
+	for _, d := range list {
+		Walk(v, d)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect traverses the tree in depth-first order, calling f(node) for
+// each node. If f returns true, Inspect visits the children of node,
+// followed by a call to f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
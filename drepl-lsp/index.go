@@ -0,0 +1,288 @@
+package main
+
+import (
+	"unicode/utf8"
+	"drepl/ast"
+)
+
+type symKind int
+
+const (
+	symType symKind = iota		// dataset type
+	symConst
+	symVar				// dataset variable
+	symView
+	symViewType
+	symViewVar
+	symReplica
+)
+
+var kindNames = [...]string {
+	symType:	"type",
+	symConst:	"const",
+	symVar:		"var",
+	symView:	"view",
+	symViewType:	"type",
+	symViewVar:	"var",
+	symReplica:	"replica",
+}
+
+type symbol struct {
+	kind	symKind
+	name	string
+	view	string		// the view of the view types and variables
+	def	*ast.Ident	// where the symbol is declared
+}
+
+// identifier that refers to a symbol, including the declaring ones
+type ref struct {
+	id	*ast.Ident
+	sym	*symbol
+}
+
+// The symbols declared in a description, and the identifiers referring
+// to them. The names are resolved as the parser does, but without
+// reporting errors, so it works with descriptions that don't process.
+type index struct {
+	syms	map[symbol] *symbol	// keyed by kind, name and view
+	refs	[]ref
+}
+
+func newIndex(f *ast.File) *index {
+	x := &index{syms: make(map[symbol] *symbol)}
+	if f == nil {
+		return x
+	}
+
+	// the constants and the types of the fields can be used before
+	// they are declared
+	for _, d := range f.Decls {
+		x.declare(d)
+	}
+
+	for _, d := range f.Decls {
+		x.resolve(d)
+	}
+
+	return x
+}
+
+func (x *index) lookup(kind symKind, view, name string) *symbol {
+	return x.syms[symbol{kind: kind, view: view, name: name}]
+}
+
+func (x *index) add(kind symKind, view string, id *ast.Ident) {
+	key := symbol{kind: kind, view: view, name: id.Name}
+	if x.syms[key] != nil {
+		// the parser reports the duplicates
+		return
+	}
+
+	s := &symbol{kind: kind, view: view, name: id.Name, def: id}
+	x.syms[key] = s
+	x.refs = append(x.refs, ref{id, s})
+}
+
+func (x *index) ref(kind symKind, view string, id *ast.Ident) bool {
+	s := x.lookup(kind, view, id.Name)
+	if s == nil {
+		return false
+	}
+
+	if s.def != id {
+		x.refs = append(x.refs, ref{id, s})
+	}
+
+	return true
+}
+
+func (x *index) declare(d ast.Decl) {
+	switch d := d.(type) {
+	case *ast.DatasetDecl:
+		for _, d := range d.Decls {
+			switch d := d.(type) {
+			case *ast.TypeDecl:
+				x.add(symType, "", d.Name)
+			case *ast.VarDecl:
+				for _, id := range d.Names {
+					x.add(symVar, "", id)
+				}
+			case *ast.ConstDecl:
+				x.add(symConst, "", d.Name)
+			}
+		}
+
+	case *ast.ViewDecl:
+		view := d.Name.Name
+		x.add(symView, "", d.Name)
+		for _, d := range d.Decls {
+			switch d := d.(type) {
+			case *ast.TypeDecl:
+				x.add(symViewType, view, d.Name)
+			case *ast.ViewVarDecl:
+				x.add(symViewVar, view, d.Name)
+			}
+		}
+
+	case *ast.ReplicaDecl:
+		x.add(symReplica, "", d.Name)
+	}
+}
+
+func (x *index) resolve(d ast.Decl) {
+	switch d := d.(type) {
+	case *ast.DatasetDecl:
+		for _, d := range d.Decls {
+			switch d := d.(type) {
+			case *ast.TypeDecl:
+				x.datasetType(d.Type)
+			case *ast.VarDecl:
+				x.datasetType(d.Type)
+			case *ast.ConstDecl:
+				x.consts(d.Value)
+			}
+		}
+
+	case *ast.ViewDecl:
+		view := d.Name.Name
+		x.consts(d.Ranks)
+		for _, f := range d.Flags {
+			x.consts(f.Args...)
+		}
+
+		for _, d := range d.Decls {
+			switch d := d.(type) {
+			case *ast.TypeDecl:
+				x.viewType(view, d.Type)
+			case *ast.ViewVarDecl:
+				if d.Order != nil {
+					x.consts(d.Order.Args...)
+				}
+
+				x.viewType(view, d.Type)
+				x.ref(symVar, "", d.Value)
+				x.viewType(view, d.RType)
+				if d.Cond != nil {
+					x.where(d.Cond)
+				}
+			}
+		}
+
+	case *ast.ReplicaDecl:
+		for _, v := range d.Views {
+			if e, ok := v.(*ast.IndexExpr); ok {
+				v = e.X
+			}
+
+			if id, ok := v.(*ast.Ident); ok {
+				x.ref(symView, "", id)
+			}
+		}
+	}
+}
+
+func (x *index) datasetType(t ast.Type) {
+	switch t := t.(type) {
+	case *ast.Ident:
+		x.ref(symType, "", t)
+
+	case *ast.ArrayType:
+		x.consts(t.Dims...)
+		x.datasetType(t.Elem)
+
+	case *ast.StructType:
+		x.consts(t.Align)
+		for _, f := range t.Fields {
+			x.datasetType(f.Type)
+			x.consts(f.Align)
+		}
+	}
+}
+
+func (x *index) viewType(view string, t ast.Type) {
+	switch t := t.(type) {
+	case *ast.Ident:
+		if !x.ref(symType, "", t) {
+			x.ref(symViewType, view, t)
+		}
+
+	case *ast.ArrayType:
+		// the other names are the indices, they aren't declared,
+		// the indexed names are index arrays
+		for _, d := range t.Dims {
+			if d != nil {
+				x.where(d)
+			}
+		}
+
+		x.viewType(view, t.Elem)
+
+	case *ast.StructType:
+		for _, f := range t.Fields {
+			x.viewType(view, f.Type)
+			x.consts(f.Value)
+		}
+
+		if t.Base != nil {
+			x.ref(symType, "", t.Base)
+		}
+	}
+}
+
+// resolves the names in the predicate of a view variable, the elements
+// are of dataset variables, the field names aren't resolved
+func (x *index) where(e ast.Expr) {
+	ast.Inspect(e, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IndexExpr:
+			if id, ok := n.X.(*ast.Ident); ok {
+				x.ref(symVar, "", id)
+			} else {
+				x.where(n.X)
+			}
+
+			x.consts(n.Index...)
+			return false
+
+		case *ast.SelectorExpr:
+			x.where(n.X)
+			return false
+
+		case *ast.Ident:
+			x.ref(symConst, "", n)
+		}
+
+		return true
+	})
+}
+
+// resolves the constants in the expressions
+func (x *index) consts(list ...ast.Expr) {
+	for _, e := range list {
+		if e == nil {
+			continue
+		}
+
+		ast.Inspect(e, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				x.ref(symConst, "", id)
+			}
+
+			return true
+		})
+	}
+}
+
+// returns the identifier at the position in the file, and the symbol it
+// refers to, col is in characters, starting at 1
+func (x *index) find(fname string, line, col int) *ref {
+	for i := range x.refs {
+		r := &x.refs[i]
+		p := r.id.NamePos
+		if p.Filename == fname && p.Line == line && col >= p.Column && col < p.Column + utf8.RuneCountInString(r.id.Name) {
+			return r
+		}
+	}
+
+	return nil
+}
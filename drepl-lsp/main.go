@@ -0,0 +1,50 @@
+// Command drepl-lsp is a language server for the DRepl descriptions. It
+// speaks the Language Server Protocol over the standard input and
+// output, reports the errors in the descriptions as they are edited,
+// finds the declarations of the types, constants, variables and views,
+// and shows the sizes, offsets and dimensions computed by the parser.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+var logfile = flag.String("log", "", "log the errors to the file")
+
+var logger *log.Logger
+
+func logf(format string, args ...interface{}) {
+	if logger != nil {
+		logger.Printf(format, args...)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: drepl-lsp [-log file]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 0 {
+		usage()
+	}
+
+	if *logfile != "" {
+		f, err := os.OpenFile(*logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		logger = log.New(f, "drepl-lsp: ", log.LstdFlags)
+	}
+
+	s := newServer(newConn(os.Stdin, os.Stdout))
+	os.Exit(s.run())
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC message, a request if ID is set, otherwise a notification
+type message struct {
+	Version	string		`json:"jsonrpc"`
+	ID	json.RawMessage	`json:"id,omitempty"`
+	Method	string		`json:"method,omitempty"`
+	Params	json.RawMessage	`json:"params,omitempty"`
+	Result	interface{}	`json:"result,omitempty"`
+	Error	*rpcError	`json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code	int		`json:"code"`
+	Message	string		`json:"message"`
+}
+
+const (
+	errParse		= -32700
+	errInvalidRequest	= -32600
+	errMethodNotFound	= -32601
+	errInvalidParams	= -32602
+)
+
+// reads and writes the messages framed with the Content-Length header
+type conn struct {
+	r	*textproto.Reader
+	w	io.Writer
+	wlock	sync.Mutex
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+func (c *conn) read() (*message, error) {
+	hdr, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(hdr.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid Content-Length: %q", hdr.Get("Content-Length"))
+	}
+
+	buf := make([]byte, n)
+	if _, err = io.ReadFull(c.r.R, buf); err != nil {
+		return nil, err
+	}
+
+	m := new(message)
+	if err = json.Unmarshal(buf, m); err != nil {
+		return nil, &rpcError{errParse, err.Error()}
+	}
+
+	return m, nil
+}
+
+func (c *conn) write(m *message) error {
+	m.Version = "2.0"
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if _, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(buf)); err == nil {
+		_, err = c.w.Write(buf)
+	}
+
+	return err
+}
+
+func (c *conn) reply(id json.RawMessage, result interface{}, err *rpcError) error {
+	m := &message{ID: id, Error: err}
+	if err == nil {
+		// null results are sent too
+		m.Result = nullable{result}
+	}
+
+	return c.write(m)
+}
+
+func (c *conn) notify(method string, params interface{}) error {
+	buf, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return c.write(&message{Method: method, Params: buf})
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// a result that is encoded as null if nil, and isn't left out
+type nullable struct {
+	v	interface{}
+}
+
+func (n nullable) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.v)
+}
+
+// LSP types, only the fields used by the server
+
+type Position struct {
+	Line		int	`json:"line"`
+	Character	int	`json:"character"`	// in UTF-16 code units
+}
+
+type Range struct {
+	Start	Position	`json:"start"`
+	End	Position	`json:"end"`
+}
+
+type Location struct {
+	URI	string	`json:"uri"`
+	Range	Range	`json:"range"`
+}
+
+type Diagnostic struct {
+	Range		Range	`json:"range"`
+	Severity	int	`json:"severity"`
+	Source		string	`json:"source"`
+	Message		string	`json:"message"`
+}
+
+const severityError = 1
+
+type TextDocumentItem struct {
+	URI		string	`json:"uri"`
+	Version		int	`json:"version"`
+	Text		string	`json:"text"`
+}
+
+type TextDocumentIdentifier struct {
+	URI	string	`json:"uri"`
+}
+
+type DidOpenParams struct {
+	TextDocument	TextDocumentItem	`json:"textDocument"`
+}
+
+type DidChangeParams struct {
+	TextDocument	TextDocumentItem	`json:"textDocument"`
+	ContentChanges	[]struct {
+		Text	string	`json:"text"`
+	}	`json:"contentChanges"`
+}
+
+type DidCloseParams struct {
+	TextDocument	TextDocumentIdentifier	`json:"textDocument"`
+}
+
+type PositionParams struct {
+	TextDocument	TextDocumentIdentifier	`json:"textDocument"`
+	Position	Position		`json:"position"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI		string		`json:"uri"`
+	Version		int		`json:"version,omitempty"`
+	Diagnostics	[]Diagnostic	`json:"diagnostics"`
+}
+
+type MarkupContent struct {
+	Kind	string	`json:"kind"`
+	Value	string	`json:"value"`
+}
+
+type Hover struct {
+	Contents	MarkupContent	`json:"contents"`
+	Range		*Range		`json:"range,omitempty"`
+}
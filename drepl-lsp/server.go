@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+	"drepl/ast"
+	"drepl/parser"
+)
+
+// an open description, analyzed after each change
+type document struct {
+	uri	string
+	fname	string		// the name used by the parser
+	version	int
+	text	string
+	lines	[]string
+
+	file	*ast.File
+	dr	*parser.DRepl
+	errs	parser.ErrorList
+	idx	*index
+}
+
+type server struct {
+	c		*conn
+	docs		map[string] *document
+	shutdown	bool
+}
+
+func newServer(c *conn) *server {
+	return &server{c: c, docs: make(map[string] *document)}
+}
+
+// serves the requests until the exit notification, returns the exit status
+func (s *server) run() int {
+	for {
+		m, err := s.c.read()
+		if err != nil {
+			if rerr, ok := err.(*rpcError); ok {
+				s.c.reply(nil, nil, rerr)
+				continue
+			}
+
+			logf("read: %v", err)
+			return 1
+		}
+
+		if m.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+
+			return 1
+		}
+
+		result, rerr := s.handle(m)
+		if m.ID != nil {
+			s.c.reply(m.ID, result, rerr)
+		}
+	}
+}
+
+func (s *server) handle(m *message) (interface{}, *rpcError) {
+	var err error
+
+	switch m.Method {
+	case "initialize":
+		return map[string]interface{} {
+			"capabilities": map[string]interface{} {
+				"textDocumentSync":	1,	// the whole document is sent
+				"definitionProvider":	true,
+				"hoverProvider":	true,
+			},
+			"serverInfo": map[string]string{"name": "drepl-lsp"},
+		}, nil
+
+	case "initialized":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p DidOpenParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			s.update(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text)
+		}
+
+	case "textDocument/didChange":
+		var p DidChangeParams
+		if err = json.Unmarshal(m.Params, &p); err == nil && len(p.ContentChanges) > 0 {
+			s.update(p.TextDocument.URI, p.TextDocument.Version, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		}
+
+	case "textDocument/didClose":
+		var p DidCloseParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			delete(s.docs, p.TextDocument.URI)
+			s.c.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+
+	case "textDocument/definition":
+		var p PositionParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			return s.definition(&p), nil
+		}
+
+	case "textDocument/hover":
+		var p PositionParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			return s.hover(&p), nil
+		}
+
+	default:
+		if m.ID != nil {
+			return nil, &rpcError{errMethodNotFound, "method not supported: " + m.Method}
+		}
+	}
+
+	if err != nil {
+		return nil, &rpcError{errInvalidParams, err.Error()}
+	}
+
+	return nil, nil
+}
+
+// parses and processes the new text of the document, and publishes the
+// errors found
+func (s *server) update(uri string, version int, text string) {
+	d := s.docs[uri]
+	if d == nil {
+		d = &document{uri: uri, fname: uriToPath(uri)}
+		s.docs[uri] = d
+	}
+
+	d.version = version
+	d.text = text
+	d.lines = strings.Split(text, "\n")
+	d.dr, d.file, d.errs = parser.Check(d.fname, []byte(text), nil)
+	d.idx = newIndex(d.file)
+
+	diags := []Diagnostic{}
+	for _, e := range d.errs {
+		diags = append(diags, s.diagnostic(d, e))
+	}
+
+	s.c.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: uri, Version: version, Diagnostics: diags})
+}
+
+func (s *server) diagnostic(d *document, e *parser.Error) Diagnostic {
+	diag := Diagnostic{Severity: severityError, Source: "drepl", Message: e.Msg}
+	pos := e.Position()
+	switch {
+	case pos.Filename == d.fname && pos.IsValid():
+		diag.Range = s.identRange(pos, "")
+
+	case pos.IsValid():
+		// in an included file, shown at the include
+		diag.Message = fmt.Sprintf("%v: %s", pos, e.Msg)
+		if inc := includeOf(d, pos.Filename); inc != nil {
+			diag.Range = s.identRange(inc.ValuePos, inc.Value)
+		}
+	}
+
+	return diag
+}
+
+// returns the literal of the include that reads the file fname
+func includeOf(d *document, fname string) *ast.BasicLit {
+	if d.file == nil {
+		return nil
+	}
+
+	for _, decl := range d.file.Decls {
+		var lit *ast.BasicLit
+
+		switch decl := decl.(type) {
+		case *ast.DatasetDecl:
+			lit = decl.File
+		case *ast.ViewDecl:
+			lit = decl.File
+		}
+
+		if lit == nil {
+			continue
+		}
+
+		name, err := strconv.Unquote(lit.Value)
+		if err == nil && !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(d.fname), name)
+		}
+
+		if name == fname {
+			return lit
+		}
+	}
+
+	return nil
+}
+
+func (s *server) definition(p *PositionParams) interface{} {
+	d, r := s.find(p)
+	if r == nil {
+		return nil
+	}
+
+	id := r.sym.def
+	return &Location{URI: s.fileURI(d, id.NamePos.Filename), Range: s.identRange(id.NamePos, id.Name)}
+}
+
+func (s *server) hover(p *PositionParams) interface{} {
+	d, r := s.find(p)
+	if r == nil {
+		return nil
+	}
+
+	sym := r.sym
+	text := ""
+	if d.dr != nil {
+		switch sym.kind {
+		case symType:
+			text = d.dr.TypeInfo(sym.name)
+		case symConst:
+			text = d.dr.ConstInfo(sym.name)
+		case symVar:
+			text = d.dr.VarInfo(sym.name)
+		case symView:
+			text = d.dr.ViewInfo(sym.name)
+		case symViewVar:
+			text = d.dr.ViewVarInfo(sym.view, sym.name)
+		}
+	}
+
+	if text == "" {
+		// not processed
+		text = kindNames[sym.kind] + " " + sym.name + "\n"
+		if sym.view != "" {
+			text = "view " + sym.view + " " + text
+		}
+	}
+
+	rng := s.identRange(r.id.NamePos, r.id.Name)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: "```\n" + text + "```\n"}, Range: &rng}
+}
+
+// returns the document and the identifier at the position
+func (s *server) find(p *PositionParams) (*document, *ref) {
+	d := s.docs[p.TextDocument.URI]
+	if d == nil || p.Position.Line >= len(d.lines) {
+		return d, nil
+	}
+
+	col := runeColumn(d.lines[p.Position.Line], p.Position.Character)
+	return d, d.idx.find(d.fname, p.Position.Line + 1, col)
+}
+
+// returns the range of the identifier name at pos, if name is "" the
+// range covers the word at pos
+func (s *server) identRange(pos ast.Pos, name string) Range {
+	line := s.line(pos.Filename, pos.Line)
+	n := utf8.RuneCountInString(name)
+	if name == "" {
+		n = wordLen(line, pos.Column)
+	}
+
+	start := Position{Line: pos.Line - 1, Character: utf16Column(line, pos.Column)}
+	end := Position{Line: pos.Line - 1, Character: utf16Column(line, pos.Column + n)}
+	return Range{start, end}
+}
+
+// returns the text of the line in the file, from the open document if
+// there is one
+func (s *server) line(fname string, line int) string {
+	var lines []string
+
+	for _, d := range s.docs {
+		if d.fname == fname {
+			lines = d.lines
+			break
+		}
+	}
+
+	if lines == nil {
+		buf, err := os.ReadFile(fname)
+		if err != nil {
+			return ""
+		}
+
+		lines = strings.Split(string(buf), "\n")
+	}
+
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	return lines[line-1]
+}
+
+func (s *server) fileURI(d *document, fname string) string {
+	if fname == d.fname {
+		return d.uri
+	}
+
+	u := url.URL{Scheme: "file", Path: fname}
+	return u.String()
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	return filepath.FromSlash(u.Path)
+}
+
+// converts the column in characters (starting at 1) to the LSP character
+// offset (UTF-16 units, starting at 0)
+func utf16Column(line string, col int) int {
+	n := 0
+	for i, c := range []rune(line) {
+		if i >= col - 1 {
+			break
+		}
+
+		n += len(utf16.Encode([]rune{c}))
+	}
+
+	return n
+}
+
+// converts the LSP character offset to the column in characters
+func runeColumn(line string, character int) int {
+	col := 1
+	for _, c := range line {
+		character -= len(utf16.Encode([]rune{c}))
+		if character < 0 {
+			break
+		}
+
+		col++
+	}
+
+	return col
+}
+
+// returns the length in characters of the word starting at col, at
+// least 1 if col is in the line
+func wordLen(line string, col int) int {
+	r := []rune(line)
+	if col < 1 || col > len(r) {
+		return 0
+	}
+
+	n := 0
+	for _, c := range r[col-1:] {
+		if c != '_' && !isAlnum(c) {
+			break
+		}
+
+		n++
+	}
+
+	if n == 0 {
+		n = 1
+	}
+
+	return n
+}
+
+func isAlnum(c rune) bool {
+	return 'a'<=c && c<='z' || 'A'<=c && c<='Z' || '0'<=c && c<='9'
+}
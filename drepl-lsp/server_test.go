@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///tmp/test.drepl"
+
+const testSrc = `dataset {
+	const N = 10
+	type pt struct { x, y int32 }
+	var a [N]pt
+	var b [N]int32
+}
+
+view v {
+	var x [i] = a[i]
+	var y [i] = b[i + 1]
+}
+`
+
+// opens the document with the text src, and returns the server and the
+// diagnostics it published
+func openDoc(t *testing.T, src string) (*server, []Diagnostic) {
+	var out bytes.Buffer
+
+	s := newServer(newConn(nil, &out))
+	s.update(testURI, 1, src)
+	m, err := newConn(&out, nil).read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p PublishDiagnosticsParams
+	if err = json.Unmarshal(m.Params, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Method != "textDocument/publishDiagnostics" || p.URI != testURI || p.Version != 1 {
+		t.Fatalf("got %s %s version %d", m.Method, p.URI, p.Version)
+	}
+
+	return s, p.Diagnostics
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		src	string
+		rng	Range
+		msg	string
+	}{
+		{strings.Replace(testSrc, "b[i + 1]", "c[i]", 1), Range{Position{9, 13}, Position{9, 14}}, "variable 'c' not found"},
+		{strings.Replace(testSrc, "a[i]", "a[j]", 1), Range{Position{8, 1}, Position{8, 4}}, "index 'i' isn't used on the right side"},
+		{strings.Replace(testSrc, "var b [N]int32", "var b [N]int33", 1), Range{Position{4, 10}, Position{4, 15}}, "int33"},
+
+		// the columns are in UTF-16 units
+		{strings.Replace(testSrc, "b[i + 1]", "/* é𝄞 */ c[i]", 1), Range{Position{9, 23}, Position{9, 24}}, "variable 'c' not found"},
+	}
+
+	for _, test := range tests {
+		_, diags := openDoc(t, test.src)
+		if len(diags) == 0 {
+			t.Errorf("%s: no diagnostics", test.src)
+			continue
+		}
+
+		d := diags[0]
+		if d.Range != test.rng || d.Severity != severityError || !strings.Contains(d.Message, test.msg) {
+			t.Errorf("%s: got %v %q, expecting %v %q", test.src, d.Range, d.Message, test.rng, test.msg)
+		}
+	}
+
+	if _, diags := openDoc(t, testSrc); len(diags) != 0 {
+		t.Errorf("got diagnostics %v, expecting none", diags)
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		pos	Position
+		want	string		// nothing if ""
+	}{
+		{Position{1, 7}, "const N = 10\n"},
+		{Position{2, 7}, "type pt struct\nsize 8, align 4\n"},
+		{Position{3, 11}, "type pt struct\n"},
+		{Position{3, 5}, "var a [10]pt\noffset 0\n"},
+		{Position{9, 13}, "var b [10]int32\noffset 80\n"},
+		{Position{7, 5}, "view v rowmajor\nvar x: size 80\nvar y: size 36\n"},
+		{Position{8, 5}, "view v var x = a\nsize 80\n"},
+		{Position{8, 13}, "var a [10]pt\n"},
+		{Position{0, 0}, ""},
+		{Position{9, 8}, ""},
+		{Position{20, 0}, ""},
+	}
+
+	s, _ := openDoc(t, testSrc)
+	for _, test := range tests {
+		h, _ := s.hover(&PositionParams{TextDocumentIdentifier{testURI}, test.pos}).(*Hover)
+		switch {
+		case test.want == "" && h != nil:
+			t.Errorf("%v: got hover %q, expecting none", test.pos, h.Contents.Value)
+		case test.want != "" && h == nil:
+			t.Errorf("%v: no hover, expecting %q", test.pos, test.want)
+		case test.want != "" && !strings.HasPrefix(h.Contents.Value, "```\n" + test.want):
+			t.Errorf("%v: got hover %q, expecting %q", test.pos, h.Contents.Value, test.want)
+		case test.want != "" && h.Range.Start.Line != test.pos.Line:
+			t.Errorf("%v: got range %v", test.pos, *h.Range)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package drepl
 import (
 	"fmt"
 	"errors"
+	"hash"
 )
 
 type Block interface {
@@ -11,13 +12,14 @@ type Block interface {
 	Read(buf []byte, offset, base int64) (int64, error)
 	Write(data []byte, offset, base int64, write, replicate bool) (int64, error)
 //	Clone() Block				// doesn't clone the destinations
-	ConnectDestinations()
-	cloneConnect(blk1, blk2 Block, udest bool) Block
+	ConnectDestinations() error
+	cloneConnect(blk1, blk2 Block, udest bool) (Block, error)
 	isDest(d Block) bool
-	xform(src, dst []byte)			// converts data described by the block to the data described to the (single) destination
+	xform(src, dst []byte) error		// converts data described by the block to the data described to the (single) destination
 	replicate(data []byte, offset, base int64) error
 	export1(blks map[Block]int32)
 	export2(data []byte, blks map[Block]int32, views map[*View]int32, visited map[Block]bool) []byte
+	fingerprint(h hash.Hash64)
 }
 
 // single block
@@ -27,6 +29,8 @@ type SBlock struct {
 	size	int64
 	dests	[]*SBlock
 	src	*SBlock		// if unmaterialized block, pointer to the block to read from
+	endian	int		// byte order of the value
+	ntype	int		// numeric type of the value (NoType if not a number)
 
 	// debugging stuff
 	clonee	*SBlock		// if the block is a clone, the original
@@ -41,9 +45,18 @@ type ABlock struct {
 	dim	[]int64
 	elsize	int64
 	elnum	int64		// number of elements (product of all values in dim)
+	elo	ElementOrder	// order of the elements, by default the view's one
 	elblk	Block
 	dests	[]*ADest
 	src	*ADest		// if unmaterialized block, pointer to the block to read from
+	recs	*Records	// if not nil, the first dimension is unlimited
+	filter	*Filter		// if not nil, the elements are selected by their values
+	gather	[]*Gather	// index arrays giving some of the source indices
+	gatherer *ABlock	// if the block is an index array, the array using it
+	red	*Reduce		// if not nil, the elements are reduced over windows of the source
+	deps	[]*ABlock	// materialized arrays to refresh when the block is written
+	rdeps	[]*rdep		// materialized reductions to update when the block is written
+	copies	*ADest		// if the block wraps, the other copies of its elements
 
 	// debugging stuff
 	clonee	*ABlock		// if the block is a clone, the original
@@ -51,6 +64,9 @@ type ABlock struct {
 
 type ADest struct {
 	expr	[]PExpr
+	cond	[]PExpr		// the element belongs to arr only if all are zero
+	wrap	[]PExpr		// wrapped indices of the source, variables following its indices
+	period	[]PPeriod	// periods of the wrapped indices of arr, variables following wrap
 	arr	*ABlock
 	el	Block
 }
@@ -63,6 +79,7 @@ type TBlock struct {
 	bs	BlockSeq
 	dests	[]*TBlock
 	src	*TBlock		// if unmaterialized view, pointer to the block to read from
+	comp	[]*Computed	// fields calculated from the other ones
 
 	// debugging stuff
 	clonee	*TBlock		// if the block is a clone, the original
@@ -123,12 +140,36 @@ func (b *SBlock) Read(buf []byte, offset, base int64) (int64, error) {
 	// in their views too
 //	fmt.Printf("SBlock.Read %p offset %d count %d\n", b, offset, len(buf))
 	sb := b.src
-	return sb.Read(buf, offset - base - b.offset + sb.offset, 0)
+	if !converted(sb, b) {
+		return sb.Read(buf, offset - base - b.offset + sb.offset, 0)
+	}
+
+	// read the whole value so it can be converted
+	sbuf := make([]byte, sb.size)
+	n, err := sb.Read(sbuf, sb.offset, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if n != sb.size {
+		return 0, errors.New("short read")
+	}
+
+	dbuf := make([]byte, b.size)
+	if err := convert(sb, b, sbuf, dbuf); err != nil {
+		return 0, err
+	}
 
+	return int64(copy(buf, dbuf[offset - base - b.offset:])), nil
 }
 
-func (b *SBlock) xform(src, dst []byte) {
-	copy(dst, src)
+func (b *SBlock) xform(src, dst []byte) error {
+	if len(b.dests) == 0 {
+		copy(dst, src)
+		return nil
+	}
+
+	return convert(b, b.dests[0], src, dst)
 }
 
 func (b *SBlock) replicate(data []byte, offset, base int64) (err error) {
@@ -136,7 +177,19 @@ func (b *SBlock) replicate(data []byte, offset, base int64) (err error) {
 	dbase := offset - base + b.offset
 	doff := offset - b.offset
 	for _, d := range b.dests {
-		_, err := d.Write(data, doff + d.offset, dbase + d.offset, true, false)
+		buf := data
+		if converted(b, d) {
+			if int64(len(data)) % b.size != 0 {
+				return errors.New("partial write of converted value")
+			}
+
+			buf = make([]byte, int64(len(data)) / b.size * d.size)
+			if err := convert(b, d, data, buf); err != nil {
+				return err
+			}
+		}
+
+		_, err := d.Write(buf, doff + d.offset, dbase + d.offset, true, false)
 		if err != nil {
 			return err
 		}
@@ -145,6 +198,25 @@ func (b *SBlock) replicate(data []byte, offset, base int64) (err error) {
 	return nil
 }
 
+// Sets the byte order of the value described by the block
+func (b *SBlock) SetEndian(endian int) {
+	b.endian = endian
+}
+
+func (b *SBlock) Endian() int {
+	return b.endian
+}
+
+// Sets the numeric type of the value described by the block. Values
+// of different numeric types are converted when copied between blocks
+func (b *SBlock) SetType(ntype int) {
+	b.ntype = ntype
+}
+
+func (b *SBlock) Type() int {
+	return b.ntype
+}
+
 func (b *SBlock) Write(data []byte, offset, base int64, write, replicate bool) (n int64, err error) {
 //	fmt.Printf("SBlock.Write %p r %v b.offset %d offset %d count %d\n", b, replicate, b.offset, offset, len(data))
 	if write && b.view.repl != nil {
@@ -169,7 +241,7 @@ func (b *SBlock) Write(data []byte, offset, base int64, write, replicate bool) (
 }
 
 // Clones blk1 and connects it to blk2 recursively. Both blk1 and blk2 are destinations of b
-func (b *SBlock) cloneConnect(blk1, blk2 Block, force bool) Block {
+func (b *SBlock) cloneConnect(blk1, blk2 Block, force bool) (Block, error) {
 	b1 := blk1.(*SBlock)
 	b2 := blk2.(*SBlock)
 	nb := new(SBlock)
@@ -189,15 +261,19 @@ func (b *SBlock) cloneConnect(blk1, blk2 Block, force bool) Block {
 
 	if nb.view.repl == nil && b2.view == nb.view.dflt {
 //		fmt.Printf("SBlock.CloneConnect %p source for %p\n", b2, nb)
-		nb2 := (b.cloneConnect(blk2, blk1, true)).(*SBlock)
-		nb.AddSource(nb2)
+		nb2, err := b.cloneConnect(blk2, blk1, true)
+		if err != nil {
+			return nil, err
+		}
+
+		nb.AddSource(nb2.(*SBlock))
 	}
 		
 //	fmt.Printf("SBlock.cloneConnect nb %p\n", nb)
-	return nb
+	return nb, nil
 }
 
-func (b *SBlock) ConnectDestinations() {
+func (b *SBlock) ConnectDestinations() error {
 //	fmt.Printf("SBlock.ConnectDestinations %p view %s offset %v \n", b, b.view.Name, b.offset)
 	for i, d1 := range b.dests {
 		fmt.Printf("\td1 %p view %s offset %v\n", d1, d1.view.Name, d1.offset)
@@ -209,7 +285,12 @@ func (b *SBlock) ConnectDestinations() {
 //					fmt.Printf("SBlock.ConnectDestinations: %p source for %p\n", d2, d1)
 					nd2 := d2
 					if !d1.view.IsReadonly() {
-						nd2 = (b.cloneConnect(d2, d1, false)).(*SBlock)
+						nb, err := b.cloneConnect(d2, d1, false)
+						if err != nil {
+							return err
+						}
+
+						nd2 = nb.(*SBlock)
 					}
 
 					d1.AddSource(nd2)
@@ -231,6 +312,8 @@ func (b *SBlock) ConnectDestinations() {
 			}
 		}
 	}
+
+	return nil
 }
 
 /*
@@ -251,25 +334,177 @@ func (b *ABlock) Size() int64 {
 }
 
 func (b *ABlock) AddDestination(ab *ABlock, el Block, pe []PExpr) {
+	b.addDestination(ab, el, ADest{expr: pe})
+}
+
+// c has the expressions of the destination
+func (b *ABlock) addDestination(ab *ABlock, el Block, c ADest) {
 	ad := new(ADest)
+	*ad = c
 	ad.arr = ab
 	ad.el = el
-	ad.expr = pe
 	b.dests = append(b.dests, ad)
 }
 
 func (b *ABlock) AddSource(ab *ABlock, el Block, pe []PExpr) {
+	b.addSource(ab, el, ADest{expr: pe})
+}
+
+func (b *ABlock) addSource(ab *ABlock, el Block, c ADest) {
 	as := new(ADest)
+	*as = c
 	as.arr = ab
 	as.el = el
-	as.expr = pe
 	b.src = as
 }
 
+// number of variables of the expressions that calculate the dataset
+// indices from the indices of the array
+func (b *ABlock) nvar() int {
+	n := len(b.dim)
+	if b.filter != nil {
+		n = len(b.filter.dim)
+	}
+
+	if b.red != nil {
+		n += len(b.red.win)
+	}
+
+	return n + len(b.gather)
+}
+
+// Calculates the indices didx of the element in the destination array
+// from the indices idx in the source one. Returns false if the element
+// doesn't belong to the destination array.
+func (d *ADest) index(idx, didx []int64) bool {
+	for i := range d.expr {
+		q, r := d.expr[i].calc(idx)
+		if r != 0 || q < 0 || q >= d.arr.dim[i] {
+			// if there is a remainder, or the index is
+			// outside, the element isn't in the array
+			return false
+		}
+
+		didx[i] = q
+	}
+
+	for i := range d.cond {
+		q, r := d.cond[i].calc(idx)
+		if q != 0 || r != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Calls f with the indices didx of each element of the destination array
+// that the element with the indices idx in the source array corresponds
+// to. There can be more than one if the destination wraps. Stops when f
+// returns true, and returns true if it did.
+func (d *ADest) each(idx, didx []int64, f func() bool) bool {
+	if d.wrap == nil && d.period == nil {
+		return d.index(idx, didx) && f()
+	}
+
+	// the wrapped indices and the periods follow the indices
+	n := len(idx) + len(d.wrap)
+	xa := make([]int64, n + len(d.period))
+	copy(xa, idx)
+	for i := range d.wrap {
+		q, r := d.wrap[i].calc(idx)
+		if r != 0 {
+			return false
+		}
+
+		xa[len(idx) + i] = q
+	}
+
+	for i := range d.period {
+		p := &d.period[i]
+		if p.Max < p.Min {
+			return false
+		}
+
+		if p.M != 0 {
+			q, r := p.Expr.calc(xa)
+			if r != 0 || q < 0 || q >= p.M {
+				// no index of the destination wraps to it
+				return false
+			}
+		}
+
+		xa[n + i] = p.Min
+	}
+
+	for {
+		if d.index(xa, didx) && f() {
+			return true
+		}
+
+		// next combination of the periods
+		i := len(d.period) - 1
+		for ; i >= 0 && xa[n + i] >= d.period[i].Max; i-- {
+			xa[n + i] = d.period[i].Min
+		}
+
+		if i < 0 {
+			return false
+		}
+
+		xa[n + i]++
+	}
+}
+
+// Calculates the indices didx of the first element in the destination
+// array the element idx of the source corresponds to. Returns false if
+// there is none.
+func (d *ADest) first(idx, didx []int64) bool {
+	return d.each(idx, didx, func() bool { return true })
+}
+
+func (b *ABlock) SetOrder(elo ElementOrder) {
+	b.elo = elo
+}
+
+func (b *ABlock) Order() ElementOrder {
+	return b.elo
+}
+
 func (b *ABlock) Element() Block {
 	return b.elblk
 }
 
+// Makes the first dimension of the array unlimited, its length is
+// the number of records in r
+func (b *ABlock) SetRecords(r *Records) {
+	r.add(b)
+}
+
+func (b *ABlock) Records() *Records {
+	return b.recs
+}
+
+func (b *ABlock) setRecords(n int64) {
+	b.dim[0] = n
+	b.elnum = 1
+	for _, m := range b.dim {
+		b.elnum *= m
+	}
+
+	b.size = b.elnum * b.elsize
+}
+
+// size of a single record of an array with unlimited dimension
+func (b *ABlock) recordSize() int64 {
+	sz := b.elsize
+	for _, m := range b.dim[1:] {
+		sz *= m
+	}
+
+	return sz
+}
+
 func (b *ABlock) isDest(d Block) bool {
 	for _, dd := range b.dests {
 		if dd.arr == d {
@@ -286,8 +521,18 @@ func (b *ABlock) Read(data []byte, offset, base int64) (int64, error) {
 	}
 
 	// Unmaterialized view
+	return b.readSource(data, offset, base)
+}
+
+// reads the elements from the block's source
+func (b *ABlock) readSource(data []byte, offset, base int64) (int64, error) {
 //	fmt.Printf("ABlock.Read %p offset %d count %d\n", b, offset, len(data))
 	offset -= base
+	if offset + int64(len(data)) > b.size {
+		// only the part described by the block
+		data = data[0:b.size - offset]
+	}
+
 	esz := b.elblk.Size()
 	eidx := int64(offset + int64(len(data))) / esz
 	sidx := int64(offset) / esz
@@ -296,45 +541,73 @@ func (b *ABlock) Read(data []byte, offset, base int64) (int64, error) {
 //	fmt.Printf("ABlock.Read sidx %d eidx %d soffset %d esz %d\n", sidx, eidx, soffset, esz)
 	n := esz - (offset - soffset) + (eidx - sidx - 1) * esz
 	data = data[0:n]	// finish at whole element
-	elo := b.view.elo
-	idx := make([]int64, len(b.dim))
-	didx := make([]int64, len(b.dim))
+	elo := b.elo
+	dim := b.dim
+	if b.filter != nil {
+		// the indices are the ones in the original array
+		dim = b.filter.dim
+	}
+
+	var gvals [][]int64
+
+	for _, g := range b.gather {
+		vals, err := g.indices()
+		if err != nil {
+			return 0, err
+		}
+
+		gvals = append(gvals, vals)
+	}
+
+	// the windows of a reduction and the values of the index arrays
+	// follow the indices
+	idx := make([]int64, b.nvar())
 	off := offset - b.Offset()
 	d := b.src
+	didx := make([]int64, len(d.expr))
 	buf := make([]byte, d.arr.elsize)
 
 	for int64(len(data)) >= esz {
-		elo.ToIdx(sidx, idx, b.dim)
+		if b.filter != nil {
+			b.filter.toIdx(elo, sidx, idx[0:len(dim)])
+		} else {
+			elo.ToIdx(sidx, idx[0:len(dim)], b.dim)
+		}
+
+		if b.gather != nil {
+			b.gatherIdx(gvals, idx)
+		}
 //		fmt.Printf("ABlock.Read: source index: %v\n", idx)
 
-		// calculate the indices in the destination array
-		for i := 0; i < len(idx); i++ {
-			q, r := d.expr[i].calc(idx)
-			if r!=0 {
-				// if there is a remainder, the element doesn't
-				// belong to the destination array
-				return 0, errors.New("default view doesn't have the requested element")
+		if b.red != nil {
+			if err := b.reduce(idx, data[0:esz]); err != nil {
+				return 0, err
 			}
 
-			didx[i] = q
+			data = data[esz:]
+			off += esz
+			sidx++
+			continue
 		}
 
-		// base offset for the destination element
-		doff := d.arr.view.elo.FromIdx(didx, d.arr.dim) * d.arr.elsize
-//		fmt.Printf("ABlock.Read: destination offset %d index: %v esz %d data %d %v\n", doff, didx, esz, len(data), data[0:esz])
-//		fmt.Printf("ABlock.Read: d.el %v\n", d.el)
-		n, err := d.el.Read(buf, d.arr.offset + doff, d.arr.offset + doff)
-//		fmt.Printf("ABlock.Read: result %d %v\n", n, err)
-		if err != nil {
-			return 0, err
+		// calculate the indices in the destination array
+		if !d.first(idx, didx) {
+			// the element isn't in the default view, it
+			// doesn't have a value
+			for i := int64(0); i < esz; i++ {
+				data[i] = 0
+			}
+
+			data = data[esz:]
+			off += esz
+			sidx++
+			continue
 		}
 
-		if n != int64(len(buf)) {
-//			fmt.Printf("ABlock.Read: short write: got %d instead of %d\n", n, b.elsize)
-			return 0, errors.New("short write")
+		if err := d.readElement(didx, buf, data[0:esz]); err != nil {
+			return 0, err
 		}
 
-		d.el.xform(buf, data[0:esz])
 		data = data[esz:]
 		off += esz
 		sidx++
@@ -343,60 +616,80 @@ func (b *ABlock) Read(data []byte, offset, base int64) (int64, error) {
 	return n, nil
 }
 
-func (b *ABlock) xform(src, dst []byte) {
+// reads the element of the destination array with the indices didx into
+// buf, and converts it to dst
+func (d *ADest) readElement(didx []int64, buf, dst []byte) error {
+	// base offset for the destination element
+	doff := d.arr.elo.FromIdx(didx, d.arr.dim) * d.arr.elsize
+//	fmt.Printf("ABlock.Read: destination offset %d index: %v data %v\n", doff, didx, dst)
+//	fmt.Printf("ABlock.Read: d.el %v\n", d.el)
+	n, err := d.el.Read(buf, d.arr.offset + doff, d.arr.offset + doff)
+//	fmt.Printf("ABlock.Read: result %d %v\n", n, err)
+	if err != nil {
+		return err
+	}
+
+	if n != int64(len(buf)) {
+//		fmt.Printf("ABlock.Read: short write: got %d instead of %d\n", n, len(buf))
+		return errors.New("short write")
+	}
+
+	return d.el.xform(buf, dst)
+}
+
+func (b *ABlock) xform(src, dst []byte) error {
 	idx := make([]int64, len(b.dim))
-	didx := make([]int64, len(b.dim))
-	elo := b.view.elo
+	elo := b.elo
 	d := b.dests[0]		// single destination
-l1:	for n := int64(0); n < b.elnum; n++ {
+	didx := make([]int64, len(d.expr))
+	for n := int64(0); n < b.elnum; n++ {
+		var err error
+
 		elo.ToIdx(n, idx, b.dim)
-		for i := 0; i < len(idx); i++ {
-			q, r := d.expr[i].calc(idx)
-			if r != 0 {
-				// if there is a remainder, the element doesn't
-				// belong to the destination array
-				continue l1
-			}
+		d.each(idx, didx, func() bool {
+			dn := d.arr.elo.FromIdx(didx, d.arr.dim)
+			soff := n*b.elsize
+			doff := dn*d.arr.elsize
+			err = b.elblk.xform(src[soff:soff + b.elsize], dst[doff:doff+d.arr.elsize])
+			return err != nil
+		})
 
-			didx[i] = q
+		if err != nil {
+			return err
 		}
-
-		dn := d.arr.view.elo.FromIdx(didx, d.arr.dim)
-		soff := n*b.elsize
-		doff := dn*d.arr.elsize
-		b.elblk.xform(src[soff:soff + b.elsize], dst[doff:doff+d.arr.elsize])
 	}
+
+	return nil
 }
 
 func (b *ABlock) replicate(data []byte, offset, base int64) (err error) {
 	// replicate the data to all destinations
 	esz := b.elblk.Size()
 	idx := make([]int64, len(b.dim))
-	didx := make([]int64, len(b.dim))
+	didx := make([][]int64, len(b.dests))
+	for i, d := range b.dests {
+		didx[i] = make([]int64, len(d.expr))
+	}
+
 	off := offset - base
-	elo := b.view.elo
+	elo := b.elo
 	o := off - (off/b.elsize)*b.elsize
 	for int64(len(data)) >= esz {
 		elo.ToIdx(off / b.elsize, idx, b.dim)
 //		fmt.Printf("ABlock.Write: source index: %v\n", idx)
 
-l1:		for _, d := range b.dests {
-			// calculate the indices in the destination array
-			for i := 0; i < len(idx); i++ {
-				q, r := d.expr[i].calc(idx)
-				if r!=0 {
-					// if there is a remainder, the element doesn't
-					// belong to the destination array
-					goto l1
-				}
-
-				didx[i] = q
-			}
+		for i, d := range b.dests {
+			// calculate the indices in the destination array, a
+			// wrapped destination can have the element more
+			// than once
+			d.each(idx, didx[i], func() bool {
+				// base offset for the destination element
+				doff := d.arr.elo.FromIdx(didx[i], d.arr.dim) * d.arr.elsize
+//				fmt.Printf("ABlock.Write: destination offset %d index: %v esz %d data %d %v\n", doff, didx, esz, len(data), data[0:esz])
+				err = d.el.replicate(data[0:esz], d.arr.offset + doff + o, d.arr.offset + doff)
+				return err != nil
+			})
 
-			// base offset for the destination element
-			doff := d.arr.view.elo.FromIdx(didx, d.arr.dim) * d.arr.elsize
-//			fmt.Printf("ABlock.Write: destination offset %d index: %v esz %d data %d %v\n", doff, didx, esz, len(data), data[0:esz])
-			err := d.el.replicate(data[0:esz], d.arr.offset + doff + o, d.arr.offset + doff)
 			if err != nil {
 				return err
 			}
@@ -429,6 +722,18 @@ func (b *ABlock) Write(data []byte, offset, base int64, write, replicate bool) (
 
 	if write && b.view.repl != nil {
 		n, err = b.view.Write(data, offset)
+		if err == nil && hasComputed(b.elblk) {
+			// the computed fields of the elements written
+			end := offset + int64(len(data))
+			for off := base + (offset - base) / b.elsize * b.elsize; off < end && err == nil; off += b.elsize {
+				err = recompute(b.view, b.elblk, off)
+			}
+		}
+
+		if err == nil && b.copies != nil {
+			err = b.writeCopies(offset, base, int64(len(data)))
+		}
+
 		if !replicate || err!=nil {
 //			fmt.Printf("ABlock.Write %p return %d %v\n", b, n, err)
 			return n, err
@@ -442,8 +747,15 @@ func (b *ABlock) Write(data []byte, offset, base int64, write, replicate bool) (
 //	fmt.Printf("ABlock.Write %s:%p return %d\n", b.view.repl.Name, b, n)
 	if !AsyncWrite {
 		err = b.replicate(data, offset, base)
+		if err == nil {
+			err = b.refreshDeps(data, offset, base)
+		}
 	} else {
-		go b.replicate(data, offset, base)
+		go func() {
+			if b.replicate(data, offset, base) == nil {
+				b.refreshDeps(data, offset, base)
+			}
+		}()
 	}
 
 //	fmt.Printf("SBlock.Write %p return %d %v\n", b, len(data), err)
@@ -451,13 +763,19 @@ func (b *ABlock) Write(data []byte, offset, base int64, write, replicate bool) (
 }
 
 // Clones blk1 and connects it to blk2 recursively. Both blk1 and blk2 are destinations of b
-func (b *ABlock) cloneConnect(blk1, blk2 Block, force bool) Block {
+func (b *ABlock) cloneConnect(blk1, blk2 Block, force bool) (Block, error) {
 	b1 := blk1.(*ABlock)
 	b2 := blk2.(*ABlock)
 	nb := new(ABlock)
 	*nb = *b1
 	nb.clonee = b1
 	nb.dests = nil
+	nb.deps = nil
+	nb.rdeps = nil
+	nb.copies = nil
+	if nb.recs != nil {
+		nb.recs.add(nb)
+	}
 //	fmt.Printf("ABlock.CloneConnect b %p b1 %p b2 %p nb %p force %v\n", b, b1, b2, nb, force)
 
 	if b2.view.readonly {
@@ -465,7 +783,10 @@ func (b *ABlock) cloneConnect(blk1, blk2 Block, force bool) Block {
 	}
 
 	// recursively connect the array elements
-	el := b.elblk.cloneConnect(b1.elblk, b2.elblk, force)
+	el, err := b.elblk.cloneConnect(b1.elblk, b2.elblk, force)
+	if err != nil {
+		return nil, err
+	}
 
 	// find destinations b1 and b2 belong to
 	var d1, d2 *ADest
@@ -478,35 +799,41 @@ func (b *ABlock) cloneConnect(blk1, blk2 Block, force bool) Block {
 	}
 
 	// calculate the conversion expression
-	ae := make([]PExpr, len(d1.expr))
-	for n := 0; n < len(d1.expr); n++ {
-		e1 := &ae[n]
-		d1 := &d1.expr[n]
-		d2 := &d2.expr[n]
-
-		e1.A = d1.D*d2.A - d1.B*d2.C
-		e1.B = d1.D*d2.B - d1.B*d2.D
-		e1.C = d1.A*d2.C - d1.C*d2.A
-		e1.D = d1.A*d2.D - d1.C*d2.B
+	c, err := composeExpr(d1.expr, d2.expr, b1.nvar(), b2.dim)
+	if err != nil {
+		return nil, err
 	}
 
 //	fmt.Printf("ABlock.CloneConnect b2.view.repl %p\n", b2.view.repl)
 	if b2.view.repl!=nil || force {
-		nb.AddDestination(b2, el, ae)
+		nb.addDestination(b2, el, c)
 	}
 
 	if nb.view.repl==nil && b2.view == nb.view.dflt {
 //		fmt.Printf("ABlock.CloneConnect: %p source for %p\n", b2, nb)
-		nb2 := b.cloneConnect(b2, nb, true).(*ABlock)
-		nb.AddSource(nb2, el, ae)
+		nb2, err := b.cloneConnect(b2, nb, true)
+		if err != nil {
+			return nil, err
+		}
+
+		nb.addSource(nb2.(*ABlock), el, c)
 	}
 
-	return nb
+	return nb, nil
 }
 
-func (b *ABlock) ConnectDestinations() {
+func (b *ABlock) ConnectDestinations() error {
 //	fmt.Printf("ABlock.ConnectDestinations %p\n", b)
 
+	b.connectGathers()
+	if err := b.connectReductions(); err != nil {
+		return err
+	}
+
+	if err := b.connectCopies(); err != nil {
+		return err
+	}
+
 	for i, ad1 := range b.dests {
 		v1 := ad1.arr.view
 
@@ -514,59 +841,483 @@ func (b *ABlock) ConnectDestinations() {
 			ad2 := b.dests[j]
 			v2 := ad2.arr.view
 
-			// calculate the conversion expression
-			ae1 := make([]PExpr, len(ad1.expr))
-			ae2 := make([]PExpr, len(ad1.expr))
-			for n := 0; n < len(ad1.expr); n++ {
-				e1 := &ae1[n]
-				e2 := &ae2[n]
-				d1 := &ad1.expr[n]
-				d2 := &ad2.expr[n]
-				
-				e1.A = d1.D*d2.A - d1.B*d2.C
-				e1.B = d1.D*d2.B - d1.B*d2.D
-				e1.C = d1.A*d2.C - d1.C*d2.A
-				e1.D = d1.A*d2.D - d1.C*d2.B
-				e2.A = -e1.D
-				e2.B = e1.B
-				e2.C = e1.C
-				e2.D = -e1.A
+			// calculate the conversion expressions
+			c1, err := composeExpr(ad1.expr, ad2.expr, ad1.arr.nvar(), ad2.arr.vardim())
+			if err != nil {
+				return err
+			}
+
+			c2, err := composeExpr(ad2.expr, ad1.expr, ad2.arr.nvar(), ad1.arr.vardim())
+			if err != nil {
+				return err
 			}
 
 //			fmt.Printf("ABlock.ConnectDestinations ad2.arr.view.repl %p\n", ad2.arr.view.repl)
-			if v2.repl!=nil && !v1.IsReadonly() {
-				el1 := b.elblk.cloneConnect(ad1.arr.elblk, ad2.arr.elblk, false)
-				ad1.arr.AddDestination(ad2.arr, el1, ae1)
+			if v2.repl!=nil && !v1.IsReadonly() && ad2.arr.gather == nil && ad2.arr.red == nil {
+				el1, err := b.elblk.cloneConnect(ad1.arr.elblk, ad2.arr.elblk, false)
+				if err != nil {
+					return err
+				}
+
+				ad1.arr.addDestination(ad2.arr, el1, c1)
 			} else if v2.dflt == v1 {
 //				fmt.Printf("ABlock.ConnectDestinations %p source for %p\n", ad1.arr, ad2.arr)
-				na1 := ad1.arr
-				nel1 := ad1.arr.elblk
-
-				if !v2.IsReadonly() {
-					nel1 = b.elblk.cloneConnect(ad1.arr.elblk, ad2.arr.elblk, true)
-					na1 = b.cloneConnect(ad1.arr, ad2.arr, true).(*ABlock)
+				na1, nel1, err := b.sourceConnect(ad1.arr, ad2.arr)
+				if err != nil {
+					return err
 				}
 
-				ad2.arr.AddSource(na1, nel1, ae1)
+				ad2.arr.addSource(na1, nel1, c2)
 			}
 
 //			fmt.Printf("ABlock.ConnectDestinations ad1.arr.view.repl %p\n", ad1.arr.view.repl)
-			if v1.repl!=nil && !v2.IsReadonly() {
-				el2 := b.elblk.cloneConnect(ad2.arr.elblk, ad1.arr.elblk, false)
-				ad2.arr.AddDestination(ad1.arr, el2, ae2)
+			if v1.repl!=nil && !v2.IsReadonly() && ad1.arr.gather == nil && ad1.arr.red == nil {
+				el2, err := b.elblk.cloneConnect(ad2.arr.elblk, ad1.arr.elblk, false)
+				if err != nil {
+					return err
+				}
+
+				ad2.arr.addDestination(ad1.arr, el2, c2)
 			} else if v1.dflt == v2 {
 //				fmt.Printf("ABlock.ConnectDestinations %p source for %p\n", ad2.arr, ad1.arr)
-				nel2 := ad2.arr.elblk
-				na2 := ad2.arr
+				na2, nel2, err := b.sourceConnect(ad2.arr, ad1.arr)
+				if err != nil {
+					return err
+				}
+
+				ad1.arr.addSource(na2, nel2, c1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the array the unmaterialized array dst reads from, and the
+// block of its elements. Unless dst is readonly, src is cloned so the
+// elements are written back through it, otherwise the elements are only
+// converted when read. Both src and dst are destinations of b.
+func (b *ABlock) sourceConnect(src, dst *ABlock) (*ABlock, Block, error) {
+	if dst.view.IsReadonly() {
+		el, err := readConnect(b.elblk, src.elblk, dst.elblk)
+		return src, el, err
+	}
+
+	el, err := b.elblk.cloneConnect(src.elblk, dst.elblk, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	na, err := b.cloneConnect(src, dst, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return na.(*ABlock), el, nil
+}
+
+// Finds the materialized arrays of the dataset array b that wrap, and can
+// have an element more than once, and makes them write all the copies of
+// the elements written to them.
+func (b *ABlock) connectCopies() error {
+	for _, d := range b.dests {
+		a := d.arr
+		if a.view.repl == nil || a.view.IsReadonly() || !wraps(d.expr) {
+			continue
+		}
 
-				if !v1.IsReadonly() {
-					nel2 = b.elblk.cloneConnect(ad2.arr.elblk, ad1.arr.elblk, true)
-					na2 = b.cloneConnect(ad2.arr, ad1.arr, true).(*ABlock)
+		c, err := composeExpr(d.expr, d.expr, a.nvar(), a.dim)
+		if err != nil {
+			return err
+		}
+
+		c.arr = a
+		a.copies = &c
+	}
+
+	return nil
+}
+
+// true if some of the expressions wrap
+func wraps(es []PExpr) bool {
+	for _, e := range es {
+		if e.M != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Writes the elements of the array written at offset to their other
+// copies in the array
+func (b *ABlock) writeCopies(offset, base, count int64) error {
+	var err error
+
+	idx := make([]int64, len(b.dim))
+	cidx := make([]int64, len(b.copies.expr))
+	buf := make([]byte, b.elsize)
+	last := (offset - base + count - 1) / b.elsize
+	for n := (offset - base) / b.elsize; n <= last && n < b.elnum; n++ {
+		if _, err = b.view.Read(buf, base + n*b.elsize); err != nil {
+			return err
+		}
+
+		b.elo.ToIdx(n, idx, b.dim)
+		b.copies.each(idx, cidx, func() bool {
+			if m := b.elo.FromIdx(cidx, b.dim); m != n {
+				_, err = b.view.Write(buf, base + m*b.elsize)
+			}
+
+			return err != nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Clones blk1 so its data is converted to the layout of blk2 when read.
+// Both blk1 and blk2 are destinations of b. Unlike cloneConnect, nothing
+// is written through the clone, blk2 belongs to a readonly view.
+func readConnect(b, blk1, blk2 Block) (Block, error) {
+	var err error
+
+	switch b := b.(type) {
+	case *SBlock:
+		b1 := blk1.(*SBlock)
+		nb := new(SBlock)
+		*nb = *b1
+		nb.clonee = b1
+		nb.dests = nil
+		nb.AddDestination(blk2.(*SBlock))
+		return nb, nil
+
+	case *ABlock:
+		var d1, d2 *ADest
+
+		b1 := blk1.(*ABlock)
+		b2 := blk2.(*ABlock)
+		for _, d := range b.dests {
+			if d.arr == b1 {
+				d1 = d
+			} else if d.arr == b2 {
+				d2 = d
+			}
+		}
+
+		nb := new(ABlock)
+		*nb = *b1
+		nb.clonee = b1
+		nb.dests = nil
+		if nb.elblk, err = readConnect(b.elblk, b1.elblk, b2.elblk); err != nil {
+			return nil, err
+		}
+
+		c, err := composeExpr(d1.expr, d2.expr, b1.nvar(), b2.dim)
+		if err != nil {
+			return nil, err
+		}
+
+		nb.addDestination(b2, nb.elblk, c)
+		return nb, nil
+
+	case *TBlock:
+		b1 := blk1.(*TBlock)
+		b2 := blk2.(*TBlock)
+		nb := new(TBlock)
+		*nb = *b1
+		nb.clonee = b1
+		nb.dests = nil
+		nb.bs.blks = make([]Block, len(b1.bs.blks))
+		copy(nb.bs.blks, b1.bs.blks)
+		for i, bb1 := range b1.bs.blks {
+			var bb, bb2 Block
+
+			for _, tb := range b.bs.blks {
+				if tb.isDest(bb1) {
+					bb = tb
+					break
+				}
+			}
+
+			for _, tb := range b2.bs.blks {
+				if bb != nil && bb.isDest(tb) {
+					bb2 = tb
+					break
 				}
+			}
 
-				ad1.arr.AddSource(na2, nel2, ae2)
+			if bb2 != nil {
+				if nb.bs.blks[i], err = readConnect(bb, bb1, bb2); err != nil {
+					return nil, err
+				}
 			}
 		}
+
+		nb.AddDestination(b2)
+		return nb, nil
+	}
+
+	return blk1, nil
+}
+
+// Calculates the expressions that convert the indices of the array
+// described by e1 into the indices of the array described by e2, with
+// dimensions dim. Both e1 and e2 calculate the indices of the same
+// (dataset) array from the indices of their arrays, one expression per
+// dimension, e1 uses nvar variables. The dimensions of the arrays don't
+// need to be in the same order, or even be the same number. The result
+// has one expression per dimension of the e2 array. The dimensions of the
+// dataset array that aren't needed to find the e2 indices become
+// conditions, the element belongs to the e2 array only if all of them are
+// zero.
+//
+// The dimensions that e1 wraps are variables calculated from the e1
+// indices. An element is in the e2 array at all the indices that wrap to
+// it, the number of periods of each dimension that e2 wraps is a variable
+// too, with the range that can give an index within the e2 array. The e2
+// indices that can't be calculated from the dataset indices are
+// variables going through the whole dimension, the conditions select the
+// ones the element belongs to. The element is at all the values of the
+// indices that e2 doesn't use. The result has to be linear in the
+// variables, an error is returned if it isn't.
+func composeExpr(e1, e2 []PExpr, nvar int, dim []int64) (c ADest, err error) {
+	n := len(dim)
+	for _, e := range e1 {
+		if e.Xidx >= nvar {
+			nvar = e.Xidx + 1
+		}
+
+		for _, t := range e.Terms {
+			if t.Xidx >= nvar {
+				nvar = t.Xidx + 1
+			}
+		}
+	}
+
+	nall := nvar
+	for _, e := range e1 {
+		if e.M != 0 {
+			nall++
+		}
+	}
+
+	// e2 without wrapping
+	e := make([]PExpr, len(e2))
+	copy(e, e2)
+	for m := range e {
+		e[m].M = 0
+	}
+
+	free := freeIndices(e, dim)
+	nwrap := nall
+	for m := range e2 {
+		if e2[m].M != 0 {
+			nall++
+		}
+	}
+
+	for _, f := range free {
+		if f {
+			nall++
+		}
+	}
+
+	// the dataset indices from the e1 indices
+	x := make([]frac, nvar)
+	for i := range x {
+		x[i] = varFrac(nall, i)
+	}
+
+	u := make([]frac, len(e1))
+	for m := range e1 {
+		if e1[m].M != 0 {
+			u[m] = varFrac(nall, nvar + len(c.wrap))
+			c.wrap = append(c.wrap, e1[m])
+		} else {
+			if u[m], err = e1[m].subst(x, nall); err != nil {
+				return
+			}
+		}
+	}
+
+	// the dataset index of the wrapped dimensions plus the periods
+	for m := range e2 {
+		if e2[m].M == 0 {
+			continue
+		}
+
+		min, max := e[m].span(dim)
+		p := PPeriod{M: e2[m].M}
+		if p.Expr, err = u[m].pexpr(); err != nil {
+			return
+		}
+
+		p.Min = -floorDiv(p.M - 1 - min, p.M)
+		p.Max = floorDiv(max, p.M)
+		if u[m], err = u[m].add(varFrac(nall, nwrap + len(c.period)).scale(p.M)); err != nil {
+			return
+		}
+
+		c.period = append(c.period, p)
+	}
+
+	// the enumerated indices are variables, the ones no dimension
+	// depends on are always 0
+	y := make([]frac, n)
+	for i := range y {
+		if free[i] {
+			y[i] = varFrac(nall, nwrap + len(c.period))
+			c.period = append(c.period, PPeriod{Min: 0, Max: dim[i] - 1})
+		} else {
+			y[i] = frac{constForm(nall, 0), constForm(nall, 1)}
+		}
+	}
+
+	steps, used, _ := elimination(e, n, free)
+	for _, st := range steps {
+		m, k := st[0], st[1]
+		if y[k], err = e[m].solve(k, u[m], y); err != nil {
+			return
+		}
+	}
+
+	c.expr = make([]PExpr, n)
+	for i := range y {
+		if c.expr[i], err = y[i].pexpr(); err != nil {
+			return
+		}
+	}
+
+	for m := range e {
+		if !used[m] {
+			var cc frac
+			var p PExpr
+
+			if cc, err = e[m].subst(y, nall); err != nil {
+				return
+			}
+
+			if cc, err = cc.add(u[m].scale(-1)); err != nil {
+				return
+			}
+
+			if p, err = cc.pexpr(); err != nil {
+				return
+			}
+
+			c.cond = append(c.cond, p)
+		}
+	}
+
+	return
+}
+
+// Finds the order in which the n indices of an array can be calculated
+// from the indices of the dataset array, using the expressions e that
+// calculate the latter. Each step is a dimension of the dataset array and
+// the index it gives, the dimension uses only one index that isn't known
+// yet. The indices that are true in known (can be nil) are known from
+// the start. used is true for the dimensions in steps, ok is false if
+// some index used by e can't be calculated.
+func elimination(e []PExpr, n int, known []bool) (steps [][2]int, used []bool, ok bool) {
+	solved := make([]bool, n)
+	copy(solved, known)
+	used = make([]bool, len(e))
+	for found := true; found; {
+		found = false
+		for m := range e {
+			k := -1
+			for i := 0; i < n && !used[m]; i++ {
+				if solved[i] || !e[m].uses(i) {
+					continue
+				}
+
+				if k >= 0 {
+					k = -1
+					break
+				}
+
+				k = i
+			}
+
+			if k < 0 {
+				continue
+			}
+
+			steps = append(steps, [2]int{m, k})
+			solved[k] = true
+			used[m] = true
+			found = true
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		for m := range e {
+			if !solved[i] && e[m].uses(i) {
+				return steps, used, false
+			}
+		}
+	}
+
+	return steps, used, true
+}
+
+// Returns true if the indices of the n-dimensional array can be
+// calculated from the indices of the dataset array, the expressions e
+// calculate the latter.
+func Invertible(e []PExpr, n int) bool {
+	_, _, ok := elimination(e, n, nil)
+	return ok
+}
+
+// Returns the indices of the array with dimensions dim that have to be
+// enumerated so the others can be calculated from the dataset indices
+// with e. The smallest dimensions are enumerated first. The indices that
+// e doesn't use have all their values.
+func freeIndices(e []PExpr, dim []int64) []bool {
+	n := len(dim)
+	free := make([]bool, n)
+	for i := 0; i < n; i++ {
+		free[i] = dim[i] > 1
+		for m := range e {
+			if e[m].uses(i) {
+				free[i] = false
+			}
+		}
+	}
+
+	for {
+		steps, used, ok := elimination(e, n, free)
+		if ok {
+			return free
+		}
+
+		solved := make([]bool, n)
+		copy(solved, free)
+		for _, st := range steps {
+			solved[st[1]] = true
+		}
+
+		k := -1
+		for i := 0; i < n; i++ {
+			if solved[i] || (k >= 0 && dim[i] >= dim[k]) {
+				continue
+			}
+
+			for m := range e {
+				if !used[m] && e[m].uses(i) {
+					k = i
+					break
+				}
+			}
+		}
+
+		free[k] = true
 	}
 }
 
@@ -626,36 +1377,53 @@ func (b *TBlock) Read(buf []byte, offset, base int64) (int64, error) {
 		return 0, errors.New("short read")
 	}
 
-	b.xform(sbuf, dbuf)
+	if err := sb.xform(sbuf, dbuf); err != nil {
+		return 0, err
+	}
+
 	return int64(copy(buf, dbuf[offset - base:])), nil
 }
 
-func (b *TBlock) xform(src, dst []byte) {
+func (b *TBlock) xform(src, dst []byte) error {
 //	fmt.Printf("TBlock.xform b %p\n", b)
-	n := int64(0)
 	db := b.dests[0]
 	for _, bb := range b.bs.blks {
-		m := int64(0)
+		n := bb.Offset()
 
 		// ugly, but will do for now
 		for _, dbb := range db.bs.blks {
 			if bb.isDest(dbb) {
-		       	bb.xform(src[n:n+bb.Size()], dst[m:m+dbb.Size()])
+				m := dbb.Offset()
+				if err := bb.xform(src[n:n+bb.Size()], dst[m:m+dbb.Size()]); err != nil {
+					return err
+				}
+
 				break
 			}
-
-			m += dbb.Size()
 		}
-
-		n += bb.Size()
 	}
+
+	return db.compute(dst)
 }
 
 func (b *TBlock) replicate(data []byte, offset, base int64) (err error) {
 //	eoffset := offset + int64(len(buf))
+	start := offset
 	count := int64(0)
 //	fmt.Printf("TBlock.Write %s:%p offset %d count %d\n", b.view.repl.Name, b, offset, len(b))
 	for _, bb := range b.bs.blks {
+		// skip the padding before the field
+		if pad := bb.Offset() - count; pad > 0 {
+			if int64(len(data)) <= pad {
+				break
+			}
+
+			offset += pad
+			base += pad
+			count += pad
+			data = data[pad:]
+		}
+
 		err := bb.replicate(data[0:bb.Size()], offset, base)
 		if err != nil {
 			return err
@@ -672,6 +1440,15 @@ func (b *TBlock) replicate(data []byte, offset, base int64) (err error) {
 		}
 	}
 
+	// the fields the destinations calculate from the ones written
+	for _, d := range b.dests {
+		if d.view.repl != nil && hasComputed(d) {
+			if err := recompute(d.view, d, start); err != nil {
+				return err
+			}
+		}
+	}
+
 //	fmt.Printf("TBlock.Write %p exit %d\n", b, count)
 	return nil
 }
@@ -680,6 +1457,10 @@ func (b *TBlock) Write(buf []byte, offset, base int64, write, replicate bool) (n
 //	fmt.Printf("TBlock.Write %p offset %d count %d\n", b, offset, len(buf))
 	if write && b.view.repl != nil {
 		n, err = b.view.Write(buf, offset)
+		if err == nil && hasComputed(b) {
+			err = recompute(b.view, b, base)
+		}
+
 		if !replicate || err != nil {
 //			fmt.Printf("TBlock.Write %p return %d %v\n", b, n, err)
 			return n, err
@@ -721,7 +1502,7 @@ func (b *TBlock) Clone() Block {
 */
 
 // Clones blk1 and connects it to blk2 recursively. Both blk1 and blk2 are destinations of b
-func (b *TBlock) cloneConnect(blk1, blk2 Block, force bool) Block {
+func (b *TBlock) cloneConnect(blk1, blk2 Block, force bool) (Block, error) {
 	b1 := blk1.(*TBlock)
 	b2 := blk2.(*TBlock)
 	nb := new(TBlock)
@@ -757,6 +1538,11 @@ func (b *TBlock) cloneConnect(blk1, blk2 Block, force bool) Block {
 			}
 		}
 
+		if bb==nil && b1.isComputed(bb1) {
+			// no source in the dataset
+			continue
+		}
+
 		if bb==nil {
 			panic("can't find bb")
 		}
@@ -775,7 +1561,11 @@ func (b *TBlock) cloneConnect(blk1, blk2 Block, force bool) Block {
 		}
 
 		connected = true
-		nbb1 := bb.cloneConnect(bb1, bb2, force)
+		nbb1, err := bb.cloneConnect(bb1, bb2, force)
+		if err != nil {
+			return nil, err
+		}
+
 		nb.bs.blks[i] = nbb1
 	}
 
@@ -786,21 +1576,27 @@ func (b *TBlock) cloneConnect(blk1, blk2 Block, force bool) Block {
 
 		if nb.view.repl == nil && nb.view.dflt == b2.view {
 //			fmt.Printf("TBlock.CloneConnect %p source for %p\n", b2, nb)
-			nb2 := b.cloneConnect(b2, nb, true).(*TBlock)
-			nb.AddSource(nb2)
+			nb2, err := b.cloneConnect(b2, nb, true)
+			if err != nil {
+				return nil, err
+			}
+
+			nb.AddSource(nb2.(*TBlock))
 		}
 	}
 
 //	fmt.Printf("TBlock.CloneConnect nb.blks %v b1.blks %v exit\n", nb.bs.blks, b1.bs.blks)
 //	fmt.Printf("TBlock.cloneConnect blks after %v\n", nb.bs.blks)
-	return nb
+	return nb, nil
 }
 
-func (b *TBlock) ConnectDestinations() {
+func (b *TBlock) ConnectDestinations() error {
 //	fmt.Printf("TBlock.ConnectDestinations %p\n", b)
 
 	for _, bb := range b.bs.blks {
-		bb.ConnectDestinations()
+		if err := bb.ConnectDestinations(); err != nil {
+			return err
+		}
 	}
 
 	for i, d1 := range b.dests {
@@ -816,7 +1612,12 @@ func (b *TBlock) ConnectDestinations() {
 				d1.AddDestination(d2)
 			} else if d2.view.dflt == d1.view {
 //				fmt.Printf("TBlock.ConnectDestinations %p source for %p\n", d1, d2)
-				d2.AddSource(d1)
+				src, err := b.sourceConnect(d1, d2)
+				if err != nil {
+					return err
+				}
+
+				d2.AddSource(src)
 			}
 
 			if v1.repl!=nil && !v2.IsReadonly() {
@@ -824,10 +1625,37 @@ func (b *TBlock) ConnectDestinations() {
 				d2.AddDestination(d1)
 			} else if d1.view.dflt == d2.view {
 //				fmt.Printf("TBlock.ConnectDestinations %p source for %p\n", d2, d1)
-				d1.AddSource(d2)
+				src, err := b.sourceConnect(d2, d1)
+				if err != nil {
+					return err
+				}
+
+				d1.AddSource(src)
 			}
 		}
 	}
+
+	return nil
+}
+
+// Returns the clone of src the unmaterialized block dst reads from, its
+// only destination is dst so the elements can be converted to the layout
+// of dst. Both src and dst are destinations of b.
+func (b *TBlock) sourceConnect(src, dst *TBlock) (*TBlock, error) {
+	var nb Block
+	var err error
+
+	if dst.view.IsReadonly() {
+		nb, err = readConnect(b, src, dst)
+	} else {
+		nb, err = b.cloneConnect(src, dst, true)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nb.(*TBlock), nil
 }
 
 func (b *TBlock) String() string {
@@ -840,7 +1668,7 @@ func (b *TBlock) String() string {
 }
 
 func (d *ADest) String() string {
-	return fmt.Sprintf("(pexpr %v arr %s:%d el <%v>)", d.expr, d.arr.view.repl.Name, d.arr.offset, d.el)
+	return fmt.Sprintf("(pexpr %v cond %v arr %s:%d el <%v>)", d.expr, d.cond, d.arr.view.repl.Name, d.arr.offset, d.el)
 }
 
 // returns slice with all blocks that describe data in the specified interval
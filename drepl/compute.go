@@ -0,0 +1,154 @@
+package drepl
+
+import (
+	"fmt"
+)
+
+// Field of a structure whose value isn't read from the dataset, but
+// calculated from the other fields of the same element when the element
+// is converted to the view's layout.
+type Computed struct {
+	blk	*SBlock		// the field, it has no source
+	value	func(el []byte) (interface{}, error)
+}
+
+// Makes blk, one of the fields of the structure, a computed field. value
+// is called with the converted element, without the computed fields, and
+// returns the value of the field as int64 or float64. The computed fields
+// can't be written, the values written to them are replaced with the
+// calculated ones.
+func (b *TBlock) AddComputed(blk *SBlock, value func(el []byte) (interface{}, error)) {
+	b.comp = append(b.comp, &Computed{blk: blk, value: value})
+}
+
+func (b *TBlock) Computed() []*Computed {
+	return b.comp
+}
+
+// Returns true if the view has structures with computed fields
+func (v *View) Computed() bool {
+	for _, b := range v.bs.blks {
+		if hasComputed(b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasComputed(b Block) bool {
+	switch b := b.(type) {
+	case *ABlock:
+		return hasComputed(b.elblk)
+
+	case *TBlock:
+		if b.comp != nil {
+			return true
+		}
+
+		for _, bb := range b.bs.blks {
+			if hasComputed(bb) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// returns true if blk is one of the computed fields of the structure
+func (b *TBlock) isComputed(blk Block) bool {
+	for _, c := range b.comp {
+		if c.blk == blk {
+			return true
+		}
+	}
+
+	return false
+}
+
+// calculates the computed fields of the element el
+func (b *TBlock) compute(el []byte) error {
+	for _, c := range b.comp {
+		val, err := c.value(el)
+		if err != nil {
+			return err
+		}
+
+		sb := c.blk
+		if err := sb.SetValue(el[sb.offset:sb.offset + sb.size], val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// calculates the computed fields of the element el described by b,
+// including the ones of the nested structures
+func computeAll(b Block, el []byte) error {
+	switch b := b.(type) {
+	case *ABlock:
+		if !hasComputed(b.elblk) {
+			return nil
+		}
+
+		for off := int64(0); off + b.elsize <= int64(len(el)); off += b.elsize {
+			if err := computeAll(b.elblk, el[off:off + b.elsize]); err != nil {
+				return err
+			}
+		}
+
+	case *TBlock:
+		for _, bb := range b.bs.blks {
+			off := bb.Offset()
+			if err := computeAll(bb, el[off:off + bb.Size()]); err != nil {
+				return err
+			}
+		}
+
+		return b.compute(el)
+	}
+
+	return nil
+}
+
+// Calculates the computed fields of the element described by b at the
+// offset off of the materialized view v, after the other fields changed
+func recompute(v *View, b Block, off int64) error {
+	el := make([]byte, b.Size())
+	if _, err := v.Read(el, off); err != nil {
+		return err
+	}
+
+	if err := computeAll(b, el); err != nil {
+		return err
+	}
+
+	_, err := v.Write(el, off)
+	return err
+}
+
+// Stores the number val (int64, uint64 or float64) in data described by
+// the block, converted with the conversion policy of the block's view
+func (b *SBlock) SetValue(data []byte, val interface{}) error {
+	if b.ntype == NoType {
+		return fmt.Errorf("value %v isn't a number", val)
+	}
+
+	policy := ConvSaturate
+	if b.view != nil {
+		policy = b.view.conv
+	}
+
+	switch v := val.(type) {
+	case int64:
+		return putInt(b, data, v, policy)
+	case uint64:
+		return putFloat(b, data, float64(v), policy)
+	case float64:
+		return putFloat(b, data, v, policy)
+	}
+
+	return fmt.Errorf("value %v isn't a number", val)
+}
@@ -0,0 +1,69 @@
+package drepl
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// structure { x float64; y int32; c } where c is computed by value
+func computedBlock(ctype int, value func(el []byte) (interface{}, error)) (*TBlock, *SBlock) {
+	v := NewView("v", RowMajorOrder, false)
+	bs := v.NewBlockSeq()
+	fbs := v.NewBlockSeq()
+	x := fbs.NewSBlock(8)
+	x.SetEndian(LittleEndian)
+	x.SetType(Float64)
+	y := fbs.NewSBlock(4)
+	y.SetEndian(LittleEndian)
+	y.SetType(Int32)
+	c := fbs.NewSBlock(typeSize[ctype])
+	c.SetEndian(LittleEndian)
+	c.SetType(ctype)
+	fbs.Pad(24 - fbs.Size())
+	tb := bs.NewTBlock(fbs)
+	tb.AddComputed(c, value)
+	return tb, c
+}
+
+func TestCompute(t *testing.T) {
+	x := func(el []byte) float64 { return getFloat(&SBlock{size: 8, endian: LittleEndian, ntype: Float64}, el[0:8]) }
+	y := func(el []byte) int64 { return getInt(&SBlock{size: 4, endian: LittleEndian, ntype: Int32}, el[8:12]) }
+	tests := []struct {
+		ctype	int
+		x	float64
+		y	int64
+		value	func(el []byte) (interface{}, error)
+		want	float64
+	}{
+		{Float64, 3, 2, func(el []byte) (interface{}, error) { return x(el) / float64(y(el)), nil }, 1.5},
+		{Float64, 3, 0, func(el []byte) (interface{}, error) { return x(el) / float64(y(el)), nil }, math.Inf(1)},
+		{Float32, 3, 2, func(el []byte) (interface{}, error) { return x(el) * float64(y(el)), nil }, 6},
+		{Int32, 7, 2, func(el []byte) (interface{}, error) { return int64(x(el)) / y(el), nil }, 3},
+
+		// the value is stored with the view's conversion policy
+		{Int16, 1e6, 1, func(el []byte) (interface{}, error) { return x(el), nil }, math.MaxInt16},
+		{Int32, 2.6, 1, func(el []byte) (interface{}, error) { return x(el), nil }, 3},
+	}
+
+	for _, test := range tests {
+		tb, c := computedBlock(test.ctype, test.value)
+		el := make([]byte, tb.Size())
+		setFloat(&SBlock{size: 8, endian: LittleEndian, ntype: Float64}, el[0:8], test.x)
+		setInt(&SBlock{size: 4, endian: LittleEndian, ntype: Int32}, el[8:12], test.y)
+		if err := computeAll(tb, el); err != nil {
+			t.Errorf("%v, %v: %v", test.x, test.y, err)
+			continue
+		}
+
+		if got := convValue(c, el[c.offset:c.offset + c.size]); got != test.want {
+			t.Errorf("%v, %v: got %v, expecting %v", test.x, test.y, got, test.want)
+		}
+	}
+
+	// the errors of the calculation fail the conversion of the element
+	tb, _ := computedBlock(Int32, func(el []byte) (interface{}, error) { return nil, errors.New("division by zero") })
+	if err := computeAll(tb, make([]byte, tb.Size())); err == nil || err.Error() != "division by zero" {
+		t.Errorf("got error %v, expecting division by zero", err)
+	}
+}
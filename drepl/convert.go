@@ -0,0 +1,222 @@
+package drepl
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// numeric type of the value described by a SBlock
+const (
+	NoType = iota		// raw bytes, never converted
+	Int8
+	Int16
+	Int32
+	Int64
+	Float32
+	Float64
+)
+
+// policy for values that can't be represented exactly in the destination type
+const (
+	ConvSaturate = iota	// clamp to the destination range, round floats to the nearest integer
+	ConvWrap		// same as a C cast, integers are truncated
+	ConvExact		// fail if the value changes
+)
+
+var errInexact = errors.New("value not representable in the destination type")
+
+var intRange = [...]struct{min, max int64} {
+	Int8:	{math.MinInt8, math.MaxInt8},
+	Int16:	{math.MinInt16, math.MaxInt16},
+	Int32:	{math.MinInt32, math.MaxInt32},
+	Int64:	{math.MinInt64, math.MaxInt64},
+}
+
+// returns true if the value needs to be converted (or byte-swapped) when
+// copied between the two blocks
+func converted(b1, b2 *SBlock) bool {
+	if b1.ntype == NoType || b2.ntype == NoType || b1.ntype == b2.ntype {
+		return swapped(b1, b2)
+	}
+
+	return true
+}
+
+func byteOrderOf(b *SBlock) binary.ByteOrder {
+	if byteOrder(b.endian) == BigEndian {
+		return binary.BigEndian
+	}
+
+	return binary.LittleEndian
+}
+
+func isFloat(ntype int) bool {
+	return ntype == Float32 || ntype == Float64
+}
+
+// converts the values in src described by sb to the values in dst
+// described by db, using the conversion policy of the destination view
+func convert(sb, db *SBlock, src, dst []byte) error {
+	if !converted(sb, db) {
+		copy(dst, src)
+		return nil
+	}
+
+	if sb.ntype == db.ntype || sb.ntype == NoType || db.ntype == NoType {
+		copy(dst, src)
+		byteSwap(dst, db.size)
+		return nil
+	}
+
+	policy := ConvSaturate
+	if db.view != nil {
+		policy = db.view.conv
+	}
+
+	for n, m := int64(0), int64(0); n + sb.size <= int64(len(src)) && m + db.size <= int64(len(dst)); n, m = n + sb.size, m + db.size {
+		var err error
+
+		if isFloat(sb.ntype) {
+			err = putFloat(db, dst[m:m+db.size], getFloat(sb, src[n:n+sb.size]), policy)
+		} else {
+			err = putInt(db, dst[m:m+db.size], getInt(sb, src[n:n+sb.size]), policy)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getInt(b *SBlock, data []byte) int64 {
+	bo := byteOrderOf(b)
+	switch b.ntype {
+	case Int8:
+		return int64(int8(data[0]))
+	case Int16:
+		return int64(int16(bo.Uint16(data)))
+	case Int32:
+		return int64(int32(bo.Uint32(data)))
+	}
+
+	return int64(bo.Uint64(data))
+}
+
+func getFloat(b *SBlock, data []byte) float64 {
+	bo := byteOrderOf(b)
+	if b.ntype == Float32 {
+		return float64(math.Float32frombits(bo.Uint32(data)))
+	}
+
+	return math.Float64frombits(bo.Uint64(data))
+}
+
+func setInt(b *SBlock, data []byte, v int64) {
+	bo := byteOrderOf(b)
+	switch b.ntype {
+	case Int8:
+		data[0] = byte(v)
+	case Int16:
+		bo.PutUint16(data, uint16(v))
+	case Int32:
+		bo.PutUint32(data, uint32(v))
+	default:
+		bo.PutUint64(data, uint64(v))
+	}
+}
+
+func setFloat(b *SBlock, data []byte, v float64) {
+	bo := byteOrderOf(b)
+	if b.ntype == Float32 {
+		bo.PutUint32(data, math.Float32bits(float32(v)))
+	} else {
+		bo.PutUint64(data, math.Float64bits(v))
+	}
+}
+
+func putInt(b *SBlock, data []byte, v int64, policy int) error {
+	if isFloat(b.ntype) {
+		f := float64(v)
+		if b.ntype == Float32 {
+			f = float64(float32(v))
+		}
+
+		if policy == ConvExact && (f >= math.MaxInt64 || int64(f) != v) {
+			return errInexact
+		}
+
+		setFloat(b, data, f)
+		return nil
+	}
+
+	r := intRange[b.ntype]
+	if v < r.min || v > r.max {
+		switch policy {
+		case ConvExact:
+			return errInexact
+		case ConvSaturate:
+			if v < r.min {
+				v = r.min
+			} else {
+				v = r.max
+			}
+		}
+	}
+
+	setInt(b, data, v)
+	return nil
+}
+
+func putFloat(b *SBlock, data []byte, f float64, policy int) error {
+	if b.ntype == Float32 {
+		f32 := float32(f)
+		switch {
+		case policy == ConvExact && !math.IsNaN(f) && float64(f32) != f:
+			return errInexact
+		case policy == ConvSaturate && math.IsInf(float64(f32), 0) && !math.IsInf(f, 0):
+			f32 = float32(math.Copysign(math.MaxFloat32, f))
+		}
+
+		setFloat(b, data, float64(f32))
+		return nil
+	} else if b.ntype == Float64 {
+		setFloat(b, data, f)
+		return nil
+	}
+
+	// float to integer
+	r := intRange[b.ntype]
+	switch policy {
+	case ConvExact:
+		if math.IsNaN(f) || f != math.Trunc(f) || f < float64(r.min) || f >= -float64(r.min) {
+			return errInexact
+		}
+
+	case ConvSaturate:
+		f = math.Round(f)
+		if math.IsNaN(f) {
+			f = 0
+		}
+
+	case ConvWrap:
+		f = math.Trunc(f)
+		if math.IsNaN(f) {
+			f = 0
+		}
+	}
+
+	var v int64
+	switch {
+	case f <= math.MinInt64:
+		v = math.MinInt64
+	case f >= math.MaxInt64:
+		v = math.MaxInt64
+	default:
+		v = int64(f)
+	}
+
+	return putInt(b, data, v, policy)
+}
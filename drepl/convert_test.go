@@ -0,0 +1,116 @@
+package drepl
+
+import (
+	"math"
+	"testing"
+)
+
+var typeSize = [...]int64{Int8: 1, Int16: 2, Int32: 4, Int64: 8, Float32: 4, Float64: 8}
+
+// a little-endian block of the numeric type, in a view with the
+// conversion policy
+func convBlock(ntype, policy int) *SBlock {
+	v := new(View)
+	v.SetConversion(policy)
+	return &SBlock{view: v, size: typeSize[ntype], endian: LittleEndian, ntype: ntype}
+}
+
+// the value of the type in data, as a float64
+func convValue(b *SBlock, data []byte) float64 {
+	if isFloat(b.ntype) {
+		return getFloat(b, data)
+	}
+
+	return float64(getInt(b, data))
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		from, to	int
+		policy		int
+		val		float64
+		want		float64
+		inexact		bool
+	}{
+		// values that fit are converted with all policies
+		{Int32, Int8, ConvSaturate, -100, -100, false},
+		{Int32, Int8, ConvWrap, 100, 100, false},
+		{Int32, Int8, ConvExact, 127, 127, false},
+		{Int8, Int64, ConvExact, -128, -128, false},
+		{Int16, Float32, ConvExact, 1234, 1234, false},
+		{Float64, Int32, ConvExact, 42, 42, false},
+
+		// integers out of range
+		{Int32, Int8, ConvSaturate, 300, 127, false},
+		{Int32, Int8, ConvSaturate, -300, -128, false},
+		{Int32, Int8, ConvWrap, 300, 44, false},
+		{Int32, Int8, ConvWrap, -129, 127, false},
+		{Int32, Int8, ConvExact, 128, 0, true},
+		{Int64, Int16, ConvSaturate, 1 << 40, math.MaxInt16, false},
+		{Int64, Int32, ConvWrap, 1<<32 + 5, 5, false},
+
+		// floats to integers
+		{Float64, Int32, ConvSaturate, 2.5, 3, false},
+		{Float64, Int32, ConvSaturate, -2.6, -3, false},
+		{Float64, Int32, ConvWrap, -2.6, -2, false},
+		{Float64, Int32, ConvExact, 2.5, 0, true},
+		{Float64, Int8, ConvSaturate, 1e10, 127, false},
+		{Float64, Int8, ConvExact, 128, 0, true},
+		{Float64, Int16, ConvSaturate, math.NaN(), 0, false},
+		{Float64, Int16, ConvExact, math.NaN(), 0, true},
+
+		// floats to floats and integers to floats
+		{Float64, Float32, ConvSaturate, 0.1, float64(float32(0.1)), false},
+		{Float64, Float32, ConvExact, 0.1, 0, true},
+		{Float64, Float32, ConvExact, 0.5, 0.5, false},
+		{Float64, Float32, ConvSaturate, 1e300, math.MaxFloat32, false},
+		{Float64, Float32, ConvWrap, 1e300, math.Inf(1), false},
+		{Float32, Float64, ConvExact, 0.25, 0.25, false},
+		{Int64, Float32, ConvExact, 1<<24 + 1, 0, true},
+		{Int64, Float64, ConvSaturate, 1<<53 + 1, 1<<53, false},
+	}
+
+	for _, test := range tests {
+		sb := convBlock(test.from, ConvSaturate)
+		db := convBlock(test.to, test.policy)
+		src := make([]byte, sb.size)
+		dst := make([]byte, db.size)
+		if isFloat(test.from) {
+			setFloat(sb, src, test.val)
+		} else {
+			setInt(sb, src, int64(test.val))
+		}
+
+		err := convert(sb, db, src, dst)
+		switch {
+		case test.inexact && err != errInexact:
+			t.Errorf("%v from %d to %d, policy %d: got error %v, expecting %v", test.val, test.from, test.to, test.policy, err, errInexact)
+		case !test.inexact && err != nil:
+			t.Errorf("%v from %d to %d, policy %d: %v", test.val, test.from, test.to, test.policy, err)
+		case !test.inexact && convValue(db, dst) != test.want:
+			t.Errorf("%v from %d to %d, policy %d: got %v, expecting %v", test.val, test.from, test.to, test.policy, convValue(db, dst), test.want)
+		}
+	}
+}
+
+func TestConvertArray(t *testing.T) {
+	// all the elements are converted, and the byte order of the
+	// destination is used
+	sb := convBlock(Int32, ConvSaturate)
+	db := convBlock(Int16, ConvSaturate)
+	db.endian = BigEndian
+	src := make([]byte, 12)
+	for i, v := range []int64{1, -70000, 70000} {
+		setInt(sb, src[4*i:], v)
+	}
+
+	dst := make([]byte, 6)
+	if err := convert(sb, db, src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0x00, 0x01, 0x80, 0x00, 0x7f, 0xff}
+	if string(dst) != string(want) {
+		t.Errorf("got %x, expecting %x", dst, want)
+	}
+}
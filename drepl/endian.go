@@ -0,0 +1,50 @@
+package drepl
+
+import (
+	"encoding/binary"
+)
+
+// byte order of the value described by a SBlock
+const (
+	AnyEndian = iota		// bytes and strings, never swapped
+	NativeEndian
+	LittleEndian
+	BigEndian
+)
+
+var hostEndian = LittleEndian
+
+func init() {
+	if binary.NativeEndian.Uint16([]byte{0, 1}) == 1 {
+		hostEndian = BigEndian
+	}
+}
+
+// returns the byte order, native order is resolved to the host one
+func byteOrder(endian int) int {
+	if endian == NativeEndian {
+		return hostEndian
+	}
+
+	return endian
+}
+
+// returns true if the values need to be byte-swapped when copied
+// between the two blocks
+func swapped(b1, b2 *SBlock) bool {
+	if b1.endian == AnyEndian || b2.endian == AnyEndian {
+		return false
+	}
+
+	return byteOrder(b1.endian) != byteOrder(b2.endian)
+}
+
+// reverses the bytes of each value of size sz in data
+func byteSwap(data []byte, sz int64) {
+	for n := int64(0); n + sz <= int64(len(data)); n += sz {
+		v := data[n:n+sz]
+		for i, j := 0, len(v) - 1; i < j; i, j = i + 1, j - 1 {
+			v[i], v[j] = v[j], v[i]
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package drepl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSwapped(t *testing.T) {
+	tests := []struct {
+		e1, e2	int
+		want	bool
+	}{
+		{LittleEndian, BigEndian, true},
+		{BigEndian, LittleEndian, true},
+		{BigEndian, BigEndian, false},
+		{LittleEndian, LittleEndian, false},
+		{NativeEndian, hostEndian, false},
+		{NativeEndian, LittleEndian + BigEndian - hostEndian, true},
+
+		// bytes and strings
+		{AnyEndian, BigEndian, false},
+		{LittleEndian, AnyEndian, false},
+	}
+
+	for _, test := range tests {
+		b1 := &SBlock{size: 4, endian: test.e1}
+		b2 := &SBlock{size: 4, endian: test.e2}
+		if got := swapped(b1, b2); got != test.want {
+			t.Errorf("%d, %d: got %v, expecting %v", test.e1, test.e2, got, test.want)
+		}
+	}
+}
+
+func TestByteSwap(t *testing.T) {
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	byteSwap(data, 4)
+
+	// the partial value at the end isn't swapped
+	if want := []byte{4, 3, 2, 1, 8, 7, 6, 5, 9}; !bytes.Equal(data, want) {
+		t.Errorf("got %v, expecting %v", data, want)
+	}
+
+	byteSwap(data, 4)
+	if want := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}; !bytes.Equal(data, want) {
+		t.Errorf("swapped twice: got %v, expecting %v", data, want)
+	}
+}
@@ -19,6 +19,9 @@ package drepl
 // 	replid	int32
 // 	offset	int64
 // 	elo	int32
+// 	nelop	int32
+// 	elop	*int64		// element order parameters (tile shape for tiled, permutation for permuted)
+// 	conv	int32		// numeric conversion policy (0 saturate, 1 wrap, 2 exact)
 // 	dfltid	int32
 // 	nblks	int32
 // 	blkids	*int32
@@ -29,10 +32,29 @@ package drepl
 // 	c	int64
 // 	d	int64
 // 	idx	int32
+// 	nterm	int32
+// 	terms	*Term		// other indices added to the numerator
+// 	m	int64		// the value is modulo m, unless zero
+// 
+// Term
+// 	a	int64
+// 	idx	int32
+// 
+// Period
+// 	expr	Expr		// the value the indices wrap to, 0 to m-1
+// 	m	int64
+// 	min	int64
+// 	max	int64
 // 
 // Dest
 // 	nexpr	int32
 // 	expr	*Expr
+// 	ncond	int32
+// 	cond	*Expr		// the element is in the array only if all are zero
+// 	nwrap	int32
+// 	wrap	*Expr		// wrapped source indices, variables after the indices
+// 	nperiod	int32
+// 	period	*Period		// periods of the wrapped indices, variables after wrap
 // 	arrid	int32
 // 	elid	int32
 // 
@@ -41,6 +63,8 @@ package drepl
 // 	viewid	int32
 // 	offset	int64
 // 	size	int64
+// 	endian	int32		// byte order of sblock values (0 any, 2 little, 3 big)
+// 	ntype	int32		// numeric type of sblock values (0 none, 1-4 int8-int64, 5 float32, 6 float64)
 // 	src	Dest
 // 	ndest	int32
 // 	dests	*Dest
@@ -50,6 +74,9 @@ package drepl
 // 	dim	*int64
 // 	elsize	int64
 // 	elnum	int64
+// 	elo	int32
+// 	nelop	int32
+// 	elop	*int64
 // 	elid	int32
 // 
 // 	// tblock
@@ -59,6 +86,11 @@ package drepl
 type Exporter struct {
 	repls	map[*Replica]int32
 	views	map[*View]int32
+
+	// replicas and views in the order they were added, the ids are
+	// assigned in the same order
+	rlist	[]*Replica
+	vlist	[]*View
 }
 
 func NewExporter() *Exporter {
@@ -77,6 +109,7 @@ func (e *Exporter) AddReplica(r *Replica) {
 
 	id = int32(len(e.repls) + 1)
 	e.repls[r] = id
+	e.rlist = append(e.rlist, r)
 }
 
 func (e *Exporter) AddView(v *View) {
@@ -87,38 +120,52 @@ func (e *Exporter) AddView(v *View) {
 
 	id = int32(len(e.views) + 1)
 	e.views[v] = id
+	e.vlist = append(e.vlist, v)
 }
 
 func (e *Exporter) Data(flags uint32) []byte {
 
 	// first get list of all blocks
 	blks := make(map[Block]int32)
-	for v, _ := range e.views {
+	for _, v := range e.vlist {
 		for _, b := range v.bs.blks {
 			b.export1(blks)
 		}
 	}
 
+	// the blocks ordered by id
+	blist := make([]Block, len(blks))
+	for b, id := range blks {
+		blist[id - 1] = b
+	}
+
 	// header
 	p := pint32(nil, int32(len(e.repls)))
 	p = pint32(p, int32(len(e.views)))
 	p = pint32(p, int32(len(blks)))
 
 	// replicas
-	for r, id := range e.repls {
-		p = pint32(p, id)
+	for _, r := range e.rlist {
+		p = pint32(p, e.repls[r])
 		p = pstr(p, r.Name)
 		p = pstr(p, r.FileName)
 	}
 
 	// views
-	for v, id := range e.views {
-		p = pint32(p, id)
+	for _, v := range e.vlist {
+		p = pint32(p, e.views[v])
 		p = pstr(p, v.Name)
 		p = pint32(p, int32(flags))
 		p = pint32(p, e.repls[v.repl])
 		p = pint64(p, v.offset)
 		p = pint32(p, v.elo.Id())
+		elop := v.elo.Params()
+		p = pint32(p, int32(len(elop)))
+		for _, n := range elop {
+			p = pint64(p, n)
+		}
+
+		p = pint32(p, int32(v.conv))
 		p = pint32(p, e.views[v.dflt])
 		p = pint32(p, int32(len(v.bs.blks)))
 		for _, b := range v.bs.blks {
@@ -128,7 +175,7 @@ func (e *Exporter) Data(flags uint32) []byte {
 
 	// blocks
 	visited := make(map[Block]bool)
-	for b, _ := range blks {
+	for _, b := range blist {
 		p = b.export2(p, blks, e.views, visited)
 	}
 
@@ -220,9 +267,14 @@ func (b *SBlock) export2(data []byte, blks map[Block]int32, views map[*View]int3
 	p = pint32(p, views[b.view])
 	p = pint64(p, b.offset)
 	p = pint64(p, b.size)
+	p = pint32(p, int32(byteOrder(b.endian)))
+	p = pint32(p, int32(b.ntype))
 
 	// src
 	p = pint32(p, 0)		// nexpr
+	p = pint32(p, 0)		// ncond
+	p = pint32(p, 0)		// nwrap
+	p = pint32(p, 0)		// nperiod
 	p = pblk(p, blks, b.src)	// arrid
 	p = pblk(p, blks, nil)		// elid
 
@@ -230,6 +282,9 @@ func (b *SBlock) export2(data []byte, blks map[Block]int32, views map[*View]int3
 	p = pint32(p, int32(len(b.dests)))
 	for _, bb := range b.dests {
 		p = pint32(p, 0)	// nexpr
+		p = pint32(p, 0)	// ncond
+		p = pint32(p, 0)	// nwrap
+		p = pint32(p, 0)	// nperiod
 		p = pblk(p, blks, bb)	// arrid
 		p = pblk(p, blks, nil)	// elid
 	}
@@ -238,6 +293,8 @@ func (b *SBlock) export2(data []byte, blks map[Block]int32, views map[*View]int3
 	p = pint32(p, 0)	// ndim
 	p = pint64(p, 0)	// elsize
 	p = pint64(p, 0)	// elnum
+	p = pint32(p, 0)	// elo
+	p = pint32(p, 0)	// nelop
 	p = pint32(p, 0)	// elid
 
 	// empty tblock
@@ -266,41 +323,19 @@ func (b *ABlock) export2(data []byte, blks map[Block]int32, views map[*View]int3
 	p = pint32(p, views[b.view])
 	p = pint64(p, b.offset)
 	p = pint64(p, b.size)
+	p = pint32(p, 0)	// endian
+	p = pint32(p, 0)	// ntype
 
 	// src
 	if b.src != nil {
-		p = pint32(p, int32(len(b.src.expr)))	// nexpr
-		for i := 0; i < len(b.src.expr); i++ {
-			e := &b.src.expr[i]
-			p = pint64(p, e.A)
-			p = pint64(p, e.B)
-			p = pint64(p, e.C)
-			p = pint64(p, e.D)
-			p = pint32(p, int32(e.Xidx))
-		}
-
-		p = pblk(p, blks, b.src.arr)	// arrid
-		p = pblk(p, blks, b.src.el)	// elid
+		p = pdest(p, blks, b.src)
 	} else {
-		p = pint32(p, 0)
-		p = pblk(p, blks, nil)
-		p = pblk(p, blks, nil)
+		p = pdest(p, blks, &ADest{})
 	}
 
 	p = pint32(p, int32(len(b.dests)))
 	for _, d := range b.dests {
-		p = pint32(p, int32(len(d.expr)))	// nexpr
-		for i := 0; i < len(d.expr); i++ {
-			e := &d.expr[i]
-			p = pint64(p, e.A)
-			p = pint64(p, e.B)
-			p = pint64(p, e.C)
-			p = pint64(p, e.D)
-			p = pint32(p, int32(e.Xidx))
-		}
-
-		p = pblk(p, blks, d.arr)	// arrid
-		p = pblk(p, blks, d.el)		// elid
+		p = pdest(p, blks, d)
 	}
 
 	// ablock
@@ -311,6 +346,13 @@ func (b *ABlock) export2(data []byte, blks map[Block]int32, views map[*View]int3
 
 	p = pint64(p, b.elsize)
 	p = pint64(p, b.elnum)
+	p = pint32(p, b.elo.Id())
+	elop := b.elo.Params()
+	p = pint32(p, int32(len(elop)))
+	for _, n := range elop {
+		p = pint64(p, n)
+	}
+
 	p = pblk(p, blks, b.elblk)
 
 	// empty tblock
@@ -342,9 +384,14 @@ func (b *TBlock) export2(data []byte, blks map[Block]int32, views map[*View]int3
 	p = pint32(p, views[b.view])
 	p = pint64(p, b.offset)
 	p = pint64(p, b.size)
+	p = pint32(p, 0)	// endian
+	p = pint32(p, 0)	// ntype
 
 	// src
 	p = pint32(p, 0)	// nexpr
+	p = pint32(p, 0)	// ncond
+	p = pint32(p, 0)	// nwrap
+	p = pint32(p, 0)	// nperiod
 	p = pblk(p, blks, b.src)// arrid
 	p = pblk(p, blks, nil)	// elid
 
@@ -352,6 +399,9 @@ func (b *TBlock) export2(data []byte, blks map[Block]int32, views map[*View]int3
 	p = pint32(p, int32(len(b.dests)))
 	for _, bb := range b.dests {
 		p = pint32(p, 0)	// nexpr
+		p = pint32(p, 0)	// ncond
+		p = pint32(p, 0)	// nwrap
+		p = pint32(p, 0)	// nperiod
 		p = pblk(p, blks, bb)	// arrid
 		p = pblk(p, blks, nil)	// elid
 	}
@@ -360,6 +410,8 @@ func (b *TBlock) export2(data []byte, blks map[Block]int32, views map[*View]int3
 	p = pint32(p, 0)	// ndim
 	p = pint64(p, 0)	// elsize
 	p = pint64(p, 0)	// elnum
+	p = pint32(p, 0)	// elo
+	p = pint32(p, 0)	// nelop
 	p = pint32(p, 0)	// elid
 
 	p = pint32(p, int32(len(b.bs.blks)))
@@ -418,3 +470,45 @@ func pblk(buf []byte, blks map[Block]int32, b Block) []byte {
 
 	return pint32(buf, id)
 }
+
+func pexprs(buf []byte, es []PExpr) []byte {
+	buf = pint32(buf, int32(len(es)))
+	for i := range es {
+		buf = pexpr(buf, &es[i])
+	}
+
+	return buf
+}
+
+func pexpr(buf []byte, e *PExpr) []byte {
+	buf = pint64(buf, e.A)
+	buf = pint64(buf, e.B)
+	buf = pint64(buf, e.C)
+	buf = pint64(buf, e.D)
+	buf = pint32(buf, int32(e.Xidx))
+	buf = pint32(buf, int32(len(e.Terms)))
+	for _, t := range e.Terms {
+		buf = pint64(buf, t.A)
+		buf = pint32(buf, int32(t.Xidx))
+	}
+
+	return pint64(buf, e.M)
+}
+
+func pdest(buf []byte, blks map[Block]int32, d *ADest) []byte {
+	buf = pexprs(buf, d.expr)
+	buf = pexprs(buf, d.cond)
+	buf = pexprs(buf, d.wrap)
+	buf = pint32(buf, int32(len(d.period)))
+	for i := range d.period {
+		pd := &d.period[i]
+		buf = pexpr(buf, &pd.Expr)
+		buf = pint64(buf, pd.M)
+		buf = pint64(buf, pd.Min)
+		buf = pint64(buf, pd.Max)
+	}
+
+	buf = pblk(buf, blks, d.arr)	// arrid
+	buf = pblk(buf, blks, d.el)	// elid
+	return buf
+}
@@ -0,0 +1,161 @@
+package drepl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Selects the elements of an unmaterialized array by their values. The
+// values are read from the probe, an unmaterialized array with the same
+// dimensions, when the view is opened. The selected elements form a
+// one-dimensional array, in the order of the original array.
+type Filter struct {
+	probe	*ABlock
+	match	func(el []byte) (bool, error)
+	dim	[]int64		// dimensions of the original array
+	sel	[]int64		// numbers of the selected elements in the original array
+	vals	[]byte		// values of the probe sel was selected with
+}
+
+
+// Makes the array a filtered one, match is called with each element of
+// the probe to decide if the corresponding element of the array is
+// selected. No elements are selected until the view's Select is called,
+// before that the array is empty.
+func (b *ABlock) SetFilter(probe *ABlock, match func(el []byte) (bool, error)) {
+	f := new(Filter)
+	f.probe = probe
+	f.match = match
+	f.dim = b.dim
+	b.filter = f
+	b.dim = []int64{0}
+	b.elnum = 0
+	b.size = 0
+}
+
+func (b *ABlock) Filter() *Filter {
+	return b.filter
+}
+
+// Returns true if the view has filtered arrays
+func (v *View) Filtered() bool {
+	for _, b := range v.bs.blks {
+		if ab, ok := b.(*ABlock); ok && ab.filter != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Selects the elements of the view's filtered arrays using the current
+// values of the dataset. The size of the arrays, and of the view, change
+// to the number of selected elements. Select has to be called before the
+// view is read, usually when it's opened; it does nothing if the values
+// didn't change since the last call. The blocks of the view change, so
+// the caller has to make sure the view isn't read or written while
+// Select runs.
+func (v *View) Select() error {
+	if v.repl != nil {
+		return errors.New("materialized view can't be filtered")
+	}
+
+	v.selmu.Lock()
+	defer v.selmu.Unlock()
+
+	off := int64(0)
+	end := int64(0)
+	for _, b := range v.bs.blks {
+		// keep the padding between the blocks
+		off += b.Offset() - end
+		end = b.Offset() + b.Size()
+		if ab, ok := b.(*ABlock); ok && ab.filter != nil {
+			if err := ab.filter.selectElements(ab); err != nil {
+				return fmt.Errorf("view %s: %v", v.Name, err)
+			}
+		}
+
+		if b.Offset() != off {
+			setOffset(b, off)
+		}
+
+		off += b.Size()
+	}
+
+	return nil
+}
+
+func (f *Filter) selectElements(b *ABlock) error {
+	p := f.probe
+	if len(p.dim) != len(f.dim) {
+		return errors.New("probe doesn't match the array")
+	}
+
+	buf := make([]byte, p.size)
+	if len(buf) > 0 {
+		if _, err := p.Read(buf, p.offset, p.offset); err != nil {
+			return err
+		}
+	}
+
+	if f.vals != nil && bytes.Equal(buf, f.vals) {
+		return nil
+	}
+
+	elnum := int64(1)
+	for _, n := range f.dim {
+		elnum *= n
+	}
+
+	var sel []int64
+	idx := make([]int64, len(f.dim))
+	for n := int64(0); n < elnum; n++ {
+		b.elo.ToIdx(n, idx, f.dim)
+		pn := p.elo.FromIdx(idx, p.dim)
+		ok, err := f.match(buf[pn*p.elsize:(pn+1)*p.elsize])
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			sel = append(sel, n)
+		}
+	}
+
+	f.sel = sel
+	b.dim[0] = int64(len(f.sel))
+	b.elnum = b.dim[0]
+	b.size = b.elnum * b.elsize
+	f.vals = buf
+	return nil
+}
+
+// Returns the indices in the original array of the selected element n
+func (f *Filter) toIdx(elo ElementOrder, n int64, idx []int64) {
+	elo.ToIdx(f.sel[n], idx, f.dim)
+}
+
+func setOffset(b Block, off int64) {
+	switch b := b.(type) {
+	case *SBlock:
+		b.offset = off
+	case *ABlock:
+		b.offset = off
+	case *TBlock:
+		b.offset = off
+	}
+}
+
+// Returns the number in data described by the block, as int64 or
+// float64, or nil if the block isn't a number
+func (b *SBlock) Value(data []byte) interface{} {
+	switch {
+	case b.ntype == NoType:
+		return nil
+	case isFloat(b.ntype):
+		return getFloat(b, data)
+	}
+
+	return getInt(b, data)
+}
@@ -0,0 +1,186 @@
+package drepl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Returns the fingerprint of the replica's file layout: the views stored
+// in it, and the offsets, sizes and types of the values in the views. The
+// tools can store it with the file to detect that the file was written
+// using a different layout. The number of records of the unlimited
+// dimensions doesn't change the fingerprint.
+func (r *Replica) Fingerprint() uint64 {
+	h := fnv.New64a()
+	hint(h, int64(len(r.views)))
+	for _, v := range r.views {
+		v.fingerprint(h)
+	}
+
+	return h.Sum64()
+}
+
+// Compares the fingerprint stored with the replica's file to the one of
+// the replica's layout, and returns an error if the file was written using
+// a different layout, or has no fingerprint. The fingerprint is stored in
+// FileName.fp with the numbers of records of the unlimited dimensions,
+// which are restored before the file is set, and kept up to date when
+// records are appended.
+func (r *Replica) CheckFingerprint() error {
+	fname := r.FileName + ".fp"
+	if _, err := os.Stat(r.FileName); os.IsNotExist(err) {
+		// new file
+		r.fpname = fname
+		return r.saveFingerprint()
+	} else if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("replica %s: %s has no layout fingerprint", r.Name, r.FileName)
+	} else if err != nil {
+		return err
+	}
+
+	f := strings.Fields(string(data))
+	recs := r.records()
+	if len(f) != len(recs) + 1 || f[0] != fmt.Sprintf("%016x", r.Fingerprint()) {
+		return fmt.Errorf("replica %s: %s was written using a different layout", r.Name, r.FileName)
+	}
+
+	for i, rs := range recs {
+		n, err := strconv.ParseInt(f[i+1], 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("replica %s: invalid number of records in %s", r.Name, fname)
+		}
+
+		if n > rs.n {
+			if err = rs.grow(n); err != nil {
+				return err
+			}
+		}
+	}
+
+	r.fpname = fname
+	return nil
+}
+
+// Writes the fingerprint and the numbers of records to the file set by
+// CheckFingerprint
+func (r *Replica) saveFingerprint() error {
+	if r.fpname == "" {
+		return nil
+	}
+
+	s := fmt.Sprintf("%016x", r.Fingerprint())
+	for _, rs := range r.records() {
+		s += fmt.Sprintf(" %d", rs.n)
+	}
+
+	return os.WriteFile(r.fpname, []byte(s + "\n"), 0666)
+}
+
+// Returns the records of the unlimited dimensions in the replica, in the
+// order of the views
+func (r *Replica) records() []*Records {
+	var recs []*Records
+
+	for _, v := range r.views {
+		if b := v.records(); b != nil {
+			recs = append(recs, b.recs)
+		}
+	}
+
+	return recs
+}
+
+func (v *View) fingerprint(h hash.Hash64) {
+	hstr(h, v.Name)
+	helo(h, v.elo)
+	hint(h, int64(len(v.bs.blks)))
+	for _, b := range v.bs.blks {
+		b.fingerprint(h)
+	}
+}
+
+func (b *SBlock) fingerprint(h hash.Hash64) {
+	if b == nil {
+		return
+	}
+
+	hstr(h, "s")
+	hint(h, b.offset)
+	hint(h, b.size)
+	hint(h, int64(byteOrder(b.endian)))
+	hint(h, int64(b.ntype))
+}
+
+func (b *ABlock) fingerprint(h hash.Hash64) {
+	if b == nil {
+		return
+	}
+
+	hstr(h, "a")
+	hint(h, b.offset)
+	hint(h, int64(len(b.dim)))
+	for i, n := range b.dim {
+		if i == 0 && b.recs != nil {
+			// unlimited, the size depends on the number of records
+			n = -1
+		}
+
+		hint(h, n)
+	}
+
+	hint(h, b.elsize)
+	helo(h, b.elo)
+	if b.elblk != nil {
+		b.elblk.fingerprint(h)
+	}
+}
+
+func (b *TBlock) fingerprint(h hash.Hash64) {
+	if b == nil {
+		return
+	}
+
+	hstr(h, "t")
+	hint(h, b.offset)
+	hint(h, b.size)
+	hint(h, int64(len(b.bs.blks)))
+	for _, bb := range b.bs.blks {
+		bb.fingerprint(h)
+	}
+}
+
+func hint(h hash.Hash64, n int64) {
+	var buf [8]byte
+
+	binary.LittleEndian.PutUint64(buf[:], uint64(n))
+	h.Write(buf[:])
+}
+
+func hstr(h hash.Hash64, s string) {
+	hint(h, int64(len(s)))
+	h.Write([]byte(s))
+}
+
+func helo(h hash.Hash64, elo ElementOrder) {
+	if elo == nil {
+		hint(h, -1)
+		return
+	}
+
+	hint(h, int64(elo.Id()))
+	elop := elo.Params()
+	hint(h, int64(len(elop)))
+	for _, n := range elop {
+		hint(h, n)
+	}
+}
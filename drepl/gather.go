@@ -0,0 +1,161 @@
+package drepl
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Index array of an unmaterialized array whose source indices are read
+// from the dataset. The values of the index array are an additional
+// variable of the expressions that calculate the source indices, the
+// k-th index array of the array b gives the variable len(b.dim) + k.
+type Gather struct {
+	arr	*ABlock		// the indices, an unmaterialized array
+	dims	[]int		// the dimensions of the gathering array that index arr
+	value	func(el []byte) (int64, error)
+}
+
+// Adds an index array to the array. The elements of idx are indexed by
+// the dimensions dims of the array, value is called with each element to
+// get the index. The array has to belong to a readonly view. The
+// elements whose indices are outside of the source array are 0.
+func (b *ABlock) AddGather(idx *ABlock, dims []int, value func(el []byte) (int64, error)) {
+	g := new(Gather)
+	g.arr = idx
+	g.dims = dims
+	g.value = value
+	idx.gatherer = b
+	b.gather = append(b.gather, g)
+}
+
+func (b *ABlock) Gathers() []*Gather {
+	return b.gather
+}
+
+func (g *Gather) Array() *ABlock {
+	return g.arr
+}
+
+// Returns true if the view has arrays with index arrays
+func (v *View) Gathered() bool {
+	for _, b := range v.bs.blks {
+		if ab, ok := b.(*ABlock); ok && ab.gather != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reads all indices of the index array
+func (g *Gather) indices() ([]int64, error) {
+	p := g.arr
+	buf := make([]byte, p.size)
+	if len(buf) > 0 {
+		if _, err := p.Read(buf, p.offset, p.offset); err != nil {
+			return nil, err
+		}
+	}
+
+	vals := make([]int64, p.elnum)
+	for n := range vals {
+		v, err := g.value(buf[int64(n)*p.elsize:int64(n+1)*p.elsize])
+		if err != nil {
+			return nil, err
+		}
+
+		vals[n] = v
+	}
+
+	return vals, nil
+}
+
+// Sets the variables of the index arrays in idx, the indices of the
+// element of b are at the beginning
+func (b *ABlock) gatherIdx(vals [][]int64, idx []int64) {
+	n := len(idx) - len(b.gather)
+	for k, g := range b.gather {
+		gidx := make([]int64, len(g.dims))
+		for i, d := range g.dims {
+			gidx[i] = idx[d]
+		}
+
+		idx[n + k] = vals[k][g.arr.elo.FromIdx(gidx, g.arr.dim)]
+	}
+}
+
+// Reads the elements of the materialized arrays with index arrays, and
+// of the reductions, from the view's default view again
+func (v *View) Refresh() error {
+	if v.repl == nil {
+		return nil
+	}
+
+	for _, b := range v.bs.blks {
+		if ab, ok := b.(*ABlock); ok && (ab.gather != nil || ab.red != nil) {
+			if err := ab.refresh(); err != nil {
+				return fmt.Errorf("view %s: %v", v.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *ABlock) refresh() error {
+	if b.src == nil {
+		return errors.New("array has no source")
+	}
+
+	buf := make([]byte, b.size)
+	if len(buf) == 0 {
+		return nil
+	}
+
+	if _, err := b.readSource(buf, b.offset, b.offset); err != nil {
+		return err
+	}
+
+	_, err := b.view.Write(buf, b.offset)
+	return err
+}
+
+// Finds the materialized arrays with index arrays that use the dataset
+// array b, either as their source or as the index array, and makes all
+// other arrays of b refresh them when written.
+func (b *ABlock) connectGathers() {
+	var gs []*ABlock
+
+	for _, d := range b.dests {
+		g := d.arr
+		if g.gatherer != nil {
+			g = g.gatherer
+		} else if g.gather == nil {
+			continue
+		}
+
+		if g.view.repl != nil {
+			gs = append(gs, g)
+		}
+	}
+
+	for _, d := range b.dests {
+		if d.arr.gather != nil || d.arr.gatherer != nil || d.arr.view.IsReadonly() {
+			continue
+		}
+
+		d.arr.deps = append(d.arr.deps, gs...)
+	}
+}
+
+// refreshes the arrays that depend on the values of b, data was written
+// at offset
+func (b *ABlock) refreshDeps(data []byte, offset, base int64) error {
+	for _, g := range b.deps {
+		if err := g.refresh(); err != nil {
+			return err
+		}
+	}
+
+	return b.updateReductions(data, offset, base)
+}
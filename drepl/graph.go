@@ -63,6 +63,10 @@ func (g *Graph) AddBlock(bb Block) {
 			g.AddBlock(d.arr)
 		}
 
+		for _, gg := range b.gather {
+			g.AddBlock(gg.arr)
+		}
+
 	case *TBlock:
 		if b==nil {
 			return
@@ -123,6 +127,15 @@ func (g *Graph) outputBlock(showptr bool, bb Block) (nodes, links string) {
 			links += fmt.Sprintf("dest%p:arr -> node%p [\ncolor=green\nfontcolor=green\nlabel=arr\n]\n", d, d.arr)
 			links += fmt.Sprintf("dest%p:el -> node%p [\ncolor=green\nfontcolor=green\nlabel=el\n]\n", d, d.el)
 		}
+		for i, gg := range b.gather {
+			links += fmt.Sprintf("node%p -> node%p [\ncolor=red\nfontcolor=red\nlabel=index%d\n]\n", b, gg.arr, i)
+		}
+		for _, bb := range b.deps {
+			links += fmt.Sprintf("node%p -> node%p [\ncolor=red\nfontcolor=red\nstyle=dashed\nlabel=refresh\n]\n", b, bb)
+		}
+		for _, dep := range b.rdeps {
+			links += fmt.Sprintf("node%p -> node%p [\ncolor=red\nfontcolor=red\nstyle=dashed\nlabel=update\n]\n", b, dep.arr)
+		}
 		if b.clonee != nil {
 			links += fmt.Sprintf("node%p -> node%p [\ncolor=blue\nfontcolor=blue\nlabel=clonee\n]\n", b, b.clonee)
 		}
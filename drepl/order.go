@@ -6,6 +6,7 @@ type ElementOrder interface {
 	FromIdx(idx, dim []int64) int64
 	ToIdx(n int64, idx, dim []int64)
 	Id() int32
+	Params() []int64		// order specific parameters, exported with the id
 }
 
 type RowMajor int
@@ -38,6 +39,10 @@ func (RowMajor) Id() int32 {
 	return 1
 }
 
+func (RowMajor) Params() []int64 {
+	return nil
+}
+
 func (RowMinor) FromIdx(idx, dim []int64) int64 {
 	n := int64(idx[len(idx) - 1])
 	for i := len(idx) - 2; i >= 0; i-- {
@@ -59,3 +64,336 @@ func (RowMinor) Id() int32 {
 	return 2
 }
 
+func (RowMinor) Params() []int64 {
+	return nil
+}
+
+// Z-order (Morton) curve. The positions on the curve that fall outside
+// of the array (if the dimensions are not powers of two) are skipped, so
+// the elements are still stored densely.
+type ZOrder int
+
+// Hilbert curve. Dimensions that are not powers of two are handled the
+// same way as for ZOrder.
+type Hilbert int
+
+var ZOrderOrder ZOrder
+var HilbertOrder Hilbert
+
+func (ZOrder) FromIdx(idx, dim []int64) int64 {
+	return curveFromIdx(idx, dim, false)
+}
+
+func (ZOrder) ToIdx(n int64, idx, dim []int64) {
+	curveToIdx(n, idx, dim, false)
+}
+
+func (ZOrder) Id() int32 {
+	return 3
+}
+
+func (ZOrder) Params() []int64 {
+	return nil
+}
+
+func (Hilbert) FromIdx(idx, dim []int64) int64 {
+	return curveFromIdx(idx, dim, true)
+}
+
+func (Hilbert) ToIdx(n int64, idx, dim []int64) {
+	curveToIdx(n, idx, dim, true)
+}
+
+func (Hilbert) Id() int32 {
+	return 4
+}
+
+func (Hilbert) Params() []int64 {
+	return nil
+}
+
+// State of the traversal of a space filling curve. At each level a cell
+// is split into 2^n subcells, one bit per dimension (dimension 0 is the
+// most significant bit). The Z-order curve always visits the subcells in
+// the same order, the Hilbert curve order depends on the entry point e
+// and direction d of the cell (see C. Hamilton, Compact Hilbert Indices).
+type curve struct {
+	n	uint		// number of dimensions
+	hilbert	bool
+	e	uint64
+	d	uint
+}
+
+func (c *curve) rotr(x uint64, r uint) uint64 {
+	r %= c.n
+	return ((x >> r) | (x << (c.n - r))) & (1<<c.n - 1)
+}
+
+func (c *curve) rotl(x uint64, r uint) uint64 {
+	r %= c.n
+	return ((x << r) | (x >> (c.n - r))) & (1<<c.n - 1)
+}
+
+func graycode(w uint64) uint64 {
+	return w ^ (w >> 1)
+}
+
+func graycodeInv(g uint64) uint64 {
+	w := g
+	for s := uint(1); s < 64; s <<= 1 {
+		w ^= w >> s
+	}
+
+	return w
+}
+
+// returns the subcell that is visited w-th in the current cell
+func (c *curve) cell(w uint64) uint64 {
+	if !c.hilbert {
+		return w
+	}
+
+	return c.rotl(graycode(w), c.d + 1) ^ c.e
+}
+
+// returns the position of the subcell in the visiting order
+func (c *curve) index(cell uint64) uint64 {
+	if !c.hilbert {
+		return cell
+	}
+
+	return graycodeInv(c.rotr(cell ^ c.e, c.d + 1))
+}
+
+// updates the state when entering the w-th subcell
+func (c *curve) descend(w uint64) {
+	if !c.hilbert || w == 0 {
+		if c.hilbert {
+			c.d = (c.d + 1) % c.n
+		}
+
+		return
+	}
+
+	e := graycode(2 * ((w - 1) / 2))
+	t := w
+	if w % 2 == 0 {
+		t = w - 1
+	}
+
+	d := uint(0)
+	for ; t & 1 != 0; t >>= 1 {
+		d++
+	}
+
+	c.e ^= c.rotl(e, c.d + 1)
+	c.d = (c.d + d % c.n + 1) % c.n
+}
+
+// number of levels needed to cover all dimensions
+func curveLevels(dim []int64) uint {
+	m := uint(0)
+	for _, d := range dim {
+		for int64(1) << m < d {
+			m++
+		}
+	}
+
+	return m
+}
+
+// Returns the number of array elements within a subcell at level l. The
+// bits of idx below l+1 are ignored, the bits above define the parent cell.
+func cellCount(cell uint64, l uint, idx, dim []int64) int64 {
+	n := len(dim)
+	s := int64(1) << l
+	count := int64(1)
+	for k := 0; k < n; k++ {
+		start := idx[k] &^ (2*s - 1)
+		if cell & (1 << uint(n - 1 - k)) != 0 {
+			start += s
+		}
+
+		m := dim[k] - start
+		if m <= 0 {
+			return 0
+		} else if m > s {
+			m = s
+		}
+
+		count *= m
+	}
+
+	return count
+}
+
+func curveFromIdx(idx, dim []int64, hilbert bool) int64 {
+	c := curve{n: uint(len(dim)), hilbert: hilbert}
+	pos := int64(0)
+	for l := int(curveLevels(dim)) - 1; l >= 0; l-- {
+		cell := uint64(0)
+		for k := 0; k < len(idx); k++ {
+			cell |= uint64((idx[k] >> uint(l)) & 1) << uint(len(idx) - 1 - k)
+		}
+
+		// skip the elements in the subcells visited before
+		w := c.index(cell)
+		for j := uint64(0); j < w; j++ {
+			pos += cellCount(c.cell(j), uint(l), idx, dim)
+		}
+
+		c.descend(w)
+	}
+
+	return pos
+}
+
+func curveToIdx(n int64, idx, dim []int64, hilbert bool) {
+	c := curve{n: uint(len(dim)), hilbert: hilbert}
+	for k := 0; k < len(idx); k++ {
+		idx[k] = 0
+	}
+
+	for l := int(curveLevels(dim)) - 1; l >= 0; l-- {
+		var w, cell uint64
+
+		for w = 0; w < 1 << c.n; w++ {
+			cell = c.cell(w)
+			m := cellCount(cell, uint(l), idx, dim)
+			if n < m {
+				break
+			}
+
+			n -= m
+		}
+
+		for k := 0; k < len(idx); k++ {
+			if cell & (1 << uint(len(idx) - 1 - k)) != 0 {
+				idx[k] |= int64(1) << uint(l)
+			}
+		}
+
+		c.descend(w)
+	}
+}
+
+// Tiled (chunked) order. The array is split into tiles of the specified
+// shape. The tiles are stored in row-major order, and so are the elements
+// within each tile. The last tile in a dimension that is not a multiple of
+// the tile size is smaller. The tile shape has one size for each
+// dimension of the array.
+type Tiled struct {
+	tile	[]int64
+}
+
+func NewTiledOrder(tile []int64) *Tiled {
+	t := new(Tiled)
+	t.tile = tile
+
+	return t
+}
+
+func (t *Tiled) FromIdx(idx, dim []int64) int64 {
+	n := int64(0)		// elements in the tiles before
+	m := int64(0)		// position within the tile
+	ext := int64(1)		// product of the tile extents in the previous dimensions
+	for k := 0; k < len(dim); k++ {
+		ts := t.tile[k]
+		start := (idx[k] / ts) * ts
+		rest := int64(1)
+		for j := k + 1; j < len(dim); j++ {
+			rest *= dim[j]
+		}
+
+		n += ext * start * rest
+		e := dim[k] - start
+		if e > ts {
+			e = ts
+		}
+
+		ext *= e
+		m = m*e + idx[k] - start
+	}
+
+	return n + m
+}
+
+func (t *Tiled) ToIdx(n int64, idx, dim []int64) {
+	ext := int64(1)
+	for k := 0; k < len(dim); k++ {
+		ts := t.tile[k]
+		rest := int64(1)
+		for j := k + 1; j < len(dim); j++ {
+			rest *= dim[j]
+		}
+
+		slab := ext * ts * rest
+		idx[k] = (n / slab) * ts
+		n %= slab
+		e := dim[k] - idx[k]
+		if e > ts {
+			e = ts
+		}
+
+		ext *= e
+	}
+
+	// n is the position within the tile
+	for k := len(dim) - 1; k >= 0; k-- {
+		e := dim[k] - idx[k]
+		if ts := t.tile[k]; e > ts {
+			e = ts
+		}
+
+		idx[k] += n % e
+		n /= e
+	}
+}
+
+func (t *Tiled) Id() int32 {
+	return 5
+}
+
+func (t *Tiled) Params() []int64 {
+	return t.tile
+}
+
+// Permuted order. The permutation lists the dimensions from the slowest
+// to the fastest varying one, i.e. (0, 1, 2) is the same as RowMajor and
+// (2, 1, 0) is the same as RowMinor for 3D arrays. The permutation has
+// one value for each dimension of the array.
+type Permuted struct {
+	perm	[]int64
+}
+
+func NewPermutedOrder(perm []int64) *Permuted {
+	p := new(Permuted)
+	p.perm = perm
+
+	return p
+}
+
+func (p *Permuted) FromIdx(idx, dim []int64) int64 {
+	n := int64(0)
+	for _, k := range p.perm {
+		n = n*dim[k] + idx[k]
+	}
+
+	return n
+}
+
+func (p *Permuted) ToIdx(n int64, idx, dim []int64) {
+	for i := len(p.perm) - 1; i >= 0; i-- {
+		k := p.perm[i]
+		idx[k] = n % dim[k]
+		n /= dim[k]
+	}
+}
+
+func (p *Permuted) Id() int32 {
+	return 6
+}
+
+func (p *Permuted) Params() []int64 {
+	return p.perm
+}
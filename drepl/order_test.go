@@ -0,0 +1,179 @@
+package drepl
+
+import (
+	"testing"
+)
+
+// array shapes the orders are checked on, including dimensions that are
+// not powers of two and dimensions of size 1
+var orderDims = [][]int64{
+	{5}, {3, 5}, {4, 4}, {7, 7}, {8, 8}, {1, 9}, {16, 3},
+	{2, 2, 2}, {3, 4, 5}, {6, 1, 3},
+}
+
+// checks that the order maps the indices of an array of the dimensions
+// dim to the positions 0 to n-1, each position once, and that ToIdx is
+// the inverse of FromIdx
+func checkBijection(t *testing.T, name string, o ElementOrder, dim []int64) {
+	n := int64(1)
+	for _, d := range dim {
+		n *= d
+	}
+
+	seen := make([]bool, n)
+	idx := make([]int64, len(dim))
+	back := make([]int64, len(dim))
+	for i := int64(0); i < n; i++ {
+		// all the indices, in row-major order
+		RowMajorOrder.ToIdx(i, idx, dim)
+		p := o.FromIdx(idx, dim)
+		if p < 0 || p >= n || seen[p] {
+			t.Errorf("%s %v: index %v at invalid or repeated position %d", name, dim, idx, p)
+			return
+		}
+
+		seen[p] = true
+		o.ToIdx(p, back, dim)
+		for j := range idx {
+			if back[j] != idx[j] {
+				t.Errorf("%s %v: index %v at position %d, which is index %v", name, dim, idx, p, back)
+				return
+			}
+		}
+	}
+}
+
+func TestOrderBijection(t *testing.T) {
+	orders := []struct {
+		name	string
+		o	ElementOrder
+	}{
+		{"rowmajor", RowMajorOrder},
+		{"rowminor", RowMinorOrder},
+		{"zorder", ZOrderOrder},
+		{"hilbert", HilbertOrder},
+	}
+
+	for _, o := range orders {
+		for _, dim := range orderDims {
+			checkBijection(t, o.name, o.o, dim)
+		}
+	}
+}
+
+func TestZOrderPositions(t *testing.T) {
+	// the cells of each level are visited with dimension 0 as the most
+	// significant bit
+	dim := []int64{4, 4}
+	want := [][]int64{
+		{0, 0}, {0, 1}, {1, 0}, {1, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3},
+		{2, 0}, {2, 1}, {3, 0}, {3, 1}, {2, 2}, {2, 3}, {3, 2}, {3, 3},
+	}
+
+	for p, idx := range want {
+		if n := ZOrderOrder.FromIdx(idx, dim); n != int64(p) {
+			t.Errorf("index %v: got position %d, expecting %d", idx, n, p)
+		}
+	}
+
+	// positions outside of a 3x3 array are skipped
+	if n := ZOrderOrder.FromIdx([]int64{2, 0}, []int64{3, 3}); n != 6 {
+		t.Errorf("index [2 0] of 3x3: got position %d, expecting 6", n)
+	}
+}
+
+func TestHilbertAdjacent(t *testing.T) {
+	// consecutive positions on the Hilbert curve are neighbours
+	for _, dim := range [][]int64{{8, 8}, {16, 16}, {4, 4, 4}} {
+		n := int64(1)
+		for _, d := range dim {
+			n *= d
+		}
+
+		prev := make([]int64, len(dim))
+		cur := make([]int64, len(dim))
+		HilbertOrder.ToIdx(0, prev, dim)
+		for p := int64(1); p < n; p++ {
+			HilbertOrder.ToIdx(p, cur, dim)
+			dist := int64(0)
+			for i := range cur {
+				if d := cur[i] - prev[i]; d < 0 {
+					dist -= d
+				} else {
+					dist += d
+				}
+			}
+
+			if dist != 1 {
+				t.Errorf("%v: position %d at %v, position %d at %v", dim, p-1, prev, p, cur)
+				break
+			}
+
+			copy(prev, cur)
+		}
+	}
+}
+
+func TestTiledBijection(t *testing.T) {
+	tests := []struct {
+		tile	[]int64
+		dim	[]int64
+	}{
+		{[]int64{2}, []int64{5}},
+		{[]int64{2, 2}, []int64{4, 4}},
+		{[]int64{2, 3}, []int64{5, 7}},
+		{[]int64{4, 4}, []int64{3, 3}},
+		{[]int64{1, 5}, []int64{3, 5}},
+		{[]int64{2, 2, 2}, []int64{3, 4, 5}},
+	}
+
+	for _, test := range tests {
+		checkBijection(t, "tiled", NewTiledOrder(test.tile), test.dim)
+	}
+}
+
+func TestTiledPositions(t *testing.T) {
+	// 2x2 tiles of a 3x3 array, the last tile of each dimension is smaller
+	o := NewTiledOrder([]int64{2, 2})
+	dim := []int64{3, 3}
+	want := [][]int64{
+		{0, 0}, {0, 1}, {1, 0}, {1, 1}, {0, 2}, {1, 2},
+		{2, 0}, {2, 1}, {2, 2},
+	}
+
+	for p, idx := range want {
+		if n := o.FromIdx(idx, dim); n != int64(p) {
+			t.Errorf("index %v: got position %d, expecting %d", idx, n, p)
+		}
+	}
+}
+
+func TestPermutedBijection(t *testing.T) {
+	tests := []struct {
+		perm	[]int64
+		dim	[]int64
+	}{
+		{[]int64{0}, []int64{5}},
+		{[]int64{1, 0}, []int64{3, 5}},
+		{[]int64{2, 0, 1}, []int64{3, 4, 5}},
+		{[]int64{1, 2, 0}, []int64{2, 1, 3}},
+	}
+
+	for _, test := range tests {
+		checkBijection(t, "order", NewPermutedOrder(test.perm), test.dim)
+	}
+
+	// the identity and the reverse permutations are RowMajor and RowMinor
+	dim := []int64{3, 4, 5}
+	idx := make([]int64, 3)
+	for i := int64(0); i < 60; i++ {
+		RowMajorOrder.ToIdx(i, idx, dim)
+		if n, m := NewPermutedOrder([]int64{0, 1, 2}).FromIdx(idx, dim), RowMajorOrder.FromIdx(idx, dim); n != m {
+			t.Errorf("order(0, 1, 2) %v: got position %d, expecting %d", idx, n, m)
+		}
+
+		if n, m := NewPermutedOrder([]int64{2, 1, 0}).FromIdx(idx, dim), RowMinorOrder.FromIdx(idx, dim); n != m {
+			t.Errorf("order(2, 1, 0) %v: got position %d, expecting %d", idx, n, m)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package drepl
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -11,6 +12,33 @@ type PExpr struct {
 	C	int64
 	D	int64
 	Xidx	int
+
+	// other variables added to the numerator, empty unless the
+	// expression combines several indices
+	Terms	[]PTerm
+
+	// if not zero, the value wraps around, it is taken modulo M and
+	// is always from 0 to M-1
+	M	int64
+}
+
+// a*x, x variable
+type PTerm struct {
+	A	int64
+	Xidx	int
+}
+
+// Period of a wrapped index of a destination array. The element is in
+// the array at all the indices that wrap to the value of Expr, which has
+// to be from 0 to M-1. The period is a variable of the index expressions,
+// from Min to Max. An index of the destination that can't be calculated
+// from the dataset indices is a period with M 0, going through all its
+// values.
+type PPeriod struct {
+	Expr	PExpr
+	M	int64
+	Min	int64
+	Max	int64
 }
 
 func (p *PExpr) calc(xa []int64) (q int64, r int64) {
@@ -19,15 +47,320 @@ func (p *PExpr) calc(xa []int64) (q int64, r int64) {
 	// TODO: handle overflows
 	n := x*p.A + p.B
 	m := x*p.C + p.D
+	for _, t := range p.Terms {
+		n += xa[t.Xidx]*t.A
+	}
+
 	q = n / m
 	r = n % m
+	if p.M != 0 {
+		q %= p.M
+		if q < 0 {
+			q += p.M
+		}
+	}
+
 	return
 }
 
+// returns the coefficient of variable i in the numerator
+func (p *PExpr) coef(i int) (a int64) {
+	if p.Xidx == i {
+		a = p.A
+	}
+
+	for _, t := range p.Terms {
+		if t.Xidx == i {
+			a += t.A
+		}
+	}
+
+	return
+}
+
+// true if the value of the expression depends on variable i
+func (p *PExpr) uses(i int) bool {
+	return p.coef(i) != 0 || p.Xidx == i && p.C != 0
+}
+
 //func (p *PExpr) String() string {
 //	return fmt.Sprintf("(%d | %d, %d, %d, %d)", p.Xidx, p.A, p.B, p.C, p.D)
 //}
 
 func (p PExpr) String() string {
-	return fmt.Sprintf("(%d | %d, %d, %d, %d)", p.Xidx, p.A, p.B, p.C, p.D)
+	s := fmt.Sprintf("(%d | %d, %d, %d, %d", p.Xidx, p.A, p.B, p.C, p.D)
+	for _, t := range p.Terms {
+		s += fmt.Sprintf(" + %d*%d", t.A, t.Xidx)
+	}
+
+	if p.M != 0 {
+		s += fmt.Sprintf(" %% %d", p.M)
+	}
+
+	return s + ")"
+}
+
+// Returns the range [min, max] of the value of p, without wrapping it,
+// for the indices of an array with dimensions dim. p can't divide by an
+// index.
+func (p *PExpr) span(dim []int64) (min, max int64) {
+	min, max = p.B, p.B
+	for i, a := range pexprTerms(p) {
+		if i >= len(dim) || dim[i] == 0 {
+			continue
+		}
+
+		x, y := int64(0), a*(dim[i] - 1)
+		if x > y {
+			x, y = y, x
+		}
+
+		min += x
+		max += y
+	}
+
+	min, max = floorDiv(min, p.D), floorDiv(max, p.D)
+	if min > max {
+		min, max = max, min
+	}
+
+	return
+}
+
+// returns the coefficients of the variables used by p
+func pexprTerms(p *PExpr) map[int]int64 {
+	n := make(map[int]int64)
+	if p.A != 0 {
+		n[p.Xidx] += p.A
+	}
+
+	for _, t := range p.Terms {
+		n[t.Xidx] += t.A
+	}
+
+	return n
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+
+	return q
+}
+
+// linear form a·x + b over n variables
+type lform struct {
+	a	[]int64
+	b	int64
+}
+
+// n / m, the expressions are composed in this form and converted back
+// to PExpr when done
+type frac struct {
+	n, m	lform
+}
+
+func constForm(nvar int, b int64) lform {
+	return lform{make([]int64, nvar), b}
+}
+
+func (l lform) isConst() bool {
+	for _, a := range l.a {
+		if a != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// k1*l1 + k2*l2
+func (l1 lform) comb(k1 int64, l2 lform, k2 int64) lform {
+	l := constForm(len(l1.a), k1*l1.b + k2*l2.b)
+	for i := range l.a {
+		l.a[i] = k1*l1.a[i] + k2*l2.a[i]
+	}
+
+	return l
+}
+
+var errNonLinear = errors.New("non-linear index expression")
+
+// l1*l2, one of them has to be constant
+func (l1 lform) mul(l2 lform) (lform, error) {
+	if !l1.isConst() && !l2.isConst() {
+		return lform{}, errNonLinear
+	}
+
+	if l1.isConst() {
+		return l2.comb(l1.b, l2, 0), nil
+	}
+
+	return l1.comb(l2.b, l1, 0), nil
+}
+
+// the value of the source variable i
+func varFrac(nvar, i int) frac {
+	f := frac{constForm(nvar, 0), constForm(nvar, 1)}
+	f.n.a[i] = 1
+	return f
+}
+
+func (f frac) add(g frac) (frac, error) {
+	n1, err := f.n.mul(g.m)
+	if err != nil {
+		return frac{}, err
+	}
+
+	n2, err := g.n.mul(f.m)
+	if err != nil {
+		return frac{}, err
+	}
+
+	m, err := f.m.mul(g.m)
+	if err != nil {
+		return frac{}, err
+	}
+
+	return frac{n1.comb(1, n2, 1), m}, nil
+}
+
+func (f frac) scale(k int64) frac {
+	return frac{f.n.comb(k, f.n, 0), f.m}
+}
+
+// Substitutes the values of the variables of p with xs, the values use
+// nvar variables.
+func (p *PExpr) subst(xs []frac, nvar int) (frac, error) {
+	var err error
+
+	if p.Terms == nil {
+		x := frac{constForm(nvar, 0), constForm(nvar, 1)}
+		if p.Xidx >= 0 && p.Xidx < len(xs) {
+			x = xs[p.Xidx]
+		}
+
+		// (a(xn/xm) + b) / (c(xn/xm) + d)
+		return frac{x.n.comb(p.A, x.m, p.B), x.n.comb(p.C, x.m, p.D)}, nil
+	}
+
+	n := frac{constForm(nvar, p.B), constForm(nvar, 1)}
+	if n, err = n.add(xs[p.Xidx].scale(p.A)); err != nil {
+		return frac{}, err
+	}
+
+	for _, t := range p.Terms {
+		if n, err = n.add(xs[t.Xidx].scale(t.A)); err != nil {
+			return frac{}, err
+		}
+	}
+
+	n.m = n.m.comb(p.D, n.m, 0)
+	return n, nil
+}
+
+// Solves p(..., x, ...) = u for the variable i, the other variables of p
+// have the values xs.
+func (p *PExpr) solve(i int, u frac, xs []frac) (frac, error) {
+	if p.Terms == nil {
+		// (ax + b) / (cx + d) = u  =>  x = (du - b) / (a - cu)
+		return frac{u.n.comb(p.D, u.m, -p.B), u.m.comb(p.A, u.n, -p.C)}, nil
+	}
+
+	// a*x + rest = d*u  =>  x = (d*u - rest) / a
+	a := p.coef(i)
+	q := *p
+	q.Terms = nil
+	for _, t := range p.Terms {
+		if t.Xidx != i {
+			q.Terms = append(q.Terms, t)
+		}
+	}
+
+	if q.Xidx == i {
+		q.A = 0
+	}
+
+	q.D = 1
+	rest, err := q.subst(xs, len(u.n.a))
+	if err != nil {
+		return frac{}, err
+	}
+
+	v, err := u.scale(p.D).add(rest.scale(-1))
+	if err != nil {
+		return frac{}, err
+	}
+
+	v.m = v.m.comb(a, v.m, 0)
+	return v, nil
+}
+
+func gcd(a, b int64) int64 {
+	if a < 0 {
+		a = -a
+	}
+
+	if b < 0 {
+		b = -b
+	}
+
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+// Converts f back to PExpr. The denominator can only use one variable.
+func (f frac) pexpr() (PExpr, error) {
+	var p PExpr
+
+	g := gcd(f.n.b, f.m.b)
+	for i := range f.n.a {
+		g = gcd(g, gcd(f.n.a[i], f.m.a[i]))
+	}
+
+	if g == 0 {
+		g = 1
+	}
+
+	if f.m.isConst() && f.m.b < 0 {
+		g = -g
+	}
+
+	p.Xidx = -1
+	for i, c := range f.m.a {
+		if c == 0 {
+			continue
+		}
+
+		if p.Xidx >= 0 {
+			return p, errNonLinear
+		}
+
+		p.Xidx = i
+		p.C = c / g
+	}
+
+	for i, a := range f.n.a {
+		switch {
+		case a == 0:
+		case p.Xidx < 0 || p.Xidx == i:
+			p.Xidx = i
+			p.A = a / g
+		default:
+			p.Terms = append(p.Terms, PTerm{a / g, i})
+		}
+	}
+
+	if p.Xidx < 0 {
+		p.Xidx = 0
+	}
+
+	p.B = f.n.b / g
+	p.D = f.m.b / g
+	return p, nil
 }
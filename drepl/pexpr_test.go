@@ -0,0 +1,50 @@
+package drepl
+
+import (
+	"testing"
+)
+
+// the product of two forms that use variables isn't linear
+func TestMulNonLinear(t *testing.T) {
+	x := varFrac(2, 0)
+	y := varFrac(2, 1)
+	if _, err := x.n.mul(y.n); err != errNonLinear {
+		t.Errorf("x*y: got %v, expecting %v", err, errNonLinear)
+	}
+
+	l, err := x.n.mul(constForm(2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l.a[0] != 3 || l.a[1] != 0 || l.b != 0 {
+		t.Errorf("x*3: got %v", l)
+	}
+}
+
+// the indices of an array are calculated from the indices of another
+// array of the same dataset array
+func TestComposeExpr(t *testing.T) {
+	// a[i + j] read by a[2*k]
+	e1 := []PExpr{{A: 1, D: 1, Xidx: 0, Terms: []PTerm{{1, 1}}}}
+	c, err := composeExpr(e1, []PExpr{{A: 2, D: 1, Xidx: 0}}, 2, []int64{5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.expr) != 1 {
+		t.Fatalf("got %d expressions, expecting 1", len(c.expr))
+	}
+
+	// i = 3, j = 5 is k = 4
+	if q, r := c.expr[0].calc([]int64{3, 5}); q != 4 || r != 0 {
+		t.Errorf("got %d remainder %d, expecting 4", q, r)
+	}
+
+	// a[i + j] read by a[k / (k + 1)], k is (i + j) / (1 - i - j) with
+	// both indices in the denominator
+	_, err = composeExpr(e1, []PExpr{{A: 1, C: 1, D: 1, Xidx: 0}}, 2, []int64{5})
+	if err != errNonLinear {
+		t.Errorf("got %v, expecting %v", err, errNonLinear)
+	}
+}
@@ -0,0 +1,52 @@
+package drepl
+
+// Number of records of an unlimited (appendable) leading array dimension.
+// All array blocks that describe the same dataset variable share the
+// same Records and grow together.
+type Records struct {
+	n	int64
+	blks	[]*ABlock
+}
+
+func NewRecords() *Records {
+	return new(Records)
+}
+
+// Returns the current number of records
+func (r *Records) Len() int64 {
+	return r.n
+}
+
+func (r *Records) add(b *ABlock) {
+	b.recs = r
+	b.setRecords(r.n)
+	r.blks = append(r.blks, b)
+}
+
+// Sets the number of records to n in all blocks and lays out the replicas
+// that contain them again
+func (r *Records) grow(n int64) error {
+	var repls []*Replica
+
+	seen := make(map[*Replica]bool)
+	r.n = n
+	for _, b := range r.blks {
+		b.setRecords(n)
+		if rp := b.view.repl; rp != nil && !seen[rp] {
+			seen[rp] = true
+			repls = append(repls, rp)
+		}
+	}
+
+	for _, rp := range repls {
+		if err := rp.resize(); err != nil {
+			return err
+		}
+
+		if err := rp.saveFingerprint(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package drepl
+
+import (
+	"errors"
+	"math"
+)
+
+// aggregation functions of the reduced arrays
+const (
+	ReduceMean = 1 + iota
+	ReduceMin
+	ReduceMax
+	ReduceSum
+)
+
+// Windows of an unmaterialized array whose elements are reduced from
+// several elements of the source. The windows are additional variables
+// of the expressions that calculate the source indices, following the
+// indices of the array, the k-th goes from 0 to win[k]-1.
+type Reduce struct {
+	op	int
+	win	[]int64
+}
+
+// materialized reduction to update when an array of the same dataset
+// array is written, c calculates the indices of the reduced array and of
+// its windows from the indices of the written one
+type rdep struct {
+	arr	*ABlock
+	c	ADest
+}
+
+// running value of a reduction
+type accum struct {
+	op	int
+	n	int64		// number of values
+	i	int64		// integers
+	f	float64		// floating point values
+}
+
+// Reduces the elements of the array over the windows win with the
+// aggregation function op. The elements have to be numbers, and the
+// array has to belong to a readonly view.
+func (b *ABlock) SetReduce(op int, win []int64) {
+	b.red = &Reduce{op: op, win: win}
+}
+
+func (b *ABlock) Reduction() *Reduce {
+	return b.red
+}
+
+// Returns true if the view has arrays with reduced elements
+func (v *View) Reduced() bool {
+	for _, b := range v.bs.blks {
+		if ab, ok := b.(*ABlock); ok && ab.red != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dimensions of the variables of the expressions that calculate the
+// dataset indices, the windows follow the indices of the array
+func (b *ABlock) vardim() []int64 {
+	if b.red == nil {
+		return b.dim
+	}
+
+	return append(append([]int64(nil), b.dim...), b.red.win...)
+}
+
+// Reads the elements of the source in the windows of the element with
+// the indices idx, and stores the reduced value in dst. The variables of
+// the windows follow the indices in idx.
+func (b *ABlock) reduce(idx []int64, dst []byte) error {
+	r := b.red
+	d := b.src
+	sb, ok := b.elblk.(*SBlock)
+	if !ok || sb.ntype == NoType {
+		return errors.New("only numbers can be reduced")
+	}
+
+	n := len(idx) - len(r.win) - len(b.gather)
+	w := idx[n:n + len(r.win)]
+	for i := range w {
+		w[i] = 0
+	}
+
+	didx := make([]int64, len(d.expr))
+	buf := make([]byte, d.arr.elsize)
+	el := make([]byte, len(dst))
+	a := accum{op: r.op}
+	for {
+		// the elements outside of the default view don't count
+		if d.first(idx, didx) {
+			if err := d.readElement(didx, buf, el); err != nil {
+				return err
+			}
+
+			a.add(sb, el)
+		}
+
+		// next value of the windows
+		i := len(w) - 1
+		for ; i >= 0 && w[i] >= r.win[i] - 1; i-- {
+			w[i] = 0
+		}
+
+		if i < 0 {
+			break
+		}
+
+		w[i]++
+	}
+
+	policy := ConvSaturate
+	if sb.view != nil {
+		policy = sb.view.conv
+	}
+
+	return a.put(sb, dst, policy)
+}
+
+func (a *accum) add(b *SBlock, el []byte) {
+	if isFloat(b.ntype) {
+		v := getFloat(b, el)
+		switch {
+		case a.n == 0:
+			a.f = v
+		case a.op == ReduceMin:
+			a.f = math.Min(a.f, v)
+		case a.op == ReduceMax:
+			a.f = math.Max(a.f, v)
+		default:
+			a.f += v
+		}
+	} else {
+		v := getInt(b, el)
+		switch {
+		case a.n == 0:
+			a.i = v
+		case a.op == ReduceMin:
+			if v < a.i {
+				a.i = v
+			}
+		case a.op == ReduceMax:
+			if v > a.i {
+				a.i = v
+			}
+		default:
+			a.i += v
+		}
+	}
+
+	a.n++
+}
+
+// stores the reduced value in dst, converted with the policy
+func (a *accum) put(b *SBlock, dst []byte, policy int) error {
+	switch {
+	case a.n == 0:
+		// none of the elements has a value
+		for i := range dst {
+			dst[i] = 0
+		}
+
+		return nil
+
+	case a.op == ReduceMean && isFloat(b.ntype):
+		return putFloat(b, dst, a.f / float64(a.n), policy)
+
+	case a.op == ReduceMean:
+		return putFloat(b, dst, float64(a.i) / float64(a.n), policy)
+
+	case isFloat(b.ntype):
+		return putFloat(b, dst, a.f, policy)
+	}
+
+	return putInt(b, dst, a.i, policy)
+}
+
+// Finds the materialized reductions (without index arrays, those are
+// refreshed) of the dataset array b, and makes all other arrays of b
+// update their elements when written.
+func (b *ABlock) connectReductions() error {
+	for _, rd := range b.dests {
+		r := rd.arr
+		if r.red == nil || r.gather != nil || r.view.repl == nil {
+			continue
+		}
+
+		// the indices of the windows are checked like the ones of
+		// the array
+		dim := r.vardim()
+		for _, d := range b.dests {
+			if d.arr.gather != nil || d.arr.gatherer != nil || d.arr.view.IsReadonly() {
+				continue
+			}
+
+			c, err := composeExpr(d.expr, rd.expr, d.arr.nvar(), dim)
+			if err != nil {
+				return err
+			}
+
+			dep := &rdep{arr: r, c: c}
+			dep.c.arr = &ABlock{dim: dim}
+			d.arr.rdeps = append(d.arr.rdeps, dep)
+		}
+	}
+
+	return nil
+}
+
+// Updates the elements of the materialized reductions that use the
+// elements of b written at offset
+func (b *ABlock) updateReductions(data []byte, offset, base int64) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	off := offset - base
+	first := off / b.elsize
+	last := (off + int64(len(data)) - 1) / b.elsize
+	idx := make([]int64, len(b.dim))
+	for _, dep := range b.rdeps {
+		var err error
+
+		r := dep.arr
+		ridx := make([]int64, len(dep.c.expr))
+		done := make(map[int64]bool)
+		for n := first; n <= last && n < b.elnum; n++ {
+			b.elo.ToIdx(n, idx, b.dim)
+			dep.c.each(idx, ridx, func() bool {
+				m := r.elo.FromIdx(ridx[0:len(r.dim)], r.dim)
+				if !done[m] {
+					done[m] = true
+					err = r.update(m)
+				}
+
+				return err != nil
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// reads the element m of the reduction again, and writes it to the view
+func (b *ABlock) update(m int64) error {
+	buf := make([]byte, b.elsize)
+	off := b.offset + m*b.elsize
+	if _, err := b.readSource(buf, off, b.offset); err != nil {
+		return err
+	}
+
+	_, err := b.view.Write(buf, off)
+	return err
+}
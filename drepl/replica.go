@@ -16,6 +16,7 @@ type Replica struct {
 
 	data		[]byte
 	s, e		int64		// start and end of the dirty region in data
+	fpname		string		// file with the fingerprint, see CheckFingerprint
 }
 
 func NewReplica(name, fname string) *Replica {
@@ -57,6 +58,16 @@ func (r *Replica) Size() int64 {
 	return v.offset + v.Size()
 }
 
+// Assigns the offsets of the views, in the order they were added to the
+// replica
+func (r *Replica) Layout() {
+	offset := int64(0)
+	for _, v := range r.views {
+		v.offset = offset
+		offset += v.Size()
+	}
+}
+
 func (r *Replica) SetFile(f *os.File) error {
 	r.f = f
 
@@ -67,11 +78,76 @@ func (r *Replica) SetFile(f *os.File) error {
 		return err
 	}
 
-	r.data, err = syscall.Mmap(int(f.Fd()), 0, int(sz), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	return r.mmap(sz)
+}
+
+func (r *Replica) mmap(sz int64) (err error) {
+	if r.data != nil {
+		err = syscall.Munmap(r.data)
+		r.data = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	if sz == 0 {
+		// can't map empty files
+		return nil
+	}
+
+	r.data, err = syscall.Mmap(int(r.f.Fd()), 0, int(sz), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	return err
+}
+
+// Lays out the views again after some of them grew. The data of the
+// views after the grown ones is moved towards the end of the file.
+func (r *Replica) resize() error {
+	old := make([]int64, len(r.views) + 1)
+	for i, v := range r.views {
+		old[i] = v.offset
+	}
+
+	old[len(r.views)] = int64(len(r.data))
+	r.Layout()
+	if r.f == nil {
+		return nil
+	}
+
+	sz := r.Size()
+	if sz == int64(len(r.data)) {
+		return nil
+	}
+
+	err := r.f.Truncate(sz)
+	if err == nil {
+		err = r.mmap(sz)
+	}
+
 	if err != nil {
 		return err
 	}
 
+	for i := len(r.views) - 1; i >= 0; i-- {
+		v := r.views[i]
+		osz := old[i+1] - old[i]
+		if v.offset == old[i] && v.Size() == osz {
+			continue
+		}
+
+		copy(r.data[v.offset:v.offset + osz], r.data[old[i]:old[i+1]])
+
+		// clear the space the view grew with
+		for n := v.offset + osz; n < v.offset + v.Size(); n++ {
+			r.data[n] = 0
+		}
+
+		if r.e <= r.s || r.s > old[i] {
+			r.s = old[i]
+		}
+
+		r.e = sz
+	}
+
 	return nil
 }
 
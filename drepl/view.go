@@ -1,7 +1,9 @@
 package drepl
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 )
 
 type View struct {
@@ -12,11 +14,14 @@ type View struct {
 	bs		BlockSeq
 	dflt		*View		// default view for unmaterialized views
 	readonly	bool
+	conv		int		// conversion policy for values written to the view
+	selmu		sync.Mutex	// serializes the calls to Select
 }
 
 type BlockSeq struct {
 	v 		*View
 	blks		[]Block
+	pad		int64		// padding after the last block
 }
 
 // creates a view that doesn't belong to a replica (unmaterialized view)
@@ -43,10 +48,24 @@ func (v *View) SetDefaultView(dv *View) {
 	v.dflt = dv
 }
 
+func (v *View) DefaultView() *View {
+	return v.dflt
+}
+
 func (v *View) IsReadonly() bool {
 	return v.readonly
 }
 
+// Sets how numeric values that don't fit in the view's types are converted
+// (ConvSaturate, ConvWrap or ConvExact)
+func (v *View) SetConversion(conv int) {
+	v.conv = conv
+}
+
+func (v *View) Conversion() int {
+	return v.conv
+}
+
 func (v *View) Blocks() *BlockSeq {
 	return &v.bs
 }
@@ -67,6 +86,55 @@ func (v *View) Write(data []byte, offset int64) (int64, error) {
 	return v.repl.Write(data, offset + v.offset)
 }
 
+// Returns the array with unlimited dimension at the end of the view, if any
+func (v *View) records() *ABlock {
+	if n := len(v.bs.blks); n > 0 {
+		if b, ok := v.bs.blks[n - 1].(*ABlock); ok && b.recs != nil {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// Returns true if records can be appended to the view
+func (v *View) Appendable() bool {
+	return v.records() != nil
+}
+
+// Appends whole records to the array with unlimited dimension at the end
+// of the view. All views that contain the same variable grow too.
+func (v *View) Append(data []byte) (count int64, err error) {
+	b := v.records()
+	if b == nil {
+		return 0, errors.New("view has no unlimited dimension")
+	}
+
+	rsz := b.recordSize()
+	if rsz == 0 || int64(len(data)) % rsz != 0 {
+		return 0, errors.New("partial record")
+	}
+
+	offset := b.offset + b.size
+	err = b.recs.grow(b.recs.n + int64(len(data)) / rsz)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, blk := range v.Search(offset, int64(len(data))) {
+		n, err := blk.Write(data, offset, blk.Offset(), true, true)
+		if err != nil {
+			return count, err
+		}
+
+		offset += n
+		count += n
+		data = data[n:]
+	}
+
+	return count, nil
+}
+
 func (v *View) Sync() error {
 	return v.repl.Sync()
 }
@@ -90,7 +158,17 @@ func (bs *BlockSeq) Size() (sz int64) {
 		sz = b.Offset() + b.Size()
 	}
 
-	return
+	return sz + bs.pad
+}
+
+// Adds padding bytes (not described by any block) at the end of the sequence
+func (bs *BlockSeq) Pad(n int64) {
+	bs.pad += n
+}
+
+func (bs *BlockSeq) add(b Block) {
+	bs.blks = append(bs.blks, b)
+	bs.pad = 0
 }
 
 func (bs *BlockSeq) NewSBlock(size int64) *SBlock {
@@ -98,7 +176,7 @@ func (bs *BlockSeq) NewSBlock(size int64) *SBlock {
 	b.view = bs.v
 	b.offset = bs.Size()
 	b.size = size
-	bs.blks = append(bs.blks, b)
+	bs.add(b)
 
 	return b
 }
@@ -113,6 +191,7 @@ func (bs *BlockSeq) NewABlock(elsize int64, dim []int64, el Block) *ABlock {
 	ab.offset = bs.Size()
 	ab.elsize = elsize
 	ab.dim = dim
+	ab.elo = bs.v.elo
 	ab.elnum = 1
 	for _, m := range(dim) {
 		ab.elnum *= m
@@ -120,7 +199,7 @@ func (bs *BlockSeq) NewABlock(elsize int64, dim []int64, el Block) *ABlock {
 
 	ab.size = ab.elnum * elsize
 	ab.elblk = el
-	bs.blks = append(bs.blks, ab)
+	bs.add(ab)
 
 	return ab
 }
@@ -131,7 +210,7 @@ func (bs *BlockSeq) NewTBlock(bbs *BlockSeq) *TBlock {
 	tb.offset = bs.Size()
 	tb.bs = *bbs
 	tb.size = bbs.Size()
-	bs.blks = append(bs.blks, Block(tb))
+	bs.add(tb)
 
 	return tb
 }
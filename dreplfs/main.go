@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"sync"
 	"syscall"
 //	"unsafe"
 	"github.com/lionkov/go9p/p"
@@ -22,24 +23,57 @@ type Drfs struct {
 type ViewFile struct {
 	srv.File
 	v	*drepl.View
+	sel	sync.RWMutex	// held by Open to select the elements of the view
 }
 
 var addr = flag.String("addr", ":5640", "network address")
 var debug = flag.Bool("d", false, "print debug messages")
-var debugall = flag.Bool("D", false, "print packets as well as debug messages")
+var debugall = flag.Bool("dd", false, "print packets as well as debug messages")
 
-var sync = flag.Bool("sync", true, "sync the other view in the background")
+var dosync = flag.Bool("sync", true, "sync the other view in the background")
 var domsync = flag.Bool("msync", false, "msync after each write")
 var graph = flag.Bool("g", false, "output a dot graph file")
 
+var defines = make(parser.Defines)
+
 var Ewrite = &p.Error{"invalid offset", uint32(syscall.EIO)}
+var Ereadonly = &p.Error{"read-only view", uint32(syscall.EROFS)}
 
 func toError(err error) *p.Error {
 	return &p.Error{err.Error(), uint32(syscall.EIO)}
 }
 
+// the view grows when records are appended to it, or to other views
+// that contain the same variables
+func (v *ViewFile) Stat(fid *srv.FFid) error {
+	v.sel.RLock()
+	defer v.sel.RUnlock()
+	v.Length = uint64(v.v.Size())
+	return nil
+}
+
+// the elements of the views with value predicates are selected when the
+// view is opened, the reads and writes of other clients wait until the
+// selection is done
+func (v *ViewFile) Open(fid *srv.FFid, mode uint8) error {
+	if v.v.Filtered() {
+		v.sel.Lock()
+		defer v.sel.Unlock()
+		if err := v.v.Select(); err != nil {
+			return toError(err)
+		}
+
+		v.Length = uint64(v.v.Size())
+	}
+
+	return nil
+}
+
 func (v *ViewFile) Read(fid *srv.FFid, data []byte, offset uint64) (count int, err error) {
+	v.sel.RLock()
+	defer v.sel.RUnlock()
 //	fmt.Printf("ViewFile.Read\n")
+	v.Length = uint64(v.v.Size())
 	count = len(data)
 	if offset > v.Length {
 		count = 0
@@ -75,6 +109,26 @@ func (v *ViewFile) Read(fid *srv.FFid, data []byte, offset uint64) (count int, e
 }
 
 func (v *ViewFile) Write(fid *srv.FFid, data []byte, offset uint64) (count int, err error) {
+	var adata []byte
+
+	if v.v.IsReadonly() {
+		return 0, Ereadonly
+	}
+
+	v.sel.RLock()
+	defer v.sel.RUnlock()
+
+	// writes past the end of the view append records
+	sz := uint64(v.v.Size())
+	if offset + uint64(len(data)) > sz && v.v.Appendable() {
+		if offset > sz {
+			return 0, Ewrite
+		}
+
+		adata = data[sz - offset:]
+		data = data[0:sz - offset]
+	}
+
 	blks := v.v.Search(int64(offset), int64(len(data)))
 //	fmt.Printf("ViewFile.Write blks %v\n", blks)
 	for _, b := range blks {
@@ -94,6 +148,15 @@ func (v *ViewFile) Write(fid *srv.FFid, data []byte, offset uint64) (count int,
 		return 0, errors.New("short write")
 	}
 
+	if len(adata) > 0 {
+		n, err := v.v.Append(adata)
+		count += int(n)
+		v.Length = uint64(v.v.Size())
+		if err != nil {
+			return count, err
+		}
+	}
+
 	if (*domsync) {
 		err = v.v.Sync()
 	}
@@ -108,6 +171,12 @@ func (*Drfs) ConnClosed(c *srv.Conn) {
 	os.Exit(0)
 }
 
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: dreplfs [flags] description\n")
+	fmt.Fprintf(os.Stderr, "-D NAME=value overrides a constant as in the other tools, the packets\nare printed with -dd (they were printed with -D before)\n")
+	flag.PrintDefaults()
+}
+
 func main() {
 	var oerr error
 	var s *Drfs
@@ -115,14 +184,16 @@ func main() {
 	var g *drepl.Graph
 
 	user := p.OsUsers.Uid2User(os.Geteuid())
+	flag.Var(defines, "D", "override the constant, as NAME=value")
+	flag.Usage = usage
 	flag.Parse()
 
 	if flag.NArg() != 1 {
-		fmt.Printf("invalid arguments")
+		flag.Usage()
 		return
 	}
 
-	dr, err := parser.Parse(flag.Arg(0))
+	dr, err := parser.ParseFile(flag.Arg(0), &parser.Options{Overrides: defines})
 	if err != "" {
 		fmt.Printf("Error: %s\n", err);
 		return
@@ -145,7 +216,13 @@ func main() {
 	}
 
 	for _, r := range repls {
-		f, err := os.Create(r.FileName)
+		// keep the data of the files written using the same layout
+		if err := r.CheckFingerprint(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		f, err := os.OpenFile(r.FileName, os.O_RDWR|os.O_CREATE, 0666)
 		if err != nil {
 			oerr = err
 			goto oerror
@@ -162,14 +239,19 @@ func main() {
 		pf := new(ViewFile)
 		pf.v = v
 //		fmt.Printf("unmaterialized view %s %v\n", v.Name, v)
-		oerr = pf.Add(root, v.Name, user, nil, 0666, pf)
+		mode := uint32(0666)
+		if v.IsReadonly() {
+			mode = 0444
+		}
+
+		oerr = pf.Add(root, v.Name, user, nil, mode, pf)
 		if oerr != nil {
 			goto oerror
 		}
 		pf.Length = uint64(v.Size())
 	}
 
-	drepl.AsyncWrite = !*sync
+	drepl.AsyncWrite = !*dosync
 
 	s = new(Drfs)
 	s.Root = root
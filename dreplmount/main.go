@@ -11,11 +11,13 @@ import (
 )
 
 var sync = flag.Bool("s", true, "synchronous writes")
+var defines = make(parser.Defines)
 
 func main() {
 	var e *drepl.Exporter
 	var flags uint32
 
+	flag.Var(defines, "D", "override the constant, as NAME=value")
 	flag.Parse()
 	if flag.NArg() != 2 {
 		fmt.Printf("invalid arguments")
@@ -26,7 +28,7 @@ func main() {
 		flags = 1
 	}
 
-	dr, err := parser.Parse(flag.Arg(0))
+	dr, err := parser.ParseFile(flag.Arg(0), &parser.Options{Overrides: defines})
 	if err != "" {
 		fmt.Printf("%s\n", err)
 		return
@@ -40,7 +42,13 @@ func main() {
 
 	e = drepl.NewExporter()
 	for _, r := range repls {
-		f, err := os.Create(r.FileName)
+		// keep the data of the files written using the same layout
+		if err := r.CheckFingerprint(); err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(1)
+		}
+
+		f, err := os.OpenFile(r.FileName, os.O_RDWR|os.O_CREATE, 0666)
 		if err != nil {
 			fmt.Printf("%s\n", err)
 			return
@@ -58,6 +66,27 @@ func main() {
 	}
 
 	for _, v := range views {
+		if v.Filtered() {
+			// the kernel module can't select the elements
+			fmt.Printf("view %s: value predicates are not supported\n", v.Name)
+			os.Exit(1)
+		}
+
+		if v.Gathered() {
+			fmt.Printf("view %s: index arrays are not supported\n", v.Name)
+			os.Exit(1)
+		}
+
+		if v.Reduced() {
+			fmt.Printf("view %s: reductions are not supported\n", v.Name)
+			os.Exit(1)
+		}
+
+		if v.Computed() {
+			fmt.Printf("view %s: computed fields are not supported\n", v.Name)
+			os.Exit(1)
+		}
+
 		e.AddView(v)
 //		fmt.Printf("%v\n", v);
 	}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"drepl/parser"
+)
+
+var list = flag.Bool("l", false, "list the files whose formatting differs")
+var write = flag.Bool("w", false, "write the result to the file instead of stdout")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: drfmt [-l] [-w] [file ...]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func printError(err error) {
+	if _, ok := err.(parser.ErrorList); ok {
+		// already formatted, one error per line
+		fmt.Fprintf(os.Stderr, "%v", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+}
+
+func format(fname string, src []byte, out io.Writer) error {
+	res, err := parser.Format(fname, src)
+	if err != nil {
+		return err
+	}
+
+	if *list && !bytes.Equal(src, res) {
+		fmt.Fprintln(out, fname)
+	}
+
+	if *write {
+		if !bytes.Equal(src, res) {
+			return os.WriteFile(fname, res, 0666)
+		}
+
+		return nil
+	}
+
+	if !*list {
+		_, err = out.Write(res)
+	}
+
+	return err
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	status := 0
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(os.Stderr, "Error: can't use -w with the standard input\n")
+			os.Exit(2)
+		}
+
+		src, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = format("<stdin>", src, os.Stdout)
+		}
+
+		if err != nil {
+			printError(err)
+			status = 1
+		}
+	}
+
+	for _, fname := range flag.Args() {
+		src, err := os.ReadFile(fname)
+		if err == nil {
+			err = format(fname, src, os.Stdout)
+		}
+
+		if err != nil {
+			printError(err)
+			status = 1
+		}
+	}
+
+	os.Exit(status)
+}
@@ -17,6 +17,8 @@ var rb = "replica b \"b\" {view b\n}";
 var vb1 = "view b {\nvar b = b\n}";
 var rb1 = "replica b \"b\" {view b\n}";
 
+var defines = make(parser.Defines)
+
 func outputGraph(dr *parser.DRepl, fname string) {
 	_, views, err := dr.CreateTransformationRules()
 	if err != "" {
@@ -40,13 +42,14 @@ func outputGraph(dr *parser.DRepl, fname string) {
 }
 
 func main() {
+	flag.Var(defines, "D", "override the constant, as NAME=value")
 	flag.Parse()
 	if flag.NArg() != 1 {
 		fmt.Printf("invalid arguments\n")
 		return
 	}
 
-	dr, err := parser.Parse(flag.Arg(0))
+	dr, err := parser.ParseFile(flag.Arg(0), &parser.Options{Overrides: defines})
 	if err != "" {
 		fmt.Printf("%s\n", err)
 		return
@@ -4,7 +4,7 @@
 
 #define BUFSZ 1024*1024
 
-static inline void drepl_block_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel);
+static inline int drepl_block_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel);
 static s64 drepl_ablock_read_seq(drepl_block *b, u8 __user *data, u64 datalen, u64 offset, u64 base);
 static s64 drepl_ablock_replicate_seq(drepl_block *b, const char __user *data, u64 datalen, u64 offset, u64 base);
 
@@ -21,17 +21,26 @@ static int drepl_is_seq(drepl_block *b, drepl_dest *d)
 		return 0;
 	}
 
-	if (b->view->elo != db->view->elo) {
-//		printk(KERN_DEFAULT "b elo %d db elo %d\n", b->view->elo, db->view->elo);
+	if (!drepl_elo_equal(b, db)) {
+//		printk(KERN_DEFAULT "b elo %d db elo %d\n", b->elo, db->elo);
+		return 0;
+	}
+
+	if (d->ncond != 0 || d->nwrap != 0 || d->nperiod != 0) {
 		return 0;
 	}
 
 	for(i = 0; i < d->nexpr; i++) {
 		e = &d->expr[i];
-		if (e->a*e->d != 1 || e->xidx != i) {
+		if (e->a*e->d != 1 || e->c != 0 || e->nterm != 0 || e->m != 0 || e->xidx != i) {
 //			printk(KERN_DEFAULT "i %d e->a %lld e->b %lld e->c %lld e->d %lld e->xidx %d\n", i, e->a, e->b, e->c, e->d, e->xidx);
 			return 0;
 		}
+
+		// all elements have to be in the destination array
+		if (e->b*e->d < 0 || b->dim[i] + e->b*e->d > db->dim[i]) {
+			return 0;
+		}
 	}
 
 //	printk(KERN_DEFAULT "drepl_is_seq TRUE\n");
@@ -52,23 +61,60 @@ static inline int drepl_block_is_dest(drepl_block *b, drepl_block *d) {
 
 static s64 drepl_sblock_read(drepl_block *b, u8 __user *data, u64 datalen, u64 offset, u64 base)
 {
+	u8 sbuf[8], dbuf[8];
+	drepl_block *sb;
+	s64 ret;
+	mm_segment_t old_fs;
+
 //	printk(KERN_DEFAULT "drepl_sblock_read %p offset %llu datalen %d\n", b, offset, datalen);
 	if (b->view->repl) {
 		return drepl_repl_read(b->view->repl, data, datalen, b->view->offset + offset);
 	}
 
 	// Unmaterialized view
-	return drepl_block_read(b->src.arr, data, datalen, offset - base - b->offset + b->src.arr->offset, 0);
+	sb = b->src.arr;
+	if (!drepl_converted(sb, b)) {
+		return drepl_block_read(sb, data, datalen, offset - base - b->offset + sb->offset, 0);
+	}
+
+	// read the whole value so it can be converted, converted
+	// values are always numbers, at most 8 bytes long
+	old_fs = get_fs();
+	set_fs(KERNEL_DS);
+	ret = drepl_block_read(sb, sbuf, sb->size, sb->offset, 0);
+	set_fs(old_fs);
+	if (ret < 0) {
+		return ret;
+	}
+
+	if (ret != sb->size) {
+		return -EIO;
+	}
+
+	ret = drepl_convert(sb, b, sbuf, dbuf, 1);
+	if (ret < 0) {
+		return ret;
+	}
+
+	ret = b->size - (offset - base - b->offset);
+	if (ret > datalen) {
+		ret = datalen;
+	}
+
+	if (copy_to_user(data, &dbuf[offset - base - b->offset], ret)) {
+		return -EFAULT;
+	}
+
+	return ret;
 }
 
 static s64 drepl_ablock_read(drepl_block *b, u8 __user *data, u64 datalen, u64 offset, u64 base)
 {
 	u64 esz, eidx, sidx, soffset, doff;
 	s64 idx1[16], didx1[16], *idx, *didx;
-	s64 q, r;
 	u8 buf1[64], *buf;
 	drepl_dest *d;
-	int ret, i, n, elo, buflen;
+	int ret, n, nv, buflen, err;
 	mm_segment_t old_fs;
 
 	if (b->view->repl) {
@@ -90,14 +136,16 @@ static s64 drepl_ablock_read(drepl_block *b, u8 __user *data, u64 datalen, u64 o
 	soffset = sidx * esz;
 	datalen = esz - (offset - soffset) + (eidx - sidx - 1) * esz;
 
-	if (ARRAY_SIZE(idx1) >= b->ndim) {
+	// the wrapped indices and the periods follow the indices
+	d = &b->src;
+	nv = b->ndim + d->nwrap + d->nperiod;
+	if (ARRAY_SIZE(idx1) >= nv) {
 		idx = idx1;
 	} else {
-		idx = kmalloc(sizeof(s64)*b->ndim, GFP_KERNEL);
+		idx = kmalloc(sizeof(s64)*nv, GFP_KERNEL);
 	}
 
 	offset -= b->offset;
-	d = &b->src;
 	buflen = ARRAY_SIZE(buf1);
 	buf = buf1;
 	if (ARRAY_SIZE(idx1) >= d->nexpr) {
@@ -107,30 +155,24 @@ static s64 drepl_ablock_read(drepl_block *b, u8 __user *data, u64 datalen, u64 o
 	}
 
 	ret = 0;
-	elo = b->view->elo;
 	old_fs = get_fs();
 	set_fs(KERNEL_DS);
 	while (datalen >= esz) {
 //		printk(KERN_DEFAULT "drepl_ablock_read: sidx %llu\n", sidx);
-		drepl_elo_toidx(elo, sidx, b->ndim, idx, b->dim);
-
-		// calculate the indices in the destination array
-		for(i = 0; i < d->nexpr; i++) {
-			drepl_calc_expr(&d->expr[i], idx, &q, &r);
-			if (r != 0) {
-				// if there is a remainder, the element doesn't belong
-				// to the destination array
-				// TODO: error string???
-				printk(KERN_ERR "boo\n");
+		drepl_elo_toidx(b, sidx, b->ndim, idx, b->dim);
+
+		// calculate the indices in the destination array, the
+		// elements that aren't in it read as zeros
+		if (!drepl_dest_index(d, b->ndim, idx, didx, 1)) {
+			if (clear_user(data, esz)) {
 				ret = -EFAULT;
 				goto out;
 			}
 
-			didx[i] = q;
-//			printk(KERN_DEFAULT "drepl_ablock_read didx: %d %lld\n", i, didx[i]);
+			goto next;
 		}
 
-		doff = drepl_elo_fromidx(d->arr->view->elo, d->nexpr, didx, d->arr->dim) * d->arr->elsize;
+		doff = drepl_elo_fromidx(d->arr, d->nexpr, didx, d->arr->dim) * d->arr->elsize;
 //		printk(KERN_DEFAULT "drepl_ablock_read doff %llu\n", doff);
 		if (buflen < d->arr->elsize) {
 			if (buf != buf1) {
@@ -154,7 +196,13 @@ static s64 drepl_ablock_read(drepl_block *b, u8 __user *data, u64 datalen, u64 o
 			goto out;
 		}
 
-		drepl_block_xform(d->el, &d->el->dest[0], buf, data, 1);
+		err = drepl_block_xform(d->el, &d->el->dest[0], buf, data, 1);
+		if (err < 0) {
+			ret = err;
+			goto out;
+		}
+
+next:
 		data += esz;
 		datalen -= esz;
 		offset += esz;
@@ -185,7 +233,7 @@ static s64 drepl_ablock_read_seq(drepl_block *b, u8 __user *data, u64 dlen, u64
 	s64 q, r, datalen, ret;
 	u8 *buf;
 	drepl_dest *d;
-	int i, n, m, elo, buflen;
+	int i, n, m, buflen, err;
 	mm_segment_t old_fs;
 
 	datalen = dlen;
@@ -217,8 +265,7 @@ static s64 drepl_ablock_read_seq(drepl_block *b, u8 __user *data, u64 dlen, u64
 	}
 
 	ret = 0;
-	elo = b->view->elo;
-	drepl_elo_toidx(elo, sidx, b->ndim, idx, b->dim);
+	drepl_elo_toidx(b, sidx, b->ndim, idx, b->dim);
 
 	// calculate the indices in the destination array
 	for(i = 0; i < d->nexpr; i++) {
@@ -235,7 +282,7 @@ static s64 drepl_ablock_read_seq(drepl_block *b, u8 __user *data, u64 dlen, u64
 		didx[i] = q;
 	}
 
-	doff = drepl_elo_fromidx(d->arr->view->elo, d->nexpr, didx, d->arr->dim) * d->arr->elsize;
+	doff = drepl_elo_fromidx(d->arr, d->nexpr, didx, d->arr->dim) * d->arr->elsize;
 
 //	printk(KERN_DEFAULT "drepl_ablock_read_seq doff %lld datalen %d esz %lld\n", doff, datalen, esz);
 	while (datalen >= esz) {
@@ -261,7 +308,12 @@ static s64 drepl_ablock_read_seq(drepl_block *b, u8 __user *data, u64 dlen, u64
 		n = n - (n%d->arr->elsize);	// should be elsize aligned, but just in case...
 		m = n / d->arr->elsize;
 //		printk(KERN_DEFAULT "drepl_ablock_read_seq: n %d m %d datalen %lld data %p\n", n, m, datalen, data);
-		drepl_block_xform(d->el, &d->el->dest[0], buf, data, m);
+		err = drepl_block_xform(d->el, &d->el->dest[0], buf, data, m);
+		if (err < 0) {
+			ret = err;
+			goto out;
+		}
+
 		data += m*esz;
 		datalen -= m*esz;
 		offset += m*esz;
@@ -325,7 +377,11 @@ static s64 drepl_tblock_read(drepl_block *b, u8 __user *data, u64 datalen, u64 o
 		goto out;
 	}
 
-	drepl_block_xform(b, &b->dest[0], sbuf, dbuf, 1);
+	ret = drepl_block_xform(b, &b->dest[0], sbuf, dbuf, 1);
+	if (ret < 0) {
+		goto out;
+	}
+
 	ret = b->size - offset + base;
 	memmove(data, &dbuf[offset - base], ret);
 
@@ -353,24 +409,29 @@ s64 drepl_block_read(drepl_block *b, u8 __user *data, u64 datalen, u64 offset, u
 	}
 }
 
-static void drepl_sblock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel)
+static int drepl_sblock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel)
 {
 //	printk(KERN_DEFAULT "drepl_sblock_xform %d dest arr %d el %d nel %d\n", b->id, d->arr?d->arr->id:-1, d->el?d->el->id:-1, nel);
-	memmove(dst, src, b->size * nel);
+	if (b->ndest == 0) {
+		memmove(dst, src, b->size * nel);
+		return 0;
+	}
+
+	return drepl_convert(b, b->dest[0].arr, src, dst, nel);
 }
 
-static void drepl_ablock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel)
+static int drepl_ablock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel)
 {
 	s64 idx1[16], didx1[16], *idx, *didx;
-	s64 q, r;
 	u64 soff, doff, n, dn;
-	int i, elo;
+	int ret, nv, first;
 
 //	printk(KERN_DEFAULT "drepl_ablock_xform %d dest arr %d el %d nel %d\n", b->id, d->arr?d->arr->id:-1, d->el?d->el->id:-1, nel);
-	if (ARRAY_SIZE(idx1) >= b->ndim) {
+	nv = b->ndim + d->nwrap + d->nperiod;
+	if (ARRAY_SIZE(idx1) >= nv) {
 		idx = idx1;
 	} else {
-		idx = kmalloc(sizeof(s64) * b->ndim, GFP_KERNEL);
+		idx = kmalloc(sizeof(s64) * nv, GFP_KERNEL);
 	}
 
 	if (ARRAY_SIZE(didx1) >= d->nexpr) {
@@ -379,28 +440,19 @@ static void drepl_ablock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst,
 		didx = kmalloc(sizeof(s64) * d->nexpr, GFP_KERNEL);
 	}
 
-	elo = b->view->elo;
+	ret = 0;
 	while (nel) {
 		for(n = 0; n < b->elnum; n++) {
-			drepl_elo_toidx(elo, n, b->ndim, idx, b->dim);
-			for(i = 0; i < d->nexpr; i++) {
-				drepl_calc_expr(&d->expr[i], idx, &q, &r);
-				if (r != 0) {
-					// if there is a remainder, the element doesn't belong to the destination array
-					break;
+			drepl_elo_toidx(b, n, b->ndim, idx, b->dim);
+			for(first = 1; drepl_dest_index(d, b->ndim, idx, didx, first); first = 0) {
+				dn = drepl_elo_fromidx(d->arr, d->nexpr, didx, d->arr->dim);
+				soff = n * b->elsize;
+				doff = dn * d->arr->elsize;
+				ret = drepl_block_xform(b->el, &b->el->dest[0], &src[soff], &dst[doff], 1);
+				if (ret < 0) {
+					goto out;
 				}
-
-				didx[i] = q;
-			}
-
-			if (i < d->nexpr) {
-				continue;
 			}
-
-			dn = drepl_elo_fromidx(d->arr->view->elo, d->nexpr, didx, d->arr->dim);
-			soff = n * b->elsize;
-			doff = dn * d->arr->elsize;
-			drepl_block_xform(b->el, &b->el->dest[0], &src[soff], &dst[doff], 1);
 		}
 
 		src += d->arr->size;
@@ -408,6 +460,7 @@ static void drepl_ablock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst,
 		nel--;
 	}
 
+out:
 	if (idx != idx1) {
 		kfree(idx);
 	}
@@ -415,20 +468,19 @@ static void drepl_ablock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst,
 	if (didx != didx1) {
 		kfree(didx);
 	}
+
+	return ret;
 }
 
-static void drepl_tblock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel)
+static int drepl_tblock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel)
 {
-	u64 n, m;
 	drepl_block *bb, *db, *dbb;
-	int i, j;
+	int i, j, ret;
 
 //	printk(KERN_DEFAULT "drepl_tblock_xform %d dest arr %d el %d nel %d src %02x%02x%02x%02x\n", b->id, d->arr?d->arr->id:-1, d->el?d->el->id:-1, nel, src[0], src[1], src[2], src[3]);
 	db = d->arr->el;
 	while (nel) {
-		n = 0;
 		for(i = 0; i < b->nfld; i++) {
-			m = 0;
 			bb = b->fld[i];
 //			printk(KERN_DEFAULT "drepl_tblock_xform src fld %d id %d\n", i, bb->id);
 			
@@ -437,59 +489,85 @@ static void drepl_tblock_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst,
 				dbb = db->fld[j];
 //				printk(KERN_DEFAULT "drepl_tblock_xform \t dst fld %d id %d\n", j, dbb->id);
 				if (drepl_block_is_dest(bb, dbb)) {
-					drepl_block_xform(bb, &bb->dest[0], &src[n], &dst[m], 1);
+					ret = drepl_block_xform(bb, &bb->dest[0], &src[bb->offset], &dst[dbb->offset], 1);
+					if (ret < 0) {
+						return ret;
+					}
+
 					break;
 				}
-
-				m += dbb->size;
 			}
-
-			n += bb->size;
 		}
 
 		src += b->size;
 		dst += db->size;
 		nel--;
 	}
+
+	return 0;
 }
 
-static inline void drepl_block_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel)
+static inline int drepl_block_xform(drepl_block *b, drepl_dest *d, u8 *src, u8 *dst, int nel)
 {
 	if (b->ndim > 0) {
-		drepl_ablock_xform(b, d, src, dst, nel);
+		return drepl_ablock_xform(b, d, src, dst, nel);
 	} else if (b->nfld > 0) {
-		drepl_tblock_xform(b, d, src, dst, nel);
+		return drepl_tblock_xform(b, d, src, dst, nel);
 	} else {
-		drepl_sblock_xform(b, d, src, dst, nel);
+		return drepl_sblock_xform(b, d, src, dst, nel);
 	}
 }
 
 static s64 drepl_sblock_replicate(drepl_block *b, const char __user *data, u64 datalen, u64 offset, u64 base)
 {
-	u64 dbase, doff;
+	u64 dbase, doff, n;
 	drepl_block *d;
 	int i;
 	s64 ret;
+	u8 *buf;
 
 //	printk(KERN_DEFAULT "drepl_sblock_replicate %d\n", b->id);
 	dbase = offset - base + b->offset;
 	doff = offset - b->offset;
+	buf = NULL;
 	for(i = 0; i < b->ndest; i++) {
 		d = b->dest[i].arr;
-		ret = drepl_block_write(d, data, datalen, doff + d->offset, dbase + d->offset, 1, 0);
+		if (drepl_converted(b, d)) {
+			if (datalen % b->size != 0) {
+				ret = -EINVAL;
+				goto out;
+			}
+
+			n = datalen / b->size;
+			kfree(buf);
+			buf = kmalloc(n * d->size, GFP_KERNEL);
+			ret = drepl_convert(b, d, (u8 *) data, buf, n);
+			if (ret < 0) {
+				goto out;
+			}
+
+			ret = drepl_block_write(d, buf, n * d->size, doff + d->offset, dbase + d->offset, 1, 0);
+		} else {
+			ret = drepl_block_write(d, data, datalen, doff + d->offset, dbase + d->offset, 1, 0);
+		}
+
 		if (ret < 0) {
-			return ret;
+			goto out;
 		}
 	}
 
-	return b->size;
+	ret = b->size;
+
+out:
+	kfree(buf);
+	return ret;
 }
 
 static s64 drepl_ablock_replicate(drepl_block *b, const char __user *data, u64 datalen, u64 offset, u64 base)
 {
 	u64 esz, o, doff;
-	s64 idx1[16], didx1[16], *idx, *didx, q, r, ret, n;
-	int elo, nd, i, j;
+	s64 idx1[16], didx1[16], *idx, *didx, ret, n;
+	int nd, nv, i, first;
 	drepl_dest *d;
 
 	for(i = 0; i < b->ndest; i++)
@@ -501,13 +579,22 @@ static s64 drepl_ablock_replicate(drepl_block *b, const char __user *data, u64 d
 
 //	printk(KERN_DEFAULT "drepl_ablock_replicate %d offset %llu base %llu datalen %llu\n", b->id, offset, base, datalen);
 	esz = b->el->size;
-	elo = b->view->elo;
 	offset -= base;
 	o = offset - (offset / b->elsize) * b->elsize;
-	if (ARRAY_SIZE(idx1) >= b->ndim) {
+
+	// the wrapped indices and the periods follow the indices
+	nv = b->ndim;
+	for(i = 0; i < b->ndest; i++) {
+		d = &b->dest[i];
+		if (nv < b->ndim + d->nwrap + d->nperiod) {
+			nv = b->ndim + d->nwrap + d->nperiod;
+		}
+	}
+
+	if (ARRAY_SIZE(idx1) >= nv) {
 		idx = idx1;
 	} else {
-		idx = kmalloc(sizeof(s64)*b->ndim, GFP_KERNEL);
+		idx = kmalloc(sizeof(s64)*nv, GFP_KERNEL);
 	}
 
 	nd = ARRAY_SIZE(didx1);
@@ -515,7 +602,7 @@ static s64 drepl_ablock_replicate(drepl_block *b, const char __user *data, u64 d
 
 	ret = 0;
 	while (datalen >= esz) {
-		drepl_elo_toidx(elo, offset / b->elsize, b->ndim, idx, b->dim);
+		drepl_elo_toidx(b, offset / b->elsize, b->ndim, idx, b->dim);
 
 		for(i=0; i < b->ndest; i++) {
 			// calculate indices
@@ -530,28 +617,16 @@ static s64 drepl_ablock_replicate(drepl_block *b, const char __user *data, u64 d
 				didx = kmalloc(sizeof(s64) * nd, GFP_KERNEL);
 			}
 
-			for(j=0; j<d->nexpr; j++) {
-				drepl_calc_expr(&d->expr[j], idx, &q, &r);
-				if (r != 0) {
-					// if there is a remainder, the element doesn't belong
-					// to the destination array
-					break;
+			// a wrapped destination can have the element more
+			// than once
+			for(first = 1; drepl_dest_index(d, b->ndim, idx, didx, first); first = 0) {
+				doff = drepl_elo_fromidx(d->arr, d->nexpr, didx, d->arr->dim) * d->arr->elsize;
+				n = drepl_block_replicate(d->el, data, esz, d->arr->offset + doff + o, d->arr->offset + doff);
+				if (n < 0) {
+					printk("drepl_ablock_replicate: error %lld\n", n);
+					ret = n;
+					goto out;
 				}
-
-				didx[j] = q;
-			}
-
-
-			if (j < d->nexpr) {
-				continue;
-			}
-
-			doff = drepl_elo_fromidx(d->arr->view->elo, d->nexpr, didx, d->arr->dim) * d->arr->elsize;
-			n = drepl_block_replicate(d->el, data, esz, d->arr->offset + doff + o, d->arr->offset + doff);
-			if (n < 0) {
-				printk("drepl_ablock_replicate: error %lld\n", n);
-				ret = n;
-				goto out;
 			}
 		}
 
@@ -579,7 +654,7 @@ static s64 drepl_ablock_replicate_seq(drepl_block *b, const char __user *dat, u6
 {
 	u64 esz, o, doff;
 	s64 idx1[16], didx1[16], *idx, *didx, q, r, n, datalen, ret;
-	int elo, nd, i, j, m, buflen;
+	int nd, i, j, m, buflen, err;
 	u8 *buf;
 	const char __user *data;
 	drepl_dest *d;
@@ -588,7 +663,6 @@ static s64 drepl_ablock_replicate_seq(drepl_block *b, const char __user *dat, u6
 //	printk(KERN_DEFAULT "drepl_ablock_replicate_seq %d offset %llu base %llu datalen %llu\n", b->id, offset, base, dlen);
 	ret = dlen;
 	esz = b->el->size;
-	elo = b->view->elo;
 	offset -= base;
 	o = offset - (offset / b->elsize) * b->elsize;
 	if (ARRAY_SIZE(idx1) >= b->ndim) {
@@ -606,7 +680,7 @@ static s64 drepl_ablock_replicate_seq(drepl_block *b, const char __user *dat, u6
 		d = &b->dest[i];
 		data = dat;
 		datalen = dlen;
-		drepl_elo_toidx(elo, o / b->elsize, b->ndim, idx, b->dim);
+		drepl_elo_toidx(b, o / b->elsize, b->ndim, idx, b->dim);
 
 //		printk(KERN_DEFAULT "drepl_ablock_replicate_seq dest %d arr %d el %d\n", i, d->arr ? d->arr->id:-1, d->el ? d->el->id:-1);
 		if (nd < d->nexpr) {
@@ -624,7 +698,7 @@ static s64 drepl_ablock_replicate_seq(drepl_block *b, const char __user *dat, u6
 			didx[j] = q;
 		}
 
-		doff = drepl_elo_fromidx(d->arr->view->elo, d->nexpr, didx, d->arr->dim) * d->arr->elsize;
+		doff = drepl_elo_fromidx(d->arr, d->nexpr, didx, d->arr->dim) * d->arr->elsize;
 		while (datalen >= esz) {
 			n = datalen > buflen ? buflen : datalen;
 			n = datalen - (datalen%esz);	// elsize aligned
@@ -655,7 +729,12 @@ static s64 drepl_ablock_replicate_seq(drepl_block *b, const char __user *dat, u6
 				}
 			}
 
-			drepl_block_xform(d->el, d, (u8 *) data, buf, m);
+			err = drepl_block_xform(d->el, d, (u8 *) data, buf, m);
+			if (err < 0) {
+				ret = err;
+				goto out;
+			}
+
 			drepl_repl_write(v->repl, buf, m*d->arr->elsize, v->offset + d->arr->offset + doff);
 			data += n;
 			datalen -= n;
@@ -688,12 +767,26 @@ static s64 drepl_tblock_replicate(drepl_block *b, const char __user *data, u64 d
 	ret = 0;
 	for(i = 0; i < b->nfld; i++) {
 		bb = b->fld[i];
+
+		// skip the padding before the field
+		n = bb->offset - ret;
+		if (n > 0) {
+			if (datalen <= (u64) n)
+				break;
+
+			offset += n;
+			base += n;
+			ret += n;
+			data += n;
+			datalen -= n;
+		}
+
 		n = drepl_block_replicate(bb, data, datalen, offset, base);
 		if (n < 0) {
 			return n;
 		}
 
-		n = b->size;
+		n = bb->size;
 		offset += n;
 		base += n;
 		ret += n;
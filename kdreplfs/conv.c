@@ -0,0 +1,369 @@
+#include <linux/kernel.h>
+#include <linux/bitops.h>
+#include <linux/string.h>
+#include <linux/errno.h>
+#include "drepl.h"
+
+/*
+ * Conversion of the numeric values between the dataset and the view
+ * types. Same as the Go implementation in drepl/convert.go. The floating
+ * point values are converted using integer arithmetic only, so the FPU
+ * state doesn't need to be saved.
+ */
+typedef struct fval fval;
+struct fval {
+	int	sign;
+	int	nan;
+	int	inf;
+	u64	m;		// value is m * 2^e
+	int	e;
+};
+
+// format of the floating point types, indexed by ntype - FLOAT32
+typedef struct ffmt ffmt;
+struct ffmt {
+	int	p;		// precision (including the implicit bit)
+	int	emin;
+	int	emax;
+	int	bias;
+};
+
+static ffmt ffmts[] = {
+	{ 24, -126, 127, 127 },		// float32
+	{ 53, -1022, 1023, 1023 },	// float64
+};
+
+static s64 int_min[] = {
+	[INT8] = S8_MIN, [INT16] = S16_MIN, [INT32] = S32_MIN, [INT64] = S64_MIN,
+};
+
+static s64 int_max[] = {
+	[INT8] = S8_MAX, [INT16] = S16_MAX, [INT32] = S32_MAX, [INT64] = S64_MAX,
+};
+
+static inline int drepl_isfloat(int ntype)
+{
+	return ntype == FLOAT32 || ntype == FLOAT64;
+}
+
+static inline int drepl_bigendian(drepl_block *b)
+{
+	if (b->endian == BIGENDIAN)
+		return 1;
+	else if (b->endian == LITTLEENDIAN)
+		return 0;
+
+#ifdef __BIG_ENDIAN
+	return 1;
+#else
+	return 0;
+#endif
+}
+
+int drepl_swapped(drepl_block *b1, drepl_block *b2)
+{
+	return b1->endian && b2->endian && b1->endian != b2->endian;
+}
+
+void drepl_byteswap(u8 *data, u64 datalen, u64 sz)
+{
+	u64 n, i, j;
+	u8 c;
+
+	for(n = 0; n + sz <= datalen; n += sz) {
+		for(i = n, j = n + sz - 1; i < j; i++, j--) {
+			c = data[i];
+			data[i] = data[j];
+			data[j] = c;
+		}
+	}
+}
+
+int drepl_converted(drepl_block *b1, drepl_block *b2)
+{
+	if (b1->ntype == 0 || b2->ntype == 0 || b1->ntype == b2->ntype)
+		return drepl_swapped(b1, b2);
+
+	return 1;
+}
+
+static u64 drepl_getval(drepl_block *b, u8 *data)
+{
+	u64 v;
+	int i;
+
+	v = 0;
+	if (drepl_bigendian(b)) {
+		for(i = 0; i < b->size; i++)
+			v = (v << 8) | data[i];
+	} else {
+		for(i = b->size - 1; i >= 0; i--)
+			v = (v << 8) | data[i];
+	}
+
+	return v;
+}
+
+static void drepl_putval(drepl_block *b, u8 *data, u64 v)
+{
+	int i;
+
+	if (drepl_bigendian(b)) {
+		for(i = b->size - 1; i >= 0; i--, v >>= 8)
+			data[i] = v;
+	} else {
+		for(i = 0; i < b->size; i++, v >>= 8)
+			data[i] = v;
+	}
+}
+
+static s64 drepl_getint(drepl_block *b, u8 *data)
+{
+	int sh;
+
+	sh = 64 - 8*b->size;
+	return ((s64) (drepl_getval(b, data) << sh)) >> sh;
+}
+
+static void drepl_getfloat(drepl_block *b, u8 *data, fval *f)
+{
+	ffmt *ff;
+	u64 v, frac;
+	int ebits, exp;
+
+	ff = &ffmts[b->ntype - FLOAT32];
+	ebits = 8*b->size - ff->p;
+	v = drepl_getval(b, data);
+	frac = v & ((1ULL << (ff->p - 1)) - 1);
+	exp = (v >> (ff->p - 1)) & ((1 << ebits) - 1);
+	f->sign = v >> (8*b->size - 1);
+	f->nan = 0;
+	f->inf = 0;
+	if (exp == (1 << ebits) - 1) {
+		// for NaN keep the payload as fraction
+		f->nan = frac != 0;
+		f->inf = frac == 0;
+		f->m = frac;
+		f->e = 1 - ff->p;
+	} else if (exp == 0) {
+		// zero or denormal
+		f->m = frac;
+		f->e = ff->emin - ff->p + 1;
+	} else {
+		f->m = frac | (1ULL << (ff->p - 1));
+		f->e = exp - ff->bias - ff->p + 1;
+	}
+}
+
+static int drepl_putint(drepl_block *b, u8 *data, s64 v, int conv);
+
+// stores the value m * 2^e in the floating point format of b, rounding to
+// the nearest even value
+static int drepl_putfloat(drepl_block *b, u8 *data, fval *f, int conv)
+{
+	ffmt *ff;
+	u64 m, keep, rem, half, v, sign;
+	int e, sh, inexact;
+
+	ff = &ffmts[b->ntype - FLOAT32];
+	sign = (u64) f->sign << (8*b->size - 1);
+	if (f->nan) {
+		// quiet NaN, keeps as much of the payload as fits
+		sh = ff->p - 1 + f->e;
+		m = sh >= 0 ? f->m << sh : f->m >> -sh;
+		v = sign | (((1ULL << (8*b->size - ff->p + 1)) - 1) << (ff->p - 2)) | m;
+		drepl_putval(b, data, v);
+		return 0;
+	}
+
+	if (f->inf)
+		goto inf;
+
+	if (f->m == 0) {
+		drepl_putval(b, data, sign);
+		return 0;
+	}
+
+	// normalize, so the value is m * 2^e, 2^63 <= m < 2^64
+	m = f->m;
+	e = f->e;
+	sh = 64 - fls64(m);
+	m <<= sh;
+	e = e - sh + 63;	// exponent of the leading bit
+
+	sh = 64 - ff->p;
+	if (e < ff->emin)
+		sh += ff->emin - e;
+
+	if (sh >= 64) {
+		keep = 0;
+		rem = sh > 64 ? 1 : m;
+		half = sh > 64 ? 2 : 1ULL << 63;
+	} else {
+		keep = m >> sh;
+		rem = m & ((1ULL << sh) - 1);
+		half = 1ULL << (sh - 1);
+	}
+
+	inexact = rem != 0;
+	if (rem > half || (rem == half && (keep & 1)))
+		keep++;
+
+	if (conv == VCONV_EXACT && inexact)
+		return -ERANGE;
+
+	if (e < ff->emin) {
+		// denormal, overflow of keep to the implicit bit makes it normal
+		drepl_putval(b, data, sign | keep);
+		return 0;
+	}
+
+	if (keep >> ff->p) {
+		keep >>= 1;
+		e++;
+	}
+
+	if (e > ff->emax) {
+		if (conv == VCONV_EXACT)
+			return -ERANGE;
+		else if (conv == VCONV_SATURATE) {
+			// largest finite value
+			v = sign | ((u64) (2*ff->bias) << (ff->p - 1)) | ((1ULL << (ff->p - 1)) - 1);
+			drepl_putval(b, data, v);
+			return 0;
+		}
+
+		goto inf;
+	}
+
+	v = sign | ((u64) (e + ff->bias) << (ff->p - 1)) | (keep & ((1ULL << (ff->p - 1)) - 1));
+	drepl_putval(b, data, v);
+	return 0;
+
+inf:
+	v = sign | ((u64) (2*ff->bias + 1) << (ff->p - 1));
+	drepl_putval(b, data, v);
+	return 0;
+}
+
+static int drepl_putint(drepl_block *b, u8 *data, s64 v, int conv)
+{
+	fval f;
+
+	if (drepl_isfloat(b->ntype)) {
+		f.sign = v < 0;
+		f.nan = 0;
+		f.inf = 0;
+		f.m = v < 0 ? -(u64) v : v;
+		f.e = 0;
+		return drepl_putfloat(b, data, &f, conv);
+	}
+
+	if (v < int_min[b->ntype] || v > int_max[b->ntype]) {
+		if (conv == VCONV_EXACT)
+			return -ERANGE;
+		else if (conv == VCONV_SATURATE)
+			v = v < 0 ? int_min[b->ntype] : int_max[b->ntype];
+	}
+
+	drepl_putval(b, data, v);
+	return 0;
+}
+
+// converts float to integer, rounds half away from zero when saturating,
+// truncates otherwise
+static int drepl_ftoint(drepl_block *b, u8 *data, fval *f, int conv)
+{
+	u64 ip, frac, half;
+	s64 v;
+	int sh;
+
+	if (f->nan) {
+		if (conv == VCONV_EXACT)
+			return -ERANGE;
+
+		return drepl_putint(b, data, 0, conv);
+	}
+
+	if (f->inf)
+		goto overflow;
+
+	if (f->e >= 0) {
+		if (f->e >= 64 || (f->e > 0 && (f->m >> (64 - f->e)) != 0))
+			goto overflow;
+
+		ip = f->m << f->e;
+		frac = 0;
+		half = 1;
+	} else {
+		sh = -f->e;
+		if (sh >= 64) {
+			ip = 0;
+			frac = f->m;
+			half = sh > 64 ? ~0ULL : 1ULL << 63;
+		} else {
+			ip = f->m >> sh;
+			frac = f->m & ((1ULL << sh) - 1);
+			half = 1ULL << (sh - 1);
+		}
+	}
+
+	if (conv == VCONV_EXACT && frac != 0)
+		return -ERANGE;
+
+	if (conv == VCONV_SATURATE && frac >= half)
+		ip++;
+
+	if (ip > (u64) S64_MAX + f->sign)
+		goto overflow;
+
+	v = f->sign ? -(s64) ip : (s64) ip;
+	return drepl_putint(b, data, v, conv);
+
+overflow:
+	if (conv == VCONV_EXACT)
+		return -ERANGE;
+
+	return drepl_putint(b, data, f->sign ? S64_MIN : S64_MAX, conv);
+}
+
+/*
+ * Converts nel values described by sb stored in src to values described
+ * by db stored to dst using the conversion policy of db's view. Returns
+ * -ERANGE if the view requires exact conversion and a value can't be
+ * represented.
+ */
+int drepl_convert(drepl_block *sb, drepl_block *db, u8 *src, u8 *dst, int nel)
+{
+	fval f;
+	int conv, ret;
+
+	if (!drepl_converted(sb, db)) {
+		memmove(dst, src, sb->size * nel);
+		return 0;
+	}
+
+	if (sb->ntype == 0 || db->ntype == 0 || sb->ntype == db->ntype) {
+		memmove(dst, src, sb->size * nel);
+		drepl_byteswap(dst, sb->size * nel, sb->size);
+		return 0;
+	}
+
+	conv = db->view ? db->view->conv : VCONV_SATURATE;
+	for(; nel > 0; nel--, src += sb->size, dst += db->size) {
+		if (!drepl_isfloat(sb->ntype)) {
+			ret = drepl_putint(db, dst, drepl_getint(sb, src), conv);
+		} else {
+			drepl_getfloat(sb, src, &f);
+			if (drepl_isfloat(db->ntype))
+				ret = drepl_putfloat(db, dst, &f, conv);
+			else
+				ret = drepl_ftoint(db, dst, &f, conv);
+		}
+
+		if (ret < 0)
+			return ret;
+	}
+
+	return 0;
+}
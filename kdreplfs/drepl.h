@@ -4,12 +4,35 @@ typedef struct drepl drepl;
 typedef struct drepl_block drepl_block;
 typedef struct drepl_dest drepl_dest;
 typedef struct drepl_expr drepl_expr;
+typedef struct drepl_period drepl_period;
 typedef struct drepl_repl drepl_repl;
+typedef struct drepl_term drepl_term;
 typedef struct drepl_view drepl_view;
 typedef struct drepl_write_req drepl_write_req;
 
 #define ROWMAJOR	1
 #define ROWMINOR	2
+#define ZORDER		3
+#define HILBERT		4
+#define TILED		5
+#define PERMUTED	6
+
+// byte order of sblock values
+#define LITTLEENDIAN	2
+#define BIGENDIAN	3
+
+// numeric type of sblock values
+#define INT8		1
+#define INT16		2
+#define INT32		3
+#define INT64		4
+#define FLOAT32		5
+#define FLOAT64		6
+
+// conversion policy of the view
+#define VCONV_SATURATE	0
+#define VCONV_WRAP	1
+#define VCONV_EXACT	2
 
 // view flags
 #define VSYNC		1
@@ -44,6 +67,9 @@ struct drepl_view {
         drepl_repl*	repl;
         u64		offset;
         u32		elo;
+        u32		nelop;
+        s64*		elop;		// element order parameters
+        u32		conv;		// numeric conversion policy
         drepl_view*	dflt;
         u64		size;
         u32		nblks;
@@ -59,11 +85,35 @@ struct drepl_expr {
         s64		c;
         s64		d;
         u32		xidx;
+        u32		nterm;
+        drepl_term*	term;		// other indices added to the numerator
+        s64		m;		// the value is modulo m, unless zero
+};
+
+struct drepl_term {
+        s64		a;
+        u32		xidx;
+};
+
+// the indices of a destination that wrap to the value of expr, from 0 to
+// m-1, differ by the period, from min to max. If m is 0, the period is an
+// index of the destination that goes from min to max.
+struct drepl_period {
+        drepl_expr	expr;
+        s64		m;
+        s64		min;
+        s64		max;
 };
 
 struct drepl_dest {
         int		nexpr;
         drepl_expr*	expr;
+        int		ncond;
+        drepl_expr*	cond;		// the element is in arr only if all are zero
+        int		nwrap;
+        drepl_expr*	wrap;		// wrapped source indices, variables after the indices
+        int		nperiod;
+        drepl_period*	period;		// periods of the wrapped indices, variables after wrap
         drepl_block*	arr;
         drepl_block*	el;
 };
@@ -73,6 +123,8 @@ struct drepl_block {
         drepl_view*	view;
         u64		offset;
         u64		size;
+        u32		endian;		// byte order of sblock values
+        u32		ntype;		// numeric type of sblock values
         drepl_dest	src;
         u32		ndest;
         drepl_dest*	dest;
@@ -82,6 +134,9 @@ struct drepl_block {
         u64*		dim;
         u64		elsize;
         u64		elnum;
+        u32		elo;
+        u32		nelop;
+        s64*		elop;		// element order parameters
         drepl_block*	el;
 
         // tblock
@@ -112,11 +167,21 @@ extern s64 drepl_block_write(drepl_block *b, const char __user *data, u64 datale
 extern s64 drepl_block_replicate(drepl_block *b, const char __user *data, u64 datalen, u64 offset, u64 base);
 
 /* elo.c */
-extern void drepl_elo_toidx(int elo, s64 n, int ndim, s64 *idx, s64 *dim);
-extern s64 drepl_elo_fromidx(int elo, int ndim, s64 *idx, s64 *dim);
+extern void drepl_elo_toidx(drepl_block *b, s64 n, int ndim, s64 *idx, s64 *dim);
+extern s64 drepl_elo_fromidx(drepl_block *b, int ndim, s64 *idx, s64 *dim);
+extern int drepl_elo_equal(drepl_block *b1, drepl_block *b2);
+
+/* conv.c */
+extern int drepl_swapped(drepl_block *b1, drepl_block *b2);
+extern void drepl_byteswap(u8 *data, u64 datalen, u64 sz);
+extern int drepl_converted(drepl_block *b1, drepl_block *b2);
+extern int drepl_convert(drepl_block *sb, drepl_block *db, u8 *src, u8 *dst, int nel);
 
 /* expr.c */
 void drepl_calc_expr(drepl_expr *p, s64 *xa, s64 *q, s64 *r);
+int drepl_dest_index(drepl_dest *d, int nidx, s64 *idx, s64 *didx, int first);
+void drepl_free_exprs(int n, drepl_expr *e);
+void drepl_free_dest(drepl_dest *d);
 
 /* repl.c */
 extern s64 drepl_repl_write(drepl_repl *r, const char __user *data, u64 datalen, u64 offset);
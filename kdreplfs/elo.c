@@ -1,11 +1,286 @@
 #include <linux/slab.h>
 #include "drepl.h"
 
-void drepl_elo_toidx(int elo, s64 n, int ndim, s64 *idx, s64 *dim)
+/*
+ * Space filling curves (Z-order and Hilbert). Same as the Go
+ * implementation in drepl/order.go: at each level a cell is split into
+ * 2^ndim subcells (dimension 0 is the most significant bit) and the
+ * positions outside of the array are skipped.
+ */
+typedef struct curve curve;
+struct curve {
+	int	n;
+	int	hilbert;
+	u64	e;
+	int	d;
+};
+
+static u64 curve_rotr(curve *c, u64 x, int r)
+{
+	r %= c->n;
+	return ((x >> r) | (x << (c->n - r))) & ((1ULL << c->n) - 1);
+}
+
+static u64 curve_rotl(curve *c, u64 x, int r)
+{
+	r %= c->n;
+	return ((x << r) | (x >> (c->n - r))) & ((1ULL << c->n) - 1);
+}
+
+static u64 graycode(u64 w)
+{
+	return w ^ (w >> 1);
+}
+
+static u64 graycode_inv(u64 g)
+{
+	int s;
+	u64 w;
+
+	w = g;
+	for(s = 1; s < 64; s <<= 1)
+		w ^= w >> s;
+
+	return w;
+}
+
+static u64 curve_cell(curve *c, u64 w)
+{
+	if (!c->hilbert)
+		return w;
+
+	return curve_rotl(c, graycode(w), c->d + 1) ^ c->e;
+}
+
+static u64 curve_index(curve *c, u64 cell)
+{
+	if (!c->hilbert)
+		return cell;
+
+	return graycode_inv(curve_rotr(c, cell ^ c->e, c->d + 1));
+}
+
+static void curve_descend(curve *c, u64 w)
+{
+	int d;
+	u64 e, t;
+
+	if (!c->hilbert)
+		return;
+
+	if (w == 0) {
+		c->d = (c->d + 1) % c->n;
+		return;
+	}
+
+	e = graycode(2 * ((w - 1) / 2));
+	t = w;
+	if (w % 2 == 0)
+		t = w - 1;
+
+	for(d = 0; t & 1; t >>= 1)
+		d++;
+
+	c->e ^= curve_rotl(c, e, c->d + 1);
+	c->d = (c->d + d % c->n + 1) % c->n;
+}
+
+static int curve_levels(int ndim, s64 *dim)
+{
+	int i, m;
+
+	m = 0;
+	for(i = 0; i < ndim; i++) {
+		while ((1LL << m) < dim[i])
+			m++;
+	}
+
+	return m;
+}
+
+static s64 curve_cell_count(u64 cell, int l, int ndim, s64 *idx, s64 *dim)
+{
+	int k;
+	s64 s, start, m, count;
+
+	s = 1LL << l;
+	count = 1;
+	for(k = 0; k < ndim; k++) {
+		start = idx[k] & ~(2*s - 1);
+		if (cell & (1ULL << (ndim - 1 - k)))
+			start += s;
+
+		m = dim[k] - start;
+		if (m <= 0)
+			return 0;
+		else if (m > s)
+			m = s;
+
+		count *= m;
+	}
+
+	return count;
+}
+
+static s64 curve_fromidx(int hilbert, int ndim, s64 *idx, s64 *dim)
+{
+	int k, l;
+	u64 j, w, cell;
+	s64 pos;
+	curve c = { ndim, hilbert, 0, 0 };
+
+	pos = 0;
+	for(l = curve_levels(ndim, dim) - 1; l >= 0; l--) {
+		cell = 0;
+		for(k = 0; k < ndim; k++)
+			cell |= ((u64) (idx[k] >> l) & 1) << (ndim - 1 - k);
+
+		w = curve_index(&c, cell);
+		for(j = 0; j < w; j++)
+			pos += curve_cell_count(curve_cell(&c, j), l, ndim, idx, dim);
+
+		curve_descend(&c, w);
+	}
+
+	return pos;
+}
+
+static void curve_toidx(int hilbert, s64 n, int ndim, s64 *idx, s64 *dim)
+{
+	int k, l;
+	u64 w, cell;
+	s64 m;
+	curve c = { ndim, hilbert, 0, 0 };
+
+	for(k = 0; k < ndim; k++)
+		idx[k] = 0;
+
+	cell = 0;
+	for(l = curve_levels(ndim, dim) - 1; l >= 0; l--) {
+		for(w = 0; w < (1ULL << ndim); w++) {
+			cell = curve_cell(&c, w);
+			m = curve_cell_count(cell, l, ndim, idx, dim);
+			if (n < m)
+				break;
+
+			n -= m;
+		}
+
+		for(k = 0; k < ndim; k++) {
+			if (cell & (1ULL << (ndim - 1 - k)))
+				idx[k] |= 1LL << l;
+		}
+
+		curve_descend(&c, w);
+	}
+}
+
+/*
+ * Tiled order, the tiles and the elements within a tile are in row-major
+ * order. The tile sizes (b->elop) correspond to the last dimensions.
+ */
+static s64 tile_size(drepl_block *b, int k, int ndim)
+{
+	int j;
+
+	j = k - (ndim - (int) b->nelop);
+	if (j < 0)
+		return 1;
+
+	return b->elop[j];
+}
+
+static s64 tiled_fromidx(drepl_block *b, int ndim, s64 *idx, s64 *dim)
+{
+	int j, k;
+	s64 n, m, ext, ts, start, rest, e;
+
+	n = 0;
+	m = 0;
+	ext = 1;
+	for(k = 0; k < ndim; k++) {
+		ts = tile_size(b, k, ndim);
+		start = (idx[k] / ts) * ts;
+		rest = 1;
+		for(j = k + 1; j < ndim; j++)
+			rest *= dim[j];
+
+		n += ext * start * rest;
+		e = dim[k] - start;
+		if (e > ts)
+			e = ts;
+
+		ext *= e;
+		m = m*e + idx[k] - start;
+	}
+
+	return n + m;
+}
+
+static void tiled_toidx(drepl_block *b, s64 n, int ndim, s64 *idx, s64 *dim)
+{
+	int j, k;
+	s64 ext, ts, rest, slab, e;
+
+	ext = 1;
+	for(k = 0; k < ndim; k++) {
+		ts = tile_size(b, k, ndim);
+		rest = 1;
+		for(j = k + 1; j < ndim; j++)
+			rest *= dim[j];
+
+		slab = ext * ts * rest;
+		idx[k] = (n / slab) * ts;
+		n %= slab;
+		e = dim[k] - idx[k];
+		if (e > ts)
+			e = ts;
+
+		ext *= e;
+	}
+
+	for(k = ndim - 1; k >= 0; k--) {
+		ts = tile_size(b, k, ndim);
+		e = dim[k] - idx[k];
+		if (e > ts)
+			e = ts;
+
+		idx[k] += n % e;
+		n /= e;
+	}
+}
+
+int drepl_elo_equal(drepl_block *b1, drepl_block *b2)
 {
 	int i;
 
+	if (b1->elo != b2->elo || b1->nelop != b2->nelop)
+		return 0;
+
+	for(i = 0; i < b1->nelop; i++) {
+		if (b1->elop[i] != b2->elop[i])
+			return 0;
+	}
+
+	return 1;
+}
+
+void drepl_elo_toidx(drepl_block *b, s64 n, int ndim, s64 *idx, s64 *dim)
+{
+	int i, elo;
+
+	elo = b->elo;
 	switch (elo) {
+	case PERMUTED:
+		if (b->nelop == ndim) {
+			for(i = ndim - 1; i >= 0; i--) {
+				idx[b->elop[i]] = n % dim[b->elop[i]];
+				n /= dim[b->elop[i]];
+			}
+			break;
+		}
+		/* fall through */
+
 	case ROWMAJOR:
 		for(i = ndim - 1; i >= 0; i--) {
 			idx[i] = n % dim[i];
@@ -19,16 +294,35 @@ void drepl_elo_toidx(int elo, s64 n, int ndim, s64 *idx, s64 *dim)
 			n /= dim[i];
 		}
 		break;
+
+	case ZORDER:
+	case HILBERT:
+		curve_toidx(elo == HILBERT, n, ndim, idx, dim);
+		break;
+
+	case TILED:
+		tiled_toidx(b, n, ndim, idx, dim);
+		break;
 	}
 }
 
-s64 drepl_elo_fromidx(int elo, int ndim, s64 *idx, s64 *dim)
+s64 drepl_elo_fromidx(drepl_block *b, int ndim, s64 *idx, s64 *dim)
 {
-	int i;
+	int i, elo;
 	s64 n;
 
 	n = 0;
+	elo = b->elo;
 	switch (elo) {
+	case PERMUTED:
+		if (b->nelop == ndim) {
+			for(i = 0; i < ndim; i++) {
+				n = n*dim[b->elop[i]] + idx[b->elop[i]];
+			}
+			break;
+		}
+		/* fall through */
+
 	case ROWMAJOR:
 		n = idx[0];
 		for(i = 1; i < ndim; i++) {
@@ -42,6 +336,15 @@ s64 drepl_elo_fromidx(int elo, int ndim, s64 *idx, s64 *dim)
 			n = n*dim[i] + idx[i];
 		}
 		break;
+
+	case ZORDER:
+	case HILBERT:
+		n = curve_fromidx(elo == HILBERT, ndim, idx, dim);
+		break;
+
+	case TILED:
+		n = tiled_fromidx(b, ndim, idx, dim);
+		break;
 	}
 
 	return n;
@@ -4,13 +4,148 @@
 void drepl_calc_expr(drepl_expr *p, s64 *xa, s64 *q, s64 *r)
 {
 	s64 x, n, m;
+	int i;
 
 	x = xa[p->xidx];
 
 	// TODO: handle overflows
 	n = x*p->a + p->b;
 	m = x*p->c + p->d;
+	for(i = 0; i < p->nterm; i++) {
+		n += xa[p->term[i].xidx] * p->term[i].a;
+	}
+
 	*q = n / m;
 	*r = n % m;
+	if (p->m != 0) {
+		*q %= p->m;
+		if (*q < 0) {
+			*q += p->m;
+		}
+	}
 }
 
+// Calculates the indices of the element in the destination array for the
+// values of the variables in xa. Returns 0 if the element isn't in the
+// array.
+static int drepl_dest_match(drepl_dest *d, s64 *xa, s64 *didx)
+{
+	int i;
+	s64 q, r;
+
+	for(i = 0; i < d->nexpr; i++) {
+		drepl_calc_expr(&d->expr[i], xa, &q, &r);
+		if (r != 0 || q < 0 || q >= d->arr->dim[i]) {
+			// if there is a remainder, or the index is
+			// outside, the element isn't in the array
+			return 0;
+		}
+
+		didx[i] = q;
+	}
+
+	for(i = 0; i < d->ncond; i++) {
+		drepl_calc_expr(&d->cond[i], xa, &q, &r);
+		if (q != 0 || r != 0) {
+			return 0;
+		}
+	}
+
+	return 1;
+}
+
+// moves the periods k to the next combination, returns 0 after the last
+static int drepl_next_period(drepl_dest *d, s64 *k)
+{
+	int i;
+
+	for(i = d->nperiod - 1; i >= 0; i--) {
+		if (k[i] < d->period[i].max) {
+			k[i]++;
+			return 1;
+		}
+
+		k[i] = d->period[i].min;
+	}
+
+	return 0;
+}
+
+// Calculates the indices of the element in the destination array from the
+// nidx indices idx of the element in the source one. Returns 0 if the
+// element isn't in the array. If the destination wraps, the element can be
+// in it more than once, the first call has first set, the next ones return
+// the other elements. idx has to have space for the wrapped indices and the
+// periods after the indices, and keeps them between the calls.
+int drepl_dest_index(drepl_dest *d, int nidx, s64 *idx, s64 *didx, int first)
+{
+	int i, n;
+	s64 q, r;
+
+	n = nidx + d->nwrap;
+	if (first) {
+		for(i = 0; i < d->nwrap; i++) {
+			drepl_calc_expr(&d->wrap[i], idx, &q, &r);
+			if (r != 0) {
+				return 0;
+			}
+
+			idx[nidx + i] = q;
+		}
+
+		for(i = 0; i < d->nperiod; i++) {
+			if (d->period[i].max < d->period[i].min) {
+				return 0;
+			}
+
+			// m is 0 for the indices that go through the
+			// whole dimension
+			if (d->period[i].m != 0) {
+				drepl_calc_expr(&d->period[i].expr, idx, &q, &r);
+				if (r != 0 || q < 0 || q >= d->period[i].m) {
+					// no index of the destination wraps to it
+					return 0;
+				}
+			}
+
+			idx[n + i] = d->period[i].min;
+		}
+	} else if (!drepl_next_period(d, &idx[n])) {
+		return 0;
+	}
+
+	for(;;) {
+		if (drepl_dest_match(d, idx, didx)) {
+			return 1;
+		}
+
+		if (!drepl_next_period(d, &idx[n])) {
+			return 0;
+		}
+	}
+}
+
+void drepl_free_exprs(int n, drepl_expr *e)
+{
+	int i;
+
+	for(i = 0; i < n; i++) {
+		kfree(e[i].term);
+	}
+
+	kfree(e);
+}
+
+void drepl_free_dest(drepl_dest *d)
+{
+	int i;
+
+	drepl_free_exprs(d->nexpr, d->expr);
+	drepl_free_exprs(d->ncond, d->cond);
+	drepl_free_exprs(d->nwrap, d->wrap);
+	for(i = 0; i < d->nperiod; i++) {
+		kfree(d->period[i].expr.term);
+	}
+
+	kfree(d->period);
+}
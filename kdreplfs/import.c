@@ -76,6 +76,13 @@ static u8 *drepl_import_view(drepl *d, u8 *buf) {
 
 	buf = gint64(buf, &v->offset);
 	buf = gint32(buf, &v->elo);
+	buf = gint32(buf, &v->nelop);
+	v->elop = kzalloc(v->nelop * sizeof(s64), GFP_KERNEL);
+	for(i = 0; i < v->nelop; i++) {
+		buf = gint64(buf, (u64 *) &v->elop[i]);
+	}
+
+	buf = gint32(buf, &v->conv);
 	buf = gint32(buf, &id);
 	if (id == 0) {
 		v->dflt = NULL;
@@ -93,20 +100,53 @@ static u8 *drepl_import_view(drepl *d, u8 *buf) {
 	return buf;
 }
 
+static u8 *drepl_import_expr(u8 *buf, drepl_expr *e) {
+	int j;
+
+	buf = gint64(buf, &e->a);
+	buf = gint64(buf, &e->b);
+	buf = gint64(buf, &e->c);
+	buf = gint64(buf, &e->d);
+	buf = gint32(buf, &e->xidx);
+	buf = gint32(buf, &e->nterm);
+	e->term = kzalloc(e->nterm*sizeof(drepl_term), GFP_KERNEL);
+	for(j = 0; j < e->nterm; j++) {
+		buf = gint64(buf, &e->term[j].a);
+		buf = gint32(buf, &e->term[j].xidx);
+	}
+
+	buf = gint64(buf, &e->m);
+	return buf;
+}
+
+static u8 *drepl_import_exprs(u8 *buf, int *nexpr, drepl_expr **expr) {
+	int i;
+
+	buf = gint32(buf, nexpr);
+	*expr = kzalloc(*nexpr*sizeof(drepl_expr), GFP_KERNEL);
+	for(i = 0; i < *nexpr; i++) {
+		buf = drepl_import_expr(buf, &(*expr)[i]);
+	}
+
+	return buf;
+}
+
 static u8 *drepl_import_dest(drepl *d, u8 *buf, drepl_dest *dd) {
 	int i;
-	drepl_expr *e;
+	drepl_period *p;
 
 //	printk(KERN_DEFAULT "dreplfs_import_dest %p\n", buf);
-	buf = gint32(buf, &dd->nexpr);
-	dd->expr = kzalloc(dd->nexpr*sizeof(drepl_expr), GFP_KERNEL);
-	for(i = 0; i < dd->nexpr; i++) {
-		e = &dd->expr[i];
-		buf = gint64(buf, &e->a);
-		buf = gint64(buf, &e->b);
-		buf = gint64(buf, &e->c);
-		buf = gint64(buf, &e->d);
-		buf = gint32(buf, &e->xidx);
+	buf = drepl_import_exprs(buf, &dd->nexpr, &dd->expr);
+	buf = drepl_import_exprs(buf, &dd->ncond, &dd->cond);
+	buf = drepl_import_exprs(buf, &dd->nwrap, &dd->wrap);
+	buf = gint32(buf, &dd->nperiod);
+	dd->period = kzalloc(dd->nperiod*sizeof(drepl_period), GFP_KERNEL);
+	for(i = 0; i < dd->nperiod; i++) {
+		p = &dd->period[i];
+		buf = drepl_import_expr(buf, &p->expr);
+		buf = gint64(buf, &p->m);
+		buf = gint64(buf, &p->min);
+		buf = gint64(buf, &p->max);
 	}
 
 	buf = gblk(buf, &dd->arr, d);
@@ -133,6 +173,8 @@ static u8 *drepl_import_block(drepl *d, u8 *buf) {
 
 	buf = gint64(buf, &b->offset);
 	buf = gint64(buf, &b->size);
+	buf = gint32(buf, &b->endian);
+	buf = gint32(buf, &b->ntype);
 	buf = drepl_import_dest(d, buf, &b->src);
 	buf = gint32(buf, &b->ndest);
 	printk(KERN_DEFAULT "dreplfs import block %d %p ndest %d\n", b->id, b, b->ndest);
@@ -149,6 +191,13 @@ static u8 *drepl_import_block(drepl *d, u8 *buf) {
 
 	buf = gint64(buf, &b->elsize);
 	buf = gint64(buf, &b->elnum);
+	buf = gint32(buf, &b->elo);
+	buf = gint32(buf, &b->nelop);
+	b->elop = kzalloc(b->nelop * sizeof(s64), GFP_KERNEL);
+	for(i = 0; i < b->nelop; i++) {
+		buf = gint64(buf, (u64 *) &b->elop[i]);
+	}
+
 	buf = gblk(buf, &b->el, d);
 
 	buf = gint32(buf, &b->nfld);
@@ -37,7 +37,6 @@ static void drepl_destroy(drepl *d)
         drepl_repl *r;
         drepl_view *v;
         drepl_block *b;
-        drepl_dest *dd;
 
         for(i = 0; i < d->nrepls; i++) {
                 r = &d->repls[i];
@@ -55,8 +54,7 @@ static void drepl_destroy(drepl *d)
         for(i = 0; i < d->nblks; i++) {
                 b = &d->blks[i];
                 for(j = 0; j < b->ndest; j++) {
-                        dd = &b->dest[j];
-                        kfree(dd->expr);
+                        drepl_free_dest(&b->dest[j]);
                 }
 
                 kfree(b->dest);
@@ -0,0 +1,1668 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"drepl/ast"
+	"drepl/drepl"
+)
+
+// Creates the dataset, views and replicas declared in a syntax tree. The
+// names are resolved in the order of declaration.
+type checker struct {
+	dr	*DRepl
+	files	map[string] []byte	// content of the parsed files, for the error messages
+	errs	ErrorList
+	cview	*View		// the view currently being checked (nil if not)
+	views	[]*View		// the views created
+	ref	func(x ast.Expr) *Expr	// converts the element references in the value predicates
+	slices	bool		// the array types can have slices (right side of a view variable)
+	reduce	bool		// the slices are the windows of a reduction
+	calls	bool		// the expressions can call the math functions (computed fields)
+	rank	*ConstDecl	// rank of the partitioned view being checked, nil if not partitioned
+	nranks	int64		// number of ranks of the partitioned view
+}
+
+// resolves an identifier used in an expression to the value stored in Expr.val
+type identResolver func(name string, pos *Pos) interface{}
+
+// aggregation functions of the reduced view variables
+var reduceFuncs = map[string] int {
+	"mean":	drepl.ReduceMean,
+	"min":	drepl.ReduceMin,
+	"max":	drepl.ReduceMax,
+	"sum":	drepl.ReduceSum,
+}
+
+var viewFlags = map[string] int {
+	"rowmajor":	Vrowmajor,
+	"columnmajor":	Vrowminor,
+	"rowminor":	Vrowminor,
+	"zorder":	Vzorder,
+	"hilbert":	Vhilbert,
+	"tiled":	Vtiled,
+	"order":	Vpermuted,
+	"default":	Vdefault,
+	"readonly":	Vreadonly,
+	"bigendian":	Vbigendian,
+	"littleendian":	Vlittleendian,
+	"packed":	Vpacked,
+}
+
+var convPolicies = map[string] int {
+	"saturate":	0,
+	"wrap":		Vwrap,
+	"exact":	Vexact,
+}
+
+// Adds the declarations in f to dr. Returns the views created, and the
+// errors found in all declarations.
+func (dr *DRepl) check(f *ast.File, files map[string] []byte) (views []*View, errs ErrorList) {
+	c := &checker{dr: dr, files: files}
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.DatasetDecl:
+			c.dataset(d)
+		case *ast.ViewDecl:
+			c.view(d)
+		case *ast.ReplicaDecl:
+			c.replica(d)
+		}
+	}
+
+	return c.views, c.errs
+}
+
+func (c *checker) pos(pos ast.Pos) *Pos {
+	return &Pos{fname: pos.Filename, data: c.files[pos.Filename], offset: pos.Offset, line: pos.Line, col: pos.Column}
+}
+
+func (c *checker) error(pos ast.Pos, msg string) {
+	c.errs.Add(c.pos(pos), msg)
+}
+
+func (c *checker) dataset(d *ast.DatasetDecl) {
+	for _, d := range d.Decls {
+		switch d := d.(type) {
+		case *ast.TypeDecl:
+			c.typeDecl(d)
+		case *ast.VarDecl:
+			c.varDecl(d)
+		case *ast.ConstDecl:
+			c.constDecl(d)
+		}
+	}
+}
+
+func (c *checker) typeDecl(d *ast.TypeDecl) {
+	ds := c.dr.Dataset
+	name := d.Name.Name
+	td, created := ds.createType(name, c.pos(d.Name.NamePos))
+	if td == nil {
+		c.error(d.Name.NamePos, fmt.Sprintf("invalid type name '%s'", name))
+		return
+	}
+
+	if !created && td.isDefined() {
+		c.error(d.Name.NamePos, fmt.Sprintf("type '%s' already defined at %v", name, &td.pos))
+		return
+	}
+
+	// the type may have been used before it was defined
+	td.pos = *c.pos(d.Name.NamePos)
+	c.datasetType(td, d.Type)
+}
+
+func (c *checker) datasetType(t *Type, x ast.Type) bool {
+	ds := c.dr.Dataset
+
+	switch x := x.(type) {
+	case *ast.Ident:
+		// alias
+		t1 := ds.getType(x.Name)
+		if t1 == nil {
+			c.error(x.NamePos, fmt.Sprintf("type '%v' not defined", x.Name))
+			return false
+		}
+
+		t.etype = t1
+		t.dimnum = 0
+
+	case *ast.ArrayType:
+		// matrix
+		t.dimnum = len(x.Dims)
+		t.dimexpr = make([]*Expr, len(x.Dims))
+		for i, d := range x.Dims {
+			if d == nil {
+				// unlimited
+				continue
+			}
+
+			if t.dimexpr[i] = c.constExpr(d); t.dimexpr[i] == nil {
+				return false
+			}
+		}
+
+		t.etype = new(Type)
+		t.etype.ds = ds
+		return c.datasetType(t.etype, x.Elem)
+
+	case *ast.StructType:
+		t.packed = x.Packed
+		if x.Align != nil {
+			if t.alignexpr = c.constExpr(x.Align); t.alignexpr == nil {
+				return false
+			}
+		}
+
+		return c.datasetStruct(t, x)
+
+	default:
+		c.error(x.Pos(), "expecting type")
+		return false
+	}
+
+	return true
+}
+
+// the type of a dataset variable or struct field, a type name can be
+// used before the type is defined
+func (c *checker) fieldType(x ast.Type) *Type {
+	ds := c.dr.Dataset
+	if id, ok := x.(*ast.Ident); ok {
+		t, _ := ds.createType(id.Name, nil)
+		if t == nil {
+			c.error(id.NamePos, fmt.Sprintf("invalid type name '%s'", id.Name))
+		}
+
+		return t
+	}
+
+	t, _ := ds.createType("", c.pos(x.Pos()))
+	if !c.datasetType(t, x) {
+		return nil
+	}
+
+	return t
+}
+
+func (c *checker) datasetStruct(t *Type, x *ast.StructType) bool {
+	for _, f := range x.Fields {
+		ftype := c.fieldType(f.Type)
+		if ftype == nil {
+			return false
+		}
+
+		for _, id := range f.Names {
+			if t.getField(id.Name) != nil {
+				c.error(id.NamePos, fmt.Sprintf("field '%s' already defined", id.Name))
+				return false
+			}
+		}
+
+		n := len(f.Names)
+		t.addFields(identNames(f.Names), ftype, c.pos(f.Pos()))
+
+		ff := &t.fields[len(t.fields) - n]
+		ff.packed = f.Packed
+		if f.Align != nil {
+			if ff.alignexpr = c.constExpr(f.Align); ff.alignexpr == nil {
+				return false
+			}
+		}
+
+		for i := len(t.fields) - n + 1; i < len(t.fields); i++ {
+			t.fields[i].packed = ff.packed
+			t.fields[i].alignexpr = ff.alignexpr
+		}
+	}
+
+	return true
+}
+
+func identNames(ids []*ast.Ident) (names []string) {
+	for _, id := range ids {
+		names = append(names, id.Name)
+	}
+
+	return
+}
+
+func (c *checker) varDecl(d *ast.VarDecl) {
+	ds := c.dr.Dataset
+	vtype := c.fieldType(d.Type)
+	if vtype == nil {
+		return
+	}
+
+	for _, id := range d.Names {
+		if v, created := ds.createVarDecl(id.Name, c.pos(d.Var)); !created {
+			c.error(id.NamePos, fmt.Sprintf("variable '%v' already defined at %v", id.Name, &v.pos))
+		} else {
+			v.t = vtype
+		}
+	}
+}
+
+func (c *checker) constDecl(d *ast.ConstDecl) {
+	ds := c.dr.Dataset
+	name := d.Name.Name
+	pos := c.pos(d.Name.NamePos)
+	cd, created := ds.createConstDecl(name, pos)
+	if !created && cd.isDefined() {
+		c.error(d.Name.NamePos, fmt.Sprintf("constant '%s' already defined at %v", name, &cd.pos))
+		return
+	}
+
+	// the constant may have been used before it was defined
+	cd.pos = *pos
+	cd.expr = c.constExpr(d.Value)
+}
+
+// converts a constant expression, the names are constants that can be
+// defined later
+func (c *checker) constExpr(x ast.Expr) *Expr {
+	ds := c.dr.Dataset
+
+	return c.expr(x, func(name string, pos *Pos) interface{} {
+		if c.rank != nil && c.rank.name == name {
+			return c.rank
+		}
+
+		cd, _ := ds.createConstDecl(name, nil)
+		return cd
+	})
+}
+
+// returns the constant name, the rank of a partitioned view hides the
+// dataset's constant with the same name
+func (c *checker) getConst(name string) *ConstDecl {
+	if c.rank != nil && c.rank.name == name {
+		return c.rank
+	}
+
+	return c.dr.Dataset.getConstDecl(name)
+}
+
+// Evaluates an integer parameter of a partitioned view when the view is
+// checked, as the number of views depends on it. The constants used
+// have to be defined before the view.
+func (c *checker) partParam(x ast.Expr, what string) (int64, bool) {
+	ds := c.dr.Dataset
+	e := c.expr(x, func(name string, pos *Pos) interface{} {
+		if cd := c.getConst(name); cd!=nil {
+			return cd
+		}
+
+		c.errs.Add(pos, fmt.Sprintf("%s can only use constants, '%s' is not one", what, name))
+		return nil
+	})
+
+	if e == nil {
+		return 0, false
+	}
+
+	ds.overrideDefined(c.dr.opts.overrides())
+	val, err := ds.evalExpr(e)
+	if err != "" {
+		c.error(x.Pos(), err)
+		return 0, false
+	}
+
+	n, ok := val.(int64)
+	if !ok {
+		c.error(x.Pos(), fmt.Sprintf("%s has to be an integer, got: %v", what, val))
+		return 0, false
+	}
+
+	return n, true
+}
+
+// converts an expression of the view's indices, the names that are not
+// constants are the temporary variables of the array type t
+func (c *checker) vexpr(x ast.Expr, t *VType) *Expr {
+	return c.expr(x, func(name string, pos *Pos) interface{} {
+		if cd := c.getConst(name); cd!=nil {
+			return &cd.EVar
+		}
+
+		temp, _ := t.createTemp(name, pos)
+		return &temp.EVar
+	})
+}
+
+func (c *checker) expr(x ast.Expr, ident identResolver) *Expr {
+	var err error
+
+	e := new(Expr)
+	e.op = ILLEGAL
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return c.expr(x.X, ident)
+
+	case *ast.Ident:
+		e.op = IDENT
+		if e.val = ident(x.Name, c.pos(x.NamePos)); e.val == nil {
+			return nil
+		}
+
+	case *ast.SliceExpr:
+		c.error(x.Pos(), "slices can only be used on the right side of a view variable")
+		return nil
+
+	case *ast.DistExpr:
+		c.error(x.Pos(), fmt.Sprintf("%s can only be a dimension of the right side of a view variable", x.Name))
+		return nil
+
+	case *ast.CallExpr:
+		if !c.calls {
+			c.error(x.Pos(), "functions can only be used in computed fields")
+			return nil
+		}
+
+		f := mathFuncs[x.Fun.Name]
+		if f == nil {
+			c.error(x.Fun.NamePos, fmt.Sprintf("unknown function '%s'", x.Fun.Name))
+			return nil
+		}
+
+		if len(x.Args) != f.nargs {
+			c.error(x.Lparen, fmt.Sprintf("%s expects %d argument(s), got %d", f.name, f.nargs, len(x.Args)))
+			return nil
+		}
+
+		e.op = LPAREN
+		e.val = f
+		if e.left = c.expr(x.Args[0], ident); e.left == nil {
+			return nil
+		}
+
+		if f.nargs > 1 {
+			if e.right = c.expr(x.Args[1], ident); e.right == nil {
+				return nil
+			}
+		}
+
+	case *ast.IndexExpr, *ast.SelectorExpr:
+		if c.ref == nil {
+			c.error(x.Pos(), "invalid expression")
+			return nil
+		}
+
+		return c.ref(x)
+
+	case *ast.BasicLit:
+		switch x.Kind {
+		case ast.INT:
+			e.val, err = strconv.ParseInt(x.Value, 0, 64)
+			if err != nil && err.(*strconv.NumError).Err == strconv.ErrRange {
+				e.val, err = strconv.ParseUint(x.Value, 0, 64)
+			}
+
+		case ast.FLOAT:
+			e.val, err = strconv.ParseFloat(x.Value, 64)
+
+		case ast.STRING:
+			e.val, err = strconv.Unquote(x.Value)
+		}
+
+		if err!=nil {
+			c.error(x.ValuePos, err.Error())
+			return nil
+		}
+
+	case *ast.UnaryExpr:
+		y := c.expr(x.X, ident)
+		if y == nil {
+			return nil
+		}
+
+		switch x.Op {
+		case "+":
+			return y
+
+		case "-":
+			// -x is represented as 0 - x, so the index expression
+			// transformations don't need to know about it
+			return SubExpr(ConstInt64Expr(0), y)
+		}
+
+		e.op = NOT
+		e.left = y
+
+	case *ast.BinaryExpr:
+		e.op = binaryOp(x.Op)
+		if e.op == ILLEGAL {
+			c.error(x.OpPos, fmt.Sprintf("invalid operator: %s", x.Op))
+			return nil
+		}
+
+		if e.left = c.expr(x.X, ident); e.left == nil {
+			return nil
+		}
+
+		if e.right = c.expr(x.Y, ident); e.right == nil {
+			return nil
+		}
+
+	default:
+		c.error(x.Pos(), "invalid expression")
+		return nil
+	}
+
+	return e
+}
+
+// returns the token of a binary operator, or ILLEGAL
+func binaryOp(op string) Token {
+	for tok := opstart + 1; tok < opend; tok++ {
+		if tok.Precedence() > lowestPrec && tokens[tok] == op {
+			return tok
+		}
+	}
+
+	return ILLEGAL
+}
+
+// converts the parameters of an element order, or of the align annotation
+func (c *checker) params(args []ast.Expr) (params []*Expr, ok bool) {
+	for _, a := range args {
+		e := c.constExpr(a)
+		if e == nil {
+			return nil, false
+		}
+
+		params = append(params, e)
+	}
+
+	return params, true
+}
+
+func (c *checker) view(d *ast.ViewDecl) {
+	if d.Rank == nil {
+		c.viewPart(d, d.Name.Name)
+		return
+	}
+
+	// a view for each rank, named name.rank
+	name := d.Name.Name
+	if c.dr.findView(name) != nil || c.dr.parts[name] != nil {
+		c.error(d.Name.NamePos, fmt.Sprintf("cannot create view '%s'", name))
+		return
+	}
+
+	n, ok := c.partParam(d.Ranks, "the number of ranks")
+	if !ok {
+		return
+	}
+
+	if n <= 0 {
+		c.error(d.Ranks.Pos(), fmt.Sprintf("the number of ranks has to be positive, got: %d", n))
+		return
+	}
+
+	var parts []*View
+	c.nranks = n
+	for r := int64(0); r < n; r++ {
+		cd := new(ConstDecl)
+		cd.name = d.Rank.Name
+		cd.aux = cd
+		cd.pos = *c.pos(d.Rank.NamePos)
+		cd.expr = ConstInt64Expr(r)
+		cd.val = r
+		c.rank = cd
+
+		// the errors are usually the same for all ranks
+		nerrs := len(c.errs)
+		vw := c.viewPart(d, fmt.Sprintf("%s.%d", name, r))
+		if vw == nil || len(c.errs) != nerrs {
+			break
+		}
+
+		parts = append(parts, vw)
+	}
+
+	c.rank = nil
+	if c.dr.parts == nil {
+		c.dr.parts = make(map[string] []*View)
+	}
+
+	c.dr.parts[name] = parts
+}
+
+// creates the view name from the declaration d, for the current rank if
+// the view is partitioned
+func (c *checker) viewPart(d *ast.ViewDecl, name string) *View {
+	var ok bool
+
+	flags := 0
+	order := ""
+	elop := []*Expr(nil)
+	for _, f := range d.Flags {
+		switch f.Name {
+		case "convert":
+			conv := convPolicies[f.Args[0].(*ast.Ident).Name]
+			flags = flags &^ (Vwrap | Vexact) | conv
+			continue
+
+		case "rowmajor", "columnmajor", "rowminor", "zorder", "hilbert", "tiled", "order":
+			// the element orders are values, not bits
+			if order != "" {
+				c.error(f.NamePos, fmt.Sprintf("view '%s': element order %s conflicts with %s", d.Name.Name, f.Name, order))
+				return nil
+			}
+
+			order = f.Name
+		}
+
+		flags |= viewFlags[f.Name]
+		if f.Args != nil {
+			if elop, ok = c.params(f.Args); !ok {
+				return nil
+			}
+		}
+	}
+
+//	fmt.Printf("view %s flags %x\n", name, flags)
+	vw := c.dr.createView(name, flags)
+	if vw==nil {
+		c.error(d.Name.NamePos, fmt.Sprintf("cannot create view '%s'", name))
+		return nil
+	}
+
+	vw.pos = *c.pos(d.Name.NamePos)
+	vw.elop = elop
+	c.views = append(c.views, vw)
+	c.cview = vw
+	for _, d := range d.Decls {
+		switch d := d.(type) {
+		case *ast.TypeDecl:
+			c.viewTypeDecl(d)
+		case *ast.ViewVarDecl:
+			c.viewVarDecl(d)
+		}
+	}
+
+	if flags & Vdefault != 0 && vw.filtered() {
+		c.error(d.Name.NamePos, fmt.Sprintf("default view '%s' can't have value predicates", name))
+	}
+
+	if flags & Vdefault != 0 && vw.gathered() {
+		c.error(d.Name.NamePos, fmt.Sprintf("default view '%s' can't use index arrays", name))
+	}
+
+	if flags & Vdefault != 0 && vw.broadcast() {
+		c.error(d.Name.NamePos, fmt.Sprintf("default view '%s' can't have indices that aren't used on the right side", name))
+	}
+
+	if flags & Vdefault != 0 && vw.reduced() {
+		c.error(d.Name.NamePos, fmt.Sprintf("default view '%s' can't reduce the elements", name))
+	}
+
+	if flags & Vdefault != 0 && vw.computed() {
+		c.error(d.Name.NamePos, fmt.Sprintf("default view '%s' can't have computed fields", name))
+	}
+
+	if flags & Vdefault != 0 && c.rank != nil {
+		c.error(d.Name.NamePos, fmt.Sprintf("default view '%s' can't be partitioned", d.Name.Name))
+	}
+
+	c.cview = nil
+	return vw
+}
+
+func (c *checker) viewTypeDecl(d *ast.TypeDecl) {
+	vw := c.cview
+	ds := c.dr.Dataset
+	name := d.Name.Name
+	if td := ds.getType(name); td != nil {
+		c.error(d.Name.NamePos, fmt.Sprintf("type '%s' already defined at %v", name, &td.pos))
+		return
+	}
+
+	td, ok := c.viewType(d.Type)
+	if !ok {
+		return
+	}
+
+	if td == nil || td.dt == nil {
+		c.error(d.Name.NamePos, fmt.Sprintf("dataset type must be specified when defining view type"))
+		return
+	}
+
+	if t := vw.getType(name); t != nil {
+		c.error(d.Name.NamePos, fmt.Sprintf("type '%s' already defined at %v", name, &t.pos))
+		return
+	}
+
+	vw.addType(name, td)
+}
+
+// converts the type of a view variable, returns nil if there is no type
+func (c *checker) viewType(x ast.Type) (*VType, bool) {
+	vw := c.cview
+	ds := c.dr.Dataset
+
+	switch x := x.(type) {
+	case nil:
+		return nil, true
+
+	case *ast.Ident:
+		name := x.Name
+		if t1 := ds.getType(name); t1 != nil {
+			t,_ := vw.createType("", c.pos(x.NamePos))
+			t.dt = t1
+			return t, true
+		} else if vt := vw.getType(name); vt != nil {
+			return vt, true
+		}
+
+		c.error(x.NamePos, fmt.Sprintf("type '%s' not defined", name))
+		return nil, false
+
+	case *ast.ArrayType:
+		// VArrayType
+		t, _ := vw.createType("", c.pos(x.Lbrack))
+		t.dim = make([]*Expr, len(x.Dims))
+		for i, d := range x.Dims {
+			if d == nil {
+				continue
+			}
+
+			if sx, ok := d.(*ast.SliceExpr); ok && c.slices {
+				t.dim[i] = c.slice(sx, t, i)
+			} else if dx, ok := d.(*ast.DistExpr); ok && c.slices {
+				t.dim[i] = c.dist(dx, t, i)
+			} else {
+				t.dim[i] = c.vexpr(d, t)
+			}
+
+			if t.dim[i] == nil {
+				return nil, false
+			}
+		}
+
+		var ok bool
+		t.etype, ok = c.viewType(x.Elem)
+		if !ok {
+			return nil, false
+		}
+		return t, true
+
+	case *ast.StructType:
+		// VStructType
+		t, _ := vw.createType("", c.pos(x.Struct))
+		for _, f := range x.Fields {
+			ftype, ok := c.viewType(f.Type)
+			if !ok {
+				return nil, false
+			}
+
+			for _, id := range f.Names {
+				if t.getField(id.Name) != nil {
+					c.error(id.NamePos, fmt.Sprintf("field '%s' already defined", id.Name))
+					return nil, false
+				}
+			}
+
+			t.addFields(identNames(f.Names), ftype, c.pos(f.Pos()))
+		}
+
+		// the values of the computed fields, once all fields are known
+		for _, f := range x.Fields {
+			if f.Value != nil && !c.computedField(t, f, x.Fields) {
+				return nil, false
+			}
+		}
+
+		if x.Base != nil {
+			name := x.Base.Name
+			if t1 := ds.getType(name); t1 != nil {
+				t.dt = t1
+			} else {
+				c.error(x.Base.NamePos, fmt.Sprintf("type '%s' not defined", name))
+				return nil, false
+			}
+		}
+
+		return t, true
+	}
+
+	c.error(x.Pos(), "expecting type")
+	return nil, false
+}
+
+// Converts the value of the computed field f of the struct type t. The
+// value can use the constants and the other fields of the structure,
+// except the computed ones.
+func (c *checker) computedField(t *VType, f *ast.Field, fields []*ast.Field) bool {
+	if len(f.Names) != 1 {
+		c.error(f.Pos(), "a computed field has to be declared on its own")
+		return false
+	}
+
+	name := f.Names[0].Name
+	vf := t.getField(name)
+	if ft := vf.vt; ft == nil || ft.etype != nil || ft.fields != nil || primaryType(ft.dt) == nil || primaryType(ft.dt).ntype == drepl.NoType {
+		c.error(f.Names[0].NamePos, fmt.Sprintf("computed field '%s' needs a number type", name))
+		return false
+	}
+
+	computed := make(map[string] bool)
+	for _, f1 := range fields {
+		if f1.Value != nil {
+			computed[f1.Names[0].Name] = true
+		}
+	}
+
+	c.calls = true
+	vf.expr = c.expr(f.Value, func(id string, pos *Pos) interface{} {
+		if cd := c.getConst(id); cd!=nil {
+			return &cd.EVar
+		}
+
+		rf := t.getField(id)
+		switch {
+		case rf == nil:
+			c.errs.Add(pos, fmt.Sprintf("field '%s' not defined", id))
+			return nil
+
+		case computed[id]:
+			c.errs.Add(pos, fmt.Sprintf("computed field '%s' can't use computed field '%s'", name, id))
+			return nil
+		}
+
+		r := new(VFRef)
+		r.name = id
+		r.aux = r
+		r.f = rf
+		vf.refs = append(vf.refs, r)
+		return &r.EVar
+	})
+
+	c.calls = false
+	return vf.expr != nil
+}
+
+func (c *checker) viewVarDecl(d *ast.ViewVarDecl) {
+	ds := c.dr.Dataset
+	vw := c.cview
+
+	// optional element order of the variable's arrays
+	order := -1
+	elop := []*Expr(nil)
+	if d.Order != nil {
+		var ok bool
+
+		order = viewFlags[d.Order.Name]
+		if elop, ok = c.params(d.Order.Args); !ok {
+			return
+		}
+	}
+
+	vt, ok := c.viewType(d.Type)
+	if !ok {
+		return
+	}
+
+	vname := d.Name.Name
+	v, created := vw.createVarDecl(vname, c.pos(d.Var))
+	if !created {
+		c.error(d.Name.NamePos, fmt.Sprintf("variable '%v' already defined at %v", vname, &v.pos))
+		return
+	}
+
+	v.lt = vt
+	v.order = order
+	v.elop = elop
+	v.v = ds.getVarDecl(d.Value.Name)
+	if v.v == nil {
+		c.error(d.Value.NamePos, fmt.Sprintf("variable '%s' not found", d.Value.Name))
+		return
+	}
+
+	if d.Reduce != nil {
+		if v.reduce = reduceFuncs[d.Reduce.Name]; v.reduce == 0 {
+			c.error(d.Reduce.NamePos, fmt.Sprintf("unknown aggregation function '%s', expecting mean, min, max or sum", d.Reduce.Name))
+			return
+		}
+
+		if _, ok := d.RType.(*ast.ArrayType); !ok {
+			c.error(d.Value.NamePos, "only arrays can be reduced")
+			return
+		}
+	}
+
+	c.slices = true
+	c.reduce = v.reduce != 0
+	c.ref = func(x ast.Expr) *Expr {
+		return c.gatherRef(v, x)
+	}
+
+	v.rt, _ = c.viewType(d.RType)
+	c.ref = nil
+	c.slices = false
+	c.reduce = false
+	if v.rt != nil && v.gathers != nil && !c.gathers(v, d) {
+		return
+	}
+
+	if v.rt != nil && !c.nameSlices(v.lt, v.rt) {
+		return
+	}
+
+	if v.lt == nil && v.rt != nil && v.rt.dim != nil {
+		// same indices as the right side
+		if v.lt = c.leftType(v.rt, d.RType.Pos()); v.lt == nil {
+			return
+		}
+	}
+
+	if v.gathers != nil && !c.gatherTypes(v, d) {
+		return
+	}
+
+	if v.lt != nil && v.rt != nil {
+		c.broadcasts(v)
+	}
+
+	if d.Cond != nil && v.gathers != nil {
+		c.error(d.Where, "where can't be used with index arrays")
+		return
+	}
+
+	if v.reduce != 0 && v.rt != nil && v.window() == nil {
+		c.error(d.RType.Pos(), "the reduced variable needs a window, a slice of some dimension")
+		return
+	}
+
+	if d.Cond != nil {
+		c.where(v, d)
+	}
+}
+
+// Creates the index array for the reference to an element of a dataset
+// variable on the right side of the variable v. The reference is
+// converted by gathers, once the right side type exists.
+func (c *checker) gatherRef(v *VVarDecl, x ast.Expr) *Expr {
+	var path []string
+
+	for {
+		s, ok := x.(*ast.SelectorExpr)
+		if !ok {
+			break
+		}
+
+		path = append([]string{s.Sel.Name}, path...)
+		x = s.X
+	}
+
+	ix, ok := x.(*ast.IndexExpr)
+	if !ok {
+		c.error(x.Pos(), "expecting an element of a variable")
+		return nil
+	}
+
+	id, ok := ix.X.(*ast.Ident)
+	if !ok {
+		c.error(ix.X.Pos(), "expecting a variable")
+		return nil
+	}
+
+	g := new(VGather)
+	g.name = id.Name
+	g.aux = g
+	g.ix = ix
+	g.path = path
+	v.gathers = append(v.gathers, g)
+	return &Expr{op: IDENT, val: &g.EVar}
+}
+
+// Converts the index arrays of the variable v. Each one is a variable of
+// the dataset indexed by the temps of the right side, in a dimension that
+// doesn't use other temps.
+func (c *checker) gathers(v *VVarDecl, d *ast.ViewVarDecl) bool {
+	var others, gts []*VTemp
+
+	ds := c.dr.Dataset
+	top := make(map[*VGather]bool)
+	for _, e := range v.rt.dim {
+		for _, g := range findGathers(e, nil) {
+			top[g] = true
+		}
+	}
+
+	for _, g := range v.gathers {
+		ix := g.ix
+		if !top[g] {
+			c.error(ix.Pos(), "index arrays can only be used in the dimensions of the variable")
+			return false
+		}
+
+		p := new(VVarDecl)
+		p.name = g.name
+		p.order = -1
+		p.pos = *c.pos(ix.Pos())
+		if p.v = ds.getVarDecl(g.name); p.v == nil {
+			c.error(ix.X.Pos(), fmt.Sprintf("variable '%s' not found", g.name))
+			return false
+		}
+
+		for _, ie := range ix.Index {
+			e := c.vexpr(ie, v.rt)
+			if e == nil {
+				return false
+			}
+
+			g.index = append(g.index, e)
+		}
+
+		var ok bool
+		if p.rt, ok = c.viewType(&ast.ArrayType{Lbrack: ix.Lbrack, Dims: ix.Index}); !ok {
+			return false
+		}
+
+		g.idx = p
+		gts = gatherTemps(g, gts)
+	}
+
+	for i, e := range v.rt.dim {
+		ts := findTemps(e, nil)
+		if findGathers(e, nil) == nil {
+			others = findTemps(e, others)
+		} else if ts != nil {
+			c.error(d.RType.Pos(), fmt.Sprintf("dimension %d uses an index array, it can't use other indices", i))
+			return false
+		}
+	}
+
+	for _, t := range others {
+		if usesTemp(gts, t) {
+			c.errs.Add(&t.pos, fmt.Sprintf("index '%s' is used by an index array, it can't be used in other dimensions", t.name))
+			return false
+		}
+	}
+
+	return true
+}
+
+// Creates the temps of the right side for the indices of the left side
+// type of v that the right side doesn't use. Every value of such an index
+// has the same elements. The left side doesn't give the ranges of the
+// indices, so the range of such an index is given with where, e.g.
+// var b [i, j] = a[i] where j < 4.
+func (c *checker) broadcasts(v *VVarDecl) {
+	if v.lt.dim == nil || v.rt.dim == nil {
+		return
+	}
+
+	for _, e := range v.lt.dim {
+		for _, t := range findTemps(e, nil) {
+			if v.rt.temps[t.name] != nil {
+				continue
+			}
+
+			bt, _ := v.rt.createTemp(t.name, &t.pos)
+			bt.broadcast = true
+			v.bcast = append(v.bcast, t.name)
+		}
+	}
+}
+
+// Creates the left side types of the index arrays of v, the dimensions of
+// the variable that use the index array's temps.
+func (c *checker) gatherTypes(v *VVarDecl, d *ast.ViewVarDecl) bool {
+	if v.lt == nil || v.lt.dim == nil {
+		c.error(d.Name.NamePos, "variable with index arrays has to be an array")
+		return false
+	}
+
+	for _, g := range v.gathers {
+		var dims []*Expr
+
+		ts := gatherTemps(g, nil)
+		for _, e := range v.lt.dim {
+			for _, t := range findTemps(e, nil) {
+				if usesTemp(ts, v.rt.temps[t.name]) {
+					dims = append(dims, e)
+					break
+				}
+			}
+		}
+
+		g.idx.lt = c.arrayType(dims, &v.lt.pos)
+	}
+
+	return true
+}
+
+// converts a slice bound, it can only use constants
+func (c *checker) sliceBound(x ast.Expr) (*Expr, bool) {
+	if x == nil {
+		return nil, true
+	}
+
+	e := c.expr(x, func(name string, pos *Pos) interface{} {
+		if cd := c.getConst(name); cd!=nil {
+			return &cd.EVar
+		}
+
+		c.errs.Add(pos, fmt.Sprintf("slice bounds can only use constants, '%s' is not one", name))
+		return nil
+	})
+
+	return e, e != nil
+}
+
+// Converts the slice in the dimension i of the array type t. The slice
+// defines a new temp, named after an index of the left side by
+// nameSlices.
+func (c *checker) slice(x *ast.SliceExpr, t *VType, i int) *Expr {
+	var ok bool
+
+	if c.reduce {
+		return c.window(x, t, i)
+	}
+
+	sl := new(VSlice)
+	if sl.lo, ok = c.sliceBound(x.Lo); !ok {
+		return nil
+	}
+
+	if sl.hi, ok = c.sliceBound(x.Hi); !ok {
+		return nil
+	}
+
+	if sl.step, ok = c.sliceBound(x.Step); !ok {
+		return nil
+	}
+
+	tmp, _ := t.createTemp(fmt.Sprintf(":%d", i), c.pos(x.Pos()))
+	tmp.slice = sl
+	return &Expr{op: IDENT, val: &tmp.EVar}
+}
+
+// Converts the slice in the dimension i of the right side type t of a
+// reduction. The slice is a window, a new temp goes through its values
+// lo, lo+step, ... up to hi, and the elements are reduced over them. The
+// bounds can use the indices of the left side, the step only constants.
+func (c *checker) window(x *ast.SliceExpr, t *VType, i int) *Expr {
+	var ok bool
+
+	w := new(VSlice)
+	if x.Lo != nil {
+		if w.lo = c.vexpr(x.Lo, t); w.lo == nil {
+			return nil
+		}
+	}
+
+	if x.Hi != nil {
+		if w.hi = c.vexpr(x.Hi, t); w.hi == nil {
+			return nil
+		}
+	}
+
+	if w.step, ok = c.sliceBound(x.Step); !ok {
+		return nil
+	}
+
+	tmp, _ := t.createTemp(fmt.Sprintf("window %d", i), c.pos(x.Pos()))
+	tmp.window = w
+	e := VarExpr(&tmp.EVar)
+	if w.step != nil {
+		step, _ := w.step.clone(nil)
+		e = MulExpr(step, e)
+	}
+
+	if w.lo != nil {
+		lo, _ := w.lo.clone(nil)
+		e = AddExpr(lo, e)
+	}
+
+	return e
+}
+
+// Converts the distribution in the dimension i of the right side type t
+// of a partitioned view. Like a slice, it defines new temps, named after
+// the indices of the left side by nameSlices: block and cyclic define
+// the number of the value in the part of the rank, cyclic(B) the number
+// of the rank's block and the index in the block, so it needs two
+// indices.
+func (c *checker) dist(x *ast.DistExpr, t *VType, i int) *Expr {
+	var arg int64
+
+	if x.Arg != nil {
+		var ok bool
+
+		what := "ghost width"
+		if x.Name == "cyclic" {
+			what = "block size"
+		}
+
+		if arg, ok = c.partParam(x.Arg, what); !ok {
+			return nil
+		}
+
+		if arg < 0 || (arg == 0 && x.Name == "cyclic") {
+			c.error(x.Arg.Pos(), fmt.Sprintf("invalid %s: %d", what, arg))
+			return nil
+		}
+	}
+
+	rank := c.rank.val.(int64)
+	tmp, _ := t.createTemp(fmt.Sprintf(":%d", i), c.pos(x.Pos()))
+	switch {
+	case x.Name == "block":
+		tmp.slice = &VSlice{dist: distBlock, rank: rank, nranks: c.nranks, ghost: arg}
+
+	case x.Arg == nil:
+		tmp.slice = &VSlice{dist: distCyclic, rank: rank, nranks: c.nranks}
+
+	default:
+		// block-cyclic: (k*nranks + rank)*B + j, j < B
+		tmp.slice = &VSlice{dist: distBlockCyclic, rank: rank, nranks: c.nranks}
+		j, _ := t.createTemp(fmt.Sprintf(":%d.1", i), c.pos(x.Pos()))
+		j.where = &Expr{op: LSS, left: &Expr{op: IDENT, val: &j.EVar}, right: ConstInt64Expr(arg)}
+		k := &Expr{op: IDENT, val: &tmp.EVar}
+		e := MulExpr(AddExpr(MulExpr(k, ConstInt64Expr(c.nranks)), ConstInt64Expr(rank)), ConstInt64Expr(arg))
+		return AddExpr(e, &Expr{op: IDENT, val: &j.EVar})
+	}
+
+	return &Expr{op: IDENT, val: &tmp.EVar}
+}
+
+// Names the temps defined by the slices and the distributions of the
+// right side type rt after the indices of the left side type lt that the
+// right side doesn't use, in order. Without a left side type, the right side one is used for
+// both.
+func (c *checker) nameSlices(lt, rt *VType) bool {
+	var names []string
+
+	if lt == nil {
+		return true
+	}
+
+	for _, e := range lt.dim {
+		if t := exprTemp(e); t != nil && rt.temps[t.name] == nil {
+			names = append(names, t.name)
+		}
+	}
+
+	for _, e := range rt.dim {
+		for _, t := range findTemps(e, nil) {
+			if t.name[0] != ':' {
+				// named in the source
+				continue
+			}
+
+			if t.slice != nil && t.slice.dist == distBlockCyclic && len(names) < 2 {
+				// i/B and i%B of a single index aren't linear
+				c.errs.Add(&t.pos, "block-cyclic distribution needs two indices on the left side that aren't used on the right side, the block and the index in it, as in var x [k, j] = a[cyclic(B)]")
+				return false
+			}
+
+			if len(names) == 0 {
+				what := "slice"
+				if t.slice == nil || t.slice.dist != 0 {
+					what = "distribution"
+				}
+
+				c.errs.Add(&t.pos, fmt.Sprintf("%s needs an index on the left side that isn't used on the right side", what))
+				return false
+			}
+
+			delete(rt.temps, t.name)
+			t.name = names[0]
+			rt.temps[t.name] = t
+			names = names[1:]
+		}
+	}
+
+	return true
+}
+
+// Creates the left side type of an array variable declared without one,
+// indexed by the temps of the right side type rt. Each dimension has to
+// use a temp.
+func (c *checker) leftType(rt *VType, pos ast.Pos) *VType {
+	var ts []*VTemp
+
+	for i, e := range rt.dim {
+		// the temps of the index arrays index the variable too,
+		// the windows of a reduction don't
+		var ets []*VTemp
+		for _, t := range findTemps(e, nil) {
+			if t.window == nil {
+				ets = append(ets, t)
+			}
+		}
+
+		for _, g := range findGathers(e, nil) {
+			ets = gatherTemps(g, ets)
+		}
+
+		if ets == nil {
+			c.error(pos, fmt.Sprintf("dimension %d doesn't use an index, the variable needs a type", i))
+			return nil
+		}
+
+		for _, t := range ets {
+			if !usesTemp(ts, t) {
+				ts = append(ts, t)
+			}
+		}
+	}
+
+	dims := make([]*Expr, len(ts))
+	for i, t := range ts {
+		dims[i] = &Expr{op: IDENT, val: &t.EVar}
+	}
+
+	return c.arrayType(dims, c.pos(pos))
+}
+
+// creates an array type with the dimensions dims, the temps are replaced
+// by the type's own temps with the same names
+func (c *checker) arrayType(dims []*Expr, pos *Pos) *VType {
+	var copyDim func(e *Expr) *Expr
+
+	t, _ := c.cview.createType("", pos)
+	copyDim = func(e *Expr) *Expr {
+		if e == nil {
+			return nil
+		}
+
+		if tmp := exprTemp(e); tmp != nil {
+			nt, _ := t.createTemp(tmp.name, &tmp.pos)
+			return &Expr{op: e.op, val: &nt.EVar}
+		}
+
+		ne := new(Expr)
+		*ne = *e
+		ne.left = copyDim(e.left)
+		ne.right = copyDim(e.right)
+		return ne
+	}
+
+	t.dim = make([]*Expr, len(dims))
+	for i, e := range dims {
+		t.dim[i] = copyDim(e)
+	}
+
+	return t
+}
+
+// appends the temps used in the expression that aren't in ts yet, in the
+// order they are used
+func findTemps(e *Expr, ts []*VTemp) []*VTemp {
+	if e == nil {
+		return ts
+	}
+
+	if t := exprTemp(e); t != nil {
+		for _, tt := range ts {
+			if tt == t {
+				return ts
+			}
+		}
+
+		return append(ts, t)
+	}
+
+	return findTemps(e.right, findTemps(e.left, ts))
+}
+
+// appends the index arrays used in the expression, in order
+func findGathers(e *Expr, gs []*VGather) []*VGather {
+	if e == nil {
+		return gs
+	}
+
+	if v, ok := e.val.(*EVar); ok {
+		if g, ok := v.aux.(*VGather); ok {
+			return append(gs, g)
+		}
+	}
+
+	return findGathers(e.right, findGathers(e.left, gs))
+}
+
+// appends the temps used to index the index array g that aren't in ts yet
+func gatherTemps(g *VGather, ts []*VTemp) []*VTemp {
+	for _, e := range g.index {
+		ts = findTemps(e, ts)
+	}
+
+	return ts
+}
+
+// returns the temp if the expression is just a temp, nil otherwise
+func exprTemp(e *Expr) *VTemp {
+	if e == nil {
+		return nil
+	}
+
+	if v, ok := e.val.(*EVar); ok {
+		t, _ := v.aux.(*VTemp)
+		return t
+	}
+
+	return nil
+}
+
+// Converts the where clause of a view variable. The conjuncts that use
+// only the indices select the values of an index, the ones that use the
+// elements of the dataset variable select the elements when the view is
+// opened.
+func (c *checker) where(v *VVarDecl, d *ast.ViewVarDecl) {
+	var index, value []ast.Expr
+
+	if v.rt == nil || v.rt.dim == nil {
+		c.error(d.Where, "where can only select the elements of arrays")
+		return
+	}
+
+	for _, x := range conjuncts(d.Cond, nil) {
+		if usesElements(x) {
+			value = append(value, x)
+		} else {
+			index = append(index, x)
+		}
+	}
+
+	nerrs := len(c.errs)
+	for _, x := range index {
+		c.indexPredicate(x, v.rt)
+	}
+
+	if value == nil || len(c.errs) != nerrs {
+		return
+	}
+
+	if v.bcast != nil {
+		c.error(d.Where, fmt.Sprintf("index '%s' isn't used on the right side, the elements can't be selected by their values", v.bcast[0]))
+		return
+	}
+
+	if v.reduce != 0 {
+		c.error(d.Where, "the elements of a reduction can't be selected by their values")
+		return
+	}
+
+	// the probe reads the whole elements, selected the same way
+	p := new(VVarDecl)
+	p.name = v.name
+	p.v = v.v
+	p.order = -1
+	p.pos = v.pos
+	if v.lt != nil && v.lt.dim != nil {
+		p.lt = c.arrayType(v.lt.dim, &v.lt.pos)
+	}
+
+	rt := d.RType.(*ast.ArrayType)
+	c.slices = true
+	p.rt, _ = c.viewType(&ast.ArrayType{Lbrack: rt.Lbrack, Dims: rt.Dims})
+	c.slices = false
+	c.nameSlices(p.lt, p.rt)
+	for _, x := range index {
+		c.indexPredicate(x, p.rt)
+	}
+
+	c.ref = func(x ast.Expr) *Expr {
+		return c.valueRef(v, x)
+	}
+
+	for _, x := range value {
+		e := c.vpexpr(x, v.rt)
+		if e == nil {
+			continue
+		}
+
+		if v.match == nil {
+			v.match = e
+		} else {
+			v.match = &Expr{op: AND, left: v.match, right: e}
+		}
+	}
+
+	c.ref = nil
+	if len(c.errs) == nerrs {
+		v.probe = p
+	}
+}
+
+// splits the predicate in the conjuncts of its && operators
+func conjuncts(x ast.Expr, list []ast.Expr) []ast.Expr {
+	switch y := x.(type) {
+	case *ast.ParenExpr:
+		return conjuncts(y.X, list)
+
+	case *ast.BinaryExpr:
+		if y.Op == "&&" {
+			return conjuncts(y.Y, conjuncts(y.X, list))
+		}
+	}
+
+	return append(list, x)
+}
+
+// true if the expression uses the elements of the variable
+func usesElements(x ast.Expr) (found bool) {
+	ast.Inspect(x, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.IndexExpr, *ast.SelectorExpr:
+			found = true
+		}
+
+		return !found
+	})
+
+	return
+}
+
+// Converts a predicate that uses a single index of the variable, and
+// attaches it to the temp of the right side type t.
+func (c *checker) indexPredicate(x ast.Expr, t *VType) {
+	var tmp *VTemp
+
+	e := c.expr(x, func(name string, pos *Pos) interface{} {
+		if cd := c.getConst(name); cd!=nil {
+			return &cd.EVar
+		}
+
+		t := t.temps[name]
+		switch {
+		case t == nil:
+			c.errs.Add(pos, fmt.Sprintf("'%s' is not an index of the variable", name))
+			return nil
+
+		case tmp != nil && tmp != t:
+			c.errs.Add(pos, fmt.Sprintf("predicate can't use both '%s' and '%s'", tmp.name, name))
+			return nil
+		}
+
+		tmp = t
+		return &t.EVar
+	})
+
+	if e == nil {
+		return
+	}
+
+	if tmp == nil {
+		c.error(x.Pos(), "predicate doesn't use any index")
+		return
+	}
+
+	if tmp.where == nil {
+		tmp.where = e
+	} else {
+		tmp.where = &Expr{op: AND, left: tmp.where, right: e}
+	}
+}
+
+// converts a value predicate, the names outside the element references
+// can only be constants
+func (c *checker) vpexpr(x ast.Expr, t *VType) *Expr {
+	return c.expr(x, func(name string, pos *Pos) interface{} {
+		if cd := c.getConst(name); cd!=nil {
+			return &cd.EVar
+		}
+
+		if t.temps[name] != nil {
+			c.errs.Add(pos, fmt.Sprintf("index '%s' can't be used with the values of the elements", name))
+		} else {
+			c.errs.Add(pos, fmt.Sprintf("constant '%s' not defined", name))
+		}
+
+		return nil
+	})
+}
+
+// Converts a reference to the value of an element of the variable v, or
+// of one of its fields. The element has to be indexed as on the right
+// side of the variable's definition.
+func (c *checker) valueRef(v *VVarDecl, x ast.Expr) *Expr {
+	var path []string
+
+	for {
+		s, ok := x.(*ast.SelectorExpr)
+		if !ok {
+			break
+		}
+
+		path = append([]string{s.Sel.Name}, path...)
+		x = s.X
+	}
+
+	ix, ok := x.(*ast.IndexExpr)
+	if !ok {
+		c.error(x.Pos(), "expecting an element of the variable")
+		return nil
+	}
+
+	id, ok := ix.X.(*ast.Ident)
+	if !ok || id.Name != v.v.name {
+		c.error(ix.X.Pos(), fmt.Sprintf("only the elements of '%s' can be used", v.v.name))
+		return nil
+	}
+
+	if len(ix.Index) != len(v.rt.dim) {
+		c.error(ix.Lbrack, fmt.Sprintf("'%s' has %d indices", v.v.name, len(v.rt.dim)))
+		return nil
+	}
+
+	for k, ie := range ix.Index {
+		e := c.expr(ie, func(name string, pos *Pos) interface{} {
+			if cd := c.getConst(name); cd!=nil {
+				return &cd.EVar
+			}
+
+			if t := v.rt.temps[name]; t != nil {
+				return &t.EVar
+			}
+
+			c.errs.Add(pos, fmt.Sprintf("'%s' is not an index of the variable", name))
+			return nil
+		})
+
+		if e == nil {
+			return nil
+		}
+
+		if !e.equal(v.rt.dim[k]) {
+			c.error(ie.Pos(), fmt.Sprintf("the element has to be indexed as on the right side, expecting %v", v.rt.dim[k]))
+			return nil
+		}
+	}
+
+	r := new(VRef)
+	r.name = id.Name
+	r.aux = r
+	r.path = path
+	v.refs = append(v.refs, r)
+	return &Expr{op: IDENT, val: &r.EVar}
+}
+
+func (c *checker) replica(d *ast.ReplicaDecl) {
+	flags := 0
+	for _, f := range d.Flags {
+		switch f.Name {
+		case "complete":
+			flags |= Rcomplete
+		case "readonly":
+			flags |= Rreadonly
+		}
+	}
+
+	name := d.Name.Name
+	fname := name
+	if d.File != nil {
+		fname, _ = strconv.Unquote(d.File.Value)
+	}
+
+	r := c.dr.createReplica(name, fname, flags)
+	if r==nil {
+		c.error(d.Name.NamePos, fmt.Sprintf("cannot create replica '%s'", name))
+		return
+	}
+
+	for _, x := range d.Views {
+		id, vs := c.replicaViews(x)
+		if vs == nil {
+			continue
+		}
+
+		for _, v := range vs {
+			if v.filtered() {
+				c.error(id.NamePos, fmt.Sprintf("view '%s' has value predicates and can't be materialized", id.Name))
+				break
+			}
+
+			r.addView(v)
+		}
+	}
+}
+
+// Returns the views of the replica's view x: the view, all the views of
+// a partitioned view, or the view of one rank of it
+func (c *checker) replicaViews(x ast.Expr) (*ast.Ident, []*View) {
+	var rank ast.Expr
+	if e, ok := x.(*ast.IndexExpr); ok {
+		x = e.X
+		rank = e.Index[0]
+	}
+
+	id := x.(*ast.Ident)
+	vs := c.dr.parts[id.Name]
+	if rank != nil {
+		if vs == nil {
+			c.error(id.NamePos, fmt.Sprintf("view '%s' isn't partitioned", id.Name))
+			return id, nil
+		}
+
+		r, ok := c.partParam(rank, "the rank")
+		if !ok {
+			return id, nil
+		}
+
+		if r < 0 || r >= int64(len(vs)) {
+			c.error(rank.Pos(), fmt.Sprintf("rank %d of view '%s' is outside 0..%d", r, id.Name, len(vs) - 1))
+			return id, nil
+		}
+
+		return id, vs[r:r+1]
+	}
+
+	if vs == nil {
+		v := c.dr.findView(id.Name)
+		if v==nil {
+			c.error(id.NamePos, fmt.Sprintf("can't find view '%s'", id.Name))
+			return id, nil
+		}
+
+		vs = []*View{v}
+	}
+
+	return id, vs
+}
@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"drepl/drepl"
+)
+
+const computeDataset = `
+dataset {
+	type pt struct { vx, vy float64; a, b int32 }
+	var p [3]pt
+}
+
+view dv default {
+	var p [i] = p[i]
+}
+
+view c {
+	var p [i] { vx; vy; a; b; r float64 = vx / vy; q int32 = a / b + 1; m float64 = sqrt(vx*vx + vy*vy) } = p[i]
+}
+
+replica r1 "r1" {
+	view dv
+}
+`
+
+// the element of c: the stored fields, and r, q and m
+type computeElem struct {
+	vx, vy	float64
+	r	float64
+	q	int32
+	m	float64
+}
+
+func getFloat64(data []byte) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(data))
+}
+
+func putFloat64(data []byte, x float64) {
+	binary.LittleEndian.PutUint64(data, math.Float64bits(x))
+}
+
+// the elements of c, 48 bytes each
+func computeElems(data []byte) (els []computeElem) {
+	for ; len(data) >= 48; data = data[48:] {
+		els = append(els, computeElem{getFloat64(data), getFloat64(data[8:]), getFloat64(data[24:]),
+			int32(binary.LittleEndian.Uint32(data[32:])), getFloat64(data[40:])})
+	}
+
+	return els
+}
+
+// writes the elements of p, vx, vy, a and b, through the default view
+func writePoints(t *testing.T, dv *drepl.View, vals [][4]float64) {
+	data := make([]byte, dv.Size())
+	for i, v := range vals {
+		putFloat64(data[24*i:], v[0])
+		putFloat64(data[24*i + 8:], v[1])
+		binary.LittleEndian.PutUint32(data[24*i + 16:], uint32(int32(v[2])))
+		binary.LittleEndian.PutUint32(data[24*i + 20:], uint32(int32(v[3])))
+	}
+
+	if err := writeData(dv, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the views of the description by name
+func viewMap(t *testing.T, src string) map[string] *drepl.View {
+	views, errs := createDescViews(t, src, nil)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	vs := make(map[string] *drepl.View)
+	for _, v := range views {
+		vs[v.Name] = v
+	}
+
+	return vs
+}
+
+// same value, or both NaN
+func sameFloat(x, y float64) bool {
+	return x == y || math.IsNaN(x) && math.IsNaN(y)
+}
+
+func TestComputedFields(t *testing.T) {
+	want := []computeElem{
+		{3, 4, 0.75, 4, 5},
+		{1, 0, math.Inf(1), 2, 1},		// float division by zero
+		{-1, 0, math.Inf(-1), 1, 1},
+		{0, 0, math.NaN(), 1, 0},
+	}
+
+	// read from the default view, and from a replica
+	for _, src := range []string{
+		strings.Replace(computeDataset, "[3]pt", "[4]pt", 1),
+		strings.Replace(computeDataset, "[3]pt", "[4]pt", 1) + "replica r2 \"r2\" {\n\tview c\n}\n",
+	} {
+		vs := viewMap(t, src)
+		writePoints(t, vs["dv"], [][4]float64{{3, 4, 7, 2}, {1, 0, 1, 1}, {-1, 0, 0, 1}, {0, 0, 0, -1}})
+		data, err := readData(vs["c"])
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+
+		for i, e := range computeElems(data) {
+			w := want[i]
+			if e.vx != w.vx || e.vy != w.vy || !sameFloat(e.r, w.r) || e.q != w.q || e.m != w.m {
+				t.Errorf("element %d: got %v, expecting %v", i, e, w)
+			}
+		}
+	}
+}
+
+func TestComputedDivision(t *testing.T) {
+	// integer division by zero fails the read
+	vs := viewMap(t, strings.Replace(computeDataset, "a / b + 1", "a / (b - 1)", 1))
+	writePoints(t, vs["dv"], [][4]float64{{1, 1, 1, 2}, {1, 1, 1, 1}, {1, 1, 1, 3}})
+	if _, err := readData(vs["c"]); err == nil || !strings.Contains(err.Error(), "division by zero") {
+		t.Errorf("got error %v, expecting division by zero", err)
+	}
+}
+
+func TestComputedWrites(t *testing.T) {
+	for _, src := range []string{computeDataset, computeDataset + "replica r2 \"r2\" {\n\tview c\n}\n"} {
+		vs := viewMap(t, src)
+		writePoints(t, vs["dv"], [][4]float64{{3, 4, 7, 2}, {1, 2, 1, 1}, {0, 1, 0, 1}})
+
+		// the stored fields of c are written, the computed ones are
+		// calculated again
+		data, err := readData(vs["c"])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		putFloat64(data, 6)
+		putFloat64(data[8:], 8)
+		putFloat64(data[24:], 100)
+		if err = writeData(vs["c"], data); err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+
+		if data, err = readData(vs["dv"]); err != nil {
+			t.Fatal(err)
+		} else if x, y := getFloat64(data), getFloat64(data[8:]); x != 6 || y != 8 {
+			t.Errorf("%s: got %v, %v in the default view, expecting 6, 8", src, x, y)
+		}
+
+		if data, err = readData(vs["c"]); err != nil {
+			t.Fatal(err)
+		} else if e := computeElems(data)[0]; e.r != 0.75 || e.m != 10 {
+			t.Errorf("%s: got %v, expecting r 0.75, m 10", src, e)
+		}
+
+		if vs["c"].IsReadonly() {
+			t.Errorf("%s: view with computed fields is readonly", src)
+		}
+	}
+}
+
+func TestComputedErrors(t *testing.T) {
+	const ds = "dataset {\n\ttype pt struct { vx, vy float64; s [2]int32 }\n\tvar p [3]pt\n}\n"
+	tests := map[string] string{
+		"view v { var p [i] { vx } = p[sqrt(i)] }":				"functions can only be used in computed fields",
+		"view v { var p [i] { vx; r float64 = cbrt(vx) } = p[i] }":		"unknown function 'cbrt'",
+		"view v { var p [i] { vx; r float64 = atan2(vx) } = p[i] }":		"atan2 expects 2 argument(s), got 1",
+		"view v { var p [i] { vx; r float64 = vz } = p[i] }":			"field 'vz' not defined",
+		"view v { var p [i] { vx; r float64 = vx; t float64 = r } = p[i] }":	"computed field 't' can't use computed field 'r'",
+		"view v { var p [i] { vx; r, t float64 = vx } = p[i] }":		"a computed field has to be declared on its own",
+		"view v { var p [i] { vx; r pt = vx } = p[i] }":			"computed field 'r' needs a number type",
+		"view v { var p [i] { s; r float64 = s } = p[i] }":			"field 's' used by 'r' has to be a number",
+		"view v default { var p [i] { vx; r float64 = vx } = p[i] }":		"default view 'v' can't have computed fields",
+	}
+
+	for decl, msg := range tests {
+		_, errs := ParseReader("test.drepl", strings.NewReader(ds + decl), nil)
+		if errs == "" || !strings.Contains(errs, msg) {
+			t.Errorf("%s: got error %q, expecting %q", decl, errs, msg)
+		}
+	}
+}
@@ -20,18 +20,31 @@ type Type struct {
 	dim	[]int
 	vidx	[]EVar	// used while processing the conversion expressions, variable for each dimension
 
+	// set while processing the views of an array, see checkDivisions
+	divided	bool	// an index expression divides by an index
+	combined bool	// an index expression uses several indices, or an index is used in several dimensions
+
 	// struct
 	fields	[]Field
 
 	pos	Pos // position where defined
 
 	size	int64	// size of an instance of the type (<0 if variable)
+	endian	int	// byte order of primary types (drepl.AnyEndian, ...)
+	ntype	int	// numeric type of primary types (drepl.NoType, drepl.Int8, ...)
+	align	int64	// alignment of an instance of the type
+
+	// struct layout annotations
+	packed	bool	// no padding between the fields
+	alignexpr *Expr	// align(N), nil if not specified
+	xalign	int64	// evaluated alignexpr, 0 if not specified
 }
 
 type VarDecl struct {
 	name	string
 	pos	Pos // position where defined
 	t	*Type
+	offset	int64	// offset in the dataset file, after calcVarOffsets
 //	dest	Destination
 
 	blk	drepl.Block
@@ -43,6 +56,11 @@ type Field struct {
 	t	*Type
 	offset	int64	// offset from the beginning of the structure
 	pos	Pos
+
+	// layout annotations
+	packed	bool	// the field is not aligned
+	alignexpr *Expr	// align(N), nil if not specified
+	xalign	int64	// evaluated alignexpr, 0 if not specified
 }
 
 type ConstDecl struct {
@@ -55,8 +73,14 @@ type Dataset struct {
 	vars   map[string]*VarDecl
 	consts map[string]*ConstDecl
 
+	// same as above, in the order of declaration
+	tlist	[]*Type
+	vlist	[]*VarDecl
+	clist	[]*ConstDecl
+
 	v	*drepl.View
 	repl	*drepl.Replica
+	sized	bool	// the sizes of the types and the variable offsets are calculated
 }
 
 func (ds *Dataset) setPos(p, np *Pos) {
@@ -77,6 +101,7 @@ func (ds *Dataset) createConstDecl(name string, pos *Pos) (*ConstDecl, bool) {
 	c.aux = c
 	ds.setPos(&c.pos, pos)
 	ds.consts[name] = c
+	ds.clist = append(ds.clist, c)
 	return c, true
 }
 
@@ -112,6 +137,7 @@ func (ds *Dataset) createType(name string, pos *Pos) (*Type, bool) {
 
 	if name != "" {
 		ds.types[name] = td
+		ds.tlist = append(ds.tlist, td)
 	}
 
 	return td, true
@@ -129,7 +155,8 @@ func (ds *Dataset) getType(name string) *Type {
 			return nil
 		}
 
-		t = ds.createPrimaryType(name, int64(n+1))
+		t = ds.createPrimaryType(name, int64(n+1), drepl.AnyEndian, drepl.NoType)
+		t.align = 1
 		t.dimnum = 1
 		t.dimexpr = make([]*Expr, 1)
 		t.dimexpr[0] = new(Expr)
@@ -148,6 +175,7 @@ func (ds *Dataset) createVarDecl(name string, pos *Pos) (*VarDecl, bool) {
 	vd.name = name
 	ds.setPos(&vd.pos, pos)
 	ds.vars[name] = vd
+	ds.vlist = append(ds.vlist, vd)
 
 	return vd, true
 }
@@ -208,6 +236,26 @@ func (t *Type) isStaticArray() bool {
 	return true
 }
 
+// true if the leading dimension of the array is unlimited, and only that one
+func (t *Type) isUnlimited() bool {
+	for t.etype != nil && t.dimnum == 0 {
+		// type alias
+		t = t.etype
+	}
+
+	if !t.isArray() || t.dim[0] != 0 {
+		return false
+	}
+
+	for _, n := range t.dim[1:] {
+		if n == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (t *Type) isStruct() bool {
 	return t.fields != nil
 }
@@ -230,6 +278,7 @@ func (t *Type) calcSize() (err string) {
 			return fmt.Sprintf("matrix with variable element size")
 		}
 
+		t.align = t.etype.align
 		if t.dimnum == 0 {
 			// type alias
 			t.size = esz
@@ -249,6 +298,7 @@ func (t *Type) calcSize() (err string) {
 		t.size = sz * esz
 	} else if t.fields != nil && len(t.fields) > 0 {
 		sz := int64(0)
+		salign := int64(1)
 		for i := 0; i < len(t.fields); i++ {
 			f := &t.fields[i]
 			err = f.t.calcSize()
@@ -256,18 +306,37 @@ func (t *Type) calcSize() (err string) {
 				return err
 			}
 
-			// TODO: alignment?
 			fsz := f.t.size
 			if fsz < 0 {
 				t.size = -1
 				return "field with variable size"
 			}
 
-			f.offset = sz
-			sz += fsz
+			f.xalign, err = t.ds.evalAlign(f.alignexpr)
+			if err != "" {
+				return fmt.Sprintf("field %s: %s", f.name, err)
+			}
+
+			falign := fieldAlign(f.t.align, f.xalign, t.packed || f.packed)
+			f.offset = alignUp(sz, falign)
+			sz = f.offset + fsz
+			if falign > salign {
+				salign = falign
+			}
+		}
+
+		t.xalign, err = t.ds.evalAlign(t.alignexpr)
+		if err != "" {
+			return err
 		}
 
-		t.size = sz
+		if t.xalign > salign {
+			salign = t.xalign
+		}
+
+		// the size includes the padding at the end, as in C
+		t.align = salign
+		t.size = alignUp(sz, salign)
 	} else {
 		return fmt.Sprintf("%s: undefined type", t.name)
 	}
@@ -275,6 +344,50 @@ func (t *Type) calcSize() (err string) {
 	return ""
 }
 
+// returns the alignment of a field with type alignment talign and
+// explicit alignment xalign (0 if not specified). Explicit alignment
+// can only increase the natural one, unless the field is packed.
+func fieldAlign(talign, xalign int64, packed bool) int64 {
+	a := talign
+	if packed {
+		a = 1
+	}
+
+	if xalign > a {
+		a = xalign
+	}
+
+	return a
+}
+
+// rounds n up to a multiple of align
+func alignUp(n, align int64) int64 {
+	if align <= 1 {
+		return n
+	}
+
+	return (n + align - 1) / align * align
+}
+
+// evaluates an align(N) expression, N has to be a power of two
+func (ds *Dataset) evalAlign(e *Expr) (int64, string) {
+	if e == nil {
+		return 0, ""
+	}
+
+	val, err := ds.evalExpr(e)
+	if err != "" {
+		return 0, err
+	}
+
+	n, ok := val.(int64)
+	if !ok || n <= 0 || n & (n - 1) != 0 {
+		return 0, fmt.Sprintf("alignment must be a power of two: %v", val)
+	}
+
+	return n, ""
+}
+
 func (t *Type) EvalDims() (err string) {
 	if t.dimnum > 0 && t.dim == nil {
 		t.dim = make([]int, t.dimnum)
@@ -285,24 +398,29 @@ func (t *Type) EvalDims() (err string) {
 				continue
 			}
 
+			if t.dimexpr[i] == nil {
+				// unlimited
+				t.dim[i] = 0
+				continue
+			}
+
 			_, err = t.ds.evalExpr(t.dimexpr[i])
 			if err != "" {
 				return
 			}
 
-			var val interface{}
-			if t.dimexpr[i] != nil {
-				val = t.dimexpr[i].val
+			n, ok := t.dimexpr[i].val.(int64)
+			if !ok {
+				err = fmt.Sprintf("dimension not integer")
+				return
 			}
 
-			if val == nil {
-				t.dim[i] = 0
-			} else if n, ok := val.(int64); ok {
-				t.dim[i] = int(n)
-			} else {
-				err = fmt.Sprintf("dimension not integer")
+			if n <= 0 {
+				err = fmt.Sprintf("dimension must be positive, got %d", n)
 				return
 			}
+
+			t.dim[i] = int(n)
 		}
 	}
 
@@ -345,20 +463,30 @@ func (t *Type) createBlocks(bs *drepl.BlockSeq) (b drepl.Block, err string) {
 			return nil, "internal error"
 		}
 
-		b = bs.NewABlock(t.etype.size, dim, nblks[0])
+		ab := bs.NewABlock(t.etype.size, dim, nblks[0])
+		if t.dim[0] == 0 {
+			ab.SetRecords(drepl.NewRecords())
+		}
+
+		b = ab
 	} else if t.fields != nil {
 		nbs := bs.View().NewBlockSeq()
 		for _, f := range t.fields {
+			nbs.Pad(f.offset - nbs.Size())
 			_, err = f.t.createBlocks(nbs)
 			if err != "" {
 				return
 			}
 		}
 
+		nbs.Pad(t.size - nbs.Size())
 		b = bs.NewTBlock(nbs)
 	} else {
 		// primary types
-		b = bs.NewSBlock(t.size)
+		sb := bs.NewSBlock(t.size)
+		sb.SetEndian(t.endian)
+		sb.SetType(t.ntype)
+		b = sb
 	}
 
 	return
@@ -412,11 +540,14 @@ func (cd *ConstDecl) isDefined() bool {
 	return cd.pos.fname != ""
 }
 
-func (ds *Dataset) createPrimaryType(name string, sz int64) *Type {
+func (ds *Dataset) createPrimaryType(name string, sz int64, endian, ntype int) *Type {
 	td, _ := ds.createType(name, nil)
 	td.pos.fname = "built-in"
 	td.primary = true
 	td.size = sz
+	td.endian = endian
+	td.ntype = ntype
+	td.align = sz
 	return td
 }
 
@@ -425,12 +556,15 @@ func NewDataset() *Dataset {
 	ds.types = make(map[string]*Type)
 	ds.vars = make(map[string]*VarDecl)
 	ds.consts = make(map[string]*ConstDecl)
-	ds.createPrimaryType("int8", 1)
-	ds.createPrimaryType("int16", 2)
-	ds.createPrimaryType("int32", 4)
-	ds.createPrimaryType("int64", 8)
-	ds.createPrimaryType("float32", 4)
-	ds.createPrimaryType("float64", 8)
+	ds.createPrimaryType("int8", 1, drepl.AnyEndian, drepl.Int8)
+	for _, t := range []struct{name string; sz int64; ntype int} {
+		{"int16", 2, drepl.Int16}, {"int32", 4, drepl.Int32}, {"int64", 8, drepl.Int64},
+		{"float32", 4, drepl.Float32}, {"float64", 8, drepl.Float64},
+	} {
+		ds.createPrimaryType(t.name, t.sz, drepl.NativeEndian, t.ntype)
+		ds.createPrimaryType(t.name + "le", t.sz, drepl.LittleEndian, t.ntype)
+		ds.createPrimaryType(t.name + "be", t.sz, drepl.BigEndian, t.ntype)
+	}
 //	ds.createPrimaryType("string")
 
 	return ds
@@ -478,43 +612,39 @@ func (ds *Dataset) evalExpr(e *Expr) (val interface{}, err string) {
 		}
 
 		// store the value so we don't evaluate it next time
-		e.val = val
+		if err == "" {
+			e.val = val
+		}
+
 		return
 	}
 
-	switch e.op {
-	case ADD, SUB, MUL, QUO, REM:
+	switch {
+	case e.op == NOT:
 		lv, le := ds.evalExpr(e.left)
-		rv, re := ds.evalExpr(e.right)
 		if le != "" {
 			return nil, le
 		}
 
-		if re != "" {
-			return nil, re
-		}
-
-		// first try int64 result
-		if val, err = evalInt64(lv, rv, e.op); val != nil || err != "" {
-			e.val = val
-			return
-		}
+		val, err = evalNot(lv)
+		e.val = val
 
-		// then uint64
-		if val, err = evalUint64(lv, rv, e.op); val != nil || err != "" {
-			e.val = val
-			return
+	case e.op.Precedence() > lowestPrec:
+		lv, le := ds.evalExpr(e.left)
+		rv, re := ds.evalExpr(e.right)
+		if le != "" {
+			return nil, le
 		}
 
-		if val, err = evalFloat(lv, rv, e.op); val != nil || err != "" {
-			e.val = val
-			return
+		if re != "" {
+			return nil, re
 		}
 
-		err = "invalid operand type(s)"
+		val, err = evalBinary(lv, rv, e.op)
+		e.val = val
 
 	default:
-		err = "invalid operator"
+		err = fmt.Sprintf("invalid operator: %v", e.op)
 	}
 
 	return
@@ -522,7 +652,7 @@ func (ds *Dataset) evalExpr(e *Expr) (val interface{}, err string) {
 
 func (ds *Dataset) evalConst(c *ConstDecl) (val interface{}, err string) {
 	if c.eval {
-		return nil, fmt.Sprintf("%v: constant %s used while evaluating it", &c.pos, c.name)
+		return nil, fmt.Sprintf("constant %s used while evaluating it", c.name)
 	}
 
 	if c.expr == nil {
@@ -536,11 +666,11 @@ func (ds *Dataset) evalConst(c *ConstDecl) (val interface{}, err string) {
 	return
 }
 
-func (ds *Dataset) EvalConsts() (err string) {
-	for _, c := range ds.consts {
-		_, err = ds.evalConst(c)
+func (ds *Dataset) EvalConsts() (errs ErrorList) {
+	for _, c := range ds.clist {
+		_, err := ds.evalConst(c)
 		if err != "" {
-			return
+			errs.Add(&c.pos, err)
 		}
 
 //		fmt.Printf("const %s = %v\n", c.name, c.expr.val)
@@ -549,52 +679,58 @@ func (ds *Dataset) EvalConsts() (err string) {
 	return
 }
 
-func (ds *Dataset) EvalDims() (err string) {
-	for _, v := range ds.vars {
-		err = v.t.EvalDims()
+func (ds *Dataset) EvalDims() (errs ErrorList) {
+	for _, v := range ds.vlist {
+		err := v.t.EvalDims()
 		if err!="" {
-			return fmt.Sprintf("%v: %s", &v.pos, err)
-			break
+			errs.Add(&v.pos, err)
 		}
 	}
 
 	return
 }
 
-func (ds *Dataset) calcTypeSizes() (err string) {
-	for _, t := range ds.types {
-		err = t.calcSize()
+func (ds *Dataset) calcTypeSizes() (errs ErrorList) {
+	for _, t := range ds.tlist {
+		err := t.calcSize()
 		if err!="" {
-			return
+			errs.Add(&t.pos, err)
 		}
 	}
 
-	return ""
+	return
 }
 
-func (ds *Dataset) calcVarOffsets() (err string) {
+func (ds *Dataset) calcVarOffsets() (errs ErrorList) {
 //	fname := "ds"
 	n := 0
 	offset := int64(0)
-	for _, v := range ds.vars {
+	for _, v := range ds.vlist {
 //		v.dest.fname = fname
 //		v.dest.offset = offset
 
-		err = v.t.calcSize()
+		err := v.t.calcSize()
 		if err!="" {
-			return
+			errs.Add(&v.pos, err)
+			continue
 		}
 
-		if v.t.size > 0 {
+		v.offset = offset
+		if v.t.size >= 0 {
 			offset += v.t.size
 		} else {
+			if !v.t.isUnlimited() {
+				errs.Add(&v.pos, fmt.Sprintf("%s: only the leading dimension can be unlimited", v.name))
+				continue
+			}
+
 //			fname = fmt.Sprintf("ds%d", n)
 			n++
 			offset = 0
 		}
 	}
 
-	return ""
+	return
 }
 
 func (ds *Dataset) createBlocks() (err string) {
@@ -602,7 +738,7 @@ func (ds *Dataset) createBlocks() (err string) {
 	ds.v = drepl.NewView("*default", drepl.RowMajorOrder, false)
 	ds.repl.AddView(ds.v)
 
-	for _, v := range ds.vars {
+	for _, v := range ds.vlist {
 		err = v.createBlocks(ds.v)
 		if err != "" {
 			return err
@@ -614,16 +750,24 @@ func (ds *Dataset) createBlocks() (err string) {
 
 // connect each view with each other view
 func (ds *Dataset) fixBlocks() (err string) {
-	for _, v := range ds.vars {
+	var errs ErrorList
+
+	for _, v := range ds.vlist {
 //		fmt.Printf("connect destinations for %s\n", v.name)
-		v.blk.ConnectDestinations()
+		if e := v.blk.ConnectDestinations(); e != nil {
+			errs.Add(&v.pos, fmt.Sprintf("%s: %v", v.name, e))
+		}
 	}
-	
+
+	if len(errs) != 0 {
+		err = errs.Error()
+	}
+
 	return
 }
 
 func (ds *Dataset) GetBlocks() (bs []drepl.Block) {
-	for _, v := range ds.vars {
+	for _, v := range ds.vlist {
 		bs = append(bs, v.blk)
 	}
 
@@ -638,11 +782,11 @@ func (v *VarDecl) reset() {
 }
 
 func (ds *Dataset) reset() {
-	for _, t := range ds.types {
+	for _, t := range ds.tlist {
 		t.reset()
 	}
 
-	for _, v := range ds.vars {
+	for _, v := range ds.vlist {
 		v.reset()
 	}
 
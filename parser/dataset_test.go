@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"drepl/drepl"
+)
+
+const unlimitedDataset = `
+dataset {
+	const N = 3
+	var a [N]int32
+	var t [, 2]int32
+}
+
+view dv default {
+	var a [i] = a[i]
+	var t [i, j] = t[i, j]
+}
+
+view tv {
+	var t [i, j] = t[i, j]
+}
+
+replica r1 "r1" {
+	view dv
+}
+
+view av {
+	var a [i] = a[i]
+}
+
+replica r2 "r2" {
+	view tv
+	view av
+}
+`
+
+func TestDimensionErrors(t *testing.T) {
+	tests := []struct {
+		src	string
+		opts	*Options
+		msg	string
+	}{
+		{"dataset { var a [0]int32 }", nil, "dimension must be positive, got 0"},
+		{"dataset { const N = 10; var a [N - 10]int32 }", nil, "dimension must be positive, got 0"},
+		{"dataset { var a [4, -2]int32 }", nil, "dimension must be positive, got -2"},
+		{"dataset { const N = 10; var a [N]int32 }", &Options{Overrides: map[string] interface{}{"N": int64(0)}},
+			"dimension must be positive, got 0"},
+		{"dataset { var a [4, ]int32 }", nil, "only the leading dimension can be unlimited"},
+	}
+
+	for _, test := range tests {
+		_, errs := ParseReader("test.drepl", strings.NewReader(test.src), test.opts)
+		if errs == "" || !strings.Contains(errs, test.msg) {
+			t.Errorf("%s: got error %q, expecting %q", test.src, errs, test.msg)
+		}
+	}
+
+	// only an empty dimension is unlimited
+	dr, errs := ParseReader("test.drepl", strings.NewReader("dataset { var a [, 2]int32 }"), nil)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	if typ := dr.Dataset.vars["a"].t; typ.dim[0] != 0 || typ.dim[1] != 2 {
+		t.Errorf("got dimensions %v, expecting [0 2]", typ.dim)
+	}
+}
+
+// records appended to the default view show in the other views of the
+// variable with unlimited dimension
+func TestAppend(t *testing.T) {
+	views, errs := createDescViews(t, unlimitedDataset, nil)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	var dv, tv *drepl.View
+	for _, v := range views {
+		switch v.Name {
+		case "dv":
+			dv = v
+		case "tv":
+			tv = v
+		}
+	}
+
+	if !dv.Appendable() || !tv.Appendable() {
+		t.Fatal("views with unlimited dimension not appendable")
+	}
+
+	if dv.Size() != 12 || tv.Size() != 0 {
+		t.Fatalf("got sizes %d and %d, expecting 12 and 0", dv.Size(), tv.Size())
+	}
+
+	for n := 0; n < 2; n++ {
+		data := make([]byte, 16)
+		for i := 0; i < 4; i++ {
+			binary.LittleEndian.PutUint32(data[4*i:], uint32(4*n + i))
+		}
+
+		if c, err := dv.Append(data); err != nil || c != 16 {
+			t.Fatalf("append %d: got %d, %v", n, c, err)
+		}
+	}
+
+	if _, err := dv.Append(make([]byte, 4)); err == nil {
+		t.Errorf("partial record appended")
+	}
+
+	if dv.Size() != 12 + 32 || tv.Size() != 32 {
+		t.Fatalf("got sizes %d and %d, expecting 44 and 32", dv.Size(), tv.Size())
+	}
+
+	got, err := readValues(tv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range got {
+		if v != int32(i) {
+			t.Fatalf("got %v, expecting 0 to 7", got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// b is big-endian in the dataset, lv and uv have it little-endian, bv
+// has the fields of p big-endian
+const endianDataset = `
+dataset {
+	type pt struct { x int32be; y int16le; c int8; d int8 }
+	var p [2]pt
+	var b [3]int32be
+}
+
+view dv default {
+	var p [i] = p[i]
+	var b [i] = b[i]
+}
+
+view lv littleendian {
+	var b [i] = b[i]
+}
+
+view uv littleendian {
+	var b [i] = b[i]
+}
+
+view bv bigendian {
+	var p [i] = p[i]
+}
+
+replica r1 "r1" {
+	view dv
+}
+
+replica r2 "r2" {
+	view lv
+	view bv
+}
+`
+
+// the values are swapped when they are copied between views with
+// different byte orders, in both directions
+func TestEndianReplicate(t *testing.T) {
+	vs := viewMap(t, endianDataset)
+	dv := []byte{
+		// p[0], p[1]: x, y, c, d
+		0, 0, 1, 2, 3, 0, 'a', 'b',
+		0, 0, 4, 5, 6, 0, 'c', 'd',
+		// b
+		0, 0, 0, 1, 0, 0, 1, 0, 1, 2, 3, 4,
+	}
+
+	if err := writeData(vs["dv"], dv); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string] []byte{
+		"lv": {1, 0, 0, 0, 0, 1, 0, 0, 4, 3, 2, 1},
+		"uv": {1, 0, 0, 0, 0, 1, 0, 0, 4, 3, 2, 1},
+		"bv": {0, 0, 1, 2, 0, 3, 'a', 'b', 0, 0, 4, 5, 0, 6, 'c', 'd'},
+	}
+
+	for name, w := range want {
+		got, err := readData(vs[name])
+		if err != nil {
+			t.Fatalf("view %s: %v", name, err)
+		}
+
+		if !bytes.Equal(got, w) {
+			t.Errorf("view %s: got %v, expecting %v", name, got, w)
+		}
+	}
+
+	// back to the dataset
+	if err := writeData(vs["lv"], []byte{5, 0, 0, 0, 6, 0, 0, 0, 7, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeData(vs["bv"], []byte{0, 0, 0, 8, 0, 9, 'e', 'f', 0, 0, 0, 10, 0, 11, 'g', 'h'}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := []byte{
+		0, 0, 0, 8, 9, 0, 'e', 'f',
+		0, 0, 0, 10, 11, 0, 'g', 'h',
+		0, 0, 0, 5, 0, 0, 0, 6, 0, 0, 0, 7,
+	}
+
+	got, err := readData(vs["dv"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, w) {
+		t.Errorf("view dv: got %v, expecting %v", got, w)
+	}
+}
+
+func TestEndianErrors(t *testing.T) {
+	const ds = "dataset {\n\tvar a [4]int32\n}\n"
+	for src, msg := range map[string] string{
+		"view v bigendian littleendian { var a [i] = a[i] }": "view v: both bigendian and littleendian specified",
+		"view v littleendian bigendian default { var a [i] = a[i] }": "view v: both bigendian and littleendian specified",
+	} {
+		_, errs := createDescViews(t, ds + src, nil)
+		if !strings.Contains(errs, msg) {
+			t.Errorf("%s: got error %q, expecting %q", src, errs, msg)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"drepl/ast"
+)
+
+// Error is an error found while parsing or processing a description
+type Error struct {
+	Pos	Pos
+	Msg	string
+}
+
+func (e *Error) Error() string {
+	if e.Pos.fname == "" && e.Pos.line == 0 {
+		return e.Msg
+	}
+
+	return fmt.Sprintf("%v %s", &e.Pos, e.Msg)
+}
+
+// returns the position of the error
+func (e *Error) Position() ast.Pos {
+	return astPos(&e.Pos)
+}
+
+// ErrorList is a list of errors, sortable by position
+type ErrorList []*Error
+
+func (l *ErrorList) Add(pos *Pos, msg string) {
+	e := &Error{Msg: msg}
+	if pos != nil {
+		e.Pos = *pos
+	}
+
+	*l = append(*l, e)
+}
+
+func (l ErrorList) Len() int {
+	return len(l)
+}
+
+func (l ErrorList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+func (l ErrorList) Less(i, j int) bool {
+	p, q := &l[i].Pos, &l[j].Pos
+	if p.fname != q.fname {
+		return p.fname < q.fname
+	}
+
+	if p.line != q.line {
+		return p.line < q.line
+	}
+
+	return p.col < q.col
+}
+
+// sorts the errors by position, keeping the order of the errors at the
+// same position
+func (l ErrorList) Sort() {
+	sort.Stable(l)
+}
+
+// sorts the list and removes the errors reported more than once, or
+// reported at the same position as an earlier one (usually caused by it).
+// The errors without a position are removed only if repeated.
+func (l *ErrorList) RemoveMultiples() {
+	l.Sort()
+	n := 0
+	for i, e := range *l {
+		if i > 0 {
+			last := (*l)[n-1]
+			samePos := last.Pos.line != 0 && last.Pos.col == e.Pos.col
+			if last.Pos.fname == e.Pos.fname && last.Pos.line == e.Pos.line && (samePos || last.Msg == e.Msg) {
+				continue
+			}
+		}
+
+		(*l)[n] = e
+		n++
+	}
+
+	*l = (*l)[0:n]
+}
+
+// returns the errors, each followed by the source line with a caret
+// pointing to the position of the error
+func (l ErrorList) Error() string {
+	s := ""
+	for _, e := range l {
+		s += fmt.Sprintf("Error: %v\n", e)
+		src := e.Pos.source()
+		if src == nil || e.Pos.col == 0 {
+			continue
+		}
+
+		// keep the tabs so the caret lines up with the source
+		caret := []rune{}
+		for i, c := range []rune(string(src)) {
+			if i >= e.Pos.col - 1 {
+				break
+			}
+
+			if c != '\t' {
+				c = ' '
+			}
+
+			caret = append(caret, c)
+		}
+
+		s += fmt.Sprintf("\t%s\n\t%s^\n", src, string(caret))
+	}
+
+	return s
+}
+
+// returns the list as an error, or nil if it is empty
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
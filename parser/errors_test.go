@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+type errorPos struct {
+	line, col	int
+	msg		string
+}
+
+func errorPositions(el ErrorList) []errorPos {
+	var ps []errorPos
+	for _, e := range el {
+		ps = append(ps, errorPos{e.Pos.line, e.Pos.col, e.Msg})
+	}
+
+	return ps
+}
+
+func parseErrors(t *testing.T, src string) ErrorList {
+	_, err := ParseAST("test.drepl", []byte(src), nil)
+	el, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got %v, expecting an error list", err)
+	}
+
+	return el
+}
+
+// the parser continues after an error and reports the errors of the
+// following declarations
+func TestErrorList(t *testing.T) {
+	tests := []struct {
+		src	string
+		want	[]errorPos
+	}{
+		// resync at the ; after the broken declarations
+		{"dataset {\n\tvar a [4 int32\n\tvar b [4]int32\n\ttype s struct { x int32; y }\n}\n", []errorPos{
+			{2, 16, "invalid expression"},
+			{4, 29, "expecting type"},
+		}},
+
+		// resync at the } closing the view, the replica is parsed
+		{"dataset {\n\tvar a [4]int32\n}\nview v {\n\tvar x [i] = a[i\n}\nreplica r {\n\tview 5\n}\n", []errorPos{
+			{6, 1, "invalid expression"},
+			{8, 7, "view name expected"},
+		}},
+	}
+
+	for _, test := range tests {
+		got := errorPositions(parseErrors(t, test.src))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, expecting %v", test.src, got, test.want)
+		}
+	}
+
+	// the errors found by the checker have positions too
+	src := "dataset {\n\tvar b [4]foo\n}\nview v {\n\tvar x [i] = q[i]\n}\n"
+	_, _, el := Check("test.drepl", []byte(src), nil)
+	want := []errorPos{
+		{2, 11, "type 'foo' not defined"},
+		{5, 14, "variable 'q' not found"},
+	}
+
+	if got := errorPositions(el); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %v, expecting %v", src, got, want)
+	}
+}
+
+// the caret is under the error, the tabs of the source line are kept
+func TestErrorCaret(t *testing.T) {
+	el := parseErrors(t, "dataset {\n\tvar a [4 int32\n}\n")
+	want := "Error: test.drepl:2:16: invalid expression\n" +
+		"\t\tvar a [4 int32\n" +
+		"\t\t              ^\n"
+
+	if got := el.Error(); got != want {
+		t.Errorf("got %q, expecting %q", got, want)
+	}
+
+	// no source line without a column
+	el = ErrorList{}
+	el.Add(&Pos{fname: "a", line: 3}, "bad")
+	el.Add(nil, "worse")
+	if got, want := el.Error(), "Error: a:3: bad\nError: worse\n"; got != want {
+		t.Errorf("got %q, expecting %q", got, want)
+	}
+}
+
+func TestErrorSort(t *testing.T) {
+	var el ErrorList
+	el.Add(&Pos{fname: "b", line: 1, col: 1}, "b1")
+	el.Add(&Pos{fname: "a", line: 2, col: 5}, "a2.5")
+	el.Add(&Pos{fname: "a", line: 2, col: 3}, "a2.3")
+	el.Add(&Pos{fname: "a", line: 1, col: 9}, "a1")
+	el.Add(&Pos{fname: "a", line: 2, col: 3}, "a2.3 again")
+
+	el.Sort()
+	var got []string
+	for _, e := range el {
+		got = append(got, e.Msg)
+	}
+
+	// the errors at the same position stay in order
+	want := []string{"a1", "a2.3", "a2.3 again", "a2.5", "b1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, expecting %v", got, want)
+	}
+
+	// the errors at the same position, and the same errors on a line,
+	// are reported once
+	el.Add(&Pos{fname: "a", line: 2, col: 7}, "a2.5")
+	el.Add(&Pos{fname: "a", line: 3, col: 1}, "a2.5")
+
+	// the errors without a position are kept unless repeated
+	el.Add(nil, "n1")
+	el.Add(nil, "n1")
+	el.Add(nil, "n2")
+	el.RemoveMultiples()
+	got = nil
+	for _, e := range el {
+		got = append(got, e.Msg)
+	}
+
+	want = []string{"n1", "n2", "a1", "a2.3", "a2.5", "a2.5", "b1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, expecting %v", got, want)
+	}
+
+	if el.Err() == nil || (ErrorList{}).Err() != nil {
+		t.Errorf("Err: got %v and %v", el.Err(), (ErrorList{}).Err())
+	}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"drepl/drepl"
 )
@@ -26,6 +27,61 @@ type Range struct {
 	t		int64
 }
 
+// math function used in the expression of a computed field, the call is
+// an Expr with op LPAREN and the arguments in left and right
+type Func struct {
+	name		string
+	nargs		int
+	f		func(x, y float64) float64
+}
+
+var mathFuncs = map[string] *Func {
+	"abs":		{"abs", 1, func(x, _ float64) float64 { return math.Abs(x) }},
+	"sqrt":		{"sqrt", 1, func(x, _ float64) float64 { return math.Sqrt(x) }},
+	"exp":		{"exp", 1, func(x, _ float64) float64 { return math.Exp(x) }},
+	"log":		{"log", 1, func(x, _ float64) float64 { return math.Log(x) }},
+	"sin":		{"sin", 1, func(x, _ float64) float64 { return math.Sin(x) }},
+	"cos":		{"cos", 1, func(x, _ float64) float64 { return math.Cos(x) }},
+	"tan":		{"tan", 1, func(x, _ float64) float64 { return math.Tan(x) }},
+	"floor":	{"floor", 1, func(x, _ float64) float64 { return math.Floor(x) }},
+	"ceil":		{"ceil", 1, func(x, _ float64) float64 { return math.Ceil(x) }},
+	"atan2":	{"atan2", 2, math.Atan2},
+	"pow":		{"pow", 2, math.Pow},
+}
+
+// converts an evaluated number to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// evaluates the call of the function f
+func (e *Expr) evalCall(f *Func) (val interface{}, err string) {
+	var args [2]float64
+
+	for i, a := range []*Expr{e.left, e.right}[0:f.nargs] {
+		v, ae := a.eval()
+		if ae != "" {
+			return nil, ae
+		}
+
+		var ok bool
+		if args[i], ok = toFloat(v); !ok {
+			return nil, fmt.Sprintf("invalid argument of %s: %v", f.name, v)
+		}
+	}
+
+	return f.f(args[0], args[1]), ""
+}
+
 func evalInt64(l, r interface{}, op Token) (val interface{}, err string) {
 	n, nok := l.(int64)
 	m, mok := r.(int64)
@@ -55,6 +111,40 @@ func evalInt64(l, r interface{}, op Token) (val interface{}, err string) {
 		} else {
 			val = n % m
 		}
+
+	case SHL, SHR:
+		if m < 0 {
+			err = "negative shift count"
+		} else if m >= 64 {
+			err = "shift count too large"
+		} else if op == SHL {
+			if x := n << uint64(m); x >> uint64(m) != n {
+				err = "left shift overflows"
+			} else {
+				val = x
+			}
+		} else {
+			val = n >> uint64(m)
+		}
+
+	case EQL:
+		val = boolInt64(n == m)
+	case NEQ:
+		val = boolInt64(n != m)
+	case LSS:
+		val = boolInt64(n < m)
+	case LEQ:
+		val = boolInt64(n <= m)
+	case GTR:
+		val = boolInt64(n > m)
+	case GEQ:
+		val = boolInt64(n >= m)
+	case AND:
+		val = boolInt64(n != 0 && m != 0)
+	case OR:
+		val = boolInt64(n != 0 || m != 0)
+	default:
+		err = fmt.Sprintf("invalid operator: %v", op)
 	}
 
 	return
@@ -111,6 +201,38 @@ func evalUint64(l, r interface{}, op Token) (val interface{}, err string) {
 		} else {
 			val = n % m
 		}
+
+	case SHL, SHR:
+		if m >= 64 {
+			err = "shift count too large"
+		} else if op == SHL {
+			if x := n << m; x >> m != n {
+				err = "left shift overflows"
+			} else {
+				val = x
+			}
+		} else {
+			val = n >> m
+		}
+
+	case EQL:
+		val = boolInt64(n == m)
+	case NEQ:
+		val = boolInt64(n != m)
+	case LSS:
+		val = boolInt64(n < m)
+	case LEQ:
+		val = boolInt64(n <= m)
+	case GTR:
+		val = boolInt64(n > m)
+	case GEQ:
+		val = boolInt64(n >= m)
+	case AND:
+		val = boolInt64(n != 0 && m != 0)
+	case OR:
+		val = boolInt64(n != 0 || m != 0)
+	default:
+		err = fmt.Sprintf("invalid operator: %v", op)
 	}
 
 	return
@@ -149,14 +271,71 @@ func evalFloat(l, r interface{}, op Token) (val interface{}, err string) {
 	case MUL:
 		val = a * b
 	case QUO:
-		if b == 0 {
-			err = "division by zero"
-		} else {
-			val = a / b
-		}
+		// Inf or NaN if b is 0
+		val = a / b
+
+	case EQL:
+		val = boolInt64(a == b)
+	case NEQ:
+		val = boolInt64(a != b)
+	case LSS:
+		val = boolInt64(a < b)
+	case LEQ:
+		val = boolInt64(a <= b)
+	case GTR:
+		val = boolInt64(a > b)
+	case GEQ:
+		val = boolInt64(a >= b)
+	case AND:
+		val = boolInt64(a != 0 && b != 0)
+	case OR:
+		val = boolInt64(a != 0 || b != 0)
+	default:
+		err = fmt.Sprintf("invalid operator for floating point operands: %v", op)
+	}
 
-	case REM:
-		err = "invalid operator"
+	return
+}
+
+// the comparison and logical operators evaluate to 1 (true) or 0 (false)
+func boolInt64(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// evaluates the binary operator op for already evaluated operands
+func evalBinary(lv, rv interface{}, op Token) (val interface{}, err string) {
+	// first try int64 result
+	if val, err = evalInt64(lv, rv, op); val != nil || err != "" {
+		return
+	}
+
+	// then uint64
+	if val, err = evalUint64(lv, rv, op); val != nil || err != "" {
+		return
+	}
+
+	if val, err = evalFloat(lv, rv, op); val != nil || err != "" {
+		return
+	}
+
+	return nil, fmt.Sprintf("invalid operand type(s): %v %v", lv, rv)
+}
+
+// evaluates the logical negation of an already evaluated operand
+func evalNot(v interface{}) (val interface{}, err string) {
+	switch n := v.(type) {
+	case int64:
+		val = boolInt64(n == 0)
+	case uint64:
+		val = boolInt64(n == 0)
+	case float64:
+		val = boolInt64(n == 0)
+	default:
+		err = fmt.Sprintf("invalid operand type: %v", v)
 	}
 
 	return
@@ -170,6 +349,10 @@ func (e *Expr) eval() (val interface{}, err string) {
 //	fmt.Printf("\neval: %v\n", e)
 	val = e.val
 	err = ""
+	if f, ok := val.(*Func); ok {
+		return e.evalCall(f)
+	}
+
 	if val != nil {
 		if v, ok := val.(*EVar); ok {
 			val, err = evalVar(v)
@@ -212,36 +395,27 @@ func (e *Expr) eval() (val interface{}, err string) {
 		return
 	}
 
-	switch e.op {
-	case ADD, SUB, MUL, QUO, REM:
+	switch {
+	case e.op == NOT:
 		lv, le := e.left.eval()
-		rv, re := e.right.eval()
 		if le != "" {
 			return nil, le
 		}
 
-		if re != "" {
-			return nil, re
-		}
-
-		// first try int64 result
-		if val, err = evalInt64(lv, rv, e.op); val != nil || err != "" {
-//			e.val = val
-			return
-		}
+		val, err = evalNot(lv)
 
-		// then uint64
-		if val, err = evalUint64(lv, rv, e.op); val != nil || err != "" {
-//			e.val = val
-			return
+	case e.op.Precedence() > lowestPrec:
+		lv, le := e.left.eval()
+		rv, re := e.right.eval()
+		if le != "" {
+			return nil, le
 		}
 
-		if val, err = evalFloat(lv, rv, e.op); val != nil || err != "" {
-//			e.val = val
-			return
+		if re != "" {
+			return nil, re
 		}
 
-		err = fmt.Sprintf("invalid operand type(s): %v %v", lv, rv)
+		val, err = evalBinary(lv, rv, e.op)
 
 	default:
 		err = fmt.Sprintf("invalid operator: %d", e.op)
@@ -320,6 +494,7 @@ func (e *Expr) transform() (v *EVar, ne *Expr, ep **Expr, err string) {
 		return
 	}
 
+	vright := false
 	v, ve, ep, err = e.left.transform()
 	if err!="" {
 		return
@@ -332,6 +507,8 @@ func (e *Expr) transform() (v *EVar, ne *Expr, ep **Expr, err string) {
 			err = "no references on the right side of % supported"
 			return
 		}
+
+		vright = v!=nil
 	} else {
 		var vv *EVar
 
@@ -350,34 +527,61 @@ func (e *Expr) transform() (v *EVar, ne *Expr, ep **Expr, err string) {
 	if v==nil {
 		// const op const
 		ne.op = e.op
-		ne.left = ve
-		ne.right = nve
+		ne.left = nve
+		ne.right = ve
 		return
 	}
 
-	op := Token(0)
+	// ne is the inverse operation, hole is where its operand goes.
+	// c - x and c / x are inverted to c - y and c / y
+	var hole **Expr
 	switch e.op {
 	case ADD:
-		op = SUB
+		ne.op = SUB
 	case SUB:
-		op = ADD
+		ne.op = ADD
+		if vright {
+			ne.op = SUB
+		}
 	case MUL:
-		op = QUO
+		ne.op = QUO
 	case QUO:
-		op = MUL
+		ne.op = MUL
+		if vright {
+			ne.op = QUO
+		}
+	case REM:
+		err = "% can only be the last operation of the index expression of a dimension"
+		return
+	case SHL, SHR:
+		if vright {
+			err = "no references on the right side of a shift supported"
+			return
+		}
+
+		ne.op = SHR
+		if e.op == SHR {
+			ne.op = SHL
+		}
 	default:
-		err = "invalid operation"
+		err = fmt.Sprintf("operator %v not supported in index expressions", e.op)
 		return
 	}
 
-	ne.op = op
-	ne.right = nve
+	if vright && (e.op == SUB || e.op == QUO) {
+		ne.left = nve
+		hole = &ne.right
+	} else {
+		ne.right = nve
+		hole = &ne.left
+	}
+
 	if ep != nil {
 		*ep = ne
-		ep = &ne.left
+		ep = hole
 		ne = ve
 	} else {
-		ep = &ne.left
+		ep = hole
 	}
 
 	return
@@ -405,6 +609,32 @@ func (e *Expr) replace(v *EVar, ee *Expr) (*Expr, bool) {
 	return e, false
 }
 
+// returns a copy of the expression with all uses of v replaced by ee
+func (e *Expr) subst(v *EVar, ee *Expr) *Expr {
+	if e==nil {
+		return nil
+	}
+
+	if e.val == v {
+		return ee
+	}
+
+	ne := new(Expr)
+	*ne = *e
+	ne.left = e.left.subst(v, ee)
+	ne.right = e.right.subst(v, ee)
+	return ne
+}
+
+// true if both expressions are the same, using the same variables
+func (e *Expr) equal(f *Expr) bool {
+	if e==nil || f==nil {
+		return e == f
+	}
+
+	return e.op == f.op && e.val == f.val && e.left.equal(f.left) && e.right.equal(f.right)
+}
+
 func (e *Expr) solve(right *Expr) (*EVar, *Expr, string) {
 	v, le, ep, err := e.transform()
 	if err != "" {
@@ -506,6 +736,14 @@ func (e *Expr) String() string {
 		return "(nil)"
 	}
 
+	if f, ok := e.val.(*Func); ok {
+		if f.nargs == 1 {
+			return fmt.Sprintf("%s(%s)", f.name, e.left.String())
+		}
+
+		return fmt.Sprintf("%s(%s, %s)", f.name, e.left.String(), e.right.String())
+	}
+
 	if e.val != nil {
 		if v, ok := e.val.(*EVar); ok {
 			return v.name
@@ -514,20 +752,13 @@ func (e *Expr) String() string {
 		}
 	}
 
-	c := " "
-	switch e.op {
-	case MUL:
-		c = "*"
-	case ADD:
-		c = "+"
-	case QUO:
-		c = "/"
-	case SUB:
-		c = "-"
-	case REM:
-		c = "%"
-	default:
-		c = "?"
+	if e.op == NOT {
+		return fmt.Sprintf("!%s", e.left.String())
+	}
+
+	c := "?"
+	if e.op.Precedence() > lowestPrec {
+		c = e.op.String()
 	}
 
 	return fmt.Sprintf("(%s %s %s)", e.left.String(), c, e.right.String())
@@ -541,72 +772,112 @@ func (e *Expr) printPtr() string {
 	return fmt.Sprintf("(%p %v %v)", e, e.left.printPtr(), e.right.printPtr())
 }
 
-func (e *Expr) toPExpr(pe *drepl.PExpr, vars []EVar) bool {
+func (e *Expr) toPExpr(pe *drepl.PExpr, vars []*EVar) (err string) {
 	var l, r drepl.PExpr
 
 //	fmt.Printf("%stoPExpr %v\n", indent, e)
 	if e==nil {
-		return false
+		return "empty expression"
 	}
 
 	if e.val != nil {
-		if v, ok := e.val.(*EVar); ok {
-			pe.Xidx = -1
-			for i := 0; i < len(vars); i++ {
-				if &vars[i] == v {
-					pe.Xidx = i
-					break
+		val := e.val
+		if v, ok := val.(*EVar); ok {
+			if v.val == nil {
+				pe.Xidx = -1
+				for i := 0; i < len(vars); i++ {
+					if vars[i] == v {
+						pe.Xidx = i
+						break
+					}
 				}
+
+				pe.A = 1
+				pe.B = 0
+				pe.C = 0
+				pe.D = 1
+//				fmt.Printf("%s(%d, %d, %d, %d)\n", indent, pe.a, pe.b, pe.c, pe.d)
+				return ""
 			}
 
-			pe.A = 1
-			pe.B = 0
-			pe.C = 0
-			pe.D = 1
-//			fmt.Printf("%s(%d, %d, %d, %d)\n", indent, pe.a, pe.b, pe.c, pe.d)
-			return true
+			// evaluated constant
+			val = v.val
 		}
 
-		if n, ok := e.val.(int64); ok {
+		if n, ok := val.(int64); ok {
 			pe.A = 0
 			pe.B = n
 			pe.C = 0
 			pe.D = 1
 //			fmt.Printf("%s(%d, %d, %d, %d)\n", indent, pe.a, pe.b, pe.c, pe.d)
-			return true
+			return ""
+		}
+
+		return fmt.Sprintf("%v is not an integer", val)
+	}
+
+	if e.op == NOT {
+		return "operator ! not supported in index expressions"
+	}
+
+	if err = e.left.toPExpr(&l, vars); err != "" {
+		return
+	}
+
+	if err = e.right.toPExpr(&r, vars); err != "" {
+		return
+	}
+
+	if l.A == 0 && l.C == 0 && r.A == 0 && r.C == 0 {
+		// both sides are constant, fold them
+		var val interface{}
+
+		if l.B%l.D != 0 || r.B%r.D != 0 {
+			return "constant is not an integer"
+		}
+
+		val, err = evalBinary(l.B / l.D, r.B / r.D, e.op)
+		if err != "" {
+			return
 		}
 
-		return false
+		pe.Xidx = l.Xidx
+		pe.A = 0
+		pe.B = val.(int64)
+		pe.C = 0
+		pe.D = 1
+		return ""
 	}
 
-	if !e.left.toPExpr(&l, vars) {
-		return false
+	if l.Terms != nil || r.Terms != nil || (l.A != 0 || l.C != 0) && (r.A != 0 || r.C != 0) && l.Xidx != r.Xidx {
+		// the expression combines several indices
+		return linearPExpr(pe, e, &l, &r)
 	}
 
-	if !e.right.toPExpr(&r, vars) {
-		return false
+	if l.A != 0 || l.C != 0 {
+		pe.Xidx = l.Xidx
+	} else {
+		pe.Xidx = r.Xidx
 	}
 
 	switch e.op {
-	case ADD, SUB:
-		if e.op==SUB {
-			r.A = -r.A
-			r.B = -r.B
+	case SHL, SHR:
+		// shifts by a constant are multiplications and divisions
+		if r.A != 0 || r.C != 0 {
+			return fmt.Sprintf("shift count must be constant: %v", e)
 		}
 
-		if (l.A*r.C + r.A*l.A) != 0 || l.C*r.C != 0 {
-			// x^2 coefficients, can't have them!
-			return false
+		k := r.B / r.D
+		if k < 0 || k > 62 {
+			return fmt.Sprintf("invalid shift count: %v", e)
 		}
 
-		pe.A = l.A*r.D + l.B*r.C + l.D*r.A + l.C*r.B
-		pe.B = l.D*r.B + l.B*r.D
-		pe.C = l.C*r.D + l.D*r.C
-		pe.D = l.D * r.D
-//		fmt.Printf("%s(%d, %d, %d, %d) + (%d, %d, %d, %d) = (%d, %d, %d, %d)\n", indent, l.a, l.b, l.c, l.d, r.a, r.b, r.c, r.d, pe.a, pe.b, pe.c, pe.d)
-		
+		r.B = int64(1) << uint64(k)
+		r.D = 1
+		fallthrough
+
 	case MUL, QUO:
-		if e.op==QUO {
+		if e.op==QUO || e.op==SHR {
 			t := r.A
 			r.A = r.C
 			r.C = t
@@ -617,19 +888,174 @@ func (e *Expr) toPExpr(pe *drepl.PExpr, vars []EVar) bool {
 
 		if l.A*r.A != 0 || l.C*r.C != 0 {
 			// x^2 coefficients, can't have them
-			return false
+			return fmt.Sprintf("non-linear expression: %v", e)
 		}
 
 		pe.A = l.A*r.B + l.B*r.A
 		pe.B = l.B * r.B
-		pe.D = l.C*r.D + l.D*r.C
+		pe.C = l.C*r.D + l.D*r.C
 		pe.D = l.D * r.D
 //		fmt.Printf("%s(%d, %d, %d, %d) * (%d, %d, %d, %d) = (%d, %d, %d, %d)\n", indent, l.a, l.b, l.c, l.d, r.a, r.b, r.c, r.d, pe.a, pe.b, pe.c, pe.d)
 
+	case ADD, SUB:
+		if e.op==SUB {
+			r.A = -r.A
+			r.B = -r.B
+		}
+
+		if (l.A*r.C + r.A*l.C) != 0 || l.C*r.C != 0 {
+			// x^2 coefficients, can't have them!
+			return fmt.Sprintf("non-linear expression: %v", e)
+		}
+
+		pe.A = l.A*r.D + l.B*r.C + l.D*r.A + l.C*r.B
+		pe.B = l.D*r.B + l.B*r.D
+		pe.C = l.C*r.D + l.D*r.C
+		pe.D = l.D * r.D
+//		fmt.Printf("%s(%d, %d, %d, %d) + (%d, %d, %d, %d) = (%d, %d, %d, %d)\n", indent, l.a, l.b, l.c, l.d, r.a, r.b, r.c, r.d, pe.a, pe.b, pe.c, pe.d)
+
 	default:
-		return false
+		return fmt.Sprintf("operator %v not supported in index expressions", e.op)
 	}
 
-	return true
+	return ""
 }
 
+// Combines l and r, the PExprs of the operands of e, when they use
+// different indices. The indices can only be added, or multiplied and
+// divided by constants.
+func linearPExpr(pe *drepl.PExpr, e *Expr, l, r *drepl.PExpr) (err string) {
+	if l.C != 0 || r.C != 0 {
+		return fmt.Sprintf("can't divide by an index in an expression that uses several indices: %v", e)
+	}
+
+	lc := l.A == 0 && l.Terms == nil
+	rc := r.A == 0 && r.Terms == nil
+	ln := pexprTerms(l)
+	rn := pexprTerms(r)
+	n := make(map[int]int64)
+	d := int64(1)
+	b := int64(0)
+	switch e.op {
+	case ADD, SUB:
+		k := int64(1)
+		if e.op == SUB {
+			k = -1
+		}
+
+		for i, a := range ln {
+			n[i] += a*r.D
+		}
+
+		for i, a := range rn {
+			n[i] += k*a*l.D
+		}
+
+		b = l.B*r.D + k*r.B*l.D
+		d = l.D*r.D
+
+	case MUL, SHL:
+		if !lc && !rc {
+			return fmt.Sprintf("non-linear expression: %v", e)
+		}
+
+		if e.op == SHL {
+			if !rc || r.B%r.D != 0 || r.B/r.D < 0 || r.B/r.D > 62 {
+				return fmt.Sprintf("invalid shift count: %v", e)
+			}
+
+			r.B = int64(1) << uint64(r.B/r.D)
+			r.D = 1
+		}
+
+		if lc {
+			l, r = r, l
+			ln = rn
+		}
+
+		// l uses the indices, r is a constant
+		for i, a := range ln {
+			n[i] = a*r.B
+		}
+
+		b = l.B*r.B
+		d = l.D*r.D
+
+	case QUO, SHR:
+		if !rc {
+			return fmt.Sprintf("can't divide by an index in an expression that uses several indices: %v", e)
+		}
+
+		if e.op == SHR {
+			if r.B%r.D != 0 || r.B/r.D < 0 || r.B/r.D > 62 {
+				return fmt.Sprintf("invalid shift count: %v", e)
+			}
+
+			r.B = int64(1) << uint64(r.B/r.D)
+			r.D = 1
+		}
+
+		if r.B == 0 {
+			return fmt.Sprintf("division by zero: %v", e)
+		}
+
+		for i, a := range ln {
+			n[i] = a*r.D
+		}
+
+		b = l.B*r.D
+		d = l.D*r.B
+
+	default:
+		return fmt.Sprintf("operator %v not supported in index expressions", e.op)
+	}
+
+	for i := range n {
+		if i < 0 {
+			return fmt.Sprintf("unknown index in %v", e)
+		}
+
+		if d < 0 {
+			n[i] = -n[i]
+		}
+	}
+
+	if d < 0 {
+		d = -d
+		b = -b
+	}
+
+	*pe = drepl.PExpr{B: b, D: d}
+	for i := 0; len(n) > 0; i++ {
+		a, ok := n[i]
+		if !ok {
+			continue
+		}
+
+		delete(n, i)
+		switch {
+		case a == 0:
+		case pe.A == 0:
+			pe.A = a
+			pe.Xidx = i
+		default:
+			pe.Terms = append(pe.Terms, drepl.PTerm{A: a, Xidx: i})
+		}
+	}
+
+	return ""
+}
+
+// returns the coefficients of the indices used by p
+func pexprTerms(p *drepl.PExpr) map[int]int64 {
+	n := make(map[int]int64)
+	if p.A != 0 {
+		n[p.Xidx] += p.A
+	}
+
+	for _, t := range p.Terms {
+		n[t.Xidx] += t.A
+	}
+
+	return n
+}
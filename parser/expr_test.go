@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// parses the dataset with the constant N = expr, and returns its value
+func evalConst(expr string) (interface{}, string) {
+	src := "dataset {\n\tconst N = " + expr + "\n\tvar a [4]int32\n}\n"
+	dr, errs := ParseReader("test.drepl", strings.NewReader(src), nil)
+	if errs != "" {
+		return nil, errs
+	}
+
+	return dr.Dataset.consts["N"].val, ""
+}
+
+func TestExprPrecedence(t *testing.T) {
+	tests := []struct {
+		expr	string
+		want	int64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"64 / 4 / 2", 8},
+		{"7 % 4 * 2", 6},
+		{"-2 * 3", -6},
+		{"- (2 + 3)", -5},
+		{"+4 - -4", 8},
+		{"1 << 2 + 1", 5},
+		{"1 + 2 << 3", 17},
+		{"256 >> 2 >> 1", 32},
+		{"1 << 62", 1 << 62},
+		{"-1 << 3", -8},
+		{"2 < 3", 1},
+		{"2 + 1 == 3", 1},
+		{"3 != 3", 0},
+		{"1 < 2 == 1", 1},
+		{"1 || 0 && 0", 1},
+		{"(1 || 0) && 0", 0},
+		{"!0 + 1", 2},
+		{"!(2 > 1)", 0},
+		{"1 << 2 < 5", 1},
+	}
+
+	for _, test := range tests {
+		val, errs := evalConst(test.expr)
+		if errs != "" {
+			t.Errorf("%s: %s", test.expr, errs)
+		} else if n, ok := val.(int64); !ok || n != test.want {
+			t.Errorf("%s: got %v, expecting %d", test.expr, val, test.want)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	tests := map[string] string{
+		"1 / 0": "division by zero",
+		"1 % (2 - 2)": "division by zero",
+		"1 << -1": "negative shift count",
+		"1 << 64": "shift count too large",
+		"1 >> 70": "shift count too large",
+		"1 << 70": "shift count too large",
+		"1 << 63": "left shift overflows",
+		"3 << 62": "left shift overflows",
+		"1 +": "",
+		"(1 + 2": "",
+	}
+
+	for expr, msg := range tests {
+		_, errs := evalConst(expr)
+		if errs == "" || !strings.Contains(errs, msg) {
+			t.Errorf("%s: got error %q, expecting %q", expr, errs, msg)
+		}
+	}
+}
+
+func TestIndexExprPrecedence(t *testing.T) {
+	runViewTests(t, []viewTest{
+		{"view v { var x [i] = a[2*i + 1] }", map[string] []int32{"v": {1, 3, 5, 7, 9}}},
+		{"view v { var x [i] = a[i << 1] }", map[string] []int32{"v": {0, 2, 4, 6, 8}}},
+		{"view v { var x [i] = a[N - 1 - i] }", map[string] []int32{"v": {9, 8, 7, 6, 5, 4, 3, 2, 1, 0}}},
+	})
+}
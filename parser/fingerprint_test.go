@@ -0,0 +1,265 @@
+package parser
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"drepl/drepl"
+)
+
+// dataset with enough variables and views that the iteration order of
+// the maps they are kept in changes between runs
+const fingerprintDataset = `
+dataset {
+	const N = 10
+	var a, b, c, d, e, f [N]int32
+	var g, h [N]float64
+}
+
+view dv default {
+	var a [i] = a[i]
+	var b [i] = b[i]
+	var c [i] = c[i]
+	var d [i] = d[i]
+	var e [i] = e[i]
+	var f [i] = f[i]
+	var g [i] = g[i]
+	var h [i] = h[i]
+}
+
+view v1 { var x [i] = a[i]; var y [i] = h[i] }
+view v2 { var x [i] = b[i] }
+view v3 { var x [i] = c[N - 1 - i] }
+view v4 { var x [i] = d[i]; var y [i] = e[i] }
+
+replica r1 "r1" {
+	view dv
+}
+
+replica r2 "r2" {
+	view v1
+	view v2
+	view v3
+	view v4
+}
+`
+
+// the replicas of the description in src
+func createReplicas(t *testing.T, src string, opts *Options) map[string] *drepl.Replica {
+	dr, errs := ParseReader("test.drepl", strings.NewReader(src), opts)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	repls, _, errs := dr.CreateTransformationRules()
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	rs := make(map[string] *drepl.Replica)
+	for _, r := range repls {
+		rs[r.Name] = r
+	}
+
+	return rs
+}
+
+func TestFingerprintStable(t *testing.T) {
+	want := make(map[string] uint64)
+	for n, r := range createReplicas(t, fingerprintDataset, nil) {
+		want[n] = r.Fingerprint()
+	}
+
+	for i := 0; i < 20; i++ {
+		for n, r := range createReplicas(t, fingerprintDataset, nil) {
+			if fp := r.Fingerprint(); fp != want[n] {
+				t.Fatalf("replica %s: got fingerprint %x, expecting %x", n, fp, want[n])
+			}
+		}
+	}
+}
+
+func TestFingerprintLayout(t *testing.T) {
+	fp := createReplicas(t, fingerprintDataset, nil)["r2"].Fingerprint()
+	tests := []struct {
+		src	string
+		opts	*Options
+	}{
+		{strings.Replace(fingerprintDataset, "const N = 10", "const N = 12", 1), nil},
+		{strings.Replace(fingerprintDataset, "view v4 {", "view v4 bigendian {", 1), nil},
+		{strings.Replace(fingerprintDataset, "var y [i] = h[i]", "var y [i] = g[i]; var z [i] = h[i]", 1), nil},
+		{strings.Replace(fingerprintDataset, "var x [i] = c[N - 1 - i]", "var x [i] = c[i] where i < 5", 1), nil},
+		{strings.Replace(fingerprintDataset, "view v1\n\tview v2", "view v2\n\tview v1", 1), nil},
+	}
+
+	for _, test := range tests {
+		if createReplicas(t, test.src, test.opts)["r2"].Fingerprint() == fp {
+			t.Errorf("same fingerprint for %s", test.src)
+		}
+	}
+
+	// the number of records of an unlimited dimension isn't part of the
+	// layout
+	dr, errs := ParseReader("test.drepl", strings.NewReader(unlimitedDataset), nil)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	repls, views, errs := dr.CreateTransformationRules()
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	fps := make([]uint64, len(repls))
+	for i, r := range repls {
+		f, err := os.Create(filepath.Join(t.TempDir(), r.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { f.Close() })
+		if err = r.SetFile(f); err != nil {
+			t.Fatal(err)
+		}
+
+		fps[i] = r.Fingerprint()
+	}
+
+	for _, v := range views {
+		if v.Name == "dv" {
+			if _, err := v.Append(make([]byte, 16)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i, r := range repls {
+		if r.Fingerprint() != fps[i] {
+			t.Errorf("replica %s: fingerprint changed after appending records", r.Name)
+		}
+	}
+}
+
+func TestCheckFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "r2")
+	r := createReplicas(t, fingerprintDataset, nil)["r2"]
+	r.FileName = fname
+
+	// a new file gets the fingerprint, and can be used again with the same
+	// layout
+	if err := r.CheckFingerprint(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(fname, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.CheckFingerprint(); err != nil {
+		t.Errorf("same layout: %v", err)
+	}
+
+	// existing files without a fingerprint aren't used
+	if err := os.Remove(fname + ".fp"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.CheckFingerprint(); err == nil || !strings.Contains(err.Error(), "no layout fingerprint") {
+		t.Errorf("no fingerprint: got error %v", err)
+	}
+
+	if err := os.Remove(fname); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.CheckFingerprint(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(fname, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	r = createReplicas(t, strings.Replace(fingerprintDataset, "const N = 10", "const N = 12", 1), nil)["r2"]
+	r.FileName = fname
+	if err := r.CheckFingerprint(); err == nil || !strings.Contains(err.Error(), "different layout") {
+		t.Errorf("different layout: got error %v", err)
+	}
+}
+
+// opens the replicas of the description in src in the directory dir, the
+// way the tools do, and returns the views by name
+func openReplicas(t *testing.T, src, dir string) map[string] *drepl.View {
+	dr, errs := ParseReader("test.drepl", strings.NewReader(src), nil)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	repls, views, errs := dr.CreateTransformationRules()
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	for _, r := range repls {
+		r.FileName = filepath.Join(dir, r.FileName)
+		if err := r.CheckFingerprint(); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.OpenFile(r.FileName, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { f.Close() })
+		if err = r.SetFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vs := make(map[string] *drepl.View)
+	for _, v := range views {
+		vs[v.Name] = v
+	}
+
+	return vs
+}
+
+// the records appended are kept when the replicas are opened again
+func TestFingerprintRecords(t *testing.T) {
+	dir := t.TempDir()
+	vs := openReplicas(t, unlimitedDataset, dir)
+	if err := writeValues(vs["dv"]); err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 16)
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint32(data[4*i:], uint32(10 + i))
+	}
+
+	if _, err := vs["dv"].Append(data); err != nil {
+		t.Fatal(err)
+	}
+
+	vs = openReplicas(t, unlimitedDataset, dir)
+	want := map[string] []int32{"dv": {0, 1, 2, 10, 11, 12, 13}, "tv": {10, 11, 12, 13}, "av": {0, 1, 2}}
+	for name, w := range want {
+		got, err := readValues(vs[name])
+		if err != nil {
+			t.Errorf("view %s: %v", name, err)
+		} else if !reflect.DeepEqual(got, w) {
+			t.Errorf("view %s: got %v, expecting %v", name, got, w)
+		}
+	}
+
+	for _, name := range []string{"r1", "r2"} {
+		if fi, err := os.Stat(filepath.Join(dir, name)); err != nil || fi.Size() != 28 {
+			t.Errorf("replica %s: got size %v, expecting 28", name, fi.Size())
+		}
+	}
+}
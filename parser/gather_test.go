@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"drepl/drepl"
+)
+
+// dataset with the values 10, 11, ... in vals, and the indices of conn
+const gatherDataset = `
+dataset {
+	const N = 6
+	const K = 4
+	var vals [N]int32
+	var conn [K]int32
+}
+
+view dv default {
+	var vals [i] = vals[i]
+	var conn [k] = conn[k]
+}
+
+view g {
+	var cv [k] = vals[conn[k]]
+}
+
+replica r1 "r1" {
+	view dv
+}
+`
+
+// creates the views of the gather dataset with the replicas in repl,
+// and writes the values and the indices idx to the default view
+func createGatherViews(t *testing.T, repl string, idx []int32) map[string]*drepl.View {
+	views, errs := createDescViews(t, gatherDataset + repl, nil)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	vm := make(map[string]*drepl.View)
+	for _, v := range views {
+		vm[v.Name] = v
+	}
+
+	data := make([]byte, 4*(6 + len(idx)))
+	for i := 0; i < 6; i++ {
+		binary.LittleEndian.PutUint32(data[4*i:], uint32(10 + i))
+	}
+
+	for i, n := range idx {
+		binary.LittleEndian.PutUint32(data[4*(6 + i):], uint32(n))
+	}
+
+	if err := writeData(vm["dv"], data); err != nil {
+		t.Fatal(err)
+	}
+
+	return vm
+}
+
+// writes the int32 value val to the element n of the variable at offset
+// off of the view v
+func writeElem(t *testing.T, v *drepl.View, off int64, n int, val int32) {
+	t.Helper()
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(val))
+	off += int64(4*n)
+	b := v.Search(off, 4)[0]
+	if _, err := b.Write(data, off, b.Offset(), true, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkValues(t *testing.T, v *drepl.View, want []int32) {
+	t.Helper()
+	got, err := readValues(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("view %s: got %v, expecting %v", v.Name, got, want)
+	}
+}
+
+// the elements are read through the index array when the view is read
+func TestGatherRead(t *testing.T) {
+	vm := createGatherViews(t, "", []int32{5, 0, 3, 3})
+	checkValues(t, vm["g"], []int32{15, 10, 13, 13})
+
+	// the indices are read again too
+	writeElem(t, vm["dv"], 24, 1, 2)
+	checkValues(t, vm["g"], []int32{15, 12, 13, 13})
+}
+
+// the materialized copy is refreshed when either array is written
+func TestGatherRefresh(t *testing.T) {
+	vm := createGatherViews(t, `replica r2 "r2" { view g }`, []int32{5, 0, 3, 3})
+	g := vm["g"]
+	if !g.Materialized() {
+		t.Fatal("view g isn't materialized")
+	}
+
+	checkValues(t, g, []int32{15, 10, 13, 13})
+
+	// a value used twice
+	writeElem(t, vm["dv"], 0, 3, 20)
+	checkValues(t, g, []int32{15, 10, 20, 20})
+
+	// an index
+	writeElem(t, vm["dv"], 24, 1, 2)
+	checkValues(t, g, []int32{15, 12, 20, 20})
+
+	// a value that isn't used
+	writeElem(t, vm["dv"], 0, 4, 30)
+	checkValues(t, g, []int32{15, 12, 20, 20})
+}
+
+// the elements with indices outside of the array are 0
+func TestGatherRange(t *testing.T) {
+	for _, repl := range []string{"", `replica r2 "r2" { view g }`} {
+		vm := createGatherViews(t, repl, []int32{5, -1, 6, 100})
+		checkValues(t, vm["g"], []int32{15, 0, 0, 0})
+	}
+}
+
+// the views with index arrays can't be written
+func TestGatherReadonly(t *testing.T) {
+	for _, repl := range []string{"", `replica r2 "r2" { view g }`} {
+		vm := createGatherViews(t, repl, []int32{0, 1, 2, 3})
+		if !vm["g"].IsReadonly() {
+			t.Errorf("%q: view with index arrays isn't readonly", repl)
+		}
+	}
+
+	for src, msg := range map[string] string{
+		"view dg default { var cv [k] = vals[conn[k]] }": "default view 'dg' can't use index arrays",
+		"view h { var cv [k] = vals[nope[k]] }": "variable 'nope' not found",
+		"view h { var cv [k] = vals[conn[k] + k] }": "dimension 0 uses an index array, it can't use other indices",
+	} {
+		_, errs := createDescViews(t, gatherDataset + src, nil)
+		if !strings.Contains(errs, msg) {
+			t.Errorf("%s: got error %q, expecting %q", src, errs, msg)
+		}
+	}
+}
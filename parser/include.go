@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Resolver finds the file name included from the file from, and returns
+// its content and the name to use for it in error messages and for
+// resolving the files it includes.
+type Resolver func(from, name string) (fname string, data []byte, err error)
+
+// Options controls where the parser reads the descriptions from. The zero
+// value (or nil) reads the files from the OS file system.
+type Options struct {
+	// if not nil, the files are read from FS instead of the OS file
+	// system. The names are slash-separated paths within FS.
+	FS		fs.FS
+
+	// if not nil, used to find the files instead of FS
+	Resolver	Resolver
+
+	// values of the constants that replace the ones in the description,
+	// integers, floats or strings that are parsed as the constant's type
+	Overrides	map[string] interface{}
+}
+
+func (o *Options) overrides() map[string] interface{} {
+	if o == nil {
+		return nil
+	}
+
+	return o.Overrides
+}
+
+// Returns the content of the file name included from the file from. The
+// relative names are relative to the directory of the including file,
+// the top-level file has from set to "".
+func (o *Options) resolve(from, name string) (string, []byte, error) {
+	if o != nil && o.Resolver != nil {
+		return o.Resolver(from, name)
+	}
+
+	if o != nil && o.FS != nil {
+		fname := name
+		if !strings.HasPrefix(name, "/") {
+			fname = path.Join(path.Dir(from), name)
+		}
+
+		fname = strings.TrimPrefix(path.Clean(fname), "/")
+		data, err := fs.ReadFile(o.FS, fname)
+		return fname, data, err
+	}
+
+	fname := name
+	if !filepath.IsAbs(name) && from != "" {
+		fname = filepath.Join(filepath.Dir(from), name)
+	}
+
+	data, err := os.ReadFile(fname)
+	return fname, data, err
+}
@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var includeFS = fstest.MapFS{
+	"a/b/main.drepl":	{Data: []byte("dataset \"../ds.drepl\"\nview dv default \"v.drepl\"\n")},
+	"a/ds.drepl":		{Data: []byte("var x [4]int32\nvar y [2]int64\n")},
+	"a/b/v.drepl":		{Data: []byte("var x [i] = x[i]\nvar y [i] = y[i]\n")},
+	"abs.drepl":		{Data: []byte("dataset \"/a/ds.drepl\"\nview dv default \"a/b/v.drepl\"\n")},
+	"bad.drepl":		{Data: []byte("dataset \"../ds.drepl\"\nview dv default \"v.drepl\"\n")},
+	"badv.drepl":		{Data: []byte("dataset \"a/ds.drepl\"\nview dv default \"badv.v\"\n")},
+	"badv.v":		{Data: []byte("var x [i] = x[i]\nvar z [i] = z[i]\n")},
+}
+
+func checkIncluded(t *testing.T, name string, dr *DRepl, errs string) {
+	if errs != "" {
+		t.Errorf("%s: %s", name, errs)
+		return
+	}
+
+	v := dr.Views["dv"]
+	if v == nil || len(v.vars) != 2 {
+		t.Errorf("%s: got view %v, expecting a view with x and y", name, v)
+	}
+}
+
+// the included files are relative to the file including them
+func TestIncludeFS(t *testing.T) {
+	opts := &Options{FS: includeFS}
+	dr, errs := ParseFile("a/b/main.drepl", opts)
+	checkIncluded(t, "a/b/main.drepl", dr, errs)
+
+	// the absolute names are from the root of the FS
+	dr, errs = ParseFile("abs.drepl", opts)
+	checkIncluded(t, "abs.drepl", dr, errs)
+
+	// the name of the reader is used for the includes
+	dr, errs = ParseReader("a/b/main.drepl", strings.NewReader(string(includeFS["a/b/main.drepl"].Data)), opts)
+	checkIncluded(t, "reader", dr, errs)
+
+	for name, msg := range map[string] string{
+		"missing.drepl":	"open missing.drepl: file does not exist",
+		"bad.drepl":		"bad.drepl:1:9: can't read file '../ds.drepl'",
+
+		// the errors in an included file are reported in it
+		"badv.drepl":		"badv.v:2:13: variable 'z' not found",
+	} {
+		_, errs := ParseFile(name, opts)
+		if !strings.Contains(errs, msg) {
+			t.Errorf("%s: got error %q, expecting %q", name, errs, msg)
+		}
+	}
+}
+
+// the resolver gets the names of the including file and of the included one
+func TestIncludeResolver(t *testing.T) {
+	var calls [][2]string
+	opts := &Options{Resolver: func(from, name string) (string, []byte, error) {
+		calls = append(calls, [2]string{from, name})
+		fname := path.Join("a/b", name)
+		if f := includeFS[fname]; f != nil {
+			return fname, f.Data, nil
+		}
+
+		return "", nil, fs.ErrNotExist
+	}}
+
+	dr, errs := ParseFile("main.drepl", opts)
+	checkIncluded(t, "main.drepl", dr, errs)
+
+	want := [][2]string{
+		{"", "main.drepl"},
+		{"a/b/main.drepl", "../ds.drepl"},
+		{"a/b/main.drepl", "v.drepl"},
+	}
+
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %v, expecting %v", calls, want)
+	}
+
+	// the resolver takes precedence over the FS
+	opts.FS = fstest.MapFS{}
+	opts.Resolver = func(from, name string) (string, []byte, error) {
+		return "", nil, errors.New("no includes")
+	}
+
+	_, errs = ParseReader("main.drepl", strings.NewReader("dataset \"ds.drepl\"\n"), opts)
+	if msg := "can't read file 'ds.drepl': no includes"; !strings.Contains(errs, msg) {
+		t.Errorf("got error %q, expecting %q", errs, msg)
+	}
+}
@@ -0,0 +1,278 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The functions below describe the declarations with the sizes, offsets
+// and dimensions computed while processing the description, for the
+// tools that show them to the users. They return "" if the declaration
+// doesn't exist. The computed values are left out if the description
+// has errors that prevented computing them.
+
+// TypeInfo describes the dataset type name: its size and alignment, the
+// dimensions of the arrays, and the offsets of the struct fields.
+func (dr *DRepl) TypeInfo(name string) string {
+	t := dr.Dataset.types[name]
+	if t == nil {
+		return ""
+	}
+
+	s := fmt.Sprintf("type %s %s\n", name, typeLit(t))
+	if t.primary {
+		return s + fmt.Sprintf("size %d\n", t.size)
+	}
+
+	if !dr.Dataset.sized {
+		return s
+	}
+
+	return s + t.info()
+}
+
+// VarInfo describes the dataset variable name: its type, size and the
+// offset in the dataset.
+func (dr *DRepl) VarInfo(name string) string {
+	v := dr.Dataset.vars[name]
+	if v == nil {
+		return ""
+	}
+
+	s := fmt.Sprintf("var %s %s\n", name, typeString(v.t))
+	if !dr.Dataset.sized {
+		return s
+	}
+
+	return s + fmt.Sprintf("offset %d\n", v.offset) + v.t.info()
+}
+
+// ConstInfo describes the constant name and its value.
+func (dr *DRepl) ConstInfo(name string) string {
+	c := dr.Dataset.consts[name]
+	if c == nil || !c.isDefined() {
+		return ""
+	}
+
+	if c.val == nil {
+		return fmt.Sprintf("const %s\n", name)
+	}
+
+	return fmt.Sprintf("const %s = %v\n", name, c.val)
+}
+
+// ViewInfo describes the view name: its flags, and the size of each of
+// its variables.
+func (dr *DRepl) ViewInfo(name string) string {
+	v := dr.Views[name]
+	if v == nil {
+		return ""
+	}
+
+	s := fmt.Sprintf("view %s", name)
+	if f := flagsString(v.flags); f != "" {
+		s += " " + f
+	}
+
+	s += "\n"
+	for _, vv := range v.vars {
+		s += fmt.Sprintf("var %s", vv.name)
+		if vv.processed && vv.probe != nil {
+			s += fmt.Sprintf(": size up to %s", sizeString(vv.lt.sz))
+		} else if vv.processed {
+			s += fmt.Sprintf(": size %s", sizeString(vv.lt.sz))
+		}
+
+		s += "\n"
+	}
+
+	return s
+}
+
+// ViewVarInfo describes the variable name of the view: the dataset
+// variable it is mapped to, and the size, dimensions and field offsets
+// of the view's type.
+func (dr *DRepl) ViewVarInfo(view, name string) string {
+	v := dr.Views[view]
+	if v == nil {
+		return ""
+	}
+
+	vv := v.vmap[name]
+	if vv == nil {
+		return ""
+	}
+
+	s := fmt.Sprintf("view %s var %s", view, name)
+	if vv.v != nil && vv.reduce != 0 {
+		for f, r := range reduceFuncs {
+			if r == vv.reduce {
+				s += fmt.Sprintf(" = %s(%s)", f, vv.v.name)
+			}
+		}
+	} else if vv.v != nil {
+		s += fmt.Sprintf(" = %s", vv.v.name)
+	}
+
+	s += "\n"
+	if vv.processed {
+		s += vv.lt.info()
+	}
+
+	if vv.probe != nil {
+		s += "elements selected by their values when the view is opened\n"
+	}
+
+	for _, g := range vv.gathers {
+		s += fmt.Sprintf("elements gathered through the index array '%s'\n", g.idx.name)
+	}
+
+	for _, name := range vv.bcast {
+		s += fmt.Sprintf("elements repeated for each value of '%s'\n", name)
+	}
+
+	if vv.processed && vv.reduce != 0 {
+		s += fmt.Sprintf("elements reduced over windows of %v values\n", vv.lt.win)
+	}
+
+	return s
+}
+
+// returns the size, the dimensions and the field offsets of the type
+func (t *Type) info() string {
+	for t.dimnum == 0 && t.etype != nil {
+		// type alias
+		t = t.etype
+	}
+
+	s := fmt.Sprintf("size %s, align %d\n", sizeString(t.size), t.align)
+	if t.dimnum > 0 {
+		s += "dimensions " + dimString(t.dim) + "\n"
+		s += fmt.Sprintf("element size %s\n", sizeString(t.etype.size))
+	}
+
+	for _, f := range t.fields {
+		s += fmt.Sprintf("%s %s: offset %d, size %s\n", f.name, typeString(f.t), f.offset, sizeString(f.t.size))
+	}
+
+	return s
+}
+
+// returns the size, the dimensions and the field offsets of the type
+// after the view was processed
+func (t *VType) info() string {
+	s := fmt.Sprintf("size %s\n", sizeString(t.sz))
+	if t.vdim != nil {
+		dim := make([]int, len(t.vdim))
+		for i, d := range t.vdim {
+			dim[i] = int(d.max - d.min)
+		}
+
+		s += "dimensions " + dimString(dim) + "\n"
+		if t.etype != nil {
+			s += fmt.Sprintf("element size %s\n", sizeString(t.etype.sz))
+		}
+	}
+
+	for _, f := range t.fields {
+		s += fmt.Sprintf("%s: offset %d, size %s", f.name, f.offset, sizeString(f.vt.sz))
+		if f.expr != nil {
+			s += fmt.Sprintf(", computed %v", f.expr)
+		}
+
+		s += "\n"
+	}
+
+	return s
+}
+
+// returns the type as written in the dataset, the name for the named
+// types
+func typeString(t *Type) string {
+	if t != nil && t.name != "" {
+		return t.name
+	}
+
+	return typeLit(t)
+}
+
+// returns the type as written in the dataset, without its name
+func typeLit(t *Type) string {
+	if t == nil {
+		return "?"
+	}
+
+	switch {
+	case t.dimnum > 0:
+		s := make([]string, t.dimnum)
+		for i, e := range t.dimexpr[0:t.dimnum] {
+			if e != nil && e.val != nil {
+				s[i] = fmt.Sprintf("%v", e.val)
+			} else if e != nil {
+				s[i] = "?"
+			}
+		}
+
+		return "[" + strings.Join(s, ", ") + "]" + typeString(t.etype)
+
+	case t.etype != nil:
+		return typeString(t.etype)
+
+	case t.fields != nil:
+		return "struct"
+	}
+
+	return "?"
+}
+
+func dimString(dim []int) string {
+	s := make([]string, len(dim))
+	for i, n := range dim {
+		if n == 0 {
+			s[i] = "unlimited"
+		} else {
+			s[i] = fmt.Sprintf("%d", n)
+		}
+	}
+
+	return strings.Join(s, " x ")
+}
+
+func sizeString(sz int64) string {
+	if sz < 0 {
+		return "variable"
+	}
+
+	return fmt.Sprintf("%d", sz)
+}
+
+func flagsString(flags int) string {
+	var s []string
+
+	switch flags & 0x3F {
+	case Vrowmajor:
+		s = append(s, "rowmajor")
+	case Vrowminor:
+		s = append(s, "columnmajor")
+	case Vzorder:
+		s = append(s, "zorder")
+	case Vhilbert:
+		s = append(s, "hilbert")
+	case Vtiled:
+		s = append(s, "tiled")
+	case Vpermuted:
+		s = append(s, "order")
+	}
+
+	for _, f := range []struct{flag int; name string} {
+		{Vdefault, "default"}, {Vreadonly, "readonly"}, {Vbigendian, "bigendian"},
+		{Vlittleendian, "littleendian"}, {Vpacked, "packed"}, {Vwrap, "convert(wrap)"},
+		{Vexact, "convert(exact)"},
+	} {
+		if flags & f.flag != 0 {
+			s = append(s, f.name)
+		}
+	}
+
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const layoutDataset = `
+dataset {
+	type pad struct { a int8; b int32; c int16 }
+	type nested struct { x int8; p pad; y int8 }
+	type packed struct packed { a int8; b int32; c int16 }
+	type fpacked struct { a int8; b int32 packed; c int16 }
+	type npacked struct packed { a int8; p pad }
+	type aligned struct align(16) { a int8; b int64 }
+	type faligned struct { a int8; b int16 align(8) }
+	type arr struct { a int8; v [3]int16; d float64 }
+	var s [2]pad
+}
+
+view dv default {
+	var s [i] = s[i]
+}
+
+view pv packed {
+	var s [i] = s[i]
+}
+
+view fv {
+	var s [i] { c; a } = s[i]
+}
+
+replica r1 "r1" {
+	view dv
+}
+
+// the unmaterialized arrays of structs can't be read yet, pv and fv are
+// materialized
+replica r2 "r2" {
+	view pv
+	view fv
+}
+`
+
+// checks the sizes and the offsets of the fields of the structs with
+// padding, nested and packed
+func TestStructLayout(t *testing.T) {
+	tests := []struct {
+		name	string
+		size	int64
+		align	int64
+		offsets	[]int64
+	}{
+		{"pad", 12, 4, []int64{0, 4, 8}},
+		{"nested", 20, 4, []int64{0, 4, 16}},
+		{"packed", 7, 1, []int64{0, 1, 5}},
+		{"fpacked", 8, 2, []int64{0, 1, 6}},
+		{"npacked", 13, 1, []int64{0, 1}},
+		{"aligned", 16, 16, []int64{0, 8}},
+		{"faligned", 16, 8, []int64{0, 8}},
+		{"arr", 16, 8, []int64{0, 2, 8}},
+	}
+
+	dr, errs := ParseReader("test.drepl", strings.NewReader(layoutDataset), nil)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	for _, test := range tests {
+		typ := dr.Dataset.types[test.name]
+		if typ == nil {
+			t.Errorf("type %s not found", test.name)
+			continue
+		}
+
+		if typ.size != test.size || typ.align != test.align {
+			t.Errorf("%s: got size %d align %d, expecting %d and %d", test.name, typ.size, typ.align, test.size, test.align)
+		}
+
+		var offsets []int64
+		for _, f := range typ.fields {
+			offsets = append(offsets, f.offset)
+		}
+
+		if !reflect.DeepEqual(offsets, test.offsets) {
+			t.Errorf("%s: got offsets %v, expecting %v", test.name, offsets, test.offsets)
+		}
+	}
+
+	// the views keep the padding of the dataset unless packed
+	vs := viewMap(t, layoutDataset)
+	for name, size := range map[string] int64{"dv": 24, "pv": 14, "fv": 8} {
+		if vs[name].Size() != size {
+			t.Errorf("view %s: got size %d, expecting %d", name, vs[name].Size(), size)
+		}
+	}
+
+	data := make([]byte, 24)
+	for i := 0; i < 2; i++ {
+		data[12*i] = byte(1 + i)
+		binary.LittleEndian.PutUint32(data[12*i + 4:], uint32(100 + i))
+		binary.LittleEndian.PutUint16(data[12*i + 8:], uint16(200 + i))
+	}
+
+	if err := writeData(vs["dv"], data); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readData(vs["pv"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{1, 100, 0, 0, 0, 200, 0, 2, 101, 0, 0, 0, 201, 0}
+	if !bytes.Equal(got, want) {
+		t.Errorf("view pv: got %v, expecting %v", got, want)
+	}
+
+	got, err = readData(vs["fv"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []byte{200, 0, 1, 0, 201, 0, 2, 0}
+	if !bytes.Equal(got, want) {
+		t.Errorf("view fv: got %v, expecting %v", got, want)
+	}
+
+	// back to the padded view
+	if err := writeData(vs["pv"], []byte{3, 102, 0, 0, 0, 202, 0, 4, 103, 0, 0, 0, 203, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err = readData(vs["dv"]); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		data[12*i] = byte(3 + i)
+		binary.LittleEndian.PutUint32(data[12*i + 4:], uint32(102 + i))
+		binary.LittleEndian.PutUint16(data[12*i + 8:], uint16(202 + i))
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Errorf("view dv: got %v, expecting %v", got, data)
+	}
+}
+
+func TestStructLayoutErrors(t *testing.T) {
+	for src, msg := range map[string] string{
+		"dataset { type s struct align(3) { a int8 }; var v s }": "alignment must be a power of two: 3",
+		"dataset { type s struct { a int8; b int32 align(0) }; var v s }": "field b: alignment must be a power of two: 0",
+		"dataset { const A = 6; type s struct { a int8 align(A) }; var v s }": "field a: alignment must be a power of two: 6",
+	} {
+		_, errs := ParseReader("test.drepl", strings.NewReader(src), nil)
+		if !strings.Contains(errs, msg) {
+			t.Errorf("%s: got error %q, expecting %q", src, errs, msg)
+		}
+	}
+}
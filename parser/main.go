@@ -1,9 +1,9 @@
 package parser
 
 import (
-	"flag"
 	"fmt"
-	"os"
+	"io"
+	"drepl/ast"
 	"drepl/drepl"
 )
 
@@ -11,77 +11,142 @@ type DRepl struct {
 	Dataset		*Dataset
 	Views		map[string] *View
 	Replicas	map[string] *Repl
+	opts		*Options	// where to find the included files
+	parts		map[string] []*View	// views of each partitioned view, by the declared name
+
+	// views and replicas in the order of declaration
+	vlist		[]*View
+	rlist		[]*Repl
 }
 
+// collects the errors reported by the scanner and the parser
 type ErrPrinter struct {
-	errs		string
+	errs		ErrorList
 }
 
+// Parses the description in file, reading it and the included files
+// from the OS file system
 func Parse(file string) (dr *DRepl, errs string) {
-	var f *os.File
+	return ParseFile(file, nil)
+}
 
-	fi, err := os.Stat(flag.Arg(0))
+// Parses the description in file. The file and the files it includes are
+// found using opts, which can be nil.
+func ParseFile(file string, opts *Options) (dr *DRepl, errs string) {
+	fname, descr, err := opts.resolve("", file)
 	if err!=nil {
 		errs = fmt.Sprintf("Error: %v\n", err)
 		return
 	}
 
-	buf := make([]byte, fi.Size())
-	f, err = os.Open(flag.Arg(0))
+	return newDRepl(fname, descr, opts)
+}
+
+// Parses the description read from r. The name is used in the error
+// messages, and the included files are found relative to it.
+func ParseReader(name string, r io.Reader, opts *Options) (dr *DRepl, errs string) {
+	descr, err := io.ReadAll(r)
 	if err!=nil {
 		errs = fmt.Sprintf("Error: %v\n", err)
 		return
 	}
 
+	return newDRepl(name, descr, opts)
+}
+
+func NewDRepl(descr []byte) (dr *DRepl, errs string) {
+	return newDRepl("", descr, nil)
+}
 
-	for b:=buf; len(b)>0; {
-		var n int
+// ParseAST parses the description in src, or in the file fname if src is
+// nil, and returns its syntax tree without checking or processing it.
+// The included files are found using opts, which can be nil, and their
+// declarations are added to the tree. The syntax errors are returned as
+// an ErrorList.
+func ParseAST(fname string, src []byte, opts *Options) (*ast.File, error) {
+	if src == nil {
+		var err error
 
-		n, err = f.Read(b)
+		fname, src, err = opts.resolve("", fname)
 		if err!=nil {
-			errs = fmt.Sprintf("Error: %v\n", err)
-			return
+			return nil, err
 		}
+	}
+
+	f, _, el := parse(fname, src, opts, ScanComments)
+	el.RemoveMultiples()
+	return f, el.Err()
+}
+
+// parses the description, returns the syntax tree, the content of the
+// parsed files, and the syntax errors
+func parse(fname string, src []byte, opts *Options, mode uint) (*ast.File, map[string] []byte, ErrorList) {
+	ep := new(ErrPrinter)
+	sc := NewScanner(fname, src, ep, mode | InsertSemis)
+	ps := NewParser(sc, ep, opts)
+	f := ps.Parse()
+	return f, ps.files, ep.errs
+}
+
+// Check parses and processes the description in src like ParseFile, and
+// also returns its syntax tree. The errors are returned as a list, so
+// the tools can show each of them at its position.
+func Check(fname string, src []byte, opts *Options) (dr *DRepl, f *ast.File, errs ErrorList) {
+	return load(fname, src, opts, ScanComments)
+}
 
-		b = b[n:]
+func newDRepl(fname string, descr []byte, opts *Options) (dr *DRepl, errs string) {
+	dr, _, el := load(fname, descr, opts, 0)
+	if len(el) != 0 {
+		errs = el.Error()
 	}
-	f.Close()
 
-	return NewDRepl(buf)
+	return dr, errs
 }
 
-func NewDRepl(descr []byte) (dr *DRepl, errs string) {
+func load(fname string, descr []byte, opts *Options, mode uint) (dr *DRepl, f *ast.File, el ErrorList) {
+	var files map[string] []byte
+
 	dr = new(DRepl)
 	dr.Dataset = NewDataset()
 	dr.Views = make(map[string] *View)
 	dr.Replicas = make(map[string] *Repl)
+	dr.opts = opts
 
-	ep := new(ErrPrinter)
-	sc := NewScanner(flag.Arg(0), descr, ep, InsertSemis)
-	ps := NewParser(dr, sc, ep)
-	ps.Parse()
-	if ep.errs != "" {
-		errs = ep.errs
-		return
+	f, files, el = parse(fname, descr, opts, mode)
+	if len(el) == 0 {
+		_, el = dr.check(f, files)
 	}
 
-	errs = dr.Dataset.EvalConsts()
-	if errs!="" {
-		return
+	if len(el) == 0 {
+		el = dr.process()
 	}
 
-	errs = dr.Dataset.EvalDims()
-	if errs!="" {
-		return
+	el.RemoveMultiples()
+	return
+}
+
+// Evaluates the dataset and processes the views. Each phase reports the
+// errors of all declarations, the phases that depend on it are skipped
+// if it fails.
+func (dr *DRepl) process() (errs ErrorList) {
+	ds := dr.Dataset
+	errs = ds.override(dr.opts.overrides())
+	if len(errs) == 0 {
+		errs = ds.EvalConsts()
 	}
 
-	errs = dr.Dataset.calcTypeSizes()
-	if errs!="" {
-		return
+	if len(errs) == 0 {
+		errs = ds.EvalDims()
 	}
 
-	errs = dr.Dataset.calcVarOffsets()
-	if errs!="" {
+	if len(errs) == 0 {
+		errs = ds.calcTypeSizes()
+		errs = append(errs, ds.calcVarOffsets()...)
+		ds.sized = len(errs) == 0
+	}
+
+	if len(errs) != 0 {
 		return
 	}
 
@@ -93,14 +158,21 @@ func NewDRepl(descr []byte) (dr *DRepl, errs string) {
 //		fmt.Printf("var %s sz %d '%v'\n", v.name, v.t.size, v.t)
 //	}
 
-	for _, v := range dr.Views {
-		if err:=v.process(); err!="" {
-			errs = err
-			return
-		}
+	var views []*View
+	for _, v := range dr.vlist {
+		views = append(views, v)
 	}
 
-	return dr, errs
+	return dr.processViews(views)
+}
+
+// processes the views, reporting the errors of all of them
+func (dr *DRepl) processViews(views []*View) (errs ErrorList) {
+	for _, v := range views {
+		errs = append(errs, v.process(dr.Dataset)...)
+	}
+
+	return
 }
 
 func (dr *DRepl) CreateTransformationRules() (repls []*drepl.Replica, views []*drepl.View, errs string) {
@@ -112,19 +184,13 @@ func (dr *DRepl) CreateTransformationRules() (repls []*drepl.Replica, views []*d
 
 	var defaultView *drepl.View
 	vmap := make(map[*View] *drepl.View);
-	for _, v := range dr.Views {
-		var elo drepl.ElementOrder 
-
-		switch (v.flags & 0x3F) {
-		case Vrowmajor:
-			elo = drepl.RowMajorOrder
-		case Vrowminor:
-			elo = drepl.RowMinorOrder
-		default:
+	for _, v := range dr.vlist {
+		elo := elementOrder(v.flags & 0x3F, v.elopv)
+		if elo == nil {
 			return nil, nil, fmt.Sprintf("invalid order: %d", v.flags & 0x7F)
 		}
 
-		vv := drepl.NewView(v.Name, elo, v.flags & Vreadonly != 0)
+		vv := drepl.NewView(v.Name, elo, v.flags & Vreadonly != 0 || v.filtered() || v.gathered() || v.broadcast() || v.reduced())
 		
 		if v.flags & Vdefault != 0 {
 			defaultView = vv
@@ -134,7 +200,7 @@ func (dr *DRepl) CreateTransformationRules() (repls []*drepl.Replica, views []*d
 		vmap[v] = vv;
 	}
 
-	for _, r := range dr.Replicas {
+	for _, r := range dr.rlist {
 		rr := drepl.NewReplica(r.Name, r.filename)
 		
 		for _, v := range r.views {
@@ -144,11 +210,13 @@ func (dr *DRepl) CreateTransformationRules() (repls []*drepl.Replica, views []*d
 		repls = append(repls, rr)
 	}
 
-	for _, v := range dr.Views {
+	for _, v := range dr.vlist {
 		vv := vmap[v]
 
-		// make sure that the unmaterialized views have default view to read from
-		if !vv.Materialized() {
+		// make sure that the unmaterialized views have default view to
+		// read from, the views with index arrays and the reductions
+		// read from it even if materialized
+		if !vv.Materialized() || v.gathered() || v.reduced() {
 			vv.SetDefaultView(defaultView)
 		}
 
@@ -163,11 +231,15 @@ func (dr *DRepl) CreateTransformationRules() (repls []*drepl.Replica, views []*d
 		return
 	}
 
+	for _, r := range repls {
+		r.Layout()
+	}
+
 	dr.Dataset.reset()
-	for _, v := range dr.Views {
+	for _, v := range dr.vlist {
 		v.reset()
 	}
-	for _, r := range dr.Replicas {
+	for _, r := range dr.rlist {
 		r.reset()
 	}
 
@@ -178,7 +250,7 @@ func (dr *DRepl) CreateTransformationRules() (repls []*drepl.Replica, views []*d
 		fmt.Printf("*** %s %v\n", v.name, v.blk)
 	}
 
-	for _, v := range dr.Views {
+	for _, v := range dr.vlist {
 		for _, vv := range v.vars {
 			fmt.Printf("=== %s %v\n", vv.name, vv.blk)
 		}
@@ -189,23 +261,20 @@ func (dr *DRepl) CreateTransformationRules() (repls []*drepl.Replica, views []*d
 }
 
 func (dr *DRepl) AddView(descr []byte) (errs string) {
-	oldviews := make(map[*View] bool)
-	for _, v := range dr.Views {
-		oldviews[v] = true
+	var views []*View
+
+	f, files, el := parse("", descr, dr.opts, 0)
+	if len(el) == 0 {
+		views, el = dr.check(f, files)
 	}
 
-	ep := new(ErrPrinter)
-	sc := NewScanner(flag.Arg(0), descr, ep, InsertSemis)
-	ps := NewParser(dr, sc, ep)
-	ps.Parse()
-	if ep.errs != "" {
-		errs = ep.errs
+	if len(el) == 0 {
+		el = dr.processViews(views)
 	}
 
-	for _, v := range dr.Views {
-		if !oldviews[v] {
-			v.process()
-		}
+	el.RemoveMultiples()
+	if len(el) != 0 {
+		errs = el.Error()
 	}
 
 	return
@@ -217,16 +286,25 @@ func (dr *DRepl) RemoveView(name string) (errs string) {
 	}
 
 	delete(dr.Views, name)
+	for i, v := range dr.vlist {
+		if v.Name == name {
+			dr.vlist = append(dr.vlist[0:i], dr.vlist[i+1:]...)
+			break
+		}
+	}
+
 	return
 }
 
 func (dr *DRepl) AddReplica(descr []byte) (errs string) {
-	ep := new(ErrPrinter)
-	sc := NewScanner(flag.Arg(0), descr, ep, InsertSemis)
-	ps := NewParser(dr, sc, ep)
-	ps.Parse()
-	if ep.errs != "" {
-		errs = ep.errs
+	f, files, el := parse("", descr, dr.opts, 0)
+	if len(el) == 0 {
+		_, el = dr.check(f, files)
+	}
+
+	el.RemoveMultiples()
+	if len(el) != 0 {
+		errs = el.Error()
 	}
 
 	// TODO: process the replica ???
@@ -240,22 +318,30 @@ func (dr *DRepl) RemoveReplica(name string) (errs string) {
 	}
 
 	delete(dr.Replicas, name)
+	for i, r := range dr.rlist {
+		if r.Name == name {
+			dr.rlist = append(dr.rlist[0:i], dr.rlist[i+1:]...)
+			break
+		}
+	}
+
 	return
 }
 
 func (e *ErrPrinter) Error(pos *Pos, msg string) {
-	e.errs = fmt.Sprintf("%sError: %s:%d: %s\n", e.errs, pos.fname, pos.line, msg)
+	e.errs.Add(pos, msg)
 //	panic("boo")
 }
 
 func (dr *DRepl) createView(name string, flags int) *View {
 	v := dr.Views[name]
-	if v!=nil {
+	if v!=nil || dr.parts[name] != nil {
 		return nil
 	}
 
 	v = NewView(name, flags)
 	dr.Views[name] = v
+	dr.vlist = append(dr.vlist, v)
 	return v
 }
 
@@ -276,6 +362,7 @@ func (dr *DRepl) createReplica(name string, fname string, flags int) *Repl {
 
 	r = NewReplica(name, fname, flags)
 	dr.Replicas[name] = r
+	dr.rlist = append(dr.rlist, r)
 	return r
 }
 
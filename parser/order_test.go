@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"drepl/drepl"
+)
+
+// values of m, N to N+M*M-1, in the element order o
+func orderValues(o drepl.ElementOrder) []int32 {
+	dim := []int64{4, 4}
+	idx := make([]int64, 2)
+	vals := make([]int32, 16)
+	for p := range vals {
+		o.ToIdx(int64(p), idx, dim)
+		vals[p] = int32(10 + drepl.RowMajorOrder.FromIdx(idx, dim))
+	}
+
+	return vals
+}
+
+func TestOrderViews(t *testing.T) {
+	runViewTests(t, []viewTest{
+		{"view v { var x [i, j] = m[i, j] }", map[string] []int32{"v": orderValues(drepl.RowMajorOrder)}},
+		{"view v columnmajor { var x [i, j] = m[i, j] }",
+			map[string] []int32{"v": {10, 14, 18, 22, 11, 15, 19, 23, 12, 16, 20, 24, 13, 17, 21, 25}}},
+		{"view v zorder { var x [i, j] = m[i, j] }",
+			map[string] []int32{"v": {10, 11, 14, 15, 12, 13, 16, 17, 18, 19, 22, 23, 20, 21, 24, 25}}},
+		{"view v hilbert { var x [i, j] = m[i, j] }", map[string] []int32{"v": orderValues(drepl.HilbertOrder)}},
+		{"view v tiled(2, 2) { var x [i, j] = m[i, j] }",
+			map[string] []int32{"v": {10, 11, 14, 15, 12, 13, 16, 17, 18, 19, 22, 23, 20, 21, 24, 25}}},
+		{"view v tiled(1, 4) { var x [i, j] = m[i, j] }", map[string] []int32{"v": orderValues(drepl.RowMajorOrder)}},
+		{"view v order(1, 0) { var x [i, j] = m[i, j] }", map[string] []int32{"v": orderValues(drepl.RowMinorOrder)}},
+	})
+}
+
+// writes 0, 1, ... to the view in decl, and checks the values of m read
+// through the default view
+func TestOrderWrite(t *testing.T) {
+	tests := []struct {
+		decl	string
+		o	drepl.ElementOrder
+	}{
+		{"view v rowmajor { var x [i, j] = m[i, j] }", drepl.RowMajorOrder},
+		{"view v columnmajor { var x [i, j] = m[i, j] }", drepl.RowMinorOrder},
+		{"view v zorder { var x [i, j] = m[i, j] }", drepl.ZOrderOrder},
+		{"view v hilbert { var x [i, j] = m[i, j] }", drepl.HilbertOrder},
+		{"view v tiled(2, 3) { var x [i, j] = m[i, j] }", drepl.NewTiledOrder([]int64{2, 3})},
+		{"view v order(1, 0) { var x [i, j] = m[i, j] }", drepl.NewPermutedOrder([]int64{1, 0})},
+	}
+
+	for _, test := range tests {
+		views, errs := createViews(t, test.decl)
+		if errs != "" {
+			t.Errorf("%s: %s", test.decl, errs)
+			continue
+		}
+
+		var v, dv *drepl.View
+		for _, vw := range views {
+			switch vw.Name {
+			case "v":
+				v = vw
+			case "dv":
+				dv = vw
+			}
+		}
+
+		if err := writeValues(v); err != nil {
+			t.Fatalf("%s: %v", test.decl, err)
+		}
+
+		got, err := readValues(dv)
+		if err != nil {
+			t.Fatalf("%s: %v", test.decl, err)
+		}
+
+		// the position of each element of m in the view
+		dim := []int64{4, 4}
+		idx := make([]int64, 2)
+		want := make([]int32, 16)
+		for i := range want {
+			drepl.RowMajorOrder.ToIdx(int64(i), idx, dim)
+			want[i] = int32(test.o.FromIdx(idx, dim))
+		}
+
+		if !reflect.DeepEqual(got[10:], want) {
+			t.Errorf("%s: got %v, expecting %v", test.decl, got[10:], want)
+		}
+	}
+}
+
+func TestOrderConflicts(t *testing.T) {
+	runErrorTests(t, map[string] string{
+		"view v columnmajor zorder { var x [i, j] = m[i, j] }": "element order zorder conflicts with columnmajor",
+		"view v hilbert rowmajor { var x [i, j] = m[i, j] }": "element order rowmajor conflicts with hilbert",
+		"view v zorder zorder { var x [i, j] = m[i, j] }": "element order zorder conflicts with zorder",
+		"view v tiled(2, 2) zorder { var x [i, j] = m[i, j] }": "element order zorder conflicts with tiled",
+		"view v order(1, 0) rowminor { var x [i, j] = m[i, j] }": "element order rowminor conflicts with order",
+	})
+}
+
+func TestTileShapeErrors(t *testing.T) {
+	runErrorTests(t, map[string] string{
+		"view v tiled(2) { var x [i, j] = m[i, j] }": "tile shape has 1 dimensions, the array has 2",
+		"view v tiled(2, 2, 2) { var x [i, j] = m[i, j] }": "tile shape has 3 dimensions, the array has 2",
+		"view v tiled(2, 2) { var x [i, j] = m[i, j]; var y [i] = a[i] }": "tile shape has 2 dimensions, the array has 1",
+		"view v { var x tiled(4) [i, j] = m[i, j] }": "tile shape has 1 dimensions, the array has 2",
+		"view v tiled(0, 2) { var x [i, j] = m[i, j] }": "tile size must be a positive integer",
+	})
+}
+
+func TestPermutationErrors(t *testing.T) {
+	runErrorTests(t, map[string] string{
+		"view v order(0) { var x [i, j] = m[i, j] }": "permutation has 1 dimensions, the array has 2",
+		"view v order(1, 0) { var y [i] = a[i] }": "permutation has 2 dimensions, the array has 1",
+		"view v { var x order(2, 0, 1) [i, j] = m[i, j] }": "permutation has 3 dimensions, the array has 2",
+		"view v order(1, 1) { var x [i, j] = m[i, j] }": "dimension 1 repeated in order",
+		"view v order(0, 2) { var x [i, j] = m[i, j] }": "invalid dimension in order",
+	})
+}
+
+func TestVariableOrders(t *testing.T) {
+	// the variable's order replaces the view's one
+	tests := []viewTest{
+		{"view v zorder { var x columnmajor [i, j] = m[i, j]; var y [i, j] = m[i, j] }",
+			map[string] []int32{"v": append(orderValues(drepl.RowMinorOrder), orderValues(drepl.ZOrderOrder)...)}},
+		{"view v { var x [i, j] = m[i, j]; var y hilbert [i, j] = m[i, j]; var z tiled(2, 2) [i, j] = m[i, j] }",
+			map[string] []int32{"v": append(append(orderValues(drepl.RowMajorOrder), orderValues(drepl.HilbertOrder)...),
+				orderValues(drepl.NewTiledOrder([]int64{2, 2}))...)}},
+		{"view v order(1, 0) { var x [i, j] = m[i, j]; var y rowmajor [i] = a[i] }",
+			map[string] []int32{"v": append(orderValues(drepl.RowMinorOrder), 0, 1, 2, 3, 4, 5, 6, 7, 8, 9)}},
+	}
+
+	runViewTests(t, tests)
+
+	// in a replica
+	for i := range tests {
+		tests[i].decl += "\n" + `replica r2 "r2" { view v }`
+	}
+
+	runViewTests(t, tests)
+}
@@ -0,0 +1,215 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Defines collects the constant overrides given on the command line as
+// -D NAME=value, for use as Options.Overrides. The values are converted to the type of the
+// constants when the description is processed.
+type Defines map[string] interface{}
+
+func (d Defines) String() string {
+	var s []string
+
+	for name, val := range d {
+		s = append(s, fmt.Sprintf("%s=%v", name, val))
+	}
+
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (d Defines) Set(s string) error {
+	n := strings.Index(s, "=")
+	if n <= 0 {
+		return fmt.Errorf("expected NAME=value: %q", s)
+	}
+
+	d[strings.TrimSpace(s[0:n])] = s[n+1:]
+	return nil
+}
+
+// replaces the expressions of the overridden constants with their
+// values, has to be called before EvalConsts
+func (ds *Dataset) override(overrides map[string] interface{}) (errs ErrorList) {
+	var names []string
+
+	for name := range overrides {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		c := ds.consts[name]
+		if c == nil || c.expr == nil {
+			errs.Add(nil, fmt.Sprintf("can't override constant '%s': not defined", name))
+			continue
+		}
+
+		if err := ds.overrideConst(c, overrides[name]); err != "" {
+			errs.Add(&c.pos, fmt.Sprintf("can't override constant '%s': %s", name, err))
+		}
+	}
+
+	return
+}
+
+// Applies the overrides of the constants already defined, for the values
+// needed while the description is checked. The errors are reported by
+// override, when all the constants are defined.
+func (ds *Dataset) overrideDefined(overrides map[string] interface{}) {
+	for name, val := range overrides {
+		if c := ds.consts[name]; c != nil && c.expr != nil {
+			ds.overrideConst(c, val)
+		}
+	}
+}
+
+// replaces the expression of the constant c with the value val, converted
+// to the constant's type
+func (ds *Dataset) overrideConst(c *ConstDecl, val interface{}) string {
+	kind := ds.exprKind(c.expr)
+	v, err := overrideValue(val, kind)
+	if err != "" {
+		return err
+	}
+
+	c.expr = &Expr{op: kind, val: v}
+	return ""
+}
+
+// returns the type of the expression's value (INT, FLOAT or STRING)
+// without evaluating it, or ILLEGAL if it can't be determined
+func (ds *Dataset) exprKind(e *Expr) Token {
+	if e == nil {
+		return ILLEGAL
+	}
+
+	switch v := e.val.(type) {
+	case *ConstDecl:
+		if v.eval || v.expr == nil {
+			return ILLEGAL
+		}
+
+		v.eval = true
+		k := ds.exprKind(v.expr)
+		v.eval = false
+		return k
+
+	case []byte:
+		return e.op
+
+	case int64, uint64:
+		return INT
+
+	case float64:
+		return FLOAT
+
+	case string:
+		return STRING
+	}
+
+	if e.op == NOT || e.op.Precedence() <= EQL.Precedence() {
+		// logical operators and comparisons
+		return INT
+	}
+
+	l, r := ds.exprKind(e.left), ds.exprKind(e.right)
+	switch {
+	case l == ILLEGAL || r == ILLEGAL || l == STRING || r == STRING:
+		return ILLEGAL
+	case l == FLOAT || r == FLOAT:
+		return FLOAT
+	}
+
+	return INT
+}
+
+// converts the value of an override to the type of the constant, the
+// strings are parsed as literals of that type
+func overrideValue(v interface{}, kind Token) (val interface{}, err string) {
+	if s, ok := v.(string); ok {
+		return parseOverride(s, kind)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val = rv.Int()
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		// as for the literals, int64 unless it doesn't fit
+		if u := rv.Uint(); u > math.MaxInt64 {
+			val = u
+		} else {
+			val = int64(u)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		if kind == INT {
+			return nil, fmt.Sprintf("cannot use %v (%T) as an integer", v, v)
+		}
+
+		return rv.Float(), ""
+
+	default:
+		return nil, fmt.Sprintf("invalid value type %T", v)
+	}
+
+	switch kind {
+	case FLOAT:
+		if u, ok := val.(uint64); ok {
+			return float64(u), ""
+		}
+
+		return float64(val.(int64)), ""
+
+	case STRING:
+		return nil, fmt.Sprintf("cannot use %v (%T) as a string", v, v)
+	}
+
+	return val, ""
+}
+
+func parseOverride(s string, kind Token) (val interface{}, err string) {
+	var oe error
+
+	switch kind {
+	case INT:
+		val, oe = strconv.ParseInt(s, 0, 64)
+		if ne, ok := oe.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+			val, oe = strconv.ParseUint(s, 0, 64)
+		}
+
+		if oe != nil {
+			return nil, fmt.Sprintf("invalid integer value %q", s)
+		}
+
+	case FLOAT:
+		val, oe = strconv.ParseFloat(s, 64)
+		if oe != nil {
+			return nil, fmt.Sprintf("invalid float value %q", s)
+		}
+
+	case STRING:
+		val = s
+
+	default:
+		// the type of the constant isn't known, use the first that fits
+		for _, k := range []Token{INT, FLOAT} {
+			if val, err = parseOverride(s, k); err == "" {
+				return
+			}
+		}
+
+		val, err = s, ""
+	}
+
+	return
+}
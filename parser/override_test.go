@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// the overrides are converted to the type of the constant they replace
+func TestOverride(t *testing.T) {
+	tests := []struct {
+		expr	string
+		val	interface{}
+		want	interface{}
+		msg	string
+	}{
+		{"10", "20", int64(20), ""},
+		{"10", "0x10", int64(16), ""},
+		{"10", int32(7), int64(7), ""},
+		{"10", uint64(1 << 63), uint64(1 << 63), ""},
+		{"10", "18446744073709551615", uint64(1 << 64 - 1), ""},
+		{"1.5", "2", float64(2), ""},
+		{"1.5", 3, float64(3), ""},
+		{"1.5", float32(0.25), float64(0.25), ""},
+		{"2 * 1.5", "1e3", float64(1000), ""},
+		{"3 < 4.5", "0", int64(0), ""},
+		{`"abc"`, "def", "def", ""},
+
+		{"10", 2.5, nil, "can't override constant 'N': cannot use 2.5 (float64) as an integer"},
+		{"10", "x", nil, `can't override constant 'N': invalid integer value "x"`},
+		{"10", "1.5", nil, `can't override constant 'N': invalid integer value "1.5"`},
+		{"1.5", "y", nil, `can't override constant 'N': invalid float value "y"`},
+		{`"abc"`, 3, nil, "can't override constant 'N': cannot use 3 (int) as a string"},
+		{"10", []int{1}, nil, "can't override constant 'N': invalid value type []int"},
+	}
+
+	for _, test := range tests {
+		src := "dataset {\n\tconst N = " + test.expr + "\n\tvar a [4]int32\n}\n"
+		opts := &Options{Overrides: map[string] interface{}{"N": test.val}}
+		dr, errs := ParseReader("test.drepl", strings.NewReader(src), opts)
+		if test.msg != "" {
+			if !strings.Contains(errs, "test.drepl:2:") || !strings.Contains(errs, test.msg) {
+				t.Errorf("%s = %v: got error %q, expecting %q", test.expr, test.val, errs, test.msg)
+			}
+
+			continue
+		}
+
+		if errs != "" {
+			t.Errorf("%s = %v: %s", test.expr, test.val, errs)
+			continue
+		}
+
+		if got := dr.Dataset.consts["N"].val; got != test.want {
+			t.Errorf("%s = %v: got %v (%T), expecting %v (%T)", test.expr, test.val, got, got, test.want, test.want)
+		}
+	}
+
+	// the constants that use the overridden one are evaluated with its
+	// value
+	src := "dataset {\n\tconst N = 4\n\tconst M = N * 2\n\tvar a [M]int32\n}\n"
+	opts := &Options{Overrides: map[string] interface{}{"N": "8"}}
+	dr, errs := ParseReader("test.drepl", strings.NewReader(src), opts)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	if got := dr.Dataset.vars["a"].t.dim[0]; got != 16 {
+		t.Errorf("got dimension %d, expecting 16", got)
+	}
+}
+
+func TestOverrideUnknown(t *testing.T) {
+	src := "dataset {\n\tconst N = 4\n\tvar a [N]int32\n}\n"
+	opts := &Options{Overrides: map[string] interface{}{"M": 1, "N": 2, "K": "x"}}
+	_, errs := ParseReader("test.drepl", strings.NewReader(src), opts)
+
+	// sorted by name, without a position
+	want := "Error: can't override constant 'K': not defined\nError: can't override constant 'M': not defined\n"
+	if errs != want {
+		t.Errorf("got %q, expecting %q", errs, want)
+	}
+}
+
+func TestDefines(t *testing.T) {
+	d := make(Defines)
+	for _, s := range []string{"N=4", " M =x=y", "S="} {
+		if err := d.Set(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+
+	if got, want := d.String(), "M=x=y,N=4,S="; got != want {
+		t.Errorf("got %q, expecting %q", got, want)
+	}
+
+	for _, s := range []string{"N", "=4", ""} {
+		if err := d.Set(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
@@ -1,18 +1,29 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
-	"os"
-	"strconv"
+	"drepl/ast"
 //	"unicode"
 //	"utf8"
 )
 
+// Parser reads the tokens from the scanner and builds the syntax tree of
+// the description. The names are resolved and the declarations checked
+// later, when the tree is added to a DRepl.
 type Parser struct {
 	scanner *Scanner
 	err	ErrorHandler
-	dr	*DRepl
-	cview	*View		// the view currently being parsed (nil if not)
+	opts	*Options	// where to find the included files
+	nerr	int		// number of errors reported
+	depth	int		// nesting level of braces
+	part	bool		// in a partitioned view, the dimensions can be distributions
+
+	files	map[string] []byte	// content of the parsed files
+	comments []*ast.CommentGroup
+	cgroup	*ast.CommentGroup	// group the next comment is added to, nil if none
+	cline	int		// line where the last comment ends
+	tline	int		// line of the last token that is not a comment
 
 	// next token
 	pos	Pos
@@ -20,94 +31,180 @@ type Parser struct {
 	lit	[]byte
 }
 
-func NewParser(dr *DRepl, sc *Scanner, err ErrorHandler) *Parser {
+func NewParser(sc *Scanner, err ErrorHandler, opts *Options) *Parser {
 	ps := new(Parser)
-	ps.dr = dr
 	ps.scanner = sc
 	ps.err = err
+	ps.opts = opts
+	ps.files = make(map[string] []byte)
 	ps.next()
+	ps.files[ps.pos.fname] = ps.pos.data
 
 	return ps
 }
 
-func (p *Parser) Parse() {
+func (p *Parser) Parse() *ast.File {
+	f := &ast.File{Name: p.pos.fname}
 	for p.tok != EOF {
 		tok := p.tok
 		pos := p.pos
+		nerr := p.nerr
 
 		switch tok {
 		case DATASET:
 			p.next()
-			p.parseDataset()
+			if d := p.parseDataset(astPos(&pos)); d != nil {
+				f.Decls = append(f.Decls, d)
+			}
 		case VIEW:
 			p.next()
-			p.parseView()
+			if d := p.parseView(astPos(&pos)); d != nil {
+				f.Decls = append(f.Decls, d)
+			}
 		case COMPLETE:
 		case REPLICA:
-			p.parseReplica()
+			if d := p.parseReplica(); d != nil {
+				f.Decls = append(f.Decls, d)
+			}
 		case SEMICOLON:
-			p.next()
 		default:
 			p.error(&pos, fmt.Sprintf("invalid token: %d: %v", tok, string(p.lit)))
-			return
 		}
 
 		p.next()
+		if p.nerr != nerr {
+			p.sync(0)
+		}
 	}
+
+	f.Comments = p.comments
+	return f
 }
 
 func (p *Parser) next() {
 	var pos *Pos
 
-	pos, p.tok, p.lit = p.scanner.Scan()
-	p.pos = *pos
-}
+	switch p.tok {
+	case LBRACE:
+		p.depth++
+	case RBRACE:
+		if p.depth > 0 {
+			p.depth--
+		}
+	}
 
-func (p *Parser) includeFile(fname string) bool {
-	var f *os.File
+	for {
+		pos, p.tok, p.lit = p.scanner.Scan()
+		p.pos = *pos
+		if p.tok != COMMENT {
+			break
+		}
 
-	fi, err := os.Stat(fname)
-	if err!=nil {
-		p.error(&p.pos, fmt.Sprintf("can't read file '%s': %v", fname, err))
-		return false
+		p.comment()
 	}
 
-	buf := make([]byte, fi.Size())
-	f, err = os.Open(fname)
-	if err!=nil {
-		p.error(&p.pos, fmt.Sprintf("can't read file '%s': %v", fname, err))
-		return false
+	// the comments on the following lines are in the same group
+	if p.tok != SEMICOLON || string(p.lit) != "\n" {
+		p.cgroup = nil
 	}
 
-	for b:=buf; len(b)>0; {
-		var n int
+	p.tline = p.pos.line
+}
 
-		n, err = f.Read(b)
-		if err!=nil {
-			p.error(&p.pos, fmt.Sprintf("can't read file '%s': %v", fname, err))
-			return false
+// adds the comment in the current token to the comment groups. The
+// comments on the line of a token are not grouped with the following ones.
+func (p *Parser) comment() {
+	c := &ast.Comment{Slash: p.apos(), Text: string(p.lit)}
+	first := p.cgroup == nil || c.Slash.Filename != p.cgroup.List[0].Slash.Filename
+	if first || c.Slash.Line > p.cline + 1 || (c.Slash.Line == p.tline) != (p.cgroup.List[0].Slash.Line == p.tline) {
+		p.cgroup = new(ast.CommentGroup)
+		p.comments = append(p.comments, p.cgroup)
+	}
+
+	p.cgroup.List = append(p.cgroup.List, c)
+	p.cline = c.Slash.Line + bytes.Count(p.lit, newline)
+}
+
+// Skips the rest of a declaration after an error, so the parser can
+// continue and report the errors in the following declarations. Stops
+// after a ; or before a } at the nesting level lev, or before a keyword
+// starting a new declaration.
+func (p *Parser) sync(lev int) {
+	for p.tok != EOF && p.depth >= lev {
+		if p.depth == lev {
+			switch p.tok {
+			case SEMICOLON:
+				p.next()
+				return
+
+			case RBRACE, DATASET, VIEW, REPLICA, TYPE, VAR, CONST:
+				return
+			}
 		}
 
-		b = b[n:]
+		p.next()
+	}
+}
+
+func (p *Parser) includeFile(name string) bool {
+	fname, buf, err := p.opts.resolve(p.pos.fname, name)
+	if err!=nil {
+		p.error(&p.pos, fmt.Sprintf("can't read file '%s': %v", name, err))
+		return false
 	}
-	f.Close()
 
+	p.files[fname] = buf
 	p.scanner.PushFile(fname, buf)
 	return true
 }
 
+// the position of the current token
+func (p *Parser) apos() ast.Pos {
+	return astPos(&p.pos)
+}
+
+func astPos(pos *Pos) ast.Pos {
+	return ast.Pos{Filename: pos.fname, Offset: pos.offset, Line: pos.line, Column: pos.col}
+}
+
+// the current token, or the contextual keyword if it is one, used where
+// a flag or an annotation can start
+func (p *Parser) keyword() Token {
+	if p.tok == IDENT {
+		if tok, ok := contextKeywords[string(p.lit)]; ok {
+			return tok
+		}
+	}
+
+	return p.tok
+}
+
+func (p *Parser) parseIdent() *ast.Ident {
+	x := &ast.Ident{NamePos: p.apos(), Name: string(p.lit)}
+	p.next()
+	return x
+}
+
+// returns the string literal in the current token, without moving to
+// the next one
+func (p *Parser) stringLit() *ast.BasicLit {
+	return &ast.BasicLit{ValuePos: p.apos(), Kind: ast.STRING, Value: string(p.lit)}
+}
+
 /* dataset related methods */
-func (p *Parser) parseDataset() {
+func (p *Parser) parseDataset(pos ast.Pos) *ast.DatasetDecl {
 	inline := false
+	d := &ast.DatasetDecl{Dataset: pos}
 
 	switch p.tok {
 	default:
 		p.error(&p.pos, fmt.Sprintf("invalid token: %d: %v", p.tok, string(p.lit)))
-		return
+		return nil
 
 	case STRING:
+		d.File = p.stringLit()
 		if !p.includeFile(string(p.lit[1:len(p.lit)-1])) {
-			return
+			return nil
 		}
 
 	case LBRACE:
@@ -115,132 +212,192 @@ func (p *Parser) parseDataset() {
 	}
 
 	p.next()
+	lev := p.depth
 	for p.tok != EOF && p.tok != RBRACE {
 		tok := p.tok
 		pos := p.pos
+		nerr := p.nerr
 
 		switch tok {
 		case TYPE:
-			p.parseDatasetTypeDecl()
+			if td := p.parseDatasetTypeDecl(); td != nil {
+				d.Decls = append(d.Decls, td)
+			}
 		case VAR:
-			p.parseDatasetVarDecl()
+			if vd := p.parseDatasetVarDecl(); vd != nil {
+				d.Decls = append(d.Decls, vd)
+			}
 		case CONST:
-			p.parseDatasetConstDecl()
+			if cd := p.parseDatasetConstDecl(); cd != nil {
+				d.Decls = append(d.Decls, cd)
+			}
+		case SEMICOLON:
+			p.next()
 		default:
 			p.error(&pos, fmt.Sprintf("invalid token: %d: %v", tok, string(p.lit)))
-			return
+			p.next()
+		}
+
+		if p.nerr != nerr {
+			p.sync(lev)
 		}
 	}
 
 	if inline && p.tok != RBRACE {
 		p.error(&p.pos, "expecting }")
 	}
+
+	return d
 }
 
-func (p *Parser) parseDatasetTypeDecl() {
+func (p *Parser) parseDatasetTypeDecl() *ast.TypeDecl {
+	d := &ast.TypeDecl{TypePos: p.apos()}
 	p.next()
 	if p.tok != IDENT {
 		p.error(&p.pos, "identifier expected")
-		return
+		return nil
 	}
 
-	name := string(p.lit)
-	if td, created := p.dr.Dataset.createType(name, &p.pos); created {
-		p.next()
-		p.parseDatasetType(td)
-	} else {
-		p.error(&p.pos, fmt.Sprintf("type '%s' already defined at %v", name, &td.pos))
+	d.Name = p.parseIdent()
+	d.Type = p.parseDatasetType()
+	if d.Type == nil {
+		return nil
 	}
-}
 
-func (p *Parser) parseDatasetType(t *Type) bool {
-	ds := p.dr.Dataset
+	return d
+}
 
+func (p *Parser) parseDatasetType() ast.Type {
 	switch p.tok {
 	case IDENT:
 		// alias
-		t1 := ds.getType(string(p.lit))
-		if t1 == nil {
-			p.error(&p.pos, fmt.Sprintf("type '%v' not defined", string(p.lit)))
-			return false
-		}
-
-		t.etype = t1
-		t.dimnum = 0
-		p.next()
+		return p.parseIdent()
 
 	case LBRACK:
 		// matrix
-		if !p.parseArrayLengths(t) {
-			return false
+		t := &ast.ArrayType{Lbrack: p.apos()}
+		if !p.parseArrayLengths(&t.Dims) {
+			return nil
 		}
 
 		if p.tok != RBRACK {
 			p.error(&p.pos, "expecting ]")
-			return false
+			return nil
 		}
 
 		p.next()
-		t.etype = new(Type)
-		return p.parseDatasetType(t.etype)
+		t.Elem = p.parseDatasetType()
+		if t.Elem == nil {
+			return nil
+		}
+
+		return t
 
 	case STRUCT:
 		// struct
+		t := &ast.StructType{Struct: p.apos()}
 		p.next()
-		return p.parseStruct(t)
+		if !p.parseLayout(&t.Packed, &t.Align) {
+			return nil
+		}
+
+		if p.tok != LBRACE {
+			p.error(&p.pos, "expecting {")
+			return nil
+		}
+
+		p.next()
+		if !p.parseStruct(t, p.parseStructFieldType, true) {
+			return nil
+		}
+
+		return t
 
 	default:
 		p.error(&p.pos, "expecting type")
-		return false
+		return nil
 	}
-
-	return true
 }
 
-func (p *Parser) parseArrayLengths(t *Type) bool {
-	dimnum := 0
-	dim := make([]*Expr, 8)
+// parses the dimensions of an array, from the [ to the ], the empty
+// dimensions are nil
+func (p *Parser) parseArrayLengths(dims *[]ast.Expr) bool {
 	for p.tok != EOF {
-		if dimnum >= len(dim) {
-			d := make([]*Expr, len(dim) + 8)
-			copy(d, dim)
-			dim = d
-		}
+		var x ast.Expr
 
 		p.next()
-		if p.tok != COMMA && p.tok != RBRACK {
-			dim[dimnum] = p.parseExpr(true)
-			if dim[dimnum]==nil {
+		if p.part && p.tok == IDENT && (string(p.lit) == "block" || string(p.lit) == "cyclic") {
+			if x = p.parseDist(); x == nil {
+				return false
+			}
+		} else if p.tok != COMMA && p.tok != RBRACK && p.tok != COLON {
+			x = p.parseExpr()
+			if x==nil {
 				return false
 			}
 
 		}
 
-		dimnum++
+		if p.tok == COLON {
+			if x = p.parseSlice(x); x == nil {
+				return false
+			}
+		}
+
+		*dims = append(*dims, x)
 		if p.tok == RBRACK {
 			break
 		}
 	}
 
-	t.dimnum = dimnum
-	t.dimexpr = dim
 	return true
 }
 
-func (p *Parser) parseExpr(constexpr bool) *Expr {
-	var err error
+// parses the rest of the slice lo:hi:step, lo is already parsed
+func (p *Parser) parseSlice(lo ast.Expr) ast.Expr {
+	x := &ast.SliceExpr{Lo: lo, Colon: p.apos()}
+	p.next()
+	if p.tok != COLON && p.tok != COMMA && p.tok != RBRACK {
+		if x.Hi = p.parseExpr(); x.Hi == nil {
+			return nil
+		}
+	}
 
-	e := new(Expr)
-	e.op = ILLEGAL
-	ds := p.dr.Dataset
-	vw := p.cview
+	if p.tok == COLON {
+		p.next()
+		if p.tok != COMMA && p.tok != RBRACK {
+			if x.Step = p.parseExpr(); x.Step == nil {
+				return nil
+			}
+		}
+	}
 
-	// left operand
-	switch p.tok {
-	case LPAREN:
+	return x
+}
+
+// parses a distribution of a partitioned view: block, block ghost(G),
+// cyclic or cyclic(B)
+func (p *Parser) parseDist() ast.Expr {
+	x := &ast.DistExpr{NamePos: p.apos(), Name: string(p.lit)}
+	p.next()
+	switch {
+	case x.Name == "block" && p.tok == IDENT && string(p.lit) == "ghost":
+		params := p.parseParamList()
+		if params == nil {
+			return nil
+		}
+
+		if len(params) != 1 {
+			p.error(&p.pos, "ghost expects a single value")
+			return nil
+		}
+
+		x.Arg = params[0]
 		p.next()
-		e = p.parseExpr(constexpr)
-		if e == nil {
+
+	case x.Name == "cyclic" && p.tok == LPAREN:
+		p.next()
+		if x.Arg = p.parseExpr(); x.Arg == nil {
 			return nil
 		}
 
@@ -249,88 +406,219 @@ func (p *Parser) parseExpr(constexpr bool) *Expr {
 			return nil
 		}
 
-	case IDENT:
-		e.op = p.tok
-		name := string(p.lit)
-		if constexpr {
-			c, _ := ds.createConstDecl(name, nil)
-			e.val = c
-		} else {
-			if c := ds.getConstDecl(name); c!=nil {
-				e.val = c
-			} else {
-				e.val, _ = vw.createVarDecl(name, nil)
+		p.next()
+	}
+
+	if p.tok != COMMA && p.tok != RBRACK {
+		p.error(&p.pos, fmt.Sprintf("expecting , or ] after %s", x.Name))
+		return nil
+	}
+
+	return x
+}
+
+// parses the optional layout annotations of structs and fields: packed, align(expr)
+func (p *Parser) parseLayout(packed *bool, align *ast.Expr) bool {
+	for {
+		switch p.keyword() {
+		case PACKED:
+			*packed = true
+
+		case ALIGN:
+			params := p.parseParamList()
+			if params == nil {
+				return false
 			}
-		}
 
-		p.next()
+			if len(params) != 1 {
+				p.error(&p.pos, "align expects a single value")
+				return false
+			}
+
+			*align = params[0]
 
-	case INT:
-		s := string(p.lit)
-		e.val, err = strconv.ParseInt(s, 0, 64)
-		if err == strconv.ErrRange {
-			e.val, err = strconv.ParseUint(s, 0, 64)
+		default:
+			return true
 		}
-		p.next()
 
-	case FLOAT:
-		e.val, err = strconv.ParseFloat(string(p.lit), 64)
 		p.next()
+	}
+}
 
-	case STRING:
-		e.val, err = strconv.Unquote(string(p.lit))
-		p.next()
+func (p *Parser) parseExpr() ast.Expr {
+	return p.parseBinaryExpr(lowestPrec + 1)
+}
 
-	default:
-		p.error(&p.pos, "invalid expression")
+// Parses a binary expression using precedence climbing. Operators with
+// precedence lower than prec are left for the caller.
+func (p *Parser) parseBinaryExpr(prec int) ast.Expr {
+	x := p.parseUnaryExpr()
+	if x == nil {
 		return nil
 	}
 
-	if err!=nil {
-		p.error(&p.pos, err.Error())
-		return nil
+	for {
+		op := p.tok
+		oprec := op.Precedence()
+		if oprec < prec {
+			return x
+		}
+
+		pos := p.apos()
+		p.next()
+		y := p.parseBinaryExpr(oprec + 1)
+		if y == nil {
+			return nil
+		}
+
+		x = &ast.BinaryExpr{X: x, OpPos: pos, Op: op.String(), Y: y}
 	}
+}
 
-	// operator
+func (p *Parser) parseUnaryExpr() ast.Expr {
 	switch p.tok {
-	case ADD, SUB, MUL, QUO, REM:
-		e1 := new(Expr)
-		e1.left = e
-		e1.op = p.tok
+	case ADD, SUB, NOT:
+		e := &ast.UnaryExpr{OpPos: p.apos(), Op: p.tok.String()}
 		p.next()
-		e1.right = p.parseExpr(constexpr)
-		e = e1
+		e.X = p.parseUnaryExpr()
+		if e.X == nil {
+			return nil
+		}
+
+		return e
 	}
 
-	return e
+	return p.parsePrimaryExpr()
 }
 
-func (p *Parser) parseStruct(t *Type) bool {
-	if p.tok != LBRACE {
-		p.error(&p.pos, "expecting {")
-		return false
+// parses an operand followed by the indices and the field selectors
+func (p *Parser) parsePrimaryExpr() ast.Expr {
+	x := p.parseOperand()
+	for x != nil {
+		switch p.tok {
+		case LBRACK:
+			e := &ast.IndexExpr{X: x, Lbrack: p.apos()}
+			p.next()
+			for {
+				i := p.parseExpr()
+				if i == nil {
+					return nil
+				}
+
+				e.Index = append(e.Index, i)
+				if p.tok != COMMA {
+					break
+				}
+
+				p.next()
+			}
+
+			if p.tok != RBRACK {
+				p.error(&p.pos, "expecting ]")
+				return nil
+			}
+
+			p.next()
+			x = e
+
+		case PERIOD:
+			p.next()
+			if p.tok != IDENT {
+				p.error(&p.pos, "identifier expected")
+				return nil
+			}
+
+			x = &ast.SelectorExpr{X: x, Sel: p.parseIdent()}
+
+		case LPAREN:
+			id, ok := x.(*ast.Ident)
+			if !ok {
+				return x
+			}
+
+			e := &ast.CallExpr{Fun: id, Lparen: p.apos()}
+			p.next()
+			for p.tok != RPAREN {
+				a := p.parseExpr()
+				if a == nil {
+					return nil
+				}
+
+				e.Args = append(e.Args, a)
+				if p.tok != COMMA {
+					break
+				}
+
+				p.next()
+			}
+
+			if p.tok != RPAREN {
+				p.error(&p.pos, "expecting )")
+				return nil
+			}
+
+			e.Rparen = p.apos()
+			p.next()
+			x = e
+
+		default:
+			return x
+		}
 	}
 
-	ds := p.dr.Dataset
-	p.next()
-	fnames := make([]string, 16)
+	return nil
+}
+
+func (p *Parser) parseOperand() ast.Expr {
+	switch p.tok {
+	case LPAREN:
+		e := &ast.ParenExpr{Lparen: p.apos()}
+		p.next()
+		e.X = p.parseBinaryExpr(lowestPrec + 1)
+		if e.X == nil {
+			return nil
+		}
+
+		if p.tok != RPAREN {
+			p.error(&p.pos, "expecting )")
+			return nil
+		}
+
+		p.next()
+		return e
+
+	case IDENT:
+		return p.parseIdent()
+
+	case INT, FLOAT, STRING:
+		e := &ast.BasicLit{ValuePos: p.apos(), Value: string(p.lit)}
+		switch p.tok {
+		case INT:
+			e.Kind = ast.INT
+		case FLOAT:
+			e.Kind = ast.FLOAT
+		case STRING:
+			e.Kind = ast.STRING
+		}
+
+		p.next()
+		return e
+	}
+
+	p.error(&p.pos, "invalid expression")
+	return nil
+}
+
+// parses the fields of a struct after the {, using ftype to parse the
+// type of each field. The fields of the dataset structs can have layout
+// annotations.
+func (p *Parser) parseStruct(t *ast.StructType, ftype func() (ast.Type, bool), layout bool) bool {
 	for p.tok == IDENT {
-		ftype := (*Type)(nil)
-		n := 0
-		pos := p.pos
+		f := new(ast.Field)
 
 		// read the fields
 		for p.tok == IDENT {
-//			log.Println("field", n, "name", string(p.lit), "...", p.lit)
-			if n>len(fnames) {
-				f := make([]string, len(fnames) + 16)
-				copy(f, fnames)
-				fnames = f
-			}
-
-			fnames[n] = string(p.lit)
-			n++
-			p.next()
+			f.Names = append(f.Names, p.parseIdent())
 			if p.tok != COMMA {
 				break
 			}
@@ -339,22 +627,24 @@ func (p *Parser) parseStruct(t *Type) bool {
 		}
 
 		// read the type
-		switch p.tok {
-		case IDENT:
-			ftype, _ = ds.createType(string(p.lit), nil)
-			p.next()
-
-		default:
-			ftype, _ = ds.createType("", &pos)
-			if !p.parseDatasetType(ftype) {
-				return false
-			}
+		var ok bool
+		if f.Type, ok = ftype(); !ok {
+			return false
 		}
 
-		if !t.addFields(fnames[0:n], ftype, &pos) {
+		t.Fields = append(t.Fields, f)
+		if layout && !p.parseLayout(&f.Packed, &f.Align) {
 			return false
 		}
 
+		if !layout && p.tok == ASSIGN {
+			// computed field of a view
+			p.next()
+			if f.Value = p.parseExpr(); f.Value == nil {
+				return false
+			}
+		}
+
 		if p.tok == SEMICOLON {
 			p.next()
 		}
@@ -369,24 +659,22 @@ func (p *Parser) parseStruct(t *Type) bool {
 	return true
 }
 
-func (p *Parser) parseDatasetVarDecl() bool {
-	ds := p.dr.Dataset
-	vnames := make([]string, 16)
-	vtype := (*Type)(nil)
-	n := 0
-	pos := p.pos
-	p.next()
-	for p.tok == IDENT {
-		if n>len(vnames) {
-			v := make([]string, len(vnames) + 8)
-			copy(v, vnames)
-			vnames = v
-		}
+// the type of a dataset variable or struct field, a type name can be
+// defined later
+func (p *Parser) parseStructFieldType() (ast.Type, bool) {
+	if p.tok == IDENT {
+		return p.parseIdent(), true
+	}
 
-		vnames[n] = string(p.lit)
-		n++
+	t := p.parseDatasetType()
+	return t, t != nil
+}
 
-		p.next()
+func (p *Parser) parseDatasetVarDecl() *ast.VarDecl {
+	d := &ast.VarDecl{Var: p.apos()}
+	p.next()
+	for p.tok == IDENT {
+		d.Names = append(d.Names, p.parseIdent())
 		if p.tok != COMMA {
 			break
 		}
@@ -394,108 +682,111 @@ func (p *Parser) parseDatasetVarDecl() bool {
 		p.next()
 	}
 
-	switch p.tok {
-	case IDENT:
-		vtype, _ = ds.createType(string(p.lit), nil)
-		p.next()
-
-	default:
-		vtype, _ = ds.createType("", &pos)
-		if !p.parseDatasetType(vtype) {
-			return false
-		}
-	}
-
-	for i:=0; i<n; i++ {
-		name := vnames[i]
-		if v, created := ds.createVarDecl(name, &pos); !created {
-			p.error(&p.pos, fmt.Sprintf("variable '%v' already defined at %v", name, &v.pos))
-			return false
-		} else {
-			v.t = vtype
-		}
+	var ok bool
+	if d.Type, ok = p.parseStructFieldType(); !ok {
+		return nil
 	}
 
 	if p.tok == SEMICOLON {
 		p.next()
 	}
 
-	return true
+	return d
 }
 
-func (p *Parser) parseDatasetConstDecl() {
-	ds := p.dr.Dataset
+func (p *Parser) parseDatasetConstDecl() *ast.ConstDecl {
+	d := &ast.ConstDecl{Const: p.apos()}
 	p.next()
 	if p.tok != IDENT {
 		p.error(&p.pos, "expecting identifier")
-		return
-	}
-
-	name := string(p.lit)
-	c, created := ds.createConstDecl(name, &p.pos)
-	if !created && c.isDefined() {
-		p.error(&p.pos, fmt.Sprintf("constant '%s' already defined at %v", name, &c.pos))
-		return
+		return nil
 	}
 
-	p.next()
+	d.Name = p.parseIdent()
 	if p.tok != ASSIGN {
 		p.error(&p.pos, "expecting =")
-		return
+		return nil
 	}
 
 	p.next()
-	c.expr = p.parseExpr(true)
-	if c.expr==nil {
-		return
+	d.Value = p.parseExpr()
+	if d.Value==nil {
+		return nil
 	}
 
 	if p.tok == SEMICOLON {
 		p.next()
 	}
-}
 
-func (p *Parser) parseView() {
-	var vw *View
+	return d
+}
 
+func (p *Parser) parseView(pos ast.Pos) *ast.ViewDecl {
 	inline := false
+	lev := 0
 
 	if p.tok != IDENT {
 		p.error(&p.pos, "expecting view name")
-		return
+		return nil
 	}
 
-	name := string(p.lit)
-	p.next()
+	d := &ast.ViewDecl{View: pos}
+	d.Name = p.parseIdent()
+
+	// partitioned view: (rank of nranks)
+	if p.tok == LPAREN {
+		p.next()
+		if p.tok != IDENT {
+			p.error(&p.pos, "expecting rank name")
+			return nil
+		}
+
+		d.Rank = p.parseIdent()
+		if p.tok != IDENT || string(p.lit) != "of" {
+			p.error(&p.pos, "expecting of")
+			return nil
+		}
+
+		p.next()
+		if d.Ranks = p.parseExpr(); d.Ranks == nil {
+			return nil
+		}
+
+		if p.tok != RPAREN {
+			p.error(&p.pos, "expecting )")
+			return nil
+		}
+
+		p.next()
+		p.part = true
+		defer func() { p.part = false }()
+	}
 
 	// view flags
-	flags := 0
 l1:	for {
-		switch p.tok {
-		case ROWMAJOR:
-			flags |= Vrowmajor
-
-		case COLMAJOR:
-			flags |= Vrowminor
+		tok := p.keyword()
+		f := &ast.Flag{NamePos: p.apos(), Name: tok.String()}
+		switch tok {
+		case ROWMAJOR, COLMAJOR, ZORDER, HILBERT, DEFAULT, READONLY, BIGENDIAN, LITTLEENDIAN, PACKED:
 
-		case DEFAULT:
-			flags |= Vdefault
+		case TILED, ORDER:
+			f.Args = p.parseParamList()
+			if f.Args == nil {
+				return nil
+			}
 
-		case READONLY:
-			flags |= Vreadonly
+		case CONVERT:
+			f.Args = p.parseConversion()
+			if f.Args == nil {
+				return nil
+			}
 
 		case IDENT:
 			// for backward compatibility
-			s := string(p.lit)
-			if s=="rowmajor" {
-				flags |= Vrowmajor
-			} else if s=="rowminor" {
-				flags |= Vrowminor
-			} else if s=="default" {
-				flags |= Vdefault
-			} else {
-				p.error(&p.pos, fmt.Sprintf("undefined view flag: %s", s))
-				goto done
+			f.Name = string(p.lit)
+			if f.Name!="rowmajor" && f.Name!="rowminor" && f.Name!="default" {
+				p.error(&p.pos, fmt.Sprintf("undefined view flag: %s", f.Name))
+				return nil
 			}
 
 		default:
@@ -504,25 +795,19 @@ l1:	for {
 //			goto done
 		}
 
+		d.Flags = append(d.Flags, f)
 		p.next()
 	}
 
-//	fmt.Printf("view %s flags %x\n", name, flags)
-	vw = p.dr.createView(name, flags)
-	if vw==nil {
-		p.error(&p.pos, fmt.Sprintf("cannot create view '%s'", name))
-		return
-	}
-
-	p.cview = vw
 	switch p.tok {
 	default:
 		p.error(&p.pos, fmt.Sprintf("invalid token: %d: %v", p.tok, string(p.lit)))
-		goto done
+		return nil
 
 	case STRING:
+		d.File = p.stringLit()
 		if !p.includeFile(string(p.lit[1:len(p.lit)-1])) {
-			goto done
+			return nil
 		}
 
 	case LBRACE:
@@ -530,20 +815,30 @@ l1:	for {
 	}
 
 	p.next()
+	lev = p.depth
 	for p.tok != EOF && p.tok != RBRACE {
 		tok := p.tok
 		pos := p.pos
+		nerr := p.nerr
 
 		switch tok {
 		case TYPE:
-			p.parseViewTypeDecl()
+			if td := p.parseViewTypeDecl(); td != nil {
+				d.Decls = append(d.Decls, td)
+			}
 		case VAR:
-			p.parseViewVarDecl()
+			if vd := p.parseViewVarDecl(); vd != nil {
+				d.Decls = append(d.Decls, vd)
+			}
 		case SEMICOLON:
 			p.next()
 		default:
 			p.error(&pos, fmt.Sprintf("invalid token: %d: %v", tok, string(p.lit)))
-			goto done
+			p.next()
+		}
+
+		if p.nerr != nerr {
+			p.sync(lev)
 		}
 	}
 
@@ -551,69 +846,99 @@ l1:	for {
 		p.error(&p.pos, "expecting }")
 	}
 
-done:
-	p.cview = nil
+	return d
 }
 
-func (p *Parser) parseViewTypeDecl() {
-	vw := p.cview
-	ds := p.dr.Dataset
+// parses a list of constant parameters, e.g. the tile shape of the tiled
+// order, or the permutation: (expr, ...)
+func (p *Parser) parseParamList() []ast.Expr {
+	var params []ast.Expr
+
 	p.next()
-	if p.tok != IDENT {
-		p.error(&p.pos, "identifier expected")
-		return
+	if p.tok != LPAREN {
+		p.error(&p.pos, "expecting (")
+		return nil
 	}
 
-	name := string(p.lit)
-	if td := ds.getType(name); td != nil {
-		p.error(&p.pos, fmt.Sprintf("type '%s' already defined at %v", name, td.pos))
-		return
+	for p.tok != RPAREN {
+		p.next()
+		e := p.parseExpr()
+		if e == nil {
+			return nil
+		}
+
+		params = append(params, e)
+		if p.tok != COMMA && p.tok != RPAREN {
+			p.error(&p.pos, "expecting , or )")
+			return nil
+		}
+	}
+
+	return params
+}
+
+// parses convert(saturate|wrap|exact), returns the conversion policy as
+// the only parameter, or nil on error
+func (p *Parser) parseConversion() []ast.Expr {
+	p.next()
+	if p.tok != LPAREN {
+		p.error(&p.pos, "expecting (")
+		return nil
 	}
 
 	p.next()
-	td, ok := p.parseViewType()
-	if !ok {
-		return
+	s := string(p.lit)
+	if p.tok != IDENT || (s != "saturate" && s != "wrap" && s != "exact") {
+		p.error(&p.pos, "expecting saturate, wrap or exact")
+		return nil
+	}
+
+	x := p.parseIdent()
+	if p.tok != RPAREN {
+		p.error(&p.pos, "expecting )")
+		return nil
 	}
 
-	if td.dt == nil {
-		p.error(&p.pos, fmt.Sprintf("dataset type must be specified when defining view type"))
+	return []ast.Expr{x}
+}
+
+func (p *Parser) parseViewTypeDecl() *ast.TypeDecl {
+	d := &ast.TypeDecl{TypePos: p.apos()}
+	p.next()
+	if p.tok != IDENT {
+		p.error(&p.pos, "identifier expected")
+		return nil
 	}
-	
-	if !vw.addType(name, td) {
-		p.error(&p.pos, fmt.Sprintf("type '%s' already defined at %v", name, td.pos))
+
+	d.Name = p.parseIdent()
+	var ok bool
+	if d.Type, ok = p.parseViewType(); !ok {
+		return nil
 	}
 
 	if p.tok == SEMICOLON {
 		p.next()
 	}
-}
 
-func (p *Parser) parseViewType() (*VType, bool) {
-	vw := p.cview
-	ds := p.dr.Dataset
+	return d
+}
 
+// parses the type of a view variable, returns nil if there is no type
+func (p *Parser) parseViewType() (ast.Type, bool) {
 //	fmt.Printf("parseViewType\n")
 	switch p.tok {
 	case IDENT:
-		name := string(p.lit)
-		if t1 := ds.getType(name); t1 != nil {
-			t,_ := vw.createType("", &p.pos)
-			t.dt = t1
-			p.next()
-			return t, true
-		} else if vt := vw.getType(name); vt != nil {
-			p.next()
-			return vt, true
-		} else {
-			p.error(&p.pos, fmt.Sprintf("type '%s' not defined", name))
-			return nil, false
+		if p.keyword() == WHERE {
+			// the where clause after the right side
+			return nil, true
 		}
 
+		return p.parseIdent(), true
+
 	case LBRACK:
 		// VArrayType
-		t, _ := vw.createType("", &p.pos)
-		if !p.parseVArrayLengths(t) {
+		t := &ast.ArrayType{Lbrack: p.apos()}
+		if !p.parseArrayLengths(&t.Dims) {
 			return nil, false
 		}
 
@@ -625,7 +950,7 @@ func (p *Parser) parseViewType() (*VType, bool) {
 		p.next()
 
 		var ok bool
-		t.etype, ok = p.parseViewType()
+		t.Elem, ok = p.parseViewType()
 		if !ok {
 			return nil, false
 		}
@@ -633,8 +958,17 @@ func (p *Parser) parseViewType() (*VType, bool) {
 
 	case LBRACE:
 		// VStructType
+		t := &ast.StructType{Struct: p.apos()}
 		p.next()
-		return p.parseVStruct()
+		if !p.parseStruct(t, p.parseViewType, false) {
+			return nil, false
+		}
+
+		if p.tok == IDENT && p.keyword() != WHERE {
+			t.Base = p.parseIdent()
+		}
+
+		return t, true
 
 /*
 	case SEMICOLON:
@@ -648,330 +982,182 @@ func (p *Parser) parseViewType() (*VType, bool) {
 	return nil, true
 }
 
-func (p *Parser) parseVArrayLengths(t *VType) bool {
-	dimnum := 0
-	dim := make([]*Expr, 8)
-	for p.tok != EOF {
-		if dimnum >= len(dim) {
-			d := make([]*Expr, len(dim) + 8)
-			copy(d, dim)
-			dim = d
-		}
-
-		p.next()
-		if p.tok != COMMA && p.tok != RBRACK {
-			dim[dimnum] = p.parseVExpr(t)
-			if dim[dimnum]==nil {
-				return false
-			}
-
-		}
-
-		dimnum++
-		if p.tok == RBRACK {
-			break
-		}
-	}
-
-	t.dim = dim[0:dimnum]
-	
-	return true
-}
-
-func (p *Parser) parseVStruct() (*VType, bool) {
-	vw := p.cview
-//	if p.tok != LBRACE {
-//		p.error(&p.pos, fmt.Sprintf("expecting {, got %d", p.tok))
-//		return false
-//	}
-
-//	p.next()
-	t, _ := vw.createType("", &p.pos)
-	fnames := make([]string, 16)
-	for p.tok == IDENT {
-		ftype := (*VType)(nil)
-		n := 0
-		pos := p.pos
-
-		// read the fields
-		for p.tok == IDENT {
-			if n>len(fnames) {
-				f := make([]string, len(fnames) + 16)
-				copy(f, fnames)
-				fnames = f
-			}
-
-			fnames[n] = string(p.lit)
-			n++
-			p.next()
-			if p.tok != COMMA {
-				break
-			}
-
-			p.next()
-		}
-
-		// read the type
-		var ok bool
-		ftype, ok = p.parseViewType()
-		if !ok {
-			return nil, false
-		}
-
-		if !t.addFields(fnames[0:n], ftype, &pos) {
-			return nil, false
-		}
-
-		if p.tok == SEMICOLON {
-			p.next()
-		}
-	}
-
-	if p.tok != RBRACE {
-		p.error(&p.pos, "expecting }")
-		return nil, false
-	}
-
-	p.next()
-	if p.tok == IDENT {
-		name := string(p.lit)
-		if t1 := p.dr.Dataset.getType(name); t1 != nil {
-			t.dt = t1
-		} else {
-			p.error(&p.pos, fmt.Sprintf("type '%s' not defined", name))
-			return nil, false
-		}
-		p.next()
-	}
-
-	return t, true
-}
-
-func (p *Parser) parseViewVarDecl() {
-	ds := p.dr.Dataset
-	vw := p.cview
-	vt := (*VType)(nil)
-	pos := p.pos
+func (p *Parser) parseViewVarDecl() *ast.ViewVarDecl {
+	d := &ast.ViewVarDecl{Var: p.apos()}
 	p.next()
 	if p.tok != IDENT {
 		p.error(&p.pos, "identifier expected")
-		return
+		return nil
 	}
 
-	vname := string(p.lit)
-	p.next()
-	if p.tok == IDENT {
-		vt = vw.getType(string(p.lit))
-	}
+	d.Name = p.parseIdent()
 
-	if vt==nil {
-		var ok bool
-		vt, ok = p.parseViewType()
-		if !ok {
-			return
+	// optional element order of the variable's arrays
+	switch tok := p.keyword(); tok {
+	case ROWMAJOR, COLMAJOR, ZORDER, HILBERT:
+		d.Order = &ast.Flag{NamePos: p.apos(), Name: tok.String()}
+		p.next()
+
+	case TILED, ORDER:
+		d.Order = &ast.Flag{NamePos: p.apos(), Name: tok.String()}
+		d.Order.Args = p.parseParamList()
+		if d.Order.Args == nil {
+			return nil
 		}
+
+		p.next()
 	}
 
-	v, created := vw.createVarDecl(vname, &pos)
-	if !created {
-		p.error(&p.pos, fmt.Sprintf("variable '%v' already defined at %v", vname, &v.pos))
-		return
+	var ok bool
+	if d.Type, ok = p.parseViewType(); !ok {
+		return nil
 	}
 
-	v.lt = vt
 	if p.tok != ASSIGN {
 		p.error(&p.pos, fmt.Sprintf("expecting =, got %v", string(p.lit)))
-		return
+		return nil
 	}
 
 	p.next()
 	if p.tok != IDENT {
 		p.error(&p.pos, "identifier expected")
-		return
-	}
-
-	v.v = ds.getVarDecl(string(p.lit))
-	if v.v == nil {
-		p.error(&p.pos, fmt.Sprintf("variable '%s' not found", string(p.lit)))
-		return
-	}
-
-	p.next()	
-	vt = (*VType)(nil)
-	if p.tok == IDENT {
-		vt = vw.getType(string(p.lit))
+		return nil
 	}
 
-	if vt==nil {
-		// are we too flexible here? we should probably only allow array type
-		var ok bool
-		vt, ok = p.parseViewType()
-		if !ok {
-			return
+	d.Value = p.parseIdent()
+	if p.tok == LPAREN {
+		// the elements are reduced by an aggregation function
+		d.Reduce = d.Value
+		p.next()
+		if p.tok != IDENT {
+			p.error(&p.pos, "identifier expected")
+			return nil
 		}
-	}
 
-	v.rt = vt
-	if p.tok == SEMICOLON {
-		p.next()
+		d.Value = p.parseIdent()
 	}
 
-	return
-
-}
-
-func (p *Parser) parseVExpr(t *VType) *Expr {
-	var err error
-
-	e := new(Expr)
-	ds := p.dr.Dataset
-
-	// left operand
-	switch p.tok {
-	case LPAREN:
-		p.next()
-		e = p.parseVExpr(t)
-		if e == nil {
-			return nil
-		}
+	// are we too flexible here? we should probably only allow array type
+	if d.RType, ok = p.parseViewType(); !ok {
+		return nil
+	}
 
+	if d.Reduce != nil {
 		if p.tok != RPAREN {
-			p.error(&p.pos, "expecting )")
+			p.error(&p.pos, fmt.Sprintf("expecting ), got %v", string(p.lit)))
 			return nil
 		}
-		p.next()
-
-	case IDENT:
-		e.op = p.tok
-		name := string(p.lit)
-		if c := ds.getConstDecl(name); c!=nil {
-			e.val = &c.EVar
-		} else {
-			temp, _ := t.createTemp(name, &p.pos)
-			e.val = &temp.EVar
-		}
-
-		p.next()
-
-	case INT:
-		s := string(p.lit)
-		e.val, err = strconv.ParseInt(s, 0, 64)
-		if err == strconv.ErrRange {
-			e.val, err = strconv.ParseUint(s, 0, 64)
-		}
-		p.next()
-
-	case FLOAT:
-		e.val, err = strconv.ParseFloat(string(p.lit), 64)
-		p.next()
 
-	case STRING:
-		e.val, err = strconv.Unquote(string(p.lit))
 		p.next()
-
-	default:
-		p.error(&p.pos, "invalid expression")
-		return nil
 	}
 
-	if err!=nil {
-		p.error(&p.pos, err.Error())
-		return nil
+	if p.keyword() == WHERE {
+		d.Where = p.apos()
+		p.next()
+		if d.Cond = p.parseExpr(); d.Cond == nil {
+			return nil
+		}
 	}
 
-	// operator
-	switch p.tok {
-	case ADD, SUB, MUL, QUO, REM:
-		e1 := new(Expr)
-		e1.left = e
-		e1.op = p.tok
+	if p.tok == SEMICOLON {
 		p.next()
-		e1.right = p.parseVExpr(t)
-		e = e1
 	}
 
-	return e
+	return d
 }
 
-func (p *Parser) parseReplica() {
+func (p *Parser) parseReplica() *ast.ReplicaDecl {
 	if p.tok != REPLICA {
 		p.error(&p.pos, "'replica' keyword expected")
-		return
+		return nil
 	}
-	p.next()
 
-	flags := 0
+	d := &ast.ReplicaDecl{Replica: p.apos()}
+	p.next()
 
 L:
 	for p.tok != IDENT {
 		switch p.tok {
 		default:
 			break L
-		case COMPLETE:
-			flags |= Rcomplete
-		case READONLY:
-			flags |= Rreadonly
+		case COMPLETE, READONLY:
+			d.Flags = append(d.Flags, &ast.Flag{NamePos: p.apos(), Name: p.tok.String()})
 		}
 		p.next()
 	}
 
 	if p.tok != IDENT {
 		p.error(&p.pos, "replica name expected")
-		return
+		return nil
 	}
 
-	name := string(p.lit)
-	p.next()
-
-	fname := name
+	d.Name = p.parseIdent()
 	if p.tok == STRING {
-		fname, _ = strconv.Unquote(string(p.lit))
+		d.File = p.stringLit()
 		p.next()
 	}
 
-	r := p.dr.createReplica(name, fname, flags)
-	if r==nil {
-		p.error(&p.pos, fmt.Sprintf("cannot create replica '%s'", name))
-		return
-	}
-
 	if p.tok != LBRACE {
 		p.error(&p.pos, "{ expected")
 	}
 
 	p.next()
-	for p.tok != RBRACE {
-		if p.tok == VIEW {
-			p.parseReplicaViewDecl(r)
-		} else {
+	lev := p.depth
+	for p.tok != EOF && p.tok != RBRACE {
+		nerr := p.nerr
+		switch p.tok {
+		case VIEW:
+			p.next()
+			if p.tok != IDENT {
+				p.error(&p.pos, "view name expected")
+				break
+			}
+
+			var x ast.Expr = p.parseIdent()
+			if p.tok == LBRACK {
+				// a single rank of a partitioned view
+				e := &ast.IndexExpr{X: x, Lbrack: p.apos()}
+				p.next()
+				i := p.parseExpr()
+				if i == nil {
+					break
+				}
+
+				if p.tok != RBRACK {
+					p.error(&p.pos, "expecting ]")
+					break
+				}
+
+				p.next()
+				e.Index = []ast.Expr{i}
+				x = e
+			}
+
+			d.Views = append(d.Views, x)
+			if p.tok == SEMICOLON {
+				p.next()
+			}
+		case SEMICOLON:
+			p.next()
+		default:
 			p.error(&p.pos, fmt.Sprintf("invalid token: %d: %v", p.tok, string(p.lit)))
-			return
+			p.next()
 		}
-	}
-}
 
-func (p *Parser) parseReplicaViewDecl(r *Repl) {
-	p.next()
-	if p.tok != IDENT {
-		p.error(&p.pos, "view name expected")
-		return
+		if p.nerr != nerr {
+			p.sync(lev)
+		}
 	}
 
-	name := string(p.lit)
-	v := p.dr.findView(name)
-	if v==nil {
-		p.error(&p.pos, fmt.Sprintf("can't find view '%s'", name))
-		return
+	if p.tok != RBRACE {
+		p.error(&p.pos, "expecting }")
 	}
 
-	r.addView(v)
-	p.next()
-	if p.tok == SEMICOLON {
-		p.next()
-	}
+	return d
 }
 
 func (p *Parser) error(pos *Pos, msg string) {
+	p.nerr++
 	if p.err != nil {
 		p.err.Error(pos, msg)
 	}
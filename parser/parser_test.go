@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// the flags and annotations added after the first version of the language
+// are keywords only where a flag or an annotation is expected
+func TestContextKeywords(t *testing.T) {
+	srcs := []string{
+		`dataset {
+	const order = 2
+	type where struct { order int32; align int8; packed int16 }
+	var tiled [order]where
+	var zorder, hilbert [4]int32
+	var bigendian, littleendian, convert [4]int8
+}
+view dv default {
+	var tiled [i] = tiled[i]
+	var zorder [i] = zorder[i]
+	var hilbert [i] = hilbert[i]
+	var bigendian [i] = bigendian[i]
+	var littleendian [i] = littleendian[i]
+	var convert [i] = convert[i]
+}
+`,
+		`dataset {
+	type s struct packed align(8) { order int32; align int8 align(4) }
+	var a [4, 4]s
+}
+view v zorder bigendian convert(wrap) {
+	var order [i, j] { order; align } = a[i, j] where i < 2
+	var where tiled(2, 2) [i, j] { order } = a[i, j]
+}
+`,
+	}
+
+	for _, src := range srcs {
+		if _, errs := ParseReader("test.drepl", strings.NewReader(src), nil); errs != "" {
+			t.Errorf("%s: %s", src, errs)
+		}
+	}
+
+	runViewTests(t, []viewTest{
+		{"view v { var order [i] = a[i] where i < 3 }", map[string] []int32{"v": {0, 1, 2}}},
+		{"view v hilbert { var zorder [i, j] = m[i, j] where i < 1 }", map[string] []int32{"v": {10, 11, 12, 13}}},
+	})
+}
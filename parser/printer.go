@@ -0,0 +1,453 @@
+package parser
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// token as seen by the printer
+type ptoken struct {
+	tok	Token
+	lit	string
+	line	int		// line where the token starts
+	eline	int		// line where the token ends (multi-line comments)
+	compact	bool		// binary operator printed without spaces
+}
+
+// line of the printer's output
+type pline struct {
+	indent	int
+	text	[]byte
+	sep	int		// offset in text where the type of a struct field starts, -1 if not a field
+}
+
+type printer struct {
+	lines	[]*pline
+	cur	*pline		// line being printed, nil before the first token
+
+	depth	int		// brace nesting
+	blocks	[]bool		// true for each open brace that starts a block
+	nest	int		// ( and [ nesting
+	region	Token		// DATASET, VIEW or REPLICA, the top-level declaration printed
+	vname	bool		// next token is the name of a view
+	header	bool		// in the view flags
+	expr	bool		// after the = of a declaration
+
+	prev	Token		// previous token on the line, ILLEGAL at the start of the line
+	unary	bool		// previous token is an unary operator
+	opc	bool		// the token printed is a compact binary operator
+	popc	bool		// previous token is a compact binary operator
+	brk	bool		// start a new line before the next token
+	blank	bool		// blank line before the next line
+	opened	bool		// a block was opened on the previous line
+	names	bool		// reading the names of a struct field
+	expname	bool		// expecting a name of a struct field
+}
+
+// Format returns the description in src in the canonical form. The
+// comments and the line breaks between the declarations are kept, the
+// indentation and the spaces between the tokens are normalized, and the
+// types of the struct fields are aligned. The legacy view flags are
+// replaced with the keywords, and the stringN types in the dataset with
+// the arrays of int8 they stand for.
+func Format(fname string, src []byte) ([]byte, error) {
+	var toks []ptoken
+	var open []ptoken
+	var opos []Pos
+
+	ep := new(ErrPrinter)
+	sc := NewScanner(fname, src, ep, ScanComments)
+	for {
+		pos, tok, lit := sc.Scan()
+		if tok == EOF {
+			break
+		}
+
+		t := ptoken{tok: tok, lit: string(lit), line: pos.line}
+		t.eline = t.line + bytes.Count(lit, newline)
+		switch tok {
+		case LBRACE, LPAREN, LBRACK:
+			open = append(open, t)
+			opos = append(opos, *pos)
+
+		case RBRACE, RPAREN, RBRACK:
+			n := len(open)
+			if n == 0 || open[n-1].tok != tok - (RPAREN - LPAREN) {
+				ep.Error(pos, "unexpected " + tok.String())
+			} else {
+				open = open[0:n-1]
+				opos = opos[0:n-1]
+			}
+		}
+
+		toks = append(toks, t)
+	}
+
+	for i := range open {
+		ep.Error(&opos[i], open[i].tok.String() + " not closed")
+	}
+
+	if len(ep.errs) != 0 {
+		ep.errs.RemoveMultiples()
+		return nil, ep.errs
+	}
+
+	markCompact(toks)
+	p := new(printer)
+	last := 0
+	for i := range toks {
+		t := &toks[i]
+		next := (*ptoken)(nil)
+		if i+1 < len(toks) {
+			next = &toks[i+1]
+		}
+
+		p.token(t, next, last)
+		last = t.eline
+	}
+
+	return p.bytes(), nil
+}
+
+// prints the token t, last is the line where the previous token ended
+func (p *printer) token(t, next *ptoken, last int) {
+	sameline := p.cur != nil && t.line == last
+	if !sameline && p.cur != nil {
+		p.brk = true
+		if t.line > last + 1 {
+			p.blank = true
+		}
+	}
+
+	tok, lit := t.tok, t.lit
+	p.opc = t.compact
+	switch tok {
+	case COMMENT:
+		if sameline {
+			// stays on the line even if it ends with a {
+			if strings.HasPrefix(lit, "//") {
+				p.cur.text = append(p.cur.text, "\t" + lit...)
+				p.brk = true
+			} else {
+				p.cur.text = append(p.cur.text, " " + lit...)
+			}
+
+			return
+		}
+
+		p.start()
+		p.write(lit)
+		p.prev = COMMENT
+		if strings.HasPrefix(lit, "//") {
+			p.brk = true
+		}
+
+		return
+
+	case SEMICOLON:
+		if len(p.blocks) == 0 || p.blocks[len(p.blocks)-1] {
+			// declarations are separated by new lines
+			p.brk = true
+			p.expr = false
+			return
+		}
+
+	case LBRACE:
+		block := p.depth == 0 || p.region == DATASET || next == nil || next.line > t.line
+		p.emit(tok, tok.String())
+		p.depth++
+		p.blocks = append(p.blocks, block)
+		p.header = false
+		p.expr = false
+		if block {
+			p.brk = true
+			p.opened = true
+		}
+
+		return
+
+	case RBRACE:
+		block := true
+		if len(p.blocks) > 0 {
+			block = p.blocks[len(p.blocks)-1]
+			p.blocks = p.blocks[0:len(p.blocks)-1]
+		}
+
+		if p.depth > 0 {
+			p.depth--
+		}
+
+		if block {
+			p.brk = true
+			p.blank = false
+		}
+
+		p.emit(tok, tok.String())
+		p.expr = false
+		return
+
+	case DATASET, VIEW, REPLICA:
+		if p.depth == 0 {
+			p.region = tok
+			p.vname = tok == VIEW
+		}
+
+	case STRING:
+		p.header = false
+
+	case IDENT:
+		if p.vname {
+			p.vname = false
+			p.emit(tok, lit)
+			p.header = true
+			return
+		}
+
+		if p.expr && lit == "where" {
+			// a where clause, not a name
+			tok = WHERE
+		}
+
+		if p.header {
+			// the flags before they became keywords
+			switch lit {
+			case "rowmajor":
+				tok, lit = ROWMAJOR, ROWMAJOR.String()
+			case "rowminor":
+				tok, lit = COLMAJOR, COLMAJOR.String()
+			case "default":
+				tok, lit = DEFAULT, DEFAULT.String()
+			}
+		}
+
+		if p.region == DATASET && !p.brk && (p.prev == IDENT || p.prev == RBRACK) && strings.HasPrefix(lit, "string") {
+			if n, err := strconv.Atoi(lit[6:]); err == nil && n >= 0 {
+				p.emit(LBRACK, LBRACK.String())
+				p.emit(INT, strconv.Itoa(n + 1))
+				p.emit(RBRACK, RBRACK.String())
+				p.emit(IDENT, "int8")
+				return
+			}
+		}
+	}
+
+	if tok < litstart || tok > litend {
+		lit = tok.String()
+	}
+
+	p.emit(tok, lit)
+	if tok == ASSIGN {
+		p.expr = true
+	}
+}
+
+// starts a new line if needed
+func (p *printer) start() {
+	if p.cur != nil && !p.brk {
+		return
+	}
+
+	if p.blank && !p.opened && len(p.lines) > 0 {
+		p.lines = append(p.lines, &pline{sep: -1})
+	}
+
+	p.cur = &pline{indent: p.depth, sep: -1}
+	p.lines = append(p.lines, p.cur)
+	p.brk = false
+	p.blank = false
+	p.opened = false
+	p.prev = ILLEGAL
+	p.unary = false
+	p.popc = false
+	if p.nest == 0 {
+		p.expr = false
+	}
+
+	n := len(p.blocks)
+	p.names = p.region == DATASET && n >= 2 && p.blocks[n-1]
+	p.expname = true
+}
+
+func (p *printer) emit(tok Token, lit string) {
+	p.start()
+	if p.names {
+		if tok == IDENT && p.expname {
+			p.expname = false
+		} else if tok == COMMA && !p.expname {
+			p.expname = true
+		} else {
+			if !p.expname {
+				p.cur.sep = len(p.cur.text)
+			}
+
+			p.names = false
+		}
+	}
+
+	opc := p.opc
+	p.opc = false
+	if p.space(tok) && !opc && !p.popc {
+		p.write(" ")
+	}
+
+	p.write(lit)
+	p.popc = opc
+	p.unary = (tok == SUB || tok == ADD || tok == NOT) && !operand(p.prev)
+	p.prev = tok
+	switch tok {
+	case LPAREN, LBRACK:
+		p.nest++
+	case RPAREN, RBRACK:
+		if p.nest > 0 {
+			p.nest--
+		}
+	}
+}
+
+// Marks the arithmetic operators printed without spaces around them: all
+// of them in the index expressions, and the ones with the highest
+// precedence in the expressions mixing precedences, like 2*N + 1.
+func markCompact(toks []ptoken) {
+	type expr struct {
+		ops	[]int
+		index	bool
+	}
+
+	var stack []*expr
+
+	e := new(expr)
+	done := func() {
+		maxp, mixed := 0, false
+		for _, i := range e.ops {
+			p := toks[i].tok.Precedence()
+			if maxp != 0 && p != maxp {
+				mixed = true
+			}
+
+			if p > maxp {
+				maxp = p
+			}
+		}
+
+		for _, i := range e.ops {
+			p := toks[i].tok.Precedence()
+			toks[i].compact = p >= ADD.Precedence() && (e.index || (mixed && p == maxp))
+		}
+
+		e.ops = nil
+	}
+
+	prev := ILLEGAL
+	for i := range toks {
+		tok := toks[i].tok
+		switch {
+		case tok == COMMENT:
+			continue
+
+		case tok == LPAREN || tok == LBRACK:
+			stack = append(stack, e)
+			e = &expr{index: tok == LBRACK}
+
+		case tok == RPAREN || tok == RBRACK:
+			done()
+			if len(stack) > 0 {
+				e = stack[len(stack)-1]
+				stack = stack[0:len(stack)-1]
+			}
+
+		case tok == COMMA || tok == ASSIGN || tok == SEMICOLON || tok == LBRACE || tok == RBRACE || tok == COLON || tok > keystart:
+			done()
+
+		case tok.Precedence() > lowestPrec && operand(prev):
+			e.ops = append(e.ops, i)
+		}
+
+		prev = tok
+	}
+
+	done()
+}
+
+// returns true if tok ends an operand of an expression
+func operand(tok Token) bool {
+	switch tok {
+	case IDENT, INT, FLOAT, STRING, RPAREN, RBRACK:
+		return true
+	}
+
+	return false
+}
+
+// returns true if a space is needed between the previous token and tok
+func (p *printer) space(tok Token) bool {
+	prev := p.prev
+	switch {
+	case prev == ILLEGAL || p.unary:
+		return false
+
+	case tok == COMMA || tok == RPAREN || tok == RBRACK || tok == SEMICOLON || tok == COLON || tok == PERIOD:
+		return false
+
+	case prev == LPAREN || prev == LBRACK || prev == COLON || prev == PERIOD:
+		return false
+
+	case tok == LBRACK:
+		// a[i] in expressions and view p[r] in replicas, but var a [i]
+		return prev != RBRACK && (prev != IDENT || (!p.expr && p.nest == 0 && p.region != REPLICA))
+
+	case tok == LPAREN:
+		return prev != IDENT
+
+	case prev == RBRACK:
+		// [N]int32, [i]{ a }
+		return tok != IDENT && tok != STRUCT && tok != LBRACE
+	}
+
+	return true
+}
+
+func (p *printer) write(s string) {
+	p.start()
+	p.cur.text = append(p.cur.text, s...)
+}
+
+func (p *printer) bytes() []byte {
+	// align the types of the consecutive struct fields
+	for i := 0; i < len(p.lines); {
+		j := i
+		maxw := 0
+		for ; j < len(p.lines) && p.lines[j].sep >= 0 && p.lines[j].indent == p.lines[i].indent; j++ {
+			if w := utf8.RuneCount(p.lines[j].text[0:p.lines[j].sep]); w > maxw {
+				maxw = w
+			}
+		}
+
+		if j == i {
+			i++
+			continue
+		}
+
+		col := (maxw / 8 + 1) * 8
+		for ; i < j; i++ {
+			l := p.lines[i]
+			w := utf8.RuneCount(l.text[0:l.sep])
+			text := append([]byte{}, l.text[0:l.sep]...)
+			text = append(text, strings.Repeat("\t", col / 8 - w / 8)...)
+			l.text = append(text, bytes.TrimLeft(l.text[l.sep:], " ")...)
+		}
+	}
+
+	var b bytes.Buffer
+	for _, l := range p.lines {
+		if len(l.text) > 0 {
+			b.WriteString(strings.Repeat("\t", l.indent))
+			b.Write(l.text)
+		}
+
+		b.WriteByte('\n')
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		src	string
+		want	string
+	}{
+		// indentation, spaces and struct field alignment
+		{"dataset{\nconst N=10\ntype s struct{a int32;bcd,e float64\n}\nvar a[N*2+1]int32\n}\n",
+			"dataset {\n\tconst N = 10\n\ttype s struct {\n\t\ta\tint32\n\t\tbcd, e\tfloat64\n\t}\n\tvar a [N*2+1]int32\n}\n"},
+		{"view p(r of R) zorder convert(wrap) {var x tiled(2,2) [i,j]=m[i,j]}\n",
+			"view p(r of R) zorder convert(wrap) {\n\tvar x tiled(2, 2) [i, j] = m[i, j]\n}\n"},
+		{"replica r1 \"r1\" { view v; view p[ 2 ] }\n",
+			"replica r1 \"r1\" {\n\tview v\n\tview p[2]\n}\n"},
+		{"view v { var y [ i ] {a;b}=b[i] where i<2 }\n",
+			"view v {\n\tvar y [i]{ a; b } = b[i] where i < 2\n}\n"},
+
+		// comments and blank lines are kept
+		{"// header\n\ndataset {\n\tconst N = 10 // size\n\n\t/* the\n   data */\n\tvar a [N]int32\n}\n",
+			"// header\n\ndataset {\n\tconst N = 10\t// size\n\n\t/* the\n   data */\n\tvar a [N]int32\n}\n"},
+		{"view v { // odd values\nvar x [i] = a[2 * i + 1] /* inline */\n}\n",
+			"view v {\t// odd values\n\tvar x [i] = a[2*i+1] /* inline */\n}\n"},
+
+		// legacy flags and types
+		{"view v rowminor default {\n\tvar x [i] = a[i]\n}\n",
+			"view v columnmajor default {\n\tvar x [i] = a[i]\n}\n"},
+		{"dataset {\n\tvar n string8\n}\n",
+			"dataset {\n\tvar n [9]int8\n}\n"},
+	}
+
+	for _, test := range tests {
+		got, err := Format("test.drepl", []byte(test.src))
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+
+		if string(got) != test.want {
+			t.Errorf("%s: got\n%s\nexpecting\n%s", test.src, got, test.want)
+			continue
+		}
+
+		// formatting again doesn't change the result
+		again, err := Format("test.drepl", got)
+		if err != nil {
+			t.Errorf("%s: %v", test.want, err)
+		} else if string(again) != string(got) {
+			t.Errorf("%s: not idempotent, got\n%s", test.want, again)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := map[string] string{
+		"dataset {\n\tvar a [4]int32\n": "{ not closed",
+		"view v { var x [i] = a[i) }": "unexpected )",
+		"dataset { var a [4]int32 }}": "unexpected }",
+	}
+
+	for src, msg := range tests {
+		_, err := Format("test.drepl", []byte(src))
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: got error %v, expecting %q", src, err, msg)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReductions(t *testing.T) {
+	runViewTests(t, []viewTest{
+		{"view v { var x [i] = sum(a[2*i:2*i+2]) }", map[string] []int32{"v": {1, 5, 9, 13, 17}}},
+		{"view v { var x [i] = min(m[i, 0:M]) }", map[string] []int32{"v": {10, 14, 18, 22}}},
+		{"view v { var x [j] = max(m[0:M, j]) }", map[string] []int32{"v": {22, 23, 24, 25}}},
+		{"view v { var x [i] = sum(m[i, 0:M:2]) }", map[string] []int32{"v": {22, 30, 38, 46}}},
+
+		// the last window has only a[9]
+		{"view v { var x [i] = mean(a[3*i:3*i+3]) where i < 4 }", map[string] []int32{"v": {1, 4, 7, 9}}},
+
+		// the mean of integers is rounded: 0.5, 3.5, 6.5 and 9
+		{"view v { var x [i] = mean(a[3*i:3*i+2]) where i < 4 }", map[string] []int32{"v": {1, 4, 7, 9}}},
+		{"view v { var x [i, j] = mean(m[2*i:2*i+2, 2*j:2*j+2]) }", map[string] []int32{"v": {13, 15, 21, 23}}},
+
+		// no element of the windows is in the array
+		{"view v { var x [i] = sum(a[2*i+10:2*i+12]) where i < 3 }", map[string] []int32{"v": {0, 0, 0}}},
+	})
+
+	runErrorTests(t, map[string] string{
+		"view v { var x [i] = sum(a[i:i]) where i < 3 }": "window 0 is empty",
+		"view v { var x [i] = avg(a[2*i:2*i+2]) }": "unknown aggregation function 'avg', expecting mean, min, max or sum",
+		"view v { var x [i] = sum(a[i]) }": "the reduced variable needs a window",
+		"view v default { var x [i] = sum(a[2*i:2*i+2]) }": "default view 'v' can't reduce the elements",
+	})
+
+	// the reduced values can't be written, the tools don't write
+	// readonly views
+	checkReadonly(t, "view v { var x [i] = sum(a[2*i:2*i+2]) }")
+	checkReadonly(t, "view v { var x [i] = sum(a[2*i:2*i+2]) }\n" + `replica r2 "r2" { view v }`)
+}
+
+// the mean of floating point values isn't rounded
+func TestReduceFloat(t *testing.T) {
+	const src = `
+dataset {
+	var f [5]float64
+}
+
+view dv default {
+	var f [i] = f[i]
+}
+
+view v {
+	var x [i] = mean(f[2*i:2*i+2])
+	var y [i] = max(f[2*i:2*i+2])
+}
+
+replica r1 "r1" {
+	view dv
+}
+`
+	vs := viewMap(t, src)
+	data := make([]byte, 40)
+	for i, x := range []float64{1, 2, 3.5, -4, 7} {
+		putFloat64(data[8*i:], x)
+	}
+
+	if err := writeData(vs["dv"], data); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := readData(vs["v"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []float64
+	for ; len(data) >= 8; data = data[8:] {
+		got = append(got, getFloat64(data))
+	}
+
+	want := []float64{1.5, -0.25, 7, 2, 3.5, 7}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, expecting %v", got, want)
+	}
+}
+
+// the materialized reductions are updated when the source is written
+func TestReduceUpdate(t *testing.T) {
+	views, errs := createViews(t, "view v { var x [i] = sum(a[2*i:2*i+2]) }\n" + `replica r2 "r2" { view v }`)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	dv, v := views[0], views[1]
+	if err := writeValues(dv); err != nil {
+		t.Fatal(err)
+	}
+
+	checkValues(t, v, []int32{1, 5, 9, 13, 17})
+	writeElem(t, dv, 0, 3, 100)
+	checkValues(t, v, []int32{1, 102, 9, 13, 17})
+}
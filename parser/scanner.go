@@ -31,6 +31,8 @@ const (
 	MUL		// *
 	QUO		// /
 	REM		// %
+	SHL		// <<
+	SHR		// >>
 
 	LPAREN		// (
 	LBRACE		// {
@@ -41,6 +43,7 @@ const (
 	COMMA		// ,
 	SEMICOLON	// ;
 	COLON		// :
+	PERIOD		// .
 	ASSIGN		// =
 
 	NOT		// !
@@ -48,6 +51,10 @@ const (
 	EQL		// ==
 	AND		// &&
 	OR		// ||
+	LSS		// <
+	GTR		// >
+	LEQ		// <=
+	GEQ		// >=
 	opend
 
 	// keywords
@@ -64,9 +71,112 @@ const (
 	READONLY
 	ROWMAJOR
 	COLMAJOR
+	ZORDER
+	HILBERT
+	TILED
+	ORDER
+	BIGENDIAN
+	LITTLEENDIAN
+	PACKED
+	ALIGN
+	CONVERT
+	WHERE
 	keyend
 )
 
+var tokens = [...]string {
+	ILLEGAL:	"ILLEGAL",
+	EOF:		"EOF",
+	COMMENT:	"COMMENT",
+
+	IDENT:		"IDENT",
+	INT:		"INT",
+	FLOAT:		"FLOAT",
+	STRING:		"STRING",
+
+	ADD:		"+",
+	SUB:		"-",
+	MUL:		"*",
+	QUO:		"/",
+	REM:		"%",
+	SHL:		"<<",
+	SHR:		">>",
+
+	LPAREN:		"(",
+	LBRACE:		"{",
+	LBRACK:		"[",
+	RPAREN:		")",
+	RBRACE:		"}",
+	RBRACK:		"]",
+	COMMA:		",",
+	SEMICOLON:	";",
+	COLON:		":",
+	PERIOD:		".",
+	ASSIGN:		"=",
+
+	NOT:		"!",
+	NEQ:		"!=",
+	EQL:		"==",
+	AND:		"&&",
+	OR:		"||",
+	LSS:		"<",
+	GTR:		">",
+	LEQ:		"<=",
+	GEQ:		">=",
+
+	COMPLETE:	"complete",
+	CONST:		"const",
+	DATASET:	"dataset",
+	DEFAULT:	"default",
+	REPLICA:	"replica",
+	STRUCT:		"struct",
+	TYPE:		"type",
+	VAR:		"var",
+	VIEW:		"view",
+	READONLY:	"readonly",
+	ROWMAJOR:	"rowmajor",
+	COLMAJOR:	"columnmajor",
+	ZORDER:		"zorder",
+	HILBERT:	"hilbert",
+	TILED:		"tiled",
+	ORDER:		"order",
+	BIGENDIAN:	"bigendian",
+	LITTLEENDIAN:	"littleendian",
+	PACKED:		"packed",
+	ALIGN:		"align",
+	CONVERT:	"convert",
+	WHERE:		"where",
+}
+
+func (tok Token) String() string {
+	if tok >= 0 && int(tok) < len(tokens) && tokens[tok] != "" {
+		return tokens[tok]
+	}
+
+	return fmt.Sprintf("token(%d)", int(tok))
+}
+
+const lowestPrec = 0	// non-operators
+
+// Returns the precedence of the binary operator tok, or lowestPrec if
+// tok is not a binary operator.
+func (tok Token) Precedence() int {
+	switch tok {
+	case OR:
+		return 1
+	case AND:
+		return 2
+	case EQL, NEQ, LSS, LEQ, GTR, GEQ:
+		return 3
+	case ADD, SUB:
+		return 4
+	case MUL, QUO, REM, SHL, SHR:
+		return 5
+	}
+
+	return lowestPrec
+}
+
 const ( // scanner modes
 	ScanComments	= 1<< iota
 	InsertSemis
@@ -87,11 +197,28 @@ var keywords = map[string] Token {
 	"view":		VIEW,
 }
 
+// Words scanned as identifiers that are keywords only where the parser
+// expects a flag or an annotation, so they can still name variables,
+// types and fields.
+var contextKeywords = map[string] Token {
+	"align":	ALIGN,
+	"bigendian":	BIGENDIAN,
+	"convert":	CONVERT,
+	"hilbert":	HILBERT,
+	"littleendian":	LITTLEENDIAN,
+	"order":	ORDER,
+	"packed":	PACKED,
+	"tiled":	TILED,
+	"where":	WHERE,
+	"zorder":	ZORDER,
+}
+
 type Pos struct {
 	fname		string		// name of the file
 	data		[]byte		// content of the file
 	offset		int
 	line		int
+	col		int		// column, in characters, starting at 1
 }
 
 type Scanner struct {
@@ -121,13 +248,11 @@ func (s *Scanner) nextChar() {
 	p := s.rdpos
 //	log.Println("nextChar start offset", p.offset, "len", len(p.data))
 	if p.offset >= len(p.data) {
+		// the literal of the last token ends at the end of the file
 		p.offset = len(p.data)
+		s.pos = p
 		s.c = -1
-		s.fnum--
 //		log.Println("EOF offset", p.offset, "len", len(p.data), "fnum", s.fnum)
-		if s.fnum > 0 {
-			s.rdpos = s.fstack[s.fnum]
-		}
 
 		return
 	}
@@ -135,7 +260,9 @@ func (s *Scanner) nextChar() {
 	s.pos = p
 	if s.c == '\n' {
 		s.pos.line++
+		s.pos.col = 1
 		s.rdpos.line++
+		s.rdpos.col = 1
 	}
 
 	r, w := rune(p.data[p.offset]), 1
@@ -150,6 +277,7 @@ func (s *Scanner) nextChar() {
 	}
 
 	s.rdpos.offset += w
+	s.rdpos.col++
 	s.c = r
 //	log.Println("nextChar", s.c)
 }
@@ -160,14 +288,40 @@ func (s *Scanner) PushFile(fname string, data []byte) {
 		return
 	}
 
+	// where to continue when the file ends, the current character is
+	// scanned again then
+	if s.fnum > 0 {
+		if s.c < 0 {
+			s.fstack[s.fnum-1] = s.rdpos
+		} else {
+			s.fstack[s.fnum-1] = s.pos
+		}
+	}
+
 	p := &s.fstack[s.fnum]
 	p.fname = fname
 	p.data = data
 	p.offset = 0
 	p.line = 1
+	p.col = 1
 
 	s.fnum++
 	s.rdpos = *p
+	s.c = ' '
+	s.insertSemi = false
+}
+
+// At the end of an included file continues with the including one. The
+// EOF of the included file is still returned, so the parser knows where
+// the included declarations end.
+func (s *Scanner) popFile() {
+	if s.fnum <= 1 {
+		return
+	}
+
+	s.fnum--
+	s.rdpos = s.fstack[s.fnum-1]
+	s.c = ' '
 }
 
 func NewScanner(fname string, data []byte, err ErrorHandler, mode uint) *Scanner {
@@ -207,6 +361,7 @@ func (s *Scanner) scanIdentifier() Token {
 func (s *Scanner) scanComment() Token {
 	pos := s.pos
 	pos.offset--				// offset of the initial slash
+	pos.col--
 	if s.c == '/' {
 		if s.insertSemi {
 			goto semi
@@ -241,6 +396,7 @@ semi:
 	s.pos = pos
 	s.rdpos = pos
 	s.rdpos.offset++
+	s.rdpos.col++
 	s.c = '/'
 	s.insertSemi = false
 	return SEMICOLON
@@ -291,6 +447,7 @@ func (s *Scanner) scanEscape() {
 func (s *Scanner) scanString() {
 	pos := s.pos
 	pos.offset--	// opening quote already scanned
+	pos.col--
 
 	for s.c != '"' {
 		c := s.c
@@ -344,6 +501,7 @@ again:
 			}
 
 			tok = EOF
+			s.popFile()
 
 		case '\n':
 			s.insertSemi = false
@@ -354,21 +512,21 @@ again:
 			tok = STRING
 			s.scanString()
 
-		case '.', '-', '+':
+		case '.':
 			if isDigit(s.c) {
 				insertSemi = true
-				tok = s.scanNumber(c == '.')
+				tok = s.scanNumber(true)
 			} else {
-				switch c {
-				default:
-					s.error(&pos, fmt.Sprintf("illegal character '%v'", s.c))
-				case '-':
-					tok = SUB
-				case '+':
-					tok = ADD
-				}
+				tok = PERIOD
 			}
 
+		case '-':
+			// the sign is not part of the number, so a-1 is a
+			// subtraction; negative literals are unary minus
+			tok = SUB
+		case '+':
+			tok = ADD
+
 		case '/':
 			if s.c=='/' || s.c=='*' {
 				tok = s.scanComment()
@@ -407,7 +565,6 @@ again:
 		case ',':
 			tok = COMMA
 		case '&':
-			s.nextChar()
 			if s.c=='&' {
 				tok = AND
 				s.nextChar()
@@ -428,6 +585,28 @@ again:
 			} else {
 				tok = NOT
 			}
+		case '<':
+			switch s.c {
+			case '<':
+				tok = SHL
+				s.nextChar()
+			case '=':
+				tok = LEQ
+				s.nextChar()
+			default:
+				tok = LSS
+			}
+		case '>':
+			switch s.c {
+			case '>':
+				tok = SHR
+				s.nextChar()
+			case '=':
+				tok = GEQ
+				s.nextChar()
+			default:
+				tok = GTR
+			}
 		case '=':
 			if s.c != '=' {
 				tok = ASSIGN
@@ -450,5 +629,29 @@ again:
 }
 
 func (p *Pos) String() string {
-	return fmt.Sprintf("%s:%d:", p.fname, p.line)
+	if p.col == 0 {
+		return fmt.Sprintf("%s:%d:", p.fname, p.line)
+	}
+
+	return fmt.Sprintf("%s:%d:%d:", p.fname, p.line, p.col)
+}
+
+// returns the source line the position is in, or nil if the position
+// doesn't have the file content
+func (p *Pos) source() []byte {
+	if p.data == nil || p.offset > len(p.data) {
+		return nil
+	}
+
+	start := p.offset
+	for start > 0 && p.data[start-1] != '\n' {
+		start--
+	}
+
+	end := p.offset
+	for end < len(p.data) && p.data[end] != '\n' {
+		end++
+	}
+
+	return p.data[start:end]
 }
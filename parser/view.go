@@ -1,23 +1,28 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"drepl/ast"
 	"drepl/drepl"
 )
 
-/* const (
-	// view flags
-	Vrowmajor,				// multi-dimensional arrays are row-major
-	Vcolmajor,				// multi-dimensional arrays are column-major
-	Vhilbert,				// multi-dimensional array elements are stored in hilbert-curve order
-	Vzorder,				// multi-dimensional array elements are stored in Z curve order
-)*/
-
 const (
-	Vrowmajor = iota
-	Vrowminor
+	// view flags, the lower bits define the element order
+	Vrowmajor = iota			// multi-dimensional arrays are row-major
+	Vrowminor				// multi-dimensional arrays are column-major
+	Vzorder					// multi-dimensional array elements are stored in Z curve order
+	Vhilbert				// multi-dimensional array elements are stored in hilbert-curve order
+	Vtiled					// multi-dimensional arrays are stored tile by tile
+	Vpermuted				// multi-dimensional arrays dimensions are stored in the specified order
 	Vreadonly = 0x40
 	Vdefault = 0x80				// default view to use to read unmaterialized views
+	Vbigendian = 0x100			// primary values are stored big-endian
+	Vlittleendian = 0x200			// primary values are stored little-endian
+	Vpacked = 0x400				// no padding between struct fields
+	Vwrap = 0x800				// numeric values that don't fit are truncated
+	Vexact = 0x1000				// numeric values that don't fit are an error
 )
 
 type VType struct {
@@ -28,13 +33,17 @@ type VType struct {
 	// matrix
 	etype	*VType		// element type
 	dim	[]*Expr		// size for each dimension, can only use constants and temps
+	wrap	[]int64		// modulus of each dimension wrapped with %, 0 if it doesn't wrap
+	win	[]int64		// number of values of each window of a reduction, variables following vidx
 
 	// struct
 	fields	[]*VField
 
 	sz	int64		// size of the type
+	align	int64		// alignment of the type
 	vdim	[]VDim		// description of the slice after process is called
 	vidx	[]EVar		// used while processing expressions, variable for each dimension
+	pv2d	[]drepl.PExpr	// for each dataset dimension, calculates the data index from vidx
 
 	pos	Pos		// position where defined
 }
@@ -45,17 +54,75 @@ type VTemp struct {
 	expr	*Expr		// transformed expression
 	ep	**Expr		// the right-side part in expr
 	ot	*VTemp		// the corresponding temp (same name) on the other side of the definition
-	idx	int		// dimension where the temp is used
+	idx	int		// dimension where the temp is used on the left side
 	min	int64
 	max	int64
+	where	*Expr		// predicate selecting the values of the temp, nil if all are used
+	slice	*VSlice		// slice defining the temp, nil if not defined by one
+	selected bool		// the temp is the number of the value selected by where or slice
+	indexed	bool		// the temp indexes an index array, and has its range
+	broadcast bool		// the temp is only used on the left side, all its values have the same elements
+	window	*VSlice		// window of a reduction the temp goes through, nil if not one
+	count	int64		// number of values selected by where or slice
 	pos	Pos
 }
 
+// lo:hi:step range of a dataset dimension, the expressions are constant
+// and nil if not specified. The bounds of the window of a reduction can
+// use temps.
+type VSlice struct {
+	lo, hi, step *Expr
+
+	// part of the dimension of the rank of a partitioned view, found
+	// when the size of the dimension is known
+	dist	int		// distBlock, distCyclic or distBlockCyclic, 0 for lo:hi:step
+	rank	int64
+	nranks	int64
+	ghost	int64		// cells added on each side of a block
+}
+
+// distributions of a dimension among the ranks of a partitioned view
+const (
+	distBlock = 1 + iota	// a contiguous block for each rank
+	distCyclic		// the values rank, rank + nranks, ...
+	distBlockCyclic		// the blocks rank, rank + nranks, ... (the temp is the block)
+)
+
+// value of the dataset variable used by a value predicate, read from an
+// element of the probe variable
+type VRef struct {
+	EVar
+	path	[]string	// names of the fields, empty for the whole element
+	fidx	[]int		// index of each field in the probe's element type
+}
+
+// index array used on the right side of a view variable, vals[conn[k]]
+// reads the index of the dimension of vals from the element k of conn.
+// The value is an additional variable of the index expressions.
+type VGather struct {
+	EVar
+	ix	*ast.IndexExpr	// the reference, converted once the right side type exists
+	index	[]*Expr		// index expressions of the index array, using the right side temps
+	idx	*VVarDecl	// the index array, indexed with the variable's indices
+	path	[]string	// names of the fields, empty for the whole element
+	fidx	[]int		// index of each field in the index array's element type
+	dims	[]int		// dimensions of the variable that index the index array
+}
+
 type VField struct {
 	name	string
 	vt	*VType
-	f	*Field		// corresponding field in the dataset
+	f	*Field		// corresponding field in the dataset, nil if computed
+	offset	int64		// offset from the beginning of the structure
 	pos	Pos
+	expr	*Expr		// value of a computed field, nil if not computed
+	refs	[]*VFRef	// the other fields used by expr
+}
+
+// field of the same element used in the value of a computed field
+type VFRef struct {
+	EVar
+	f	*VField
 }
 
 type VDim struct {
@@ -66,17 +133,6 @@ type VDim struct {
 	lt	*VTemp		// temp used in the expression
 	le	*Expr		// expression transformed to lt
 	lep	**Expr		// pointer into le
-
-	// right side
-	rt	*VTemp		// temp used in the expression
-	re	*Expr		// expression transformed to rt
-	rep	**Expr		// pointer into re
-
-	// index conversion
-	v2d	*Expr		// expression that uses vidx and calculates the data index
-	d2v	*Expr		// expression that uses didx and calculates the view index
-	pv2d	drepl.PExpr	// same as v2d, but as PExpr
-	pd2v	drepl.PExpr	// same as d2v, but as PExpr
 }
 
 type VVarDecl struct {
@@ -86,19 +142,130 @@ type VVarDecl struct {
 	lt, rt	*VType		// left and right type definitions
 	dim	[]VDim		// dimension stuff
 	blk	drepl.Block
+	order	int		// element order of the arrays, -1 if the view's one
+	elop	[]*Expr		// element order parameters
+	elopv	[]int64		// evaluated element order parameters
+	processed bool		// lt is the processed type
+
+	// value predicates, evaluated by the view's Select, the tools call it
+	// when the view is opened
+	match	*Expr
+	refs	[]*VRef		// the values used by match
+	probe	*VVarDecl	// variable with the values, indexed as this one
+
+	gathers	[]*VGather	// index arrays used on the right side
+	bcast	[]string	// indices only used on the left side, the elements are repeated for each value
+	reduce	int		// aggregation function (drepl.ReduceMean, ...), 0 if the elements aren't reduced
 
 	pos	Pos		// position where defined
 }
 
 type View struct {
 	Name	string
+	pos	Pos
 	flags	int
+	elop	[]*Expr		// element order parameters (tile shape, or permutation)
+	elopv	[]int64		// evaluated element order parameters
 	vars	[] *VVarDecl
 	types	map[string] *VType
 	vmap	map[string] *VVarDecl
 	dv	*drepl.View
 }
 
+// true if the elements of some of the view's variables are selected by
+// their values
+func (vw *View) filtered() bool {
+	for _, v := range vw.vars {
+		if v.probe != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// true if some of the view's variables use index arrays
+func (vw *View) gathered() bool {
+	for _, v := range vw.vars {
+		if v.gathers != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// true if some of the view's variables repeat the elements for the
+// indices that are only on the left side, the view can't be written
+func (vw *View) broadcast() bool {
+	for _, v := range vw.vars {
+		if v.bcast != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// true if some of the view's variables reduce the elements over windows
+func (vw *View) reduced() bool {
+	for _, v := range vw.vars {
+		if v.reduce != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// true if some of the view's variables have structures with computed
+// fields
+func (vw *View) computed() bool {
+	for _, v := range vw.vars {
+		if v.lt.computed() || v.rt.computed() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// true if the type has structures with computed fields
+func (t *VType) computed() bool {
+	switch {
+	case t == nil:
+		return false
+	case t.etype != nil:
+		return t.etype.computed()
+	}
+
+	for _, f := range t.fields {
+		if f.expr != nil || f.vt.computed() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the temps going through the windows of the reduction, in the
+// order of the dimensions of the right side
+func (v *VVarDecl) window() (ws []*VTemp) {
+	if v.rt == nil {
+		return nil
+	}
+
+	for _, e := range v.rt.dim {
+		for _, t := range findTemps(e, nil) {
+			if t.window != nil && !usesTemp(ws, t) {
+				ws = append(ws, t)
+			}
+		}
+	}
+
+	return ws
+}
+
 func NewView(name string, flags int) *View {
 	v := new(View)
 	v.Name = name
@@ -158,6 +325,7 @@ func (vw *View) createVarDecl(name string, pos *Pos) (*VVarDecl, bool) {
 
 	v := new(VVarDecl)
 	v.name = name
+	v.order = -1
 	vw.setPos(&v.pos, pos)
 	vw.vmap[name] = v
 	vw.vars = append(vw.vars, v)
@@ -218,148 +386,156 @@ func (t *VType) createTemp(name string, pos *Pos) (*VTemp, bool) {
 	return tmp, true
 }
 
-func processVArray(lt, rt *VType, dt *Type) (err string) {
+func processVArray(lt, rt *VType, dt *Type, packed bool) (err string) {
 	var vt, retype *VType
 
 //	fmt.Printf("processVArray lt %p rt %p dt %p\n", lt, rt, dt)
-	if rt!=nil && lt!=nil && len(rt.dim) != len(lt.dim) {
-		return "left and right types don't match"
+	if rt==nil {
+		// no right side, the whole array is used
+		rt = new(VType)
+		rt.dim = make([]*Expr, len(lt.dim))
 	}
 
-	if dt.dimnum != len(lt.dim) {
-//		for i, e := range lt.dim {
+	if dt.dimnum != len(rt.dim) {
+//		for i, e := range rt.dim {
 //			fmt.Printf("%d %v\n", i, e)
 //		}
 
-		return fmt.Sprintf("view and data types don't match: vdim %d, dim %d", len(lt.dim), dt.dimnum)
-	}
-
-	if rt!=nil {
-		retype = rt.etype
+		return fmt.Sprintf("view and data types don't match: vdim %d, dim %d", len(rt.dim), dt.dimnum)
 	}
 
-	vt, err = processVType(lt.etype, retype, dt.etype)
+	retype = rt.etype
+	vt, err = processVType(lt.etype, retype, dt.etype, packed)
 	if err!="" {
 		return err
 	}
 
 	lt.etype = vt
-	dim := make([]VDim, len(rt.dim))
-	vidx := make([]EVar, len(rt.dim))
-	for i := 0; i < len(dim); i++ {
-		// first transform the expressions on the right side so we can find the ranges for the temps
-		var n interface{}
 
-		vidx[i].name = fmt.Sprintf("v%d", i)
+	// empty dimensions on both sides use the whole dimension
+	for i, e := range rt.dim {
+		if e != nil {
+			continue
+		}
 
-		ev, ne, ep, err := rt.dim[i].transform()
-		if err != "" {
-			return err
+		if i >= len(lt.dim) || lt.dim[i] != nil {
+			return fmt.Sprintf("empty dimension on the right side should correspond to empty expression on the left side: lt %p", lt)
 		}
 
-		if ev==nil {
-			// constant or empty expression
-			dim[i].min = 0
-			if rt.dim[i] == nil {
-				if lt!=nil && lt.dim[i]!=nil {
-					return fmt.Sprintf("empty dimension on the right side should correspond to empty expression on the left side: lt %p", lt)
-				}
+		if lt.temps == nil {
+			lt.temps = make(map[string] *VTemp)
+		}
 
-				ltmp := new(VTemp)
-				rtmp := new(VTemp)
-				ltmp.ot = rtmp
-				rtmp.ot = ltmp
-				ltmp.min = 0
-				ltmp.max = int64(dt.dim[i])
-				rtmp.min = ltmp.min
-				rtmp.max = ltmp.max
-				ltmp.idx = i
-				rtmp.idx = i
-				dim[i].max = ltmp.max
-
-				dim[i].re = nil
-				dim[i].rt = rtmp
-				dim[i].rep = nil
-
-				lt.dim[i] = VarExpr(&ltmp.EVar)
-				rt.dim[i] = VarExpr(&rtmp.EVar)
-
-				dim[i].le = nil				
-				dim[i].lt = ltmp
-				dim[i].lep = nil
-			} else {
-				dim[i].max = 1
+		if rt.temps == nil {
+			rt.temps = make(map[string] *VTemp)
+		}
+
+		name := fmt.Sprintf("[%d]", i)
+		ltmp, _ := lt.createTemp(name, &lt.pos)
+		rtmp, _ := rt.createTemp(name, &rt.pos)
+		lt.dim[i] = VarExpr(&ltmp.EVar)
+		rt.dim[i] = VarExpr(&rtmp.EVar)
+	}
+
+	if err = wrapDims(rt, dt); err != "" {
+		return err
+	}
+
+	// the temps defined by slices or with where predicates become the
+	// numbers of the selected values, before they are used
+	for i, e := range rt.dim {
+		for _, t := range findTemps(e, nil) {
+			if err = windowTemp(t, int64(dt.dim[i])); err != "" {
+				return err
 			}
+		}
 
+		if err = sliceTemp(rt, e, int64(dt.dim[i])); err != "" {
+			return err
+		}
+
+		if len(findTemps(e, nil)) > 1 {
 			continue
 		}
 
-		t, ok := ev.aux.(*VTemp)
-		if !ok {
-			return "expression variable not a temp"
+		if rt.wrap[i] != 0 {
+			err = selectWrapped(rt, e, rt.wrap[i])
+		} else {
+			err = selectTemp(rt, e, int64(dt.dim[i]))
 		}
 
-		dim[i].re = ne
-		dim[i].rep = ep
-		dim[i].rt = t
+		if err != "" {
+			return err
+		}
+	}
 
-		t.expr = ne
-		t.ep = ep
-		t.idx = i
-		if ep!=nil {
-			re := new(Expr)
-			re.val = int64(0)
-			*ep = re
-			n, err = ne.eval()
-			if err != "" {
-				return err
+	for i, e := range rt.dim {
+		if len(findTemps(e, nil)) < 2 {
+			continue
+		}
+
+		if err = selectTemp(rt, e, int64(dt.dim[i])); err != "" {
+			return err
+		}
+	}
+
+	for _, t := range rt.temps {
+		t.ot = nil
+	}
+
+	// the temps on the right side, in order
+	var rtemps []*VTemp
+	var gs []*VGather
+	for _, e := range rt.dim {
+		rtemps = findTemps(e, rtemps)
+		gs = findGathers(e, gs)
+	}
+
+	// the temps indexing the index arrays (already processed) get
+	// their ranges
+	for _, g := range gs {
+		for _, t := range gatherTemps(g, nil) {
+			it := g.idx.lt.temps[t.name]
+			t.min = it.min
+			t.max = it.max
+			t.indexed = true
+			if !usesTemp(rtemps, t) {
+				rtemps = append(rtemps, t)
 			}
+		}
+	}
 
-			if nn, ok :=n.(int64); !ok {
-				return fmt.Sprintf("expected int64, got: %v", n)
-			} else {
-				t.min = nn
+	// the indices only used on the left side get their range from
+	// where
+	for _, e := range lt.dim {
+		for _, t := range findTemps(e, nil) {
+			bt := rt.temps[t.name]
+			if bt == nil || !bt.broadcast || usesTemp(rtemps, bt) {
+				continue
 			}
 
-			re.val = int64(dt.dim[i])
-			n, err = ne.eval()
-			if err != "" {
+			if err = broadcastTemp(bt); err != "" {
 				return err
 			}
 
-			*ep = nil
-			if nn, ok :=n.(int64); !ok {
-				return fmt.Sprintf("expected int64, got: %v", n)
-			} else {
-				t.max = nn
-			}
-		} else {
-			t.min = 0
-			t.max = int64(dt.dim[i])
+			rtemps = append(rtemps, bt)
 		}
+	}
 
-		if t.min > t.max {
-			n := t.min
-			t.min = t.max
-			t.max = n
-		}
+	if err = tempRanges(rt, rtemps, dt); err != "" {
+		return err
+	}
 
-		if lt==nil || lt.dim[i]==nil {
+	dim := make([]VDim, len(lt.dim))
+	vidx := make([]EVar, len(lt.dim))
+	for i := 0; i < len(dim); i++ {
+		vidx[i].name = fmt.Sprintf("v%d", i)
+		if lt.dim[i] == nil {
 			return "left index expression empty while right isn't"
 		}
 
-		// temp vars in the left and right types are different
-		ltmp := lt.temps[t.name]
-		if ltmp != nil {
-			// connect both temps
-			t.ot = ltmp
-			ltmp.ot = t
-			ltmp.min = t.min
-			ltmp.max = t.max
-		}
-
 		// transform the expression on the left side
-		ev, ne, ep, err = lt.dim[i].transform()
+		ev, ne, ep, err := lt.dim[i].transform()
 		if err != "" {
 			return err
 		}
@@ -371,17 +547,42 @@ func processVArray(lt, rt *VType, dt *Type) (err string) {
 			continue
 		}
 
-		t, ok = ev.aux.(*VTemp)
+		t, ok := ev.aux.(*VTemp)
 		if !ok {
 			return "expression variable not a temp"
 		}
 
+		// temp vars in the left and right types are different
+		rtmp := rt.temps[t.name]
+		if rtmp == nil || !usesTemp(rtemps, rtmp) {
+			return fmt.Sprintf("index '%s' isn't used on the right side", t.name)
+		}
+
+		if rtmp.ot != nil {
+			return fmt.Sprintf("index '%s' is used more than once on the left side", t.name)
+		}
+
+		// connect both temps
+		rtmp.ot = t
+		t.ot = rtmp
+		t.min = rtmp.min
+		t.max = rtmp.max
+		t.idx = i
+		t.expr = ne
+		t.ep = ep
 		dim[i].le = ne
 		dim[i].lep = ep
 		dim[i].lt = t
-		t.expr = ne
-		t.ep = ep
-		t.idx = i
+	}
+
+	// the windows of a reduction follow the view indices
+	var wins []*VTemp
+	for _, t := range rtemps {
+		if t.window != nil {
+			wins = append(wins, t)
+		} else if t.ot == nil {
+			return fmt.Sprintf("index '%s' isn't used on the left side", t.name)
+		}
 	}
 
 	for i := 0; i < len(dim); i++ {
@@ -390,32 +591,29 @@ func processVArray(lt, rt *VType, dt *Type) (err string) {
 		// evaluate the min and max values for the dimension, using
 		// the min and the max values for the temp (FIX)
 		t := d.lt
+		if t == nil {
+			continue
+		}
 
 		var nn, xx int64
 		
-		if lt!=nil && lt.dim[i]!=nil {
-			t.val = t.min
-			n, err := lt.dim[i].eval()
-			if err != "" {
-				return err
-			}
-
-			var x interface{}
-			t.val = t.max
-			x, err = lt.dim[i].eval()
-			if err != "" {
-				return err
-			}
-
-			t.val = nil
+		t.val = t.min
+		n, err := lt.dim[i].eval()
+		if err != "" {
+			return err
+		}
 
-			nn = n.(int64)
-			xx = x.(int64)
-		} else {
-			nn = 0
-			xx = int64(dt.dim[i])
+		var x interface{}
+		t.val = t.max
+		x, err = lt.dim[i].eval()
+		if err != "" {
+			return err
 		}
 
+		t.val = nil
+
+		nn = n.(int64)
+		xx = x.(int64)
 		if nn > xx {
 			tt := nn
 			nn = xx
@@ -428,40 +626,64 @@ func processVArray(lt, rt *VType, dt *Type) (err string) {
 
 		d.min = nn
 		d.max = xx
+	}
 
-		// create the conversion expressions
-		ve := new(Expr)
-		ridx := d.lt.ot.idx
-		ve.val = &dt.vidx[ridx]
-		e, ep := dim[ridx].rt.expr.clone(dim[ridx].rt.ep)
-		if ep!=nil {
-			*ep = ve
-		} else {
-			e = ve
-		}
+	// create the conversion expressions, the temps on the right side are
+	// replaced by the inverse of the left side expressions, applied to the
+	// view indices
+	vars := make([]*EVar, len(vidx))
+	for i := range vidx {
+		vars[i] = &vidx[i]
+	}
 
-		d.d2v, _ = lt.dim[i].clone(nil)
-		d.d2v, _ = d.d2v.replace(&d.lt.EVar, e)
+	var win []int64
+	for _, t := range wins {
+		vars = append(vars, &t.EVar)
+		win = append(win, t.max - t.min)
+	}
 
-		ve = new(Expr)
-		lidx := d.rt.ot.idx
-		ve.val = &vidx[lidx]
-		e, ep = dim[lidx].lt.expr.clone(dim[lidx].lt.ep)
-		if ep!=nil {
-			*ep = ve
-		} else {
-			e = ve
-		}
+	// the values of the index arrays follow the view indices and the
+	// windows
+	for _, g := range gs {
+		vars = append(vars, &g.EVar)
+	}
+
+	pv2d := make([]drepl.PExpr, len(rt.dim))
+	for n, re := range rt.dim {
+		v2d, _ := re.clone(nil)
+		for _, t := range findTemps(re, nil) {
+			if t.window != nil {
+				// a variable itself, starting from 0
+				continue
+			}
+
+			ltmp := t.ot
+			ve := VarExpr(&vidx[ltmp.idx])
+			if min := dim[ltmp.idx].min; min != 0 {
+				// the view indices start from the minimum
+				ve = AddExpr(ve, ConstInt64Expr(min))
+			}
+
+			e, ep := ltmp.expr.clone(ltmp.ep)
+			if ep!=nil {
+				*ep = ve
+			} else {
+				e = ve
+			}
 
-		d.v2d, _ = rt.dim[i].clone(nil)
-		d.v2d, _ = d.v2d.replace(&d.rt.EVar, e)
+			v2d = v2d.subst(&t.EVar, e)
+		}
 
-		if !d.d2v.toPExpr(&d.pd2v, dt.vidx) {
-			return fmt.Sprintf("can't convert %v to PExpr\n", d.d2v)
+		if err := v2d.toPExpr(&pv2d[n], vars); err != "" {
+			return fmt.Sprintf("can't convert %v to PExpr: %s", v2d, err)
 		}
 
-		if !d.v2d.toPExpr(&d.pv2d, vidx) {
-			return fmt.Sprintf("can't convert %v to PExpr\n", d.v2d)
+		if m := rt.wrap[n]; m != 0 {
+			if pv2d[n].C != 0 {
+				return fmt.Sprintf("a wrapped index can't be divided by an index: %v", re)
+			}
+
+			pv2d[n].M = m
 		}
 	}
 
@@ -472,104 +694,1083 @@ func processVArray(lt, rt *VType, dt *Type) (err string) {
 	}
 	fmt.Printf("]\n")
 
-	for i := 0; i < len(dim); i++ {
-		fmt.Printf("%d d2v %v\n", i, dim[i].d2v)
-		fmt.Printf("%d v2d %v\n", i, dim[i].v2d)
+	for i := 0; i < len(pv2d); i++ {
+		fmt.Printf("%d v2d %v\n", i, pv2d[i])
 	}
 */
 
+	if dt.dim[0] == 0 {
+		// the view's first dimension grows with the unlimited one
+		if len(dim) == 0 || dim[0].min != 0 || !isIdentity(&pv2d[0], 0) {
+			return "unlimited dimension has to be the first dimension of the view, indexed directly"
+		}
+
+		for _, p := range pv2d[1:] {
+			if p.Xidx == 0 && (p.A != 0 || p.C != 0) {
+				return "unlimited dimension has to be the first dimension of the view, indexed directly"
+			}
+		}
+	}
+
+	// the indices of a block-cyclic distribution are found going
+	// through the blocks of the rank
+	cyclic := false
+	for _, t := range rtemps {
+		if t.slice != nil && t.slice.dist == distBlockCyclic {
+			cyclic = true
+		}
+	}
+
+	if gs == nil && wins == nil && !cyclic && !drepl.Invertible(pv2d, len(dim)) {
+		return "the view indices can't be calculated from the dataset indices, each has to be the only unknown index of some dimension"
+	}
+
+	for _, g := range gs {
+		if err = g.connect(dim); err != "" {
+			return err
+		}
+	}
+
+	if err = checkDivisions(dt, pv2d); err != "" {
+		return err
+	}
+
 	sz := int64(1)
 	for i := 0; i < len(dim); i++ {
 		sz *= (dim[i].max - dim[i].min)
 	}
 
 	lt.sz = sz * lt.etype.sz
+	lt.align = lt.etype.align
 	lt.vdim = dim
 	lt.vidx = vidx
+	lt.pv2d = pv2d
+	lt.win = win
 
 	return err
 }
 
-func processVStruct(lt, rt *VType, dt *Type) (err string) {
-	var vt *VType
-
-	if rt!=nil {
-		panic("substruct error")
-	}
-
-	if dt.fields==nil || len(dt.fields)==0 {
-		return fmt.Sprintf("data type needs to be struct: %v", dt.etype)
+// true if the temp t is in ts
+func usesTemp(ts []*VTemp, t *VTemp) bool {
+	for _, tt := range ts {
+		if tt == t {
+			return true
+		}
 	}
 
-	sz := int64(0)
-	for _, vf := range(lt.fields) {
-		var f *Field
+	return false
+}
 
-		s := vf.name
-		for _, df := range(dt.fields) {
-			if s == df.name {
-				f = &df
-				break
-			}
+// Finds the dimensions of the variable that index the index array, the
+// ones using its temps, and checks that they match the array's.
+func (g *VGather) connect(dim []VDim) string {
+	ts := gatherTemps(g, nil)
+	g.dims = nil
+	for i, d := range dim {
+		if d.lt != nil && usesTemp(ts, d.lt.ot) {
+			g.dims = append(g.dims, i)
 		}
+	}
 
-		if f==nil {
-			return fmt.Sprintf("field '%s' not found", s)
-		}
+	vdim := g.idx.lt.vdim
+	if len(vdim) != len(g.dims) {
+		return fmt.Sprintf("the index array '%s' doesn't match the variable's dimensions", g.name)
+	}
 
-		vf.f = f
-		vt, err = processVType(vf.vt, nil, f.t)
-		if err!="" {
-			return ""
+	for i, n := range g.dims {
+		if vdim[i].max - vdim[i].min != dim[n].max - dim[n].min {
+			return fmt.Sprintf("the index array '%s' doesn't match the variable's dimensions", g.name)
 		}
-
-		vf.vt = vt
-		sz += vf.vt.sz
 	}
 
-	lt.sz = sz
 	return ""
 }
 
-func processVType(lt, rt *VType, dt *Type) (vt *VType, err string) {
-	vt = lt
-	if dt!=nil {
-		for dt.dimnum==0 && dt.etype!=nil {
-			// handle type aliases
-			dt = dt.etype
+// Finds the ranges of the temps ts used in the index expressions of the
+// right side type rt, for the dataset array type dt. A temp that is the
+// only one in some dimensions gets the values that keep all of them
+// within the array. A temp that is only used together with others gets
+// all the values for which the index is within the array for some of
+// the values of the others, so the view can have elements that aren't
+// in the dataset. The temps selected by where or a slice are the numbers
+// of the selected values. The wrapped dimensions are always within the
+// array, a temp only used in them goes through a single period.
+func tempRanges(rt *VType, ts []*VTemp, dt *Type) (err string) {
+	var multi []int
+
+	ranged := make(map[*VTemp]bool)
+	for _, t := range ts {
+		if t.selected {
+			// the number of the selected value
+			t.min = 0
+			t.max = t.count
+			ranged[t] = true
+		} else if t.indexed {
+			// the range of the index array
+			ranged[t] = true
 		}
 	}
 
-//	fmt.Printf("processVType lt %p rt %p dt %v\n", lt, rt, dt)
-	if lt==nil {
-		if rt==nil {
-			lt = new(VType)
-			lt.dt = dt
-			lt.sz = dt.size
-			if dt.etype != nil {
-				lt.dim = make([]*Expr, dt.dimnum)
-				rt = new(VType)
-				rt.dim = make([]*Expr, dt.dimnum)
-				err = processVArray(lt, rt, dt)
-			} else if dt.fields != nil {
-				fnames := make([]string, len(dt.fields))
-				for i, f := range dt.fields {
-					fnames[i] = f.name
-				}
-
-				lt.addFields(fnames, nil, &lt.pos)
-				err = processVStruct(lt, rt, dt)
+	for i, e := range rt.dim {
+		tts := findTemps(e, nil)
+		if len(tts) > 1 {
+			if rt.wrap[i] == 0 {
+				multi = append(multi, i)
 			}
 
-			return lt, err
+			continue
 		}
 
-		lt = rt
-		rt = nil
-	}
-
+		if len(tts) == 0 {
+			continue
+		}
+
+		t := tts[0]
+		if rt.wrap[i] != 0 {
+			// all values are within the array, without a
+			// range the temp goes through a single period
+			if !ranged[t] {
+				p, err := wrapPeriod(e, t, rt.wrap[i])
+				if err != "" {
+					return err
+				}
+
+				t.min = 0
+				t.max = p
+				ranged[t] = true
+			}
+
+			continue
+		}
+
+		_, ne, ep, err := e.transform()
+		if err != "" {
+			return err
+		}
+
+		min, max, err := tempRange(&t.EVar, e, ne, ep, int64(dt.dim[i]))
+		if err != "" {
+			return err
+		}
+
+		if ranged[t] {
+			// used in several dimensions, all have to be inside
+			if min < t.min {
+				min = t.min
+			}
+
+			if max > t.max {
+				max = t.max
+			}
+
+			if max < min {
+				max = min
+			}
+		}
+
+		t.min = min
+		t.max = max
+		ranged[t] = true
+	}
+
+	for found := true; found; {
+		found = false
+		for _, i := range multi {
+			var pe drepl.PExpr
+
+			tts := findTemps(rt.dim[i], nil)
+			vars := make([]*EVar, len(tts))
+			var t *VTemp
+			j := -1
+			for k, tt := range tts {
+				vars[k] = &tt.EVar
+				if !ranged[tt] {
+					if t != nil {
+						j = -1
+						break
+					}
+
+					t = tt
+					j = k
+				}
+			}
+
+			if j < 0 {
+				continue
+			}
+
+			if err = rt.dim[i].toPExpr(&pe, vars); err != "" {
+				return err
+			}
+
+			// a*t + rest + b has to be within [0, n*d)
+			var rmin, rmax int64
+			coef := pexprTerms(&pe)
+			for k, tt := range tts {
+				c := coef[k]
+				if k == j || c == 0 {
+					continue
+				}
+
+				x, y := c*tt.min, c*(tt.max - 1)
+				if x > y {
+					x, y = y, x
+				}
+
+				rmin += x
+				rmax += y
+			}
+
+			a := coef[j]
+			if a == 0 {
+				continue
+			}
+
+			lo := -pe.B - rmax
+			hi := int64(dt.dim[i])*pe.D - 1 - pe.B - rmin
+			if a < 0 {
+				a, lo, hi = -a, -hi, -lo
+			}
+
+			t.min = ceilDiv(lo, a)
+			t.max = floorDiv(hi, a) + 1
+			if t.max < t.min {
+				t.max = t.min
+			}
+
+			ranged[t] = true
+			found = true
+		}
+	}
+
+	for _, t := range ts {
+		if !ranged[t] {
+			return fmt.Sprintf("the range of index '%s' can't be found, it has to be the only index of some dimension, or selected by where", t.name)
+		}
+
+		if t.selected {
+			// only the values selected by the where predicate
+			if t.min < 0 {
+				t.min = 0
+			}
+
+			if t.max > t.count {
+				t.max = t.count
+			}
+
+			if t.max < t.min {
+				t.max = t.min
+			}
+		}
+	}
+
+	return ""
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+
+	return q
+}
+
+func ceilDiv(a, b int64) int64 {
+	return -floorDiv(-a, b)
+}
+
+// The indices of the views that combine several indices are composed
+// only if none of the views of the array divides by an index, as that
+// needs more than a PExpr.
+func checkDivisions(dt *Type, pv2d []drepl.PExpr) string {
+	seen := make(map[int]bool)
+	for _, p := range pv2d {
+		switch {
+		case p.C != 0:
+			dt.divided = true
+		case p.Terms != nil || p.M != 0:
+			// the periods of the wrapped indices are
+			// additional terms
+			dt.combined = true
+		}
+
+		if p.A != 0 || p.C != 0 {
+			if seen[p.Xidx] {
+				dt.combined = true
+			}
+
+			seen[p.Xidx] = true
+		}
+	}
+
+	if dt.divided && dt.combined {
+		return "dividing by an index can't be combined with expressions that use several indices, the same index in several dimensions, or wrap, of the same dataset array"
+	}
+
+	return ""
+}
+
+// Returns the range [min, max) of the values of the temp v used in the
+// right side index expression e of a dimension of size n. ne and ep are
+// the inverse of e, as returned by transform.
+func tempRange(v *EVar, e, ne *Expr, ep **Expr, n int64) (min, max int64, err string) {
+	if ep == nil {
+		return 0, n, ""
+	}
+
+	re := new(Expr)
+	*ep = re
+	defer func() { *ep = nil }()
+	for i, x := range []int64{0, n - 1} {
+		re.val = x
+		val, err := ne.eval()
+		if err != "" {
+			return 0, 0, err
+		}
+
+		nn, ok := val.(int64)
+		if !ok {
+			return 0, 0, fmt.Sprintf("expected int64, got: %v", val)
+		}
+
+		if i == 0 {
+			min = nn
+		} else {
+			max = nn
+		}
+	}
+
+	if min > max {
+		min, max = max, min
+	}
+
+	return indexRange(v, e, min, max, n)
+}
+
+// Selects the values of the temp used in the right side index expression
+// e, of a dimension of size n, that satisfy its where predicate. The
+// selected values have to be evenly spaced, s, s+m, s+2m, ..., so the
+// temp is replaced by m*t + s in the index expressions of rt, and t
+// becomes the number of the selected value.
+//
+// The index expression of a temp used together with other temps can't be
+// inverted, its where predicate selects from the values 0 to n-1.
+func selectTemp(rt *VType, e *Expr, n int64) (err string) {
+	if ts := findTemps(e, nil); len(ts) > 1 {
+		for _, t := range ts {
+			if t.where == nil || t.selected {
+				continue
+			}
+
+			if n == 0 {
+				return fmt.Sprintf("where can't select the values of '%s' in the unlimited dimension", t.name)
+			}
+
+			if err = selectValues(rt, t, 0, n); err != "" {
+				return err
+			}
+		}
+
+		return ""
+	}
+
+	v, ne, ep, err := e.transform()
+	if err != "" || v == nil {
+		return err
+	}
+
+	t, ok := v.aux.(*VTemp)
+	if !ok || t.where == nil || t.selected {
+		return ""
+	}
+
+	if n == 0 {
+		return fmt.Sprintf("where can't select the values of '%s' in the unlimited dimension", t.name)
+	}
+
+	min, max, err := tempRange(&t.EVar, e, ne, ep, n)
+	if err != "" {
+		return err
+	}
+
+	// the predicate only removes values, the view indices start from 0
+	// as without it
+	if min < 0 {
+		min = 0
+	}
+
+	return selectValues(rt, t, min, max)
+}
+
+// selects the values of the temp t within [min, max) that satisfy its
+// where predicate
+func selectValues(rt *VType, t *VTemp, min, max int64) (err string) {
+	var first, step, last, count int64
+
+	for x := min; x < max; x++ {
+		t.val = x
+		val, err := t.where.eval()
+		t.val = nil
+		if err != "" {
+			return err
+		}
+
+		sel, err := isTrue(val)
+		if err != "" {
+			return err
+		}
+
+		if !sel {
+			continue
+		}
+
+		switch {
+		case count == 0:
+			first = x
+		case count == 1:
+			step = x - last
+		case x - last != step:
+			return fmt.Sprintf("the values of '%s' selected by where are not evenly spaced", t.name)
+		}
+
+		last = x
+		count++
+	}
+
+	if step == 0 {
+		step = 1
+	}
+
+	t.selected = true
+	t.count = count
+	x := AddExpr(MulExpr(ConstInt64Expr(step), VarExpr(&t.EVar)), ConstInt64Expr(first))
+	for i, d := range rt.dim {
+		rt.dim[i] = d.subst(&t.EVar, x)
+	}
+
+	return ""
+}
+
+// Selects the values lo, lo+step, ... up to hi (not included) of the temp
+// defined by the slice in the right side index expression e, of a
+// dimension of size n. The temp is replaced by step*t + lo in the index
+// expressions of rt, and t becomes the number of the value in the slice.
+func sliceTemp(rt *VType, e *Expr, n int64) (err string) {
+	t := exprTemp(e)
+	if t == nil || t.slice == nil || t.selected {
+		return ""
+	}
+
+	if t.where != nil {
+		return fmt.Sprintf("index '%s' of a slice can't have a where predicate", t.name)
+	}
+
+	if n == 0 {
+		return "the unlimited dimension can't be sliced"
+	}
+
+	lo, hi, step, err := sliceRange(t.slice, n)
+	if err != "" {
+		return err
+	}
+
+	t.selected = true
+	if step > 0 {
+		t.count = (hi - lo + step - 1) / step
+	} else {
+		t.count = (lo - hi - step - 1) / -step
+	}
+
+	x := AddExpr(MulExpr(ConstInt64Expr(step), VarExpr(&t.EVar)), ConstInt64Expr(lo))
+	for i, d := range rt.dim {
+		rt.dim[i] = d.subst(&t.EVar, x)
+	}
+
+	return ""
+}
+
+// Returns the values selected by the slice s of a dimension of size n,
+// lo, lo+step, ... up to hi (not included). A negative step goes
+// backwards, from lo down to hi, and the bounds default to n-1 and -1,
+// so a[::-1] reverses the dimension. Negative bounds don't count from
+// the end, -1 is only valid as hi of a negative step.
+func sliceRange(s *VSlice, n int64) (lo, hi, step int64, err string) {
+	switch s.dist {
+	case distBlock:
+		// the sizes of uneven blocks differ by one at most, the
+		// ghost cells stop at the ends of the dimension
+		lo = s.rank*n/s.nranks - s.ghost
+		hi = (s.rank + 1)*n/s.nranks + s.ghost
+		if lo < 0 {
+			lo = 0
+		}
+
+		if hi > n {
+			hi = n
+		}
+
+		return lo, hi, 1, ""
+
+	case distCyclic:
+		// the ranks after the size of the dimension get nothing
+		lo = s.rank
+		if lo > n {
+			lo = n
+		}
+
+		return lo, n, s.nranks, ""
+	}
+
+	if step, err = sliceBound(s.step, 1); err != "" {
+		return
+	}
+
+	if step == 0 {
+		return 0, 0, 0, "slice step can't be 0"
+	}
+
+	if step < 0 {
+		if lo, err = sliceBound(s.lo, n - 1); err != "" {
+			return
+		}
+
+		if hi, err = sliceBound(s.hi, -1); err != "" {
+			return
+		}
+
+		if hi < -1 || lo >= n || lo < hi {
+			return 0, 0, 0, fmt.Sprintf("slice %d:%d:%d is outside the dimension of size %d", lo, hi, step, n)
+		}
+
+		return
+	}
+
+	if lo, err = sliceBound(s.lo, 0); err != "" {
+		return
+	}
+
+	if hi, err = sliceBound(s.hi, n); err != "" {
+		return
+	}
+
+	if lo < 0 || hi > n || lo > hi {
+		return 0, 0, 0, fmt.Sprintf("slice %d:%d is outside the dimension of size %d", lo, hi, n)
+	}
+
+	return
+}
+
+// returns the value of the slice's bound e, or dflt if not specified
+func sliceBound(e *Expr, dflt int64) (int64, string) {
+	if e == nil {
+		return dflt, ""
+	}
+
+	val, err := e.eval()
+	if err != "" {
+		return 0, err
+	}
+
+	n, ok := val.(int64)
+	if !ok {
+		return 0, fmt.Sprintf("slice bounds have to be integers, got: %v", val)
+	}
+
+	return n, ""
+}
+
+// Finds the number of values of the temp t going through the window of a
+// reduction, in a dimension of size n. The bounds of the window can use
+// other temps, but its width has to be constant. The window is already
+// in the index expression, t becomes the number of the value.
+func windowTemp(t *VTemp, n int64) (err string) {
+	w := t.window
+	if w == nil || t.selected {
+		return ""
+	}
+
+	lo := w.lo
+	if lo == nil {
+		lo = ConstInt64Expr(0)
+	}
+
+	hi := w.hi
+	if hi == nil {
+		if findTemps(lo, nil) != nil {
+			return fmt.Sprintf("%s starts at an index, it needs an upper bound", t.name)
+		}
+
+		if n == 0 {
+			return fmt.Sprintf("%s needs an upper bound in the unlimited dimension", t.name)
+		}
+
+		hi = ConstInt64Expr(n)
+	}
+
+	step, err := sliceBound(w.step, 1)
+	if err != "" {
+		return err
+	}
+
+	if step <= 0 {
+		return fmt.Sprintf("invalid step of %s: %d", t.name, step)
+	}
+
+	// hi - lo can't depend on the indices
+	var pe drepl.PExpr
+
+	ts := findTemps(hi, findTemps(lo, nil))
+	vars := make([]*EVar, len(ts))
+	for i, tt := range ts {
+		vars[i] = &tt.EVar
+	}
+
+	if err = SubExpr(hi, lo).toPExpr(&pe, vars); err != "" {
+		return err
+	}
+
+	constant := pe.C == 0 && pe.B % pe.D == 0
+	for _, a := range pexprTerms(&pe) {
+		if a != 0 {
+			constant = false
+		}
+	}
+
+	if !constant {
+		return fmt.Sprintf("the width of %s has to be constant", t.name)
+	}
+
+	width := pe.B / pe.D
+	if width <= 0 {
+		return fmt.Sprintf("%s is empty", t.name)
+	}
+
+	t.selected = true
+	t.count = (width + step - 1) / step
+	return ""
+}
+
+// Selects the values of the temp t that is only used on the left side.
+// The comparisons with constants in its where predicate give the range,
+// from 0 if there is no lower bound, and t becomes the number of the
+// selected value.
+func broadcastTemp(t *VTemp) (err string) {
+	if t.selected {
+		return ""
+	}
+
+	lo, hi := int64(0), int64(-1)
+	if t.where != nil {
+		if err = tempBounds(t, t.where, &lo, &hi); err != "" {
+			return err
+		}
+	}
+
+	if hi < 0 {
+		return fmt.Sprintf("index '%s' isn't used on the right side, give the number of its values n with 'where %s < n' after the right side", t.name, t.name)
+	}
+
+	var count int64
+	for x := lo; x < hi; x++ {
+		t.val = x
+		val, err := t.where.eval()
+		t.val = nil
+		if err != "" {
+			return err
+		}
+
+		sel, err := isTrue(val)
+		if err != "" {
+			return err
+		}
+
+		if sel {
+			count++
+		}
+	}
+
+	t.selected = true
+	t.count = count
+	return ""
+}
+
+// narrows the range [lo, hi) of the temp t with the comparisons of t with
+// constants in the conjuncts of the predicate e, hi is -1 while there is
+// no upper bound
+func tempBounds(t *VTemp, e *Expr, lo, hi *int64) string {
+	if e.op == AND {
+		if err := tempBounds(t, e.left, lo, hi); err != "" {
+			return err
+		}
+
+		return tempBounds(t, e.right, lo, hi)
+	}
+
+	// t op x, with x > t turned around
+	op, x := e.op, e.right
+	if exprTemp(e.right) == t {
+		x = e.left
+		switch op {
+		case LSS:
+			op = GTR
+		case LEQ:
+			op = GEQ
+		case GTR:
+			op = LSS
+		case GEQ:
+			op = LEQ
+		}
+	} else if exprTemp(e.left) != t {
+		return ""
+	}
+
+	if findTemps(x, nil) != nil {
+		return ""
+	}
+
+	val, err := x.eval()
+	if err != "" {
+		return err
+	}
+
+	n, ok := val.(int64)
+	if !ok {
+		return ""
+	}
+
+	switch op {
+	case LEQ:
+		n++
+		fallthrough
+	case LSS:
+		if *hi < 0 || n < *hi {
+			*hi = n
+		}
+
+		if *hi < 0 {
+			*hi = 0
+		}
+
+	case GTR:
+		n++
+		fallthrough
+	case GEQ:
+		if n > *lo {
+			*lo = n
+		}
+	}
+
+	return ""
+}
+
+// Finds the dimensions of the right side type rt that wrap around, the
+// index expressions that end with % and a constant. The modulus is
+// removed from the expression and kept in rt.wrap, it is applied to
+// the dataset index calculated by the rest.
+func wrapDims(rt *VType, dt *Type) (err string) {
+	if rt.wrap != nil {
+		return ""
+	}
+
+	rt.wrap = make([]int64, len(rt.dim))
+	for i, e := range rt.dim {
+		if e == nil || e.op != REM || findTemps(e.left, nil) == nil && findGathers(e.left, nil) == nil {
+			continue
+		}
+
+		if dt.dim[i] == 0 {
+			return "the unlimited dimension can't wrap"
+		}
+
+		val, err := e.right.eval()
+		if err != "" {
+			return err
+		}
+
+		m, ok := val.(int64)
+		if !ok || m <= 0 {
+			return fmt.Sprintf("the modulus of a wrapped index has to be a positive integer, got: %v", val)
+		}
+
+		// a smaller modulus uses only the beginning of the dimension,
+		// a larger one would give indices outside of it
+		if m > int64(dt.dim[i]) {
+			return fmt.Sprintf("the modulus of a wrapped index can't be larger than the dimension %d, got: %d", dt.dim[i], m)
+		}
+
+		rt.wrap[i] = m
+		rt.dim[i] = e.left
+	}
+
+	return ""
+}
+
+// Returns the number of values of the temp t that the index expression e
+// goes through before its values modulo m repeat.
+func wrapPeriod(e *Expr, t *VTemp, m int64) (int64, string) {
+	var pe drepl.PExpr
+
+	if err := e.toPExpr(&pe, []*EVar{&t.EVar}); err != "" {
+		return 0, err
+	}
+
+	if pe.C != 0 {
+		return 0, fmt.Sprintf("a wrapped index can't be divided by an index: %v", e)
+	}
+
+	if pe.A == 0 {
+		return 1, ""
+	}
+
+	n := m*pe.D
+	if n < 0 {
+		n = -n
+	}
+
+	a := pe.A
+	if a < 0 {
+		a = -a
+	}
+
+	for b := n; b != 0; {
+		a, b = b, a%b
+	}
+
+	return n / a, ""
+}
+
+// Selects the values of the temp used in the right side index expression
+// e of a dimension wrapped modulo m that satisfy its where predicate. The
+// values are selected from a period before to a period after the one the
+// temp goes through without where, so the view can have up to a period
+// of elements around the array.
+func selectWrapped(rt *VType, e *Expr, m int64) (err string) {
+	t := exprTemp(e)
+	if t == nil {
+		if ts := findTemps(e, nil); len(ts) == 1 {
+			t = ts[0]
+		}
+	}
+
+	if t == nil || t.where == nil || t.selected {
+		return ""
+	}
+
+	p, err := wrapPeriod(e, t, m)
+	if err != "" {
+		return err
+	}
+
+	return selectValues(rt, t, -p, 2*p)
+}
+
+// returns the value of a predicate
+func isTrue(val interface{}) (bool, string) {
+	switch v := val.(type) {
+	case int64:
+		return v != 0, ""
+	case uint64:
+		return v != 0, ""
+	case float64:
+		return v != 0, ""
+	}
+
+	return false, fmt.Sprintf("predicate value is not a number: %v", val)
+}
+
+// true if the expression returns the value of index idx unchanged
+func isIdentity(p *drepl.PExpr, idx int) bool {
+	return p.Xidx == idx && p.A != 0 && p.A == p.D && p.B == 0 && p.C == 0 && p.Terms == nil && p.M == 0
+}
+
+// Adjusts the inclusive range [min, max] of the temp v, calculated from the
+// inverse of the index expression e, so that it contains exactly the
+// values for which e is within [0, n). The inverse is not exact if e
+// contains divisions. Returns the range as [min, max).
+func indexRange(v *EVar, e *Expr, min, max, n int64) (int64, int64, string) {
+	var err string
+
+	inside := func(x int64) bool {
+		var val interface{}
+
+		if err != "" {
+			return false
+		}
+
+		v.val = x
+		val, err = e.eval()
+		v.val = nil
+		idx, ok := val.(int64)
+		if err == "" && !ok {
+			err = fmt.Sprintf("expected int64, got: %v", val)
+		}
+
+		return err == "" && idx >= 0 && idx < n
+	}
+
+	for min <= max && !inside(min) {
+		min++
+	}
+
+	for max >= min && !inside(max) {
+		max--
+	}
+
+	if min > max {
+		return min, min, err
+	}
+
+	for inside(min - 1) {
+		min--
+	}
+
+	for inside(max + 1) {
+		max++
+	}
+
+	return min, max + 1, err
+}
+
+func processVStruct(lt, rt *VType, dt *Type, packed bool) (err string) {
+	var vt *VType
+
+	if rt!=nil {
+		panic("substruct error")
+	}
+
+	if dt.fields==nil || len(dt.fields)==0 {
+		return fmt.Sprintf("data type needs to be struct: %v", dt.etype)
+	}
+
+	sz := int64(0)
+	salign := int64(1)
+	for _, vf := range(lt.fields) {
+		var f *Field
+
+		if vf.expr != nil {
+			// computed field, not in the dataset
+			pt := primaryType(vf.vt.dt)
+			vf.vt.sz = pt.size
+			vf.vt.align = pt.align
+			falign := int64(1)
+			if !packed {
+				falign = fieldAlign(vf.vt.align, 0, dt.packed)
+			}
+
+			vf.offset = alignUp(sz, falign)
+			sz = vf.offset + vf.vt.sz
+			if falign > salign {
+				salign = falign
+			}
+
+			continue
+		}
+
+		s := vf.name
+		for _, df := range(dt.fields) {
+			if s == df.name {
+				f = &df
+				break
+			}
+		}
+
+		if f==nil {
+			return fmt.Sprintf("field '%s' not found", s)
+		}
+
+		vf.f = f
+		vt, err = processVType(vf.vt, nil, f.t, packed)
+		if err!="" {
+			return ""
+		}
+
+		// the fields are aligned the same way as in the dataset,
+		// unless the view hides the padding
+		vf.vt = vt
+		falign := int64(1)
+		if !packed {
+			falign = fieldAlign(vf.vt.align, f.xalign, dt.packed || f.packed)
+		}
+
+		vf.offset = alignUp(sz, falign)
+		sz = vf.offset + vf.vt.sz
+		if falign > salign {
+			salign = falign
+		}
+	}
+
+	for _, vf := range(lt.fields) {
+		for _, r := range vf.refs {
+			t := r.f.vt
+			if t.etype != nil || t.fields != nil || primaryType(t.dt) == nil || primaryType(t.dt).ntype == drepl.NoType {
+				return fmt.Sprintf("field '%s' used by '%s' has to be a number", r.name, vf.name)
+			}
+		}
+	}
+
+	if !packed && dt.xalign > salign {
+		salign = dt.xalign
+	}
+
+	lt.align = salign
+	lt.sz = alignUp(sz, salign)
+	return ""
+}
+
+// returns the primary type t refers to, or nil if t is not a primary type
+func primaryType(t *Type) *Type {
+	for t != nil && t.dimnum == 0 && t.etype != nil {
+		t = t.etype
+	}
+
+	if t == nil || !t.primary {
+		return nil
+	}
+
+	return t
+}
+
+func processVType(lt, rt *VType, dt *Type, packed bool) (vt *VType, err string) {
+	vt = lt
+	if dt!=nil {
+		for dt.dimnum==0 && dt.etype!=nil {
+			// handle type aliases
+			dt = dt.etype
+		}
+	}
+
+//	fmt.Printf("processVType lt %p rt %p dt %v\n", lt, rt, dt)
+	if lt==nil {
+		if rt==nil {
+			lt = new(VType)
+			lt.dt = dt
+			lt.sz = dt.size
+			lt.align = dt.align
+			if dt.etype != nil {
+				lt.dim = make([]*Expr, dt.dimnum)
+				rt = new(VType)
+				rt.dim = make([]*Expr, dt.dimnum)
+				err = processVArray(lt, rt, dt, packed)
+			} else if dt.fields != nil {
+				fnames := make([]string, len(dt.fields))
+				for i, f := range dt.fields {
+					fnames[i] = f.name
+				}
+
+				lt.addFields(fnames, nil, &lt.pos)
+				err = processVStruct(lt, rt, dt, packed)
+			}
+
+			return lt, err
+		}
+
+		lt = rt
+		rt = nil
+	}
+
 	if lt.dim!=nil {
-		err = processVArray(lt, rt, dt)
+		err = processVArray(lt, rt, dt, packed)
 	} else if lt.fields!=nil && len(lt.fields) > 0 || dt.fields!=nil {
 		if lt.fields==nil && dt.fields != nil {
 			fnames := make([]string, len(dt.fields))
@@ -580,9 +1781,22 @@ func processVType(lt, rt *VType, dt *Type) (vt *VType, err string) {
 			lt.addFields(fnames, nil, &lt.pos)
 		}
 
-		err = processVStruct(lt, rt, dt)
+		err = processVStruct(lt, rt, dt, packed)
 	} else if dt != nil {
 		lt.sz = dt.size
+		lt.align = dt.align
+		if vdt := primaryType(lt.dt); vdt != nil && dt.primary && vdt != dt {
+			// the view declares its own primary type for the value
+			lt.dt = vdt
+			if vdt.ntype == drepl.NoType || dt.ntype == drepl.NoType {
+				if vdt.size != dt.size {
+					err = fmt.Sprintf("can't convert '%s' to '%s'", dt.name, vdt.name)
+				}
+			} else {
+				lt.sz = vdt.size
+				lt.align = vdt.align
+			}
+		}
 	}
 
 //	fmt.Printf("--- processVType: lt %v\n", lt)
@@ -611,31 +1825,58 @@ func (t *VType) createBlocks(bs *drepl.BlockSeq, dblk drepl.Block) (b drepl.Bloc
 		}
 
 		ab := bs.NewABlock(t.etype.sz, dim, nblks[0])
-		v2d := make([]drepl.PExpr, len(t.vdim))
-		for i, d := range t.vdim {
-			v2d[i] = d.pv2d
+		if r := dab.Records(); r != nil {
+			ab.SetRecords(r)
 		}
 
-		dab.AddDestination(ab, nil, v2d)
+		dab.AddDestination(ab, nil, t.pv2d)
 		b = ab
 	} else if t.fields != nil {
 		dtb := dblk.(*drepl.TBlock)
 		nbs := bs.View().NewBlockSeq()
 		dblks := dtb.Blocks()
+		fblks := make(map[*VField] drepl.Block)
 		for _, f := range t.fields {
+			nbs.Pad(f.offset - nbs.Size())
+			if f.expr != nil {
+				// nothing to read, the value is set when
+				// the element is converted
+				vdt := primaryType(f.vt.dt)
+				sb := nbs.NewSBlock(f.vt.sz)
+				sb.SetEndian(vdt.endian)
+				sb.SetType(vdt.ntype)
+				fblks[f] = sb
+				continue
+			}
+
 			db := dblks[f.f.idx]
-			_, err = f.vt.createBlocks(nbs, db)
+			fblks[f], err = f.vt.createBlocks(nbs, db)
 			if err != "" {
 				return
 			}
 		}
 
+		nbs.Pad(t.sz - nbs.Size())
+
 		tb := bs.NewTBlock(nbs)
+		for _, f := range t.fields {
+			if f.expr != nil {
+				tb.AddComputed(fblks[f].(*drepl.SBlock), f.value(fblks))
+			}
+		}
+
 		dtb.AddDestination(tb)
 		b = tb
 	} else {
 		db := dblk.(*drepl.SBlock)
 		sb := bs.NewSBlock(t.sz)
+		if vdt := primaryType(t.dt); vdt != nil {
+			sb.SetEndian(vdt.endian)
+			sb.SetType(vdt.ntype)
+		} else {
+			sb.SetEndian(db.Endian())
+			sb.SetType(db.Type())
+		}
 		db.AddDestination(sb)
 		b = sb
 	}
@@ -643,6 +1884,32 @@ func (t *VType) createBlocks(bs *drepl.BlockSeq, dblk drepl.Block) (b drepl.Bloc
 	return
 }
 
+// Returns the function calculating the computed field f from the other
+// fields of the element, fblks are the blocks of the fields
+func (f *VField) value(fblks map[*VField] drepl.Block) func(el []byte) (interface{}, error) {
+	return func(el []byte) (interface{}, error) {
+		defer func() {
+			for _, r := range f.refs {
+				r.val = nil
+				r.eval = false
+			}
+		}()
+
+		for _, r := range f.refs {
+			sb := fblks[r.f].(*drepl.SBlock)
+			off := sb.Offset()
+			r.val = sb.Value(el[off:off + sb.Size()])
+		}
+
+		val, err := f.expr.eval()
+		if err != "" {
+			return nil, errors.New(err)
+		}
+
+		return val, nil
+	}
+}
+
 func (t *VType) String() string {
 	if t.etype != nil {
 		return fmt.Sprintf("'%s' dt |%v| etype %v dim %v", t.name, t.dt, t.etype, t.dim)
@@ -657,31 +1924,362 @@ func (f *VField) String() string {
 	return fmt.Sprintf("(%s %v)", f.name, f.vt)
 }
 
-func (v *VVarDecl) process() (err string) {
-	vt, err := processVType(v.lt, v.rt, v.v.t)
+func (v *VVarDecl) process(ds *Dataset, packed bool) (err string) {
+	for _, g := range v.gathers {
+		if err = g.process(ds); err != "" {
+			return err
+		}
+	}
+
+	vt, err := processVType(v.lt, v.rt, v.v.t, packed)
 	if err!="" {
 		return err
 	}
 
+	if v.order >= 0 {
+		v.elopv, err = ds.evalOrderParams(v.name, v.order, v.elop)
+		if err != "" {
+			return err
+		}
+
+		if err = checkOrderRank(v.name, v.order, v.elopv, vt); err != "" {
+			return err
+		}
+	}
+
+	if v.probe != nil {
+		if err = v.processProbe(ds, vt); err != "" {
+			return err
+		}
+	}
+
+	if v.reduce != 0 {
+		t := vt.etype
+		if t.etype != nil || t.fields != nil || t.dt == nil || primaryType(t.dt) == nil || primaryType(t.dt).ntype == drepl.NoType {
+			return fmt.Sprintf("the elements of '%s' have to be numbers to be reduced", v.name)
+		}
+	}
+
 	v.lt = vt
 	v.rt = nil
+	v.processed = true
 
 //	fmt.Printf("view var %s sz %d\n", v.name, v.lt.sz)
 	return ""
 }
 
+// processes the probe of the value predicates, it has to have the same
+// dimensions as the variable's type vt, and finds the fields used
+func (v *VVarDecl) processProbe(ds *Dataset, vt *VType) (err string) {
+	p := v.probe
+	if err = p.process(ds, false); err != "" {
+		return err
+	}
+
+	if len(p.lt.vdim) != len(vt.vdim) {
+		return "where predicate doesn't match the variable's dimensions"
+	}
+
+	for i, d := range vt.vdim {
+		pd := p.lt.vdim[i]
+		if pd.max - pd.min != d.max - d.min {
+			return "where predicate doesn't match the variable's dimensions"
+		}
+	}
+
+	for _, r := range v.refs {
+		r.fidx = nil
+		t := p.lt.etype
+		for _, name := range r.path {
+			idx := -1
+			for i, f := range t.fields {
+				if f.name == name {
+					idx = i
+					break
+				}
+			}
+
+			if idx < 0 {
+				return fmt.Sprintf("field '%s' not found", name)
+			}
+
+			r.fidx = append(r.fidx, idx)
+			t = t.fields[idx].vt
+		}
+
+		if t.etype != nil || t.fields != nil || t.dt == nil || primaryType(t.dt) == nil || primaryType(t.dt).ntype == drepl.NoType {
+			return fmt.Sprintf("'%s' is not a number", strings.Join(append([]string{r.name}, r.path...), "."))
+		}
+	}
+
+	return ""
+}
+
+// processes the index array before the variable that uses it, and finds
+// the field with the indices
+func (g *VGather) process(ds *Dataset) (err string) {
+	p := g.idx
+	if p.v.t.isUnlimited() {
+		return fmt.Sprintf("index array '%s' can't have an unlimited dimension", g.name)
+	}
+
+	if err = p.process(ds, false); err != "" {
+		return err
+	}
+
+	g.fidx = nil
+	t := p.lt.etype
+	for _, name := range g.path {
+		idx := -1
+		for i, f := range t.fields {
+			if f.name == name {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 {
+			return fmt.Sprintf("field '%s' not found", name)
+		}
+
+		g.fidx = append(g.fidx, idx)
+		t = t.fields[idx].vt
+	}
+
+	name := strings.Join(append([]string{g.name}, g.path...), ".")
+	if t.etype != nil || t.fields != nil || t.dt == nil || primaryType(t.dt) == nil {
+		return fmt.Sprintf("'%s' is not a number", name)
+	}
+
+	switch primaryType(t.dt).ntype {
+	case drepl.NoType, drepl.Float32, drepl.Float64:
+		return fmt.Sprintf("'%s' is not an integer", name)
+	}
+
+	return ""
+}
+
 func (v *VVarDecl) createBlocks(dv *drepl.View) (err string) {
 	var b drepl.Block
 
 	b, err = v.lt.createBlocks(dv.Blocks(), v.v.blk)
 	v.blk = b
+	if err == "" && v.order >= 0 {
+		setOrder(b, elementOrder(v.order, v.elopv))
+	}
+
+	if err == "" && v.probe != nil {
+		err = v.createFilter(dv)
+	}
+
+	if err == "" && v.gathers != nil {
+		err = v.createGathers(dv)
+	}
+
+	if err == "" && v.reduce != 0 {
+		b.(*drepl.ABlock).SetReduce(v.reduce, v.lt.win)
+	}
+
 	return
 }
 
-func (v *View) process() (err string) {
-	for _, v := range v.vars {
-		err = v.process()
-		if err!="" {
+// Creates the blocks of the index arrays, each in its own view, and adds
+// them to the variable's array
+func (v *VVarDecl) createGathers(dv *drepl.View) (err string) {
+	for _, g := range v.gathers {
+		var ib drepl.Block
+
+		gv := drepl.NewView(dv.Name + "." + v.name + "." + g.name, drepl.RowMajorOrder, true)
+		gv.SetDefaultView(dv.DefaultView())
+		ib, err = g.idx.lt.createBlocks(gv.Blocks(), g.idx.v.blk)
+		if err != "" {
+			return err
+		}
+
+		ab := ib.(*drepl.ABlock)
+		b := ab.Element()
+		off := int64(0)
+		for _, i := range g.fidx {
+			b = b.(*drepl.TBlock).Blocks()[i]
+			off += b.Offset()
+		}
+
+		sb := b.(*drepl.SBlock)
+		value := func(el []byte) (int64, error) {
+			n, ok := sb.Value(el[off:off + sb.Size()]).(int64)
+			if !ok {
+				return 0, errors.New("index is not an integer")
+			}
+
+			return n, nil
+		}
+
+		v.blk.(*drepl.ABlock).AddGather(ab, g.dims, value)
+	}
+
+	return ""
+}
+
+// Creates the probe's blocks in their own view, and makes the variable's
+// array select the elements matching the value predicates
+func (v *VVarDecl) createFilter(dv *drepl.View) (err string) {
+	pv := drepl.NewView(dv.Name + "." + v.name, drepl.RowMajorOrder, true)
+	pv.SetDefaultView(dv.DefaultView())
+	pb, err := v.probe.lt.createBlocks(pv.Blocks(), v.v.blk)
+	if err != "" {
+		return err
+	}
+
+	match := func(el []byte) (bool, error) {
+		defer func() {
+			for _, r := range v.refs {
+				r.val = nil
+				r.eval = false
+			}
+		}()
+
+		for _, r := range v.refs {
+			b := pb.(*drepl.ABlock).Element()
+			off := int64(0)
+			for _, i := range r.fidx {
+				b = b.(*drepl.TBlock).Blocks()[i]
+				off += b.Offset()
+			}
+
+			sb := b.(*drepl.SBlock)
+			r.val = sb.Value(el[off:off + sb.Size()])
+		}
+
+		val, err := v.match.eval()
+		if err != "" {
+			return false, errors.New(err)
+		}
+
+		ok, err := isTrue(val)
+		if err != "" {
+			return false, errors.New(err)
+		}
+
+		return ok, nil
+	}
+
+	v.blk.(*drepl.ABlock).SetFilter(pb.(*drepl.ABlock), match)
+	return ""
+}
+
+// sets the element order of all arrays in the block
+func setOrder(b drepl.Block, elo drepl.ElementOrder) {
+	switch b := b.(type) {
+	case *drepl.ABlock:
+		b.SetOrder(elo)
+		setOrder(b.Element(), elo)
+
+	case *drepl.TBlock:
+		for _, fb := range b.Blocks() {
+			setOrder(fb, elo)
+		}
+	}
+}
+
+// sets the byte order of all primary values in the block
+func setEndian(b drepl.Block, endian int) {
+	switch b := b.(type) {
+	case *drepl.SBlock:
+		if b.Endian() != drepl.AnyEndian {
+			b.SetEndian(endian)
+		}
+
+	case *drepl.ABlock:
+		setEndian(b.Element(), endian)
+
+	case *drepl.TBlock:
+		for _, fb := range b.Blocks() {
+			setEndian(fb, endian)
+		}
+	}
+}
+
+// creates the element order from the (masked) view flags
+func elementOrder(order int, elopv []int64) drepl.ElementOrder {
+	switch order {
+	case Vrowmajor:
+		return drepl.RowMajorOrder
+	case Vrowminor:
+		return drepl.RowMinorOrder
+	case Vzorder:
+		return drepl.ZOrderOrder
+	case Vhilbert:
+		return drepl.HilbertOrder
+	case Vtiled:
+		return drepl.NewTiledOrder(elopv)
+	case Vpermuted:
+		return drepl.NewPermutedOrder(elopv)
+	}
+
+	return nil
+}
+
+// evaluates the parameters of the element order (tile shape, or permutation)
+func (ds *Dataset) evalOrderParams(name string, order int, elop []*Expr) (elopv []int64, err string) {
+	if elop == nil {
+		return nil, ""
+	}
+
+	elopv = make([]int64, len(elop))
+	for i, e := range elop {
+		val, err := ds.evalExpr(e)
+		if err != "" {
+			return nil, err
+		}
+
+		n, ok := val.(int64)
+		switch {
+		case !ok:
+			return nil, fmt.Sprintf("%s: order parameter must be an integer: %v", name, val)
+		case order == Vtiled && n <= 0:
+			return nil, fmt.Sprintf("%s: tile size must be a positive integer: %v", name, val)
+		case order == Vpermuted && (n < 0 || n >= int64(len(elop))):
+			return nil, fmt.Sprintf("%s: invalid dimension in order: %v", name, val)
+		}
+
+		elopv[i] = n
+	}
+
+	if order == Vpermuted {
+		for i, n := range elopv {
+			for _, m := range elopv[0:i] {
+				if n == m {
+					return nil, fmt.Sprintf("%s: dimension %d repeated in order", name, n)
+				}
+			}
+		}
+	}
+
+	return elopv, ""
+}
+
+// checks that the tile shape or permutation elopv has a value for each
+// dimension of the arrays in t the order applies to
+func checkOrderRank(name string, order int, elopv []int64, t *VType) string {
+	if t == nil || order != Vtiled && order != Vpermuted {
+		return ""
+	}
+
+	if t.etype != nil {
+		if len(elopv) != len(t.vdim) {
+			what := "tile shape"
+			if order == Vpermuted {
+				what = "permutation"
+			}
+
+			return fmt.Sprintf("%s: %s has %d dimensions, the array has %d", name, what, len(elopv), len(t.vdim))
+		}
+
+		return checkOrderRank(name, order, elopv, t.etype)
+	}
+
+	for _, f := range t.fields {
+		if err := checkOrderRank(name, order, elopv, f.vt); err != "" {
 			return err
 		}
 	}
@@ -689,13 +2287,71 @@ func (v *View) process() (err string) {
 	return ""
 }
 
+func (v *View) process(ds *Dataset) (errs ErrorList) {
+	var err string
+
+	if v.flags & Vbigendian != 0 && v.flags & Vlittleendian != 0 {
+		errs.Add(&v.pos, fmt.Sprintf("view %s: both bigendian and littleendian specified", v.Name))
+	}
+
+	v.elopv, err = ds.evalOrderParams("view " + v.Name, v.flags & 0x3F, v.elop)
+	if err != "" {
+		errs.Add(&v.pos, err)
+	}
+
+	for i, vv := range v.vars {
+		if !vv.v.t.isUnlimited() {
+			continue
+		}
+
+		if i != len(v.vars) - 1 {
+			errs.Add(&vv.pos, fmt.Sprintf("view %s: variable %s with unlimited dimension has to be the last one", v.Name, vv.name))
+		}
+
+		order := vv.order
+		if order < 0 {
+			order = v.flags & 0x3F
+		}
+
+		if order != Vrowmajor {
+			errs.Add(&vv.pos, fmt.Sprintf("view %s: variable %s with unlimited dimension has to be row-major", v.Name, vv.name))
+		}
+	}
+
+	packed := v.flags & Vpacked != 0
+	for _, vv := range v.vars {
+		err = vv.process(ds, packed)
+		if err == "" && vv.order < 0 && v.elopv != nil {
+			err = checkOrderRank("view " + v.Name + ": " + vv.name, v.flags & 0x3F, v.elopv, vv.lt)
+		}
+
+		if err!="" {
+			errs.Add(&vv.pos, err)
+		}
+	}
+
+	return
+}
+
 func (v *View) createBlocks(vv *drepl.View) (err string) {
 	v.dv = vv
+	if v.flags & Vwrap != 0 {
+		vv.SetConversion(drepl.ConvWrap)
+	} else if v.flags & Vexact != 0 {
+		vv.SetConversion(drepl.ConvExact)
+	}
+
 	for _, vvar := range v.vars {
 		err = vvar.createBlocks(v.dv)
 		if err != "" {
 			return err
 		}
+
+		if v.flags & Vbigendian != 0 {
+			setEndian(vvar.blk, drepl.BigEndian)
+		} else if v.flags & Vlittleendian != 0 {
+			setEndian(vvar.blk, drepl.LittleEndian)
+		}
 	}
 
 	return ""
@@ -716,10 +2372,6 @@ func (vt *VType) reset() {
 }
 
 func (vdm *VDim) reset() {
-	if vdm != nil {
-//		vdm.pv2d = nil
-//		vdm.pd2v = nil
-	}
 }
 
 func (vv *VVarDecl) reset() {
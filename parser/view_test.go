@@ -0,0 +1,398 @@
+package parser
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"drepl/drepl"
+)
+
+// dataset and default view of the descriptions in the tests, the views
+// read the values written to the default view, 0 to N-1 in a, and N to
+// N+M*M-1 in m
+const testDataset = `
+dataset {
+	const N = 10
+	const M = 4
+	const R = 4
+	var a [N]int32
+	var m [M, M]int32
+}
+
+view dv default {
+	var a [i] = a[i]
+	var m [i, j] = m[i, j]
+}
+
+replica r1 "r1" {
+	view dv
+}
+`
+
+// the views declared by decl, and the values expected in each
+type viewTest struct {
+	decl	string
+	want	map[string] []int32
+}
+
+// Parses the test dataset with the views in decl, and creates their
+// transformation rules. The replicas are created in a temporary
+// directory.
+func createViews(t *testing.T, decl string) ([]*drepl.View, string) {
+	return createDescViews(t, testDataset + decl, nil)
+}
+
+// Parses the description in src and creates its transformation rules
+// and the replica files, in a temporary directory
+func createDescViews(t *testing.T, src string, opts *Options) ([]*drepl.View, string) {
+	dr, errs := ParseReader("test.drepl", strings.NewReader(src), opts)
+	if errs != "" {
+		return nil, errs
+	}
+
+	repls, views, errs := dr.CreateTransformationRules()
+	if errs != "" {
+		return nil, errs
+	}
+
+	dir := t.TempDir()
+	for _, r := range repls {
+		f, err := os.Create(filepath.Join(dir, r.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { f.Close() })
+		if err = r.SetFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return views, ""
+}
+
+// writes the int32 values 0, 1, ... to the view
+func writeValues(v *drepl.View) error {
+	data := make([]byte, v.Size())
+	for i := 0; i + 4 <= len(data); i += 4 {
+		binary.LittleEndian.PutUint32(data[i:], uint32(i/4))
+	}
+
+	return writeData(v, data)
+}
+
+// writes data to the view, from its beginning
+func writeData(v *drepl.View, data []byte) error {
+	off := int64(0)
+	for _, b := range v.Search(0, int64(len(data))) {
+		end := b.Offset() + b.Size() - off
+		if _, err := b.Write(data[0:end], off, b.Offset(), true, true); err != nil {
+			return err
+		}
+
+		off += end
+		data = data[end:]
+	}
+
+	return nil
+}
+
+// reads the int32 values of the view
+func readValues(v *drepl.View) ([]int32, error) {
+	data, err := readData(v)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := make([]int32, len(data)/4)
+	for i := range vals {
+		vals[i] = int32(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+
+	return vals, nil
+}
+
+// reads the whole view
+func readData(v *drepl.View) ([]byte, error) {
+	data := make([]byte, v.Size())
+	buf := data
+	off := int64(0)
+	for _, b := range v.Search(0, int64(len(data))) {
+		n, err := b.Read(buf, off, b.Offset())
+		if err != nil {
+			return nil, err
+		}
+
+		off += n
+		buf = buf[n:]
+	}
+
+	return data, nil
+}
+
+func runViewTests(t *testing.T, tests []viewTest) {
+	for _, test := range tests {
+		views, errs := createViews(t, test.decl)
+		if errs != "" {
+			t.Errorf("%s: %s", test.decl, errs)
+			continue
+		}
+
+		for _, v := range views {
+			if v.Name == "dv" {
+				if err := writeValues(v); err != nil {
+					t.Fatalf("%s: %v", test.decl, err)
+				}
+			}
+		}
+
+		for _, v := range views {
+			want, ok := test.want[v.Name]
+			if !ok {
+				continue
+			}
+
+			got, err := readValues(v)
+			if err != nil {
+				t.Errorf("%s: view %s: %v", test.decl, v.Name, err)
+			} else if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: view %s: got %v, expecting %v", test.decl, v.Name, got, want)
+			}
+		}
+	}
+}
+
+// checks that the views in each declaration report an error containing
+// the message
+func runErrorTests(t *testing.T, tests map[string] string) {
+	for decl, msg := range tests {
+		_, errs := createViews(t, decl)
+		if !strings.Contains(errs, msg) {
+			t.Errorf("%s: got error %q, expecting %q", decl, errs, msg)
+		}
+	}
+}
+
+func TestWhereRanges(t *testing.T) {
+	runViewTests(t, []viewTest{
+		{"view v { var x [i] = a[i] where i < 3 }", map[string] []int32{"v": {0, 1, 2}}},
+		{"view v { var x [i] = a[i] where i % 3 == 1 }", map[string] []int32{"v": {1, 4, 7}}},
+		{"view v { var x [i] = a[i] where i >= 4 && i < 7 }", map[string] []int32{"v": {4, 5, 6}}},
+		{"view v { var x [i] = a[9 - i] where i < 3 }", map[string] []int32{"v": {9, 8, 7}}},
+		{"view v { var x [i] = a[i - 2] where i < 4 }", map[string] []int32{"v": {0, 1}}},
+
+		// the predicate can only remove elements of the view
+		{"view v { var x [i] = a[i + 2] }", map[string] []int32{"v": {2, 3, 4, 5, 6, 7, 8, 9}}},
+		{"view v { var x [i] = a[i + 2] where i < 2 }", map[string] []int32{"v": {2, 3}}},
+		{"view v { var x [i] = a[i + 2] where i > -5 }", map[string] []int32{"v": {2, 3, 4, 5, 6, 7, 8, 9}}},
+	})
+
+	runErrorTests(t, map[string] string{
+		"view v { var x [i] = a[i] where i == 1 || i == 2 || i == 4 }": "not evenly spaced",
+	})
+}
+
+func TestPartitionRanges(t *testing.T) {
+	runViewTests(t, []viewTest{
+		{"view p(r of R) { var x [i] = a[r*N/R + i] where i < N/R }",
+			map[string] []int32{"p.0": {0, 1}, "p.1": {2, 3}, "p.2": {5, 6}, "p.3": {7, 8}}},
+		{"view p(r of R) { var x [i] = a[block] }",
+			map[string] []int32{"p.0": {0, 1}, "p.1": {2, 3, 4}, "p.2": {5, 6}, "p.3": {7, 8, 9}}},
+		{"view p(r of R) { var x [i] = a[cyclic] }",
+			map[string] []int32{"p.0": {0, 4, 8}, "p.1": {1, 5, 9}, "p.2": {2, 6}, "p.3": {3, 7}}},
+		{"view p(r of R) { var x [k, j] = a[cyclic(2)] }",
+			map[string] []int32{"p.0": {0, 1, 8, 9}, "p.1": {2, 3}, "p.2": {4, 5}, "p.3": {6, 7}}},
+		{"view p(r of R) { var x [i] = a[block ghost(1)] }",
+			map[string] []int32{"p.0": {0, 1, 2}, "p.1": {1, 2, 3, 4, 5}, "p.2": {4, 5, 6, 7}, "p.3": {6, 7, 8, 9}}},
+		{"view p(r of R) { var x [i, j] = m[block ghost(1), j] }",
+			map[string] []int32{"p.0": {10, 11, 12, 13, 14, 15, 16, 17}, "p.1": {10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21},
+				"p.2": {14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25}, "p.3": {18, 19, 20, 21, 22, 23, 24, 25}}},
+	})
+
+	runErrorTests(t, map[string] string{
+		"view p(r of R) { var x [i] = a[cyclic(2)] }": "block-cyclic distribution needs two indices on the left side",
+		"view p(r of R) { var x [i] = a[cyclic(0)] }": "invalid block size: 0",
+		"view p(r of R) { var x [i] = a[block ghost(-1)] }": "invalid ghost width: -1",
+	})
+}
+
+func TestPartitionReplicas(t *testing.T) {
+	const part = "view p(r of R) { var x [i] = a[block] }\n"
+	for _, decl := range []string{
+		part + `replica r2 "r2" { view p }`,
+		part + `replica r2 "r2" { view p[2] }`,
+		part + `replica r2 "r2" { view p[R - 1]; view p[0] }`,
+	} {
+		if _, errs := createViews(t, decl); errs != "" {
+			t.Errorf("%s: %s", decl, errs)
+		}
+	}
+
+	runErrorTests(t, map[string] string{
+		part + `replica r2 "r2" { view p[4] }`: "rank 4 of view 'p' is outside 0..3",
+		part + `replica r2 "r2" { view p[-1] }`: "outside",
+		part + `replica r2 "r2" { view dv[0] }`: "view 'dv' isn't partitioned",
+	})
+}
+
+// the arrays in the fields of a struct can be used without the right side
+func TestFieldArrays(t *testing.T) {
+	const ds = "dataset {\n\ttype st struct { x [2]int32; y int32 }\n\tvar s [3]st\n}\n"
+	for _, decl := range []string{
+		"view dv default { var s [i] { x [k] } = s[i] }",
+		"view dv default { var s [i] { x [k]; y } = s[i] }",
+	} {
+		if _, errs := ParseReader("test.drepl", strings.NewReader(ds + decl), nil); errs != "" {
+			t.Errorf("%s: %s", decl, errs)
+		}
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	runViewTests(t, []viewTest{
+		{"view v { var x [i, j] = a[i] where j < 3 }",
+			map[string] []int32{"v": {0, 0, 0, 1, 1, 1, 2, 2, 2, 3, 3, 3, 4, 4, 4, 5, 5, 5, 6, 6, 6, 7, 7, 7, 8, 8, 8, 9, 9, 9}}},
+		{"view v { var x [j, i] = a[i] where j < 2 }",
+			map[string] []int32{"v": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9}}},
+		{"view v { var x [i, j] = a[i] where i < 2 && j >= 1 && j < 3 }",
+			map[string] []int32{"v": {0, 0, 1, 1}}},
+		{"view v { var x [i, j, k] = m[i, k] where j < 2 }",
+			map[string] []int32{"v": {10, 11, 12, 13, 10, 11, 12, 13, 14, 15, 16, 17, 14, 15, 16, 17,
+				18, 19, 20, 21, 18, 19, 20, 21, 22, 23, 24, 25, 22, 23, 24, 25}}},
+	})
+
+	runErrorTests(t, map[string] string{
+		"view v { var x [i, j] = a[i] }": "index 'j' isn't used on the right side, give the number of its values n with 'where j < n'",
+		"view v { var x [i, j] = a[i] where j > 2 }": "where j < n",
+		"view v default { var x [i, j] = a[i] where j < 2 }": "default view 'v' can't have indices that aren't used on the right side",
+	})
+
+	// the copies can't be written, the tools don't write readonly views
+	checkReadonly(t, "view v { var x [i, j] = a[i] where j < 2 }")
+}
+
+// checks that the view v declared in decl is readonly
+func checkReadonly(t *testing.T, decl string) {
+	views, errs := createViews(t, decl)
+	if errs != "" {
+		t.Fatalf("%s: %s", decl, errs)
+	}
+
+	for _, v := range views {
+		if v.Name == "v" && !v.IsReadonly() {
+			t.Errorf("%s: view isn't readonly", decl)
+		}
+	}
+}
+
+// the elements selected by value predicates change with the values when
+// the view is selected again
+func TestValuePredicates(t *testing.T) {
+	views, errs := createViews(t, "view v { var x [i] = a[i] where a[i] % 3 == 0 }")
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	var dv, v *drepl.View
+	for _, vv := range views {
+		switch vv.Name {
+		case "dv":
+			dv = vv
+		case "v":
+			v = vv
+		}
+	}
+
+	if !v.Filtered() || !v.IsReadonly() {
+		t.Fatalf("view isn't filtered and readonly")
+	}
+
+	// nothing is selected before Select
+	if v.Size() != 0 {
+		t.Errorf("size %d before Select", v.Size())
+	}
+
+	if err := writeValues(dv); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(want []int32) {
+		t.Helper()
+		if err := v.Select(); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := readValues(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, expecting %v", got, want)
+		}
+	}
+
+	check([]int32{0, 3, 6, 9})
+	check([]int32{0, 3, 6, 9})
+
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, 12)
+	b := dv.Search(4, 4)[0]
+	if _, err := b.Write(data, 4, b.Offset(), true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	check([]int32{0, 12, 3, 6, 9})
+}
+
+func TestSlices(t *testing.T) {
+	runViewTests(t, []viewTest{
+		{"view v { var x [i] = a[2:5] }", map[string] []int32{"v": {2, 3, 4}}},
+		{"view v { var x [i] = a[:3] }", map[string] []int32{"v": {0, 1, 2}}},
+		{"view v { var x [i] = a[7:] }", map[string] []int32{"v": {7, 8, 9}}},
+		{"view v { var x [i] = a[::3] }", map[string] []int32{"v": {0, 3, 6, 9}}},
+		{"view v { var x [i] = a[1:N-2:2] }", map[string] []int32{"v": {1, 3, 5, 7}}},
+		{"view v { var x [i] = a[5:5] }", map[string] []int32{"v": {}}},
+		{"view v { var x [i] = m[::2, 1] }", map[string] []int32{"v": {11, 19}}},
+
+		// negative steps go backwards
+		{"view v { var x [i] = a[::-1] }", map[string] []int32{"v": {9, 8, 7, 6, 5, 4, 3, 2, 1, 0}}},
+		{"view v { var x [i] = a[8:2:-2] }", map[string] []int32{"v": {8, 6, 4}}},
+		{"view v { var x [i] = a[3::-1] }", map[string] []int32{"v": {3, 2, 1, 0}}},
+		{"view v { var x [i] = a[:6:-1] }", map[string] []int32{"v": {9, 8, 7}}},
+		{"view v { var x [i, j] = m[1:3, ::-1] }", map[string] []int32{"v": {17, 16, 15, 14, 21, 20, 19, 18}}},
+	})
+
+	runErrorTests(t, map[string] string{
+		"view v { var x [i] = a[::0] }": "slice step can't be 0",
+		"view v { var x [i] = a[2:11] }": "slice 2:11 is outside the dimension of size 10",
+		"view v { var x [i] = a[5:2] }": "slice 5:2 is outside the dimension of size 10",
+		"view v { var x [i] = a[-1:] }": "slice -1:10 is outside the dimension of size 10",
+		"view v { var x [i] = a[10::-1] }": "slice 10:-1:-1 is outside the dimension of size 10",
+		"view v { var x [i] = a[2:5:-1] }": "slice 2:5:-1 is outside the dimension of size 10",
+		"view v { var x [i] = a[i:5] }": "slice bounds can only use constants, 'i' is not one",
+		"view v { var x [i] = m[i, 0:2] }": "slice needs an index on the left side that isn't used on the right side",
+	})
+
+	// written backwards
+	views, errs := createViews(t, "view v { var x [i] = a[::-1] }")
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	if err := writeValues(views[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readValues(views[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int32{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}; !reflect.DeepEqual(got[0:10], want) {
+		t.Errorf("got %v, expecting %v", got[0:10], want)
+	}
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	runViewTests(t, []viewTest{
+		// without where, a single period
+		{"view v { var x [i] = a[(i - 1) % N] }", map[string] []int32{"v": {9, 0, 1, 2, 3, 4, 5, 6, 7, 8}}},
+		{"view v { var x [i] = a[(i - 3) % N] where i >= 0 && i < 4 }", map[string] []int32{"v": {7, 8, 9, 0}}},
+		{"view v { var x [i] = a[(i + 8) % N] where i >= 0 && i < 5 }", map[string] []int32{"v": {8, 9, 0, 1, 2}}},
+		{"view v { var x [i] = a[(2*i - 1) % N] }", map[string] []int32{"v": {9, 1, 3, 5, 7}}},
+
+		// moduli that don't divide the dimension
+		{"view v { var x [i] = a[i % 3] }", map[string] []int32{"v": {0, 1, 2}}},
+		{"view v { var x [i] = a[(i - 1) % 4] where i >= 0 && i < 6 }", map[string] []int32{"v": {3, 0, 1, 2, 3, 0}}},
+		{"view v { var x [i] = a[(3*i) % 4] }", map[string] []int32{"v": {0, 3, 2, 1}}},
+
+		// halos, up to a period on each side
+		{"view v { var x [i] = a[i % N] where i >= -1 && i <= N }", map[string] []int32{"v": {9, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0}}},
+		{"view v { var x [i] = a[i % N] where i >= -20 && i < 1 }", map[string] []int32{"v": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0}}},
+		{"view v { var x [i, j] = m[i % M, j % M] where i >= -1 && i <= M && j >= 0 && j < M }",
+			map[string] []int32{"v": {22, 23, 24, 25, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 10, 11, 12, 13}}},
+		{"view p(r of R) { var x [i] = a[(2*r + i) % N] where i >= -1 && i <= 2 }",
+			map[string] []int32{"p.0": {9, 0, 1, 2}, "p.1": {1, 2, 3, 4}, "p.2": {3, 4, 5, 6}, "p.3": {5, 6, 7, 8}}},
+	})
+
+	runErrorTests(t, map[string] string{
+		"view v { var x [i] = a[(i - 1) % 0] }": "the modulus of a wrapped index has to be a positive integer, got: 0",
+		"view v { var x [i] = a[(i - 1) % -3] }": "the modulus of a wrapped index has to be a positive integer, got: -3",
+		"view v { var x [i] = a[i % 12] }": "the modulus of a wrapped index can't be larger than the dimension 10, got: 12",
+		"view v { var x [i] = a[(N / (i + 1)) % N] }": "a wrapped index can't be divided by an index",
+	})
+}
+
+// the halo cells of a materialized view are copies of the same elements
+func TestWrapHalo(t *testing.T) {
+	views, errs := createViews(t, "view v { var x [i] = a[i % N] where i >= -1 && i <= N }\n" + `replica r2 "r2" { view v }`)
+	if errs != "" {
+		t.Fatal(errs)
+	}
+
+	dv, v := views[0], views[1]
+	if err := writeValues(dv); err != nil {
+		t.Fatal(err)
+	}
+
+	checkValues(t, v, []int32{9, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0})
+
+	// both copies of a[0] change
+	writeElem(t, dv, 0, 0, 100)
+	checkValues(t, v, []int32{9, 100, 1, 2, 3, 4, 5, 6, 7, 8, 9, 100})
+
+	// written through the halo, a[9] changes, and its other copy
+	writeElem(t, v, 0, 0, 90)
+	checkValues(t, v, []int32{90, 100, 1, 2, 3, 4, 5, 6, 7, 8, 90, 100})
+	checkValues(t, dv, []int32{100, 1, 2, 3, 4, 5, 6, 7, 8, 90, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25})
+}